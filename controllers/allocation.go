@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	gin "github.com/gin-gonic/gin"
+	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	form "gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+)
+
+// AllocationController struct
+type AllocationController struct {
+	BaseController
+}
+
+// Init Controller
+func (co AllocationController) Init(router *gin.RouterGroup) {
+	router.GET("/rulesets", co.RuleSets)       // Rule set versions
+	router.GET("/rulesets/:id", co.RuleSet)    // Rule set with rules and splits
+	router.POST("/rulesets", co.CreateRuleSet) // New version
+	router.POST("/preview", co.Preview)        // Dry run
+	router.POST("/run", co.Run)                // Allocate and store statements
+	router.GET("/statements", co.Statements)   // Monthly statements
+}
+
+// costExplorer client when the source needs it
+func (co AllocationController) costExplorer(c *gin.Context, params form.AllocationRunParams) (costexploreriface.CostExplorerAPI, bool) {
+	if params.Source != services.AllocationSourceCostExplorer {
+		return nil, true
+	}
+	sess, sessError := co.DefaultSvc(co.GetAuth(c).Base.ID)
+	if sessError != nil {
+		co.SetError(http.StatusInternalServerError, sessError.Error())
+		return nil, false
+	}
+	return costexplorer.New(sess), true
+}
+
+// RuleSets list rule set versions
+// @Summary List allocation rule sets
+// @Description Rule set versions of the company, latest first
+// @Tags Allocation
+// @Accept json
+// @Produce json
+// @Success 200 {object} structs.ResponseBody{body=[]databases.AllocationRuleSet}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /allocations/rulesets [get]
+func (co AllocationController) RuleSets(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var ruleSets []databases.AllocationRuleSet
+	result := co.DB.Scopes(CompanyScope(co.GetAuth(c))).Order("version desc").Find(&ruleSets)
+	if result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+
+	co.SetBody(ruleSets)
+	return
+}
+
+// RuleSet show rule set
+// @Summary Allocation rule set
+// @Description Rule set version with its rules and shared cost splits
+// @Tags Allocation
+// @Accept json
+// @Produce json
+// @Param id path uint true "rule set ID"
+// @Success 200 {object} structs.ResponseBody{body=databases.AllocationRuleSet}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /allocations/rulesets/{id} [get]
+func (co AllocationController) RuleSet(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		co.SetError(http.StatusBadRequest, "id must be a number")
+		return
+	}
+
+	ruleSet, err := services.GetAllocationRuleSet(co.DB, co.GetAuth(c), uint(id))
+	if err != nil {
+		co.SetError(http.StatusNotFound, "Олдсонгүй")
+		return
+	}
+
+	co.SetBody(ruleSet)
+	return
+}
+
+// CreateRuleSet new rule set version
+// @Summary Create allocation rule set
+// @Description Stores rules as the next version, effective from the given month
+// @Tags Allocation
+// @Accept json
+// @Produce json
+// @Param ruleset body form.AllocationRuleSetParams true "rule set"
+// @Success 200 {object} structs.ResponseBody{body=databases.AllocationRuleSet}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /allocations/rulesets [post]
+func (co AllocationController) CreateRuleSet(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.AllocationRuleSetParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ruleSet, err := services.CreateAllocationRuleSet(co.DB, co.GetAuth(c), params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "allocation_rule_set.create", ruleSet.ID, nil, ruleSet)
+
+	co.SetBody(ruleSet)
+	return
+}
+
+// Preview allocation
+// @Summary Preview allocation
+// @Description Dry run of the month by unsaved rules, a rule set version or the version effective in the month
+// @Tags Allocation
+// @Accept json
+// @Produce json
+// @Param run body form.AllocationRunParams true "run"
+// @Success 200 {object} structs.ResponseBody{body=services.AllocationResult}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /allocations/preview [post]
+func (co AllocationController) Preview(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.AllocationRunParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	svc, ok := co.costExplorer(c, params)
+	if !ok {
+		return
+	}
+
+	result, err := services.PreviewAllocation(co.DB, svc, co.GetAuth(c), params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(result)
+	return
+}
+
+// Run allocation
+// @Summary Run allocation
+// @Description Allocates the month by a stored rule set and replaces its cost center statements
+// @Tags Allocation
+// @Accept json
+// @Produce json
+// @Param run body form.AllocationRunParams true "run"
+// @Success 200 {object} structs.ResponseBody{body=[]databases.AllocationStatement}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /allocations/run [post]
+func (co AllocationController) Run(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.AllocationRunParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	svc, ok := co.costExplorer(c, params)
+	if !ok {
+		return
+	}
+
+	statements, err := services.RunAllocation(co.DB, svc, co.GetAuth(c), params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "allocation.run", 0, nil, params)
+
+	co.SetBody(statements)
+	return
+}
+
+// Statements of the month
+// @Summary Allocation statements
+// @Description Stored per cost center statements of the month
+// @Tags Allocation
+// @Accept json
+// @Produce json
+// @Param month query string true "YYYY-MM"
+// @Success 200 {object} structs.ResponseBody{body=[]databases.AllocationStatement}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /allocations/statements [get]
+func (co AllocationController) Statements(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	month := c.Query("month")
+	if month == "" {
+		co.SetError(http.StatusBadRequest, "month is required")
+		return
+	}
+
+	var statements []databases.AllocationStatement
+	result := co.DB.Scopes(CompanyScope(co.GetAuth(c))).Where("month = ?", month).Order("total desc").Find(&statements)
+	if result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+
+	co.SetBody(statements)
+	return
+}
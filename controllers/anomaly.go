@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	gin "github.com/gin-gonic/gin"
+	viper "github.com/spf13/viper"
+	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	form "gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/notifications"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+)
+
+// AnomalyController struct
+type AnomalyController struct {
+	BaseController
+}
+
+// ListCostAnomalies ...
+type ListCostAnomalies struct {
+	Total int64                   `json:"total"`
+	List  []databases.CostAnomaly `json:"list"`
+}
+
+// Init Controller
+func (co AnomalyController) Init(router *gin.RouterGroup) {
+	router.POST("/detect", co.Detect)              // Detect
+	router.POST("/list", co.List)                  // List
+	router.PUT("/acknowledge/:id", co.Acknowledge) // Acknowledge
+	router.PUT("/dismiss/:id", co.Dismiss)         // Dismiss
+}
+
+// Detect anomalies
+// @Summary Detect cost anomalies
+// @Description Refresh daily cost snapshot and detect anomalies of the last days
+// @Tags Anomaly
+// @Accept json
+// @Produce json
+// @Param detect body form.AnomalyDetectParams true "detect"
+// @Success 200 {object} structs.ResponseBody{body=[]databases.CostAnomaly}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /anomalies/detect [post]
+func (co AnomalyController) Detect(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.AnomalyDetectParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+	authUser := co.GetAuth(c)
+
+	var svc costexploreriface.CostExplorerAPI
+	if params.Source != services.SourceCUR {
+		sess, sessError := co.DefaultSvc(authUser.Base.ID)
+		if sessError != nil {
+			co.SetError(http.StatusInternalServerError, sessError.Error())
+			return
+		}
+		svc = costexplorer.New(sess)
+	}
+
+	anomalies, err := services.RunAnomalyDetection(co.DB, svc, authUser, params.Source, services.AnomalyConfig{
+		Window:      params.Window,
+		Sensitivity: params.Sensitivity,
+		MinImpact:   params.MinImpact,
+	}, params.Days, notifications.SplitChannels(viper.GetString("anomaly.channels")))
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "anomaly.detect", 0, nil, params)
+
+	co.SetBody(anomalies)
+	return
+}
+
+// List anomalies
+// @Summary List cost anomalies
+// @Description Get cost anomalies
+// @Tags Anomaly
+// @Accept json
+// @Produce json
+// @Param filter body form.AnomalyFilter true "filter"
+// @Success 200 {object} structs.ResponseBody{body=ListCostAnomalies}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /anomalies/list [post]
+func (co AnomalyController) List(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.AnomalyFilter
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := CheckSort(params.Sort, "created_date", "date", "service", "expected", "actual", "impact", "score", "status"); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	db := co.DB.Model(&databases.CostAnomaly{}).Scopes(CompanyScope(co.GetAuth(c)))
+	db = db.Scopes(TableSearch(reflect.ValueOf(params.Filter), params.Sort))
+
+	var count int64
+	db.Count(&count)
+
+	var anomalies []databases.CostAnomaly
+	result := db.Scopes(Paginate(params.Page, params.Size)).Find(&anomalies)
+	if result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+
+	co.SetBody(ListCostAnomalies{Total: count, List: anomalies})
+	return
+}
+
+// Acknowledge anomaly
+// @Summary Acknowledge cost anomaly
+// @Description Mark anomaly as acknowledged
+// @Tags Anomaly
+// @Accept json
+// @Produce json
+// @Param id path uint true "anomaly ID"
+// @Param status body form.AnomalyStatusParams true "status"
+// @Success 200 {object} structs.ResponseBody{body=databases.CostAnomaly}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /anomalies/acknowledge/{id} [put]
+func (co AnomalyController) Acknowledge(c *gin.Context) {
+	co.setStatus(c, databases.AnomalyAcknowledged)
+}
+
+// Dismiss anomaly
+// @Summary Dismiss cost anomaly
+// @Description Mark anomaly as dismissed
+// @Tags Anomaly
+// @Accept json
+// @Produce json
+// @Param id path uint true "anomaly ID"
+// @Param status body form.AnomalyStatusParams true "status"
+// @Success 200 {object} structs.ResponseBody{body=databases.CostAnomaly}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /anomalies/dismiss/{id} [put]
+func (co AnomalyController) Dismiss(c *gin.Context) {
+	co.setStatus(c, databases.AnomalyDismissed)
+}
+
+func (co AnomalyController) setStatus(c *gin.Context, status string) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.AnomalyStatusParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+	authUser := co.GetAuth(c)
+
+	var anomaly databases.CostAnomaly
+	result := co.DB.Scopes(CompanyScope(authUser)).First(&anomaly, c.Param("id"))
+	if result.Error != nil {
+		co.SetError(http.StatusNotFound, "Олдсонгүй")
+		return
+	}
+
+	before := services.AuditSnapshot(anomaly)
+	now := time.Now()
+	anomaly.Status = status
+	anomaly.StatusUserID = authUser.Base.ID
+	anomaly.StatusDate = &now
+	anomaly.Note = params.Note
+	anomaly.Base.ModifiedDate = now
+
+	result = co.DB.Save(&anomaly)
+	if result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+
+	co.Audit(c, "anomaly."+status, anomaly.ID, before, anomaly)
+
+	co.SetBody(anomaly)
+	return
+}
@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	gin "github.com/gin-gonic/gin"
+	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	form "gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+	structs "gitlab.com/fibocloud/aws-billing/api_v2/structs"
+	gorm "gorm.io/gorm"
+)
+
+// APIKeyController struct
+type APIKeyController struct {
+	BaseController
+}
+
+// APIKeySecret API key with the key itself, returned on create only
+type APIKeySecret struct {
+	databases.APIKey
+	Key string `json:"key"`
+}
+
+// Init Controller
+func (co APIKeyController) Init(router *gin.RouterGroup) {
+	router.GET("/list", co.List)     // List
+	router.GET("get/:id", co.Get)    // Show
+	router.POST("", co.Create)       // Create
+	router.PUT("/:id", co.Update)    // Update
+	router.DELETE("/:id", co.Delete) // Revoke
+}
+
+// visible own keys, and company keys for company admins
+func (co APIKeyController) visible(c *gin.Context) *gorm.DB {
+	authUser := co.GetAuth(c)
+	if authUser.CompanyID != 0 && services.IsAdmin(authUser) {
+		return co.DB.Where("user_id = ? OR (company_id = ? AND is_company = ?)", authUser.Base.ID, authUser.CompanyID, true)
+	}
+	return co.DB.Where("user_id = ?", authUser.Base.ID)
+}
+
+// find API key visible to auth user
+func (co APIKeyController) find(c *gin.Context, key *databases.APIKey) bool {
+	result := co.visible(c).First(key, c.Param("id"))
+	if result.Error != nil {
+		co.SetError(http.StatusNotFound, "API түлхүүр олдсонгүй")
+		return false
+	}
+	return true
+}
+
+// companyKey only company admins manage company keys
+func (co APIKeyController) companyKey(c *gin.Context, isCompany bool) bool {
+	authUser := co.GetAuth(c)
+	if isCompany && (authUser.CompanyID == 0 || !services.IsAdmin(authUser)) {
+		co.SetError(http.StatusForbidden, "Хандах эрхгүй")
+		return false
+	}
+	return true
+}
+
+// List API keys
+// @Summary List API keys
+// @Description Own API keys and company keys for company admins, revoked keys included
+// @Tags APIKey
+// @Accept json
+// @Produce json
+// @Success 200 {object} structs.ResponseBody{body=[]databases.APIKey}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /apikeys/list [get]
+func (co APIKeyController) List(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var keys []databases.APIKey
+	co.visible(c).Order("created_date desc").Find(&keys)
+
+	co.SetBody(keys)
+	return
+}
+
+// Get API key
+// @Summary Get API key
+// @Description Show API key with last use, the key itself is not returned
+// @Tags APIKey
+// @Accept json
+// @Produce json
+// @Param id path uint true "API key ID"
+// @Success 200 {object} structs.ResponseBody{body=databases.APIKey}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /apikeys/get/{id} [get]
+func (co APIKeyController) Get(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var key databases.APIKey
+	if !co.find(c, &key) {
+		return
+	}
+
+	co.SetBody(key)
+	return
+}
+
+// Create API key
+// @Summary Create API key
+// @Description Key is returned only once, send it in X-API-Key header. Requests act as the creating user.
+// @Tags APIKey
+// @Accept json
+// @Produce json
+// @Param key body form.APIKeyParams true "API key"
+// @Success 200 {object} structs.ResponseBody{body=APIKeySecret}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /apikeys [post]
+func (co APIKeyController) Create(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.APIKeyParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !co.companyKey(c, params.IsCompany) {
+		return
+	}
+
+	authUser := co.GetAuth(c)
+	key := databases.APIKey{
+		CompanyID: authUser.CompanyID,
+		UserID:    authUser.Base.ID,
+		Base: databases.Base{
+			CreatedDate: time.Now(),
+		},
+	}
+	if err := services.APIKeyFromParams(&key, params); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	raw, prefix, err := services.NewAPIKey()
+	if err != nil {
+		co.SetError(http.StatusInternalServerError, err.Error())
+		return
+	}
+	key.Prefix = prefix
+	key.KeyHash = services.HashAPIKey(raw)
+
+	if result := co.DB.Create(&key); result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+	co.Audit(c, "api_key.create", key.ID, nil, key)
+
+	co.SetBody(APIKeySecret{APIKey: key, Key: raw})
+	return
+}
+
+// Update API key
+// @Summary Update API key
+// @Description Edit name, scope, expiry and IP allowlist, company keys stay company keys
+// @Tags APIKey
+// @Accept json
+// @Produce json
+// @Param id path uint true "API key ID"
+// @Param key body form.APIKeyParams true "API key"
+// @Success 200 {object} structs.ResponseBody{body=databases.APIKey}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /apikeys/{id} [put]
+func (co APIKeyController) Update(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.APIKeyParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var key databases.APIKey
+	if !co.find(c, &key) {
+		return
+	}
+	if !co.companyKey(c, key.IsCompany) {
+		return
+	}
+	if key.RevokedDate != nil {
+		co.SetError(http.StatusBadRequest, "API key is revoked")
+		return
+	}
+	before := services.AuditSnapshot(key)
+
+	params.IsCompany = key.IsCompany
+	if err := services.APIKeyFromParams(&key, params); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	key.Base.ModifiedDate = time.Now()
+	if result := co.DB.Save(&key); result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+	co.Audit(c, "api_key.update", key.ID, before, key)
+
+	co.SetBody(key)
+	return
+}
+
+// Delete API key
+// @Summary Revoke API key
+// @Description Key stops working immediately, it is kept for the audit log
+// @Tags APIKey
+// @Accept json
+// @Produce json
+// @Param id path uint true "API key ID"
+// @Success 200 {object} structs.ResponseBody{body=structs.SuccessResponse}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /apikeys/{id} [delete]
+func (co APIKeyController) Delete(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var key databases.APIKey
+	if !co.find(c, &key) {
+		return
+	}
+	if !co.companyKey(c, key.IsCompany) {
+		return
+	}
+
+	if key.RevokedDate == nil {
+		before := services.AuditSnapshot(key)
+		now := time.Now()
+		key.RevokedDate = &now
+		key.Base.ModifiedDate = now
+		if result := co.DB.Save(&key); result.Error != nil {
+			co.SetError(http.StatusInternalServerError, result.Error.Error())
+			return
+		}
+		co.Audit(c, "api_key.revoke", key.ID, before, key)
+	}
+
+	co.SetBody(structs.SuccessResponse{
+		Success: true,
+	})
+	return
+}
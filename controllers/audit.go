@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"net/http"
+	"reflect"
+
+	gin "github.com/gin-gonic/gin"
+	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	form "gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+)
+
+// AuditController struct
+type AuditController struct {
+	BaseController
+}
+
+// ListAuditLogs ...
+type ListAuditLogs struct {
+	Total int64                `json:"total"`
+	List  []databases.AuditLog `json:"list"`
+}
+
+// Init Controller
+func (co AuditController) Init(router *gin.RouterGroup) {
+	router.POST("/list", co.List) // List
+}
+
+// List audit log
+// @Summary List audit log
+// @Description Actions of company users with changes, company admins only. Users without company see their own actions.
+// @Tags Audit
+// @Accept json
+// @Produce json
+// @Param filter body form.AuditFilter true "filter"
+// @Success 200 {object} structs.ResponseBody{body=ListAuditLogs}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /audit/list [post]
+func (co AuditController) List(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.AuditFilter
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	authUser := co.GetAuth(c)
+	// users without company read their own actions below
+	if authUser.CompanyID != 0 && !services.IsAdmin(authUser) {
+		co.SetError(http.StatusForbidden, "Хандах эрхгүй")
+		return
+	}
+
+	if err := CheckSort(params.Sort, "created_date", "actor_id", "actor_email", "action", "target", "target_id", "ip"); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	db := co.DB.Model(&databases.AuditLog{})
+	if authUser.CompanyID != 0 {
+		db = db.Where("company_id = ?", authUser.CompanyID)
+	} else {
+		db = db.Where("actor_id = ?", authUser.Base.ID)
+	}
+	if params.EndDate != "" {
+		if _, err := utils.ParseDate(params.EndDate); err != nil {
+			co.SetServiceError(services.NewParamError("end_date", "must be YYYY-MM-DD"))
+			return
+		}
+		db = db.Where("created_date < ?", params.EndDate)
+	}
+	db = db.Scopes(TableSearch(reflect.ValueOf(params.Filter), params.Sort))
+
+	var count int64
+	db.Count(&count)
+
+	var logs []databases.AuditLog
+	result := db.Scopes(Paginate(params.Page, params.Size)).Find(&logs)
+	if result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+
+	co.SetBody(ListAuditLogs{Total: count, List: logs})
+	return
+}
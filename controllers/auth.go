@@ -4,13 +4,19 @@ package controllers
 import (
 	"fmt"
 	"io/ioutil"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	gin "github.com/gin-gonic/gin"
+	viper "github.com/spf13/viper"
 	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
 	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/notifications"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
 	"gitlab.com/fibocloud/aws-billing/api_v2/structs"
 	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
 )
@@ -22,10 +28,12 @@ type AuthController struct {
 
 // Init Controller
 func (co AuthController) Init(router *gin.RouterGroup) {
-	router.GET("/admin", co.Admin)         //Admin
-	router.POST("/login", co.Login)        //Login
-	router.POST("/register", co.Register)  //Register
-	router.GET("/confirm/:id", co.Confirm) //Confirm
+	router.GET("/admin", co.Admin)               //Admin
+	router.POST("/login", co.Login)              //Login
+	router.POST("/register", co.Register)        //Register
+	router.GET("/confirm/:id", co.Confirm)       //Confirm
+	router.POST("/sso/start", co.SSOStart)       // OpenID Connect redirect
+	router.POST("/sso/callback", co.SSOCallback) // OpenID Connect login
 }
 
 // LoginParams create body params
@@ -49,6 +57,7 @@ type LoginResult struct {
 // @Param auth body LoginParams true "Auth"
 // @Success 200 {object} structs.ResponseBody{body=LoginResult}
 // @Failure 400 {object} structs.ErrorResponse
+// @Failure 429 {object} structs.ErrorResponse
 // @Failure 500 {object} structs.ErrorResponse
 // @Router /auth/login [post]
 func (co AuthController) Login(c *gin.Context) {
@@ -62,28 +71,174 @@ func (co AuthController) Login(c *gin.Context) {
 		return
 	}
 
+	attempt, err := services.CheckLogin(co.DB, params.Email, c.ClientIP())
+	if err != nil {
+		co.loginBlocked(c, err)
+		return
+	}
+
 	var user databases.SystemUser
 	result := co.DB.Preload("AwsCredentials", "is_active = ?", true).Where("email = ?", params.Email).First(&user)
 
+	// unknown email and wrong password look the same and both count, so
+	// guessing does not reveal accounts
 	if result.Error != nil {
-		if result.Error.Error() == "record not found" {
-			co.SetError(http.StatusNotFound, "Хэрэглэгч олдсонгүй")
+		if result.Error.Error() != "record not found" {
+			co.SetError(http.StatusInternalServerError, result.Error.Error())
+			return
 		}
+		co.loginFailed(c, attempt, nil)
+		co.SetError(http.StatusNotFound, "Нэвтрэх нэр эсвэл нууц үг буруу байна")
 		return
 	}
 
+	if valid, _ := utils.ComparePassword(user.Password, params.Password); !valid {
+		co.loginFailed(c, attempt, &user)
+		co.SetError(http.StatusNotFound, "Нэвтрэх нэр эсвэл нууц үг буруу байна")
+		return
+	}
+
+	// inactive accounts are told only to whoever knows the password
 	if !user.IsActive {
 		co.SetError(http.StatusNotFound, "Хэрэглэгчийн эрх баталгаажаагүй байна")
 		return
 	}
 
-	if valid, err := utils.ComparePassword(user.Password, params.Password); !valid {
-		if err != nil {
-			co.SetError(http.StatusNotFound, "Нэвтрэх нэр эсвэл нууц үг буруу байна")
+	if err := services.LoginSucceeded(co.DB, attempt); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	accessToken, refreshToken := utils.GenerateToken(user)
+	co.SetBody(LoginResult{Token: accessToken, Refresh: refreshToken})
+	return
+}
+
+// loginBlocked too many requests with time to retry
+func (co AuthController) loginBlocked(c *gin.Context, err error) {
+	blocked, ok := err.(*services.LoginBlockedError)
+	if !ok {
+		co.SetServiceError(err)
+		return
+	}
+	wait := int(math.Ceil(time.Until(blocked.Until).Seconds()))
+	c.Header("Retry-After", strconv.Itoa(wait))
+	if blocked.Locked {
+		co.SetError(http.StatusTooManyRequests, fmt.Sprintf("Хэрэглэгчийн эрх түр түгжигдсэн байна, %v секундын дараа дахин оролдоно уу", wait))
+		return
+	}
+	co.SetError(http.StatusTooManyRequests, fmt.Sprintf("Хэт олон буруу оролдлого, %v секундын дараа дахин оролдоно уу", wait))
+}
+
+// loginFailed user is notified when the failed attempt locked the account,
+// the attempt was counted by CheckLogin
+func (co AuthController) loginFailed(c *gin.Context, attempt *services.LoginAttempt, user *databases.SystemUser) {
+	if !attempt.Locked || user == nil {
+		return
+	}
+
+	co.AuditAs(c, *user, "user.lock", user.Base.ID, nil, nil)
+	notification := notifications.Notification{
+		Event:      services.EventAccountLocked,
+		CompanyID:  user.CompanyID,
+		UserID:     user.Base.ID,
+		Subject:    "Your account has been locked",
+		Message:    fmt.Sprintf("Too many failed logins from %v, login is locked for %v. Ask your company admin to unlock it if this was not you.", c.ClientIP(), viper.GetString("login.lockout")),
+		Data:       map[string]string{"email": user.Email, "ip": c.ClientIP()},
+		Recipients: []string{user.Email},
+	}
+	go func() {
+		if err := notifications.Send([]string{"email"}, notification); err != nil {
+			log.Printf("[login] lock notification %v: %v", notification.UserID, err)
 		}
-		// co.SetError(http.StatusUnauthorized, err.Error())
+	}()
+}
+
+// SSOStartResult ...
+type SSOStartResult struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// SSOStart login
+// @Summary Start single sign-on
+// @Description Authorization URL of the company's identity provider, found by company_id or email domain. Redirect the browser to it.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param sso body form.SSOStartParams true "SSO"
+// @Success 200 {object} structs.ResponseBody{body=SSOStartResult}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /auth/sso/start [post]
+func (co AuthController) SSOStart(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.SSOStartParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	provider, err := services.FindSSOProvider(co.DB, params)
+	if err == services.ErrSSONotConfigured {
+		co.SetError(http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	authorizationURL, err := services.StartSSO(co.DB, *provider, params, 0)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(SSOStartResult{AuthorizationURL: authorizationURL})
+	return
+}
+
+// SSOCallback login
+// @Summary Finish single sign-on
+// @Description Exchanges code and state from the identity provider redirect for the same tokens as login. Existing accounts have to link single sign-on first, locked out accounts stay locked.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param sso body form.SSOCallbackParams true "SSO"
+// @Success 200 {object} structs.ResponseBody{body=LoginResult}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 429 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /auth/sso/callback [post]
+func (co AuthController) SSOCallback(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.SSOCallbackParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sso, err := services.FinishSSO(co.DB, params, 0)
+	if _, ok := err.(*services.LoginBlockedError); ok {
+		co.loginBlocked(c, err)
+		return
+	}
+	if err != nil {
+		co.SetError(http.StatusUnauthorized, err.Error())
 		return
 	}
+	if sso.Provisioned {
+		co.AuditAs(c, sso.User, "user.sso_provision", sso.User.ID, nil, sso.User)
+	}
+
+	var user databases.SystemUser
+	co.DB.Preload("AwsCredentials", "is_active = ?", true).First(&user, sso.User.ID)
 
 	accessToken, refreshToken := utils.GenerateToken(user)
 	co.SetBody(LoginResult{Token: accessToken, Refresh: refreshToken})
@@ -144,6 +299,10 @@ func (co AuthController) Confirm(c *gin.Context) {
 	})
 
 	tx.Commit()
+
+	var user databases.SystemUser
+	co.DB.Limit(1).Find(&user, confirm.UserID)
+	co.AuditAs(c, user, "user.confirm", confirm.UserID, map[string]interface{}{"is_active": false}, map[string]interface{}{"is_active": true})
 	return
 }
 
@@ -181,6 +340,7 @@ func (co AuthController) Register(c *gin.Context) {
 		IsActive: params.IsActive,
 		Email:    params.Email,
 		Password: hashPwd,
+		Role:     databases.RoleMember,
 		Base: databases.Base{
 			CreatedDate: time.Now(),
 		},
@@ -261,6 +421,7 @@ func (co AuthController) Register(c *gin.Context) {
 	})
 
 	tx.Commit()
+	co.AuditAs(c, systemUser, "user.register", systemUser.ID, nil, systemUser)
 	return
 }
 
@@ -289,6 +450,7 @@ func (co AuthController) Admin(c *gin.Context) {
 		IsActive: true,
 		Email:    "admin",
 		Password: hashPwd,
+		Role:     databases.RoleAdmin,
 		Base: databases.Base{
 			CreatedDate: time.Now(),
 		},
@@ -299,6 +461,7 @@ func (co AuthController) Admin(c *gin.Context) {
 		co.SetError(http.StatusInternalServerError, resultSystemUser.Error.Error())
 		return
 	}
+	co.AuditAs(c, user, "user.create", user.ID, nil, user)
 
 	co.SetBody(user)
 
@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	gin "github.com/gin-gonic/gin"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+)
+
+// AwsAnomalyController struct
+type AwsAnomalyController struct {
+	BaseController
+}
+
+// Init Controller
+func (co AwsAnomalyController) Init(router *gin.RouterGroup) {
+	router.POST("/list", co.List)                        // Anomalies
+	router.GET("/monitors", co.Monitors)                 // Monitors
+	router.POST("/monitors", co.CreateMonitor)           // Create monitor
+	router.PUT("/monitors", co.UpdateMonitor)            // Update monitor
+	router.GET("/subscriptions", co.Subscriptions)       // Subscriptions
+	router.POST("/subscriptions", co.CreateSubscription) // Create subscription
+	router.PUT("/subscriptions", co.UpdateSubscription)  // Update subscription
+	router.POST("/feedback", co.Feedback)                // Feedback
+}
+
+// costExplorer client of the auth user
+func (co AwsAnomalyController) costExplorer(c *gin.Context) (*costexplorer.CostExplorer, bool) {
+	sess, sessError := co.DefaultSvc(co.GetAuth(c).Base.ID)
+	if sessError != nil {
+		co.SetError(http.StatusInternalServerError, sessError.Error())
+		return nil, false
+	}
+	return costexplorer.New(sess), true
+}
+
+// List anomalies
+// @Summary List AWS anomalies
+// @Description Anomalies detected by AWS Cost Anomaly Detection monitors
+// @Tags AwsAnomaly
+// @Accept json
+// @Produce json
+// @Param anomalies body form.AwsAnomaliesParams true "anomalies"
+// @Success 200 {object} structs.ResponseBody{body=[]services.AwsAnomaly}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /awsanomalies/list [post]
+func (co AwsAnomalyController) List(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.AwsAnomaliesParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+	svc, ok := co.costExplorer(c)
+	if !ok {
+		return
+	}
+
+	anomalies, err := services.GetAwsAnomalies(svc, params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(anomalies)
+	return
+}
+
+// Monitors list
+// @Summary List AWS anomaly monitors
+// @Description Anomaly monitors of the account
+// @Tags AwsAnomaly
+// @Accept json
+// @Produce json
+// @Success 200 {object} structs.ResponseBody{body=[]services.AwsAnomalyMonitor}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /awsanomalies/monitors [get]
+func (co AwsAnomalyController) Monitors(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	svc, ok := co.costExplorer(c)
+	if !ok {
+		return
+	}
+
+	monitors, err := services.GetAwsAnomalyMonitors(svc, nil)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(monitors)
+	return
+}
+
+// CreateMonitor ...
+// @Summary Create AWS anomaly monitor
+// @Description DIMENSIONAL monitors every service, CUSTOM monitors linked accounts or a tag
+// @Tags AwsAnomaly
+// @Accept json
+// @Produce json
+// @Param monitor body form.AwsAnomalyMonitorParams true "monitor"
+// @Success 200 {object} structs.ResponseBody{body=services.AwsAnomalyMonitor}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /awsanomalies/monitors [post]
+func (co AwsAnomalyController) CreateMonitor(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.AwsAnomalyMonitorParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+	svc, ok := co.costExplorer(c)
+	if !ok {
+		return
+	}
+
+	monitor, err := services.CreateAwsAnomalyMonitor(svc, params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "aws_anomaly_monitor.create", 0, nil, params)
+
+	co.SetBody(monitor)
+	return
+}
+
+// UpdateMonitor ...
+// @Summary Update AWS anomaly monitor
+// @Description Rename monitor by monitor_arn
+// @Tags AwsAnomaly
+// @Accept json
+// @Produce json
+// @Param monitor body form.AwsAnomalyMonitorParams true "monitor"
+// @Success 200 {object} structs.ResponseBody{body=services.AwsAnomalyMonitor}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /awsanomalies/monitors [put]
+func (co AwsAnomalyController) UpdateMonitor(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.AwsAnomalyMonitorParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+	svc, ok := co.costExplorer(c)
+	if !ok {
+		return
+	}
+
+	monitor, err := services.UpdateAwsAnomalyMonitor(svc, params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "aws_anomaly_monitor.update", 0, nil, params)
+
+	co.SetBody(monitor)
+	return
+}
+
+// Subscriptions list
+// @Summary List AWS anomaly subscriptions
+// @Description Alert subscriptions of the account, of one monitor when monitor_arn is set
+// @Tags AwsAnomaly
+// @Accept json
+// @Produce json
+// @Param monitor_arn query string false "monitor ARN"
+// @Success 200 {object} structs.ResponseBody{body=[]services.AwsAnomalySubscription}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /awsanomalies/subscriptions [get]
+func (co AwsAnomalyController) Subscriptions(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	svc, ok := co.costExplorer(c)
+	if !ok {
+		return
+	}
+
+	subscriptions, err := services.GetAwsAnomalySubscriptions(svc, c.Query("monitor_arn"), nil)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(subscriptions)
+	return
+}
+
+// CreateSubscription ...
+// @Summary Create AWS anomaly subscription
+// @Description Alert subscribers when anomalies of monitors exceed threshold
+// @Tags AwsAnomaly
+// @Accept json
+// @Produce json
+// @Param subscription body form.AwsAnomalySubscriptionParams true "subscription"
+// @Success 200 {object} structs.ResponseBody{body=services.AwsAnomalySubscription}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /awsanomalies/subscriptions [post]
+func (co AwsAnomalyController) CreateSubscription(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.AwsAnomalySubscriptionParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+	svc, ok := co.costExplorer(c)
+	if !ok {
+		return
+	}
+
+	subscription, err := services.CreateAwsAnomalySubscription(svc, params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "aws_anomaly_subscription.create", 0, nil, params)
+
+	co.SetBody(subscription)
+	return
+}
+
+// UpdateSubscription ...
+// @Summary Update AWS anomaly subscription
+// @Description Replace subscription by subscription_arn
+// @Tags AwsAnomaly
+// @Accept json
+// @Produce json
+// @Param subscription body form.AwsAnomalySubscriptionParams true "subscription"
+// @Success 200 {object} structs.ResponseBody{body=services.AwsAnomalySubscription}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /awsanomalies/subscriptions [put]
+func (co AwsAnomalyController) UpdateSubscription(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.AwsAnomalySubscriptionParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+	svc, ok := co.costExplorer(c)
+	if !ok {
+		return
+	}
+
+	subscription, err := services.UpdateAwsAnomalySubscription(svc, params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "aws_anomaly_subscription.update", 0, nil, params)
+
+	co.SetBody(subscription)
+	return
+}
+
+// Feedback anomaly
+// @Summary AWS anomaly feedback
+// @Description Tell AWS whether the anomaly was expected
+// @Tags AwsAnomaly
+// @Accept json
+// @Produce json
+// @Param feedback body form.AwsAnomalyFeedbackParams true "feedback"
+// @Success 200 {object} structs.ResponseBody{body=string}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /awsanomalies/feedback [post]
+func (co AwsAnomalyController) Feedback(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.AwsAnomalyFeedbackParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+	svc, ok := co.costExplorer(c)
+	if !ok {
+		return
+	}
+
+	anomalyID, err := services.ProvideAwsAnomalyFeedback(svc, params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "aws_anomaly.feedback", 0, nil, params)
+
+	co.SetBody(anomalyID)
+	return
+}
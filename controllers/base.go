@@ -1,18 +1,17 @@
 package controllers
 
 import (
-	"errors"
+	"log"
 	"net/http"
 	"reflect"
-
 	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	awsCredentials "github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/gin-gonic/gin"
 	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
 	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
 	structs "gitlab.com/fibocloud/aws-billing/api_v2/structs"
 	gorm "gorm.io/gorm"
 )
@@ -25,23 +24,11 @@ type BaseController struct {
 
 // DefaultSvc ...
 func (co BaseController) DefaultSvc(userID uint) (sess *session.Session, err error) {
-	var user databases.SystemUser
-
-	result := co.DB.Preload("AwsCredentials").First(&user, userID)
-	if result.Error != nil {
-		co.SetError(http.StatusInternalServerError, result.Error.Error())
-		return nil, result.Error
-	}
-
-	if user.AwsCredentials.Base.ID != 0 {
-		sess, err = session.NewSession(&aws.Config{
-			Region:      aws.String(user.AwsRegion), //"us-east-1"
-			Credentials: awsCredentials.NewStaticCredentials(user.AwsCredentials.AccessKey, user.AwsCredentials.SecretKey, ""),
-		})
-		return sess, err
-
+	sess, err = services.Session(co.DB, userID)
+	if err != nil && err != services.ErrNoCredentials {
+		co.SetError(http.StatusInternalServerError, err.Error())
 	}
-	return sess, errors.New("You don't have a permission to access AWS")
+	return sess, err
 }
 
 // ListResponse ...
@@ -66,6 +53,26 @@ func (co BaseController) SetError(code int, message string) {
 	co.Response.Body.Body = nil
 }
 
+// SetServiceError bad request for invalid params with errors per field in
+// body, internal error otherwise
+func (co BaseController) SetServiceError(err error) {
+	switch e := err.(type) {
+	case *services.ParamError:
+		co.SetError(http.StatusBadRequest, err.Error())
+		co.Response.Body.Body = []*services.ParamError{e}
+		return
+	case *services.ValidationError:
+		co.SetError(http.StatusBadRequest, err.Error())
+		co.Response.Body.Body = e.Errors
+		return
+	}
+	if err == services.ErrCostExplorerQuota {
+		co.SetError(http.StatusTooManyRequests, err.Error())
+		return
+	}
+	co.SetError(http.StatusInternalServerError, err.Error())
+}
+
 // GetBody in response
 func (co BaseController) GetBody() (int, interface{}) {
 	return co.Response.StatusCode, co.Response.Body
@@ -79,6 +86,53 @@ func (co BaseController) GetAuth(c *gin.Context) databases.SystemUser {
 	return databases.SystemUser{}
 }
 
+// checkManager forbidden unless the auth user manages company settings
+func (co BaseController) checkManager(c *gin.Context) bool {
+	if !services.CanManage(co.GetAuth(c)) {
+		co.SetError(http.StatusForbidden, "Хандах эрхгүй")
+		return false
+	}
+	return true
+}
+
+// Audit appends audit log of auth user's action on the target, before is nil
+// on create and after is nil on delete
+func (co BaseController) Audit(c *gin.Context, action string, targetID uint, before, after interface{}) {
+	co.AuditAs(c, co.GetAuth(c), action, targetID, before, after)
+}
+
+// AuditAs audit log of the actor, for actions before login
+func (co BaseController) AuditAs(c *gin.Context, actor databases.SystemUser, action string, targetID uint, before, after interface{}) {
+	now := time.Now()
+	entry := databases.AuditLog{
+		Base:       databases.Base{CreatedDate: now, ModifiedDate: now},
+		CompanyID:  actor.CompanyID,
+		ActorID:    actor.Base.ID,
+		ActorEmail: actor.Email,
+		Action:     action,
+		Target:     strings.SplitN(action, ".", 2)[0],
+		TargetID:   targetID,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+	if key, exists := c.Get("api_key"); exists {
+		entry.APIKeyID = key.(databases.APIKey).ID
+	}
+	if err := services.Audit(co.DB, entry, before, after); err != nil {
+		log.Printf("[audit] %v %v: %v", action, targetID, err)
+	}
+}
+
+// CompanyScope rows of user's company, own rows when user has no company
+func CompanyScope(user databases.SystemUser) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if user.CompanyID != 0 {
+			return db.Where("company_id = ?", user.CompanyID)
+		}
+		return db.Where("user_id = ?", user.Base.ID)
+	}
+}
+
 // Paginate table
 func Paginate(page, pageSize int) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
@@ -99,6 +153,23 @@ func Paginate(page, pageSize int) func(db *gorm.DB) *gorm.DB {
 	}
 }
 
+// CheckSort ParamError unless sort field is one of the columns and order is
+// asc or desc, TableSearch puts them in ORDER BY as they are
+func CheckSort(sort form.SortColumn, columns ...string) error {
+	if sort.Field == "" {
+		return nil
+	}
+	if order := strings.ToLower(sort.Order); order != "" && order != "asc" && order != "desc" {
+		return services.NewParamError("sort.order", "must be asc or desc")
+	}
+	for _, column := range columns {
+		if sort.Field == column {
+			return nil
+		}
+	}
+	return services.NewParamError("sort.field", "must be one of "+strings.Join(columns, ", "))
+}
+
 // TableSearch undsen table search hiih
 func TableSearch(v reflect.Value, sort form.SortColumn) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
@@ -0,0 +1,374 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	gin "github.com/gin-gonic/gin"
+	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	form "gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+	structs "gitlab.com/fibocloud/aws-billing/api_v2/structs"
+	gorm "gorm.io/gorm"
+)
+
+// BudgetController struct
+type BudgetController struct {
+	BaseController
+}
+
+// Init Controller
+func (co BudgetController) Init(router *gin.RouterGroup) {
+	router.GET("/list", co.List)               // List
+	router.GET("get/:id", co.Get)              // Show
+	router.POST("", co.Create)                 // Create
+	router.PUT("/:id", co.Update)              // Update
+	router.DELETE("/:id", co.Delete)           // Delete
+	router.GET("/status/:id", co.Status)       // Current spend
+	router.POST("/evaluate/:id", co.Evaluate)  // Evaluate now
+	router.GET("/alerts", co.Alerts)           // Alert history
+	router.GET("/alerts/:id", co.BudgetAlerts) // Alert history of budget
+}
+
+// find budget of auth user's company
+func (co BudgetController) find(c *gin.Context, budget *databases.Budget) bool {
+	result := co.DB.Preload("Thresholds").Scopes(CompanyScope(co.GetAuth(c))).First(budget, c.Param("id"))
+	if result.Error != nil {
+		co.SetError(http.StatusNotFound, "Төсөв олдсонгүй")
+		return false
+	}
+	return true
+}
+
+// List budget
+// @Summary List budget
+// @Description Get budgets
+// @Tags Budget
+// @Accept json
+// @Produce json
+// @Success 200 {object} structs.ResponseBody{body=[]databases.Budget}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /budgets/list [get]
+func (co BudgetController) List(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var budgets []databases.Budget
+	co.DB.Preload("Thresholds").Scopes(CompanyScope(co.GetAuth(c))).Order("created_date desc").Find(&budgets)
+
+	co.SetBody(budgets)
+	return
+}
+
+// Get budget
+// @Summary Get budget
+// @Description Show budget
+// @Tags Budget
+// @Accept json
+// @Produce json
+// @Param id path uint true "budget ID"
+// @Success 200 {object} structs.ResponseBody{body=databases.Budget}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /budgets/get/{id} [get]
+func (co BudgetController) Get(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var budget databases.Budget
+	if !co.find(c, &budget) {
+		return
+	}
+
+	co.SetBody(budget)
+	return
+}
+
+// Create budget
+// @Summary Create budget
+// @Description Add budget, company admin only
+// @Tags Budget
+// @Accept json
+// @Produce json
+// @Param budget body form.BudgetParams true "budget"
+// @Success 200 {object} structs.ResponseBody{body=databases.Budget}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 403 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /budgets [post]
+func (co BudgetController) Create(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.checkManager(c) {
+		return
+	}
+
+	var params form.BudgetParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	authUser := co.GetAuth(c)
+	budget := databases.Budget{
+		CompanyID: authUser.CompanyID,
+		UserID:    authUser.Base.ID,
+		Base: databases.Base{
+			CreatedDate: time.Now(),
+		},
+	}
+	services.BudgetFromParams(&budget, params)
+
+	if err := services.ValidateBudget(budget); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	result := co.DB.Create(&budget)
+	if result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+
+	co.Audit(c, "budget.create", budget.ID, nil, budget)
+
+	co.SetBody(budget)
+	return
+}
+
+// Update budget
+// @Summary Update budget
+// @Description Edit budget, thresholds are replaced, company admin only
+// @Tags Budget
+// @Accept json
+// @Produce json
+// @Param id path uint true "budget ID"
+// @Param budget body form.BudgetParams true "budget"
+// @Success 200 {object} structs.ResponseBody{body=databases.Budget}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 403 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /budgets/{id} [put]
+func (co BudgetController) Update(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.checkManager(c) {
+		return
+	}
+
+	var params form.BudgetParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var budget databases.Budget
+	if !co.find(c, &budget) {
+		return
+	}
+	before := services.AuditSnapshot(budget)
+
+	services.BudgetFromParams(&budget, params)
+	budget.Base.ModifiedDate = time.Now()
+
+	if err := services.ValidateBudget(budget); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	err := co.DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Where("budget_id = ?", budget.ID).Delete(&databases.BudgetThreshold{}); result.Error != nil {
+			return result.Error
+		}
+		return tx.Session(&gorm.Session{FullSaveAssociations: true}).Save(&budget).Error
+	})
+	if err != nil {
+		co.SetError(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	co.Audit(c, "budget.update", budget.ID, before, budget)
+
+	co.SetBody(budget)
+	return
+}
+
+// Delete budget
+// @Summary Delete budget
+// @Description Remove budget, company admin only
+// @Tags Budget
+// @Accept json
+// @Produce json
+// @Param id path uint true "budget ID"
+// @Success 200 {object} structs.ResponseBody{body=structs.SuccessResponse}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 403 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /budgets/{id} [delete]
+func (co BudgetController) Delete(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.checkManager(c) {
+		return
+	}
+
+	var budget databases.Budget
+	if !co.find(c, &budget) {
+		return
+	}
+
+	err := co.DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Where("budget_id = ?", budget.ID).Delete(&databases.BudgetThreshold{}); result.Error != nil {
+			return result.Error
+		}
+		return tx.Delete(&budget).Error
+	})
+	if err != nil {
+		co.SetError(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	co.Audit(c, "budget.delete", budget.ID, budget, nil)
+
+	co.SetBody(structs.SuccessResponse{
+		Success: true,
+	})
+	return
+}
+
+// Status of budget
+// @Summary Budget status
+// @Description Current spend and forecast of the budget period, thresholds are not alerted
+// @Tags Budget
+// @Accept json
+// @Produce json
+// @Param id path uint true "budget ID"
+// @Success 200 {object} structs.ResponseBody{body=services.BudgetStatus}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /budgets/status/{id} [get]
+func (co BudgetController) Status(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var budget databases.Budget
+	if !co.find(c, &budget) {
+		return
+	}
+
+	sess, sessError := co.DefaultSvc(budget.UserID)
+	if sessError != nil {
+		co.SetError(http.StatusInternalServerError, sessError.Error())
+		return
+	}
+
+	status, err := services.BudgetSpend(costexplorer.New(sess), budget)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(status)
+	return
+}
+
+// Evaluate budget
+// @Summary Evaluate budget
+// @Description Evaluate budget against current spend and forecast, alerts thresholds crossed first time in the period
+// @Tags Budget
+// @Accept json
+// @Produce json
+// @Param id path uint true "budget ID"
+// @Success 200 {object} structs.ResponseBody{body=services.BudgetStatus}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /budgets/evaluate/{id} [post]
+func (co BudgetController) Evaluate(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var budget databases.Budget
+	if !co.find(c, &budget) {
+		return
+	}
+
+	sess, sessError := co.DefaultSvc(budget.UserID)
+	if sessError != nil {
+		co.SetError(http.StatusInternalServerError, sessError.Error())
+		return
+	}
+
+	status, err := services.EvaluateBudget(co.DB, costexplorer.New(sess), budget)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+	co.Audit(c, "budget.evaluate", budget.ID, nil, status)
+
+	co.SetBody(status)
+	return
+}
+
+// Alerts history
+// @Summary List budget alerts
+// @Description Get alerts of all budgets
+// @Tags Budget
+// @Accept json
+// @Produce json
+// @Success 200 {object} structs.ResponseBody{body=[]databases.BudgetAlert}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /budgets/alerts [get]
+func (co BudgetController) Alerts(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	budgetIDs := co.DB.Model(&databases.Budget{}).Select("id").Scopes(CompanyScope(co.GetAuth(c)))
+
+	var alerts []databases.BudgetAlert
+	co.DB.Preload("Budget").Where("budget_id IN (?)", budgetIDs).Order("created_date desc").Find(&alerts)
+
+	co.SetBody(alerts)
+	return
+}
+
+// BudgetAlerts history of budget
+// @Summary List alerts of budget
+// @Description Get alerts of budget
+// @Tags Budget
+// @Accept json
+// @Produce json
+// @Param id path uint true "budget ID"
+// @Success 200 {object} structs.ResponseBody{body=[]databases.BudgetAlert}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /budgets/alerts/{id} [get]
+func (co BudgetController) BudgetAlerts(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var budget databases.Budget
+	if !co.find(c, &budget) {
+		return
+	}
+
+	var alerts []databases.BudgetAlert
+	co.DB.Where("budget_id = ?", budget.ID).Order("created_date desc").Find(&alerts)
+
+	co.SetBody(alerts)
+	return
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	gin "github.com/gin-gonic/gin"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+)
+
+// CostCategoryController struct
+type CostCategoryController struct {
+	BaseController
+}
+
+// Init Controller
+func (co CostCategoryController) Init(router *gin.RouterGroup) {
+	router.GET("/list", co.List)         // List
+	router.GET("/describe", co.Describe) // Show
+	router.POST("", co.Create)           // Create
+	router.PUT("", co.Update)            // Update
+}
+
+// costExplorer client of the auth user
+func (co CostCategoryController) costExplorer(c *gin.Context) (*costexplorer.CostExplorer, bool) {
+	sess, sessError := co.DefaultSvc(co.GetAuth(c).Base.ID)
+	if sessError != nil {
+		co.SetError(http.StatusInternalServerError, sessError.Error())
+		return nil, false
+	}
+	return costexplorer.New(sess), true
+}
+
+// List cost categories
+// @Summary List cost categories
+// @Description Cost category definitions effective now
+// @Tags CostCategory
+// @Accept json
+// @Produce json
+// @Success 200 {object} structs.ResponseBody{body=[]services.CostCategoryDefinition}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /costcategories/list [get]
+func (co CostCategoryController) List(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	svc, ok := co.costExplorer(c)
+	if !ok {
+		return
+	}
+
+	definitions, err := services.ListCostCategories(svc)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(definitions)
+	return
+}
+
+// Describe cost category
+// @Summary Describe cost category
+// @Description Cost category with rules, split charge rules and default value
+// @Tags CostCategory
+// @Accept json
+// @Produce json
+// @Param arn query string true "cost category ARN"
+// @Success 200 {object} structs.ResponseBody{body=services.CostCategoryDefinition}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /costcategories/describe [get]
+func (co CostCategoryController) Describe(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	svc, ok := co.costExplorer(c)
+	if !ok {
+		return
+	}
+
+	definition, err := services.DescribeCostCategory(svc, c.Query("arn"))
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(definition)
+	return
+}
+
+// Create cost category
+// @Summary Create cost category
+// @Description Add cost category definition
+// @Tags CostCategory
+// @Accept json
+// @Produce json
+// @Param category body form.CostCategoryParams true "category"
+// @Success 200 {object} structs.ResponseBody{body=services.CostCategoryDefinition}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /costcategories [post]
+func (co CostCategoryController) Create(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.CostCategoryParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+	svc, ok := co.costExplorer(c)
+	if !ok {
+		return
+	}
+
+	definition, err := services.CreateCostCategory(svc, params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "cost_category.create", 0, nil, params)
+
+	co.SetBody(definition)
+	return
+}
+
+// Update cost category
+// @Summary Update cost category
+// @Description Replace rules, split charge rules and default value of cost category by arn
+// @Tags CostCategory
+// @Accept json
+// @Produce json
+// @Param category body form.CostCategoryParams true "category"
+// @Success 200 {object} structs.ResponseBody{body=services.CostCategoryDefinition}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /costcategories [put]
+func (co CostCategoryController) Update(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.CostCategoryParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+	svc, ok := co.costExplorer(c)
+	if !ok {
+		return
+	}
+
+	definition, err := services.UpdateCostCategory(svc, params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "cost_category.update", 0, nil, params)
+
+	co.SetBody(definition)
+	return
+}
@@ -1,19 +1,14 @@
 package controllers
 
 import (
-	"fmt"
 	"net/http"
-	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/costexplorer"
 	"github.com/gin-gonic/gin"
 	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
 )
 
-var credit = "Credit"
-var refund = "Refund"
-
 // ConstExplorerController struct
 type ConstExplorerController struct {
 	BaseController
@@ -21,8 +16,16 @@ type ConstExplorerController struct {
 
 // Init Controller
 func (co ConstExplorerController) Init(router *gin.RouterGroup) {
-	router.POST("/getcost", co.Get)       // GetCost
-	router.POST("/forecast", co.Forecast) // Forecast
+	router.POST("/getcost", co.Get)                           // GetCost
+	router.POST("/export", co.Export)                         // GetCost as CSV, XLSX
+	router.POST("/forecast", co.Forecast)                     // Forecast
+	router.POST("/monthend", co.MonthEnd)                     // Month end projection
+	router.POST("/movers", co.Movers)                         // Top movers
+	router.POST("/riutilization", co.ReservationUtilization)  // Reserved instance utilization
+	router.POST("/ricoverage", co.ReservationCoverage)        // Reserved instance coverage
+	router.POST("/sputilization", co.SavingsPlansUtilization) // Savings plans utilization
+	router.POST("/spcoverage", co.SavingsPlansCoverage)       // Savings plans coverage
+	router.POST("/rightsizing", co.Rightsizing)               // EC2 rightsizing
 }
 
 // Get cost
@@ -32,7 +35,7 @@ func (co ConstExplorerController) Init(router *gin.RouterGroup) {
 // @Accept json
 // @Produce json
 // @Param getCost body form.CostExplorerParams true "getCost"
-// @Success 200 {object} structs.ResponseBody{body=costexplorer.GetCostAndUsageOutput}
+// @Success 200 {object} structs.ResponseBody{body=services.ConvertedCostAndUsage}
 // @Failure 400 {object} structs.ErrorResponse
 // @Failure 500 {object} structs.ErrorResponse
 // @Router /getcost [post]
@@ -46,6 +49,10 @@ func (co *ConstExplorerController) Get(c *gin.Context) {
 		co.SetError(http.StatusBadRequest, err.Error())
 		return
 	}
+	if err := services.ResolveCostParams(&params); err != nil {
+		co.SetServiceError(err)
+		return
+	}
 	authUser := co.GetAuth(c)
 
 	sess, sessError := co.DefaultSvc(authUser.Base.ID)
@@ -54,82 +61,93 @@ func (co *ConstExplorerController) Get(c *gin.Context) {
 		return
 	}
 
-	var groups []*costexplorer.GroupDefinition
-	var eachGroup costexplorer.GroupDefinition
-
-	if params.GroupName != "" {
-		eachGroup.Type = aws.String("DIMENSION")
-		eachGroup.Key = aws.String(params.GroupName)
-		groups = append(groups, &eachGroup)
+	converted, err := services.RunCostQuery(co.DB, costexplorer.New(sess), authUser, params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
 	}
 
-	svc := costexplorer.New(sess)
-	input := &costexplorer.GetCostAndUsageInput{
-		Granularity: aws.String(params.Granularity),
-		Metrics:     params.Metric,
-		TimePeriod: &costexplorer.DateInterval{
-			End:   aws.String(params.EndDate),
-			Start: aws.String(params.StartDate),
-		},
-	}
+	co.SetBody(converted)
+	return
+}
 
-	if len(groups) > 0 {
-		input.GroupBy = groups
+// Export cost
+// @Summary Export cost
+// @Description Streams cost query as a flat table of period, group keys, metric, amount and unit
+// @Tags CostExporer
+// @Accept json
+// @Produce json,text/csv,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param export body form.CostExplorerExportParams true "export"
+// @Success 200 {file} file "cost table"
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /export [post]
+func (co *ConstExplorerController) Export(c *gin.Context) {
+	var params form.CostExplorerExportParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		c.JSON(co.GetBody())
+		return
 	}
+	if params.Format == "" {
+		params.Format = services.FormatCSV
+	}
+	if err := services.CheckTableFormat(params.Format); err != nil {
+		co.SetServiceError(err)
+		c.JSON(co.GetBody())
+		return
+	}
+	if err := services.ResolveCostParams(&params.CostExplorerParams); err != nil {
+		co.SetServiceError(err)
+		c.JSON(co.GetBody())
+		return
+	}
+	authUser := co.GetAuth(c)
 
-	if len(params.Services) > 0 {
-		serviceFilter := costexplorer.Expression{
-			And: []*costexplorer.Expression{
-				{
-					Dimensions: &costexplorer.DimensionValues{
-						Key:    aws.String("SERVICE"),
-						Values: params.Services,
-					},
-				},
-				{
-					Not: &costexplorer.Expression{
-						Dimensions: &costexplorer.DimensionValues{
-							Key:    aws.String("RECORD_TYPE"),
-							Values: []*string{&credit, &refund},
-						},
-					},
-				},
-			},
-		}
-
-		input.Filter = &serviceFilter
-	} else {
-		serviceFilter := costexplorer.Expression{
-			Not: &costexplorer.Expression{
-				Dimensions: &costexplorer.DimensionValues{
-					Key:    aws.String("RECORD_TYPE"),
-					Values: []*string{&credit, &refund},
-				},
-			},
-		}
-		input.Filter = &serviceFilter
+	sess, sessError := co.DefaultSvc(authUser.Base.ID)
+	if sessError != nil {
+		co.SetError(http.StatusInternalServerError, sessError.Error())
+		c.JSON(co.GetBody())
+		return
 	}
 
-	fmt.Println("input", input)
+	rates, err := services.DisplayRates(co.DB, authUser, params.Currency, params.StartDate, params.EndDate)
+	if err != nil {
+		co.SetServiceError(err)
+		c.JSON(co.GetBody())
+		return
+	}
 
-	cost, costErr := svc.GetCostAndUsage(input)
-	if costErr != nil {
-		co.SetError(http.StatusInternalServerError, costErr.Error())
+	export, err := services.NewCostExport(costexplorer.New(sess), services.CostAndUsageInput(params.CostExplorerParams), rates)
+	if err != nil {
+		co.SetServiceError(err)
+		c.JSON(co.GetBody())
 		return
 	}
 
-	co.SetBody(cost)
-	return
+	contentType, extension := services.TableContentType(params.Format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="cost-`+params.StartDate+`-`+params.EndDate+`.`+extension+`"`)
+	c.Status(http.StatusOK)
+
+	table, err := services.NewTableWriter(c.Writer, params.Format, "Cost")
+	if err == nil {
+		err = export.Write(table)
+	}
+	if err != nil {
+		// headers are sent, the truncated file is all the client gets
+		c.Error(err)
+	}
 }
 
 // Forecast cost
 // @Summary Forecast cost
-// @Description Forecast cost
+// @Description Actual cost from start date until today and forecast with prediction interval until end date
 // @Tags CostExporer
 // @Accept json
 // @Produce json
 // @Param getForecastCost body form.CostExplorerForcastParams true "getForecastCost"
-// @Success 200 {object} structs.ResponseBody{body=costexplorer.GetCostAndUsageOutput}
+// @Success 200 {object} structs.ResponseBody{body=services.ForecastResult}
 // @Failure 400 {object} structs.ErrorResponse
 // @Failure 500 {object} structs.ErrorResponse
 // @Router /forecast [post]
@@ -151,33 +169,305 @@ func (co *ConstExplorerController) Forecast(c *gin.Context) {
 		return
 	}
 
-	startDate := time.Now().Add(time.Hour * 24).Format("2006-01-02")
+	forecast, err := services.Forecast(costexplorer.New(sess), params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	rates, err := services.DisplayRates(co.DB, authUser, params.Currency, forecast.StartDate, forecast.EndDate)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	converted, err := services.ConvertForecast(forecast, rates)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(converted)
+	return
+}
+
+// MonthEnd comparison
+// @Summary Month end projection
+// @Description Month to date spend against last month with forecasted month end per service
+// @Tags CostExporer
+// @Accept json
+// @Produce json
+// @Param monthEnd body form.CostExplorerMonthEndParams true "monthEnd"
+// @Success 200 {object} structs.ResponseBody{body=services.MonthEndComparison}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /monthend [post]
+func (co *ConstExplorerController) MonthEnd(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.CostExplorerMonthEndParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	authUser := co.GetAuth(c)
+
+	sess, sessError := co.DefaultSvc(authUser.Base.ID)
+	if sessError != nil {
+		co.SetError(http.StatusInternalServerError, sessError.Error())
+		return
+	}
+
+	comparison, err := services.MonthEnd(costexplorer.New(sess), params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	rates, err := services.DisplayRates(co.DB, authUser, params.Currency, comparison.MonthStart, comparison.Today)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	converted, err := services.ConvertMonthEnd(comparison, rates)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(converted)
+	return
+}
+
+// Movers cost change
+// @Summary Top movers
+// @Description Rank services, accounts, regions or usage types by cost change between two periods
+// @Tags CostExporer
+// @Accept json
+// @Produce json
+// @Param movers body form.CostExplorerMoversParams true "movers"
+// @Success 200 {object} structs.ResponseBody{body=services.MoversReport}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /movers [post]
+func (co *ConstExplorerController) Movers(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.CostExplorerMoversParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sess, sessError := co.DefaultSvc(co.GetAuth(c).Base.ID)
+	if sessError != nil {
+		co.SetError(http.StatusInternalServerError, sessError.Error())
+		return
+	}
+
+	report, err := services.Movers(costexplorer.New(sess), params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(report)
+	return
+}
+
+// ReservationUtilization report
+// @Summary Reserved instance utilization
+// @Description Utilization, unused hours cost and savings per period and per reservation subscription
+// @Tags CostExporer
+// @Accept json
+// @Produce json
+// @Param riUtilization body form.CostExplorerCommitmentParams true "riUtilization"
+// @Success 200 {object} structs.ResponseBody{body=services.ReservationUtilizationReport}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /riutilization [post]
+func (co *ConstExplorerController) ReservationUtilization(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.CostExplorerCommitmentParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sess, sessError := co.DefaultSvc(co.GetAuth(c).Base.ID)
+	if sessError != nil {
+		co.SetError(http.StatusInternalServerError, sessError.Error())
+		return
+	}
+
+	report, err := services.GetReservationUtilization(costexplorer.New(sess), params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(report)
+	return
+}
+
+// ReservationCoverage report
+// @Summary Reserved instance coverage
+// @Description Running hours covered by reservations per period and per group_by value
+// @Tags CostExporer
+// @Accept json
+// @Produce json
+// @Param riCoverage body form.CostExplorerCommitmentParams true "riCoverage"
+// @Success 200 {object} structs.ResponseBody{body=services.ReservationCoverageReport}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /ricoverage [post]
+func (co *ConstExplorerController) ReservationCoverage(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.CostExplorerCommitmentParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sess, sessError := co.DefaultSvc(co.GetAuth(c).Base.ID)
+	if sessError != nil {
+		co.SetError(http.StatusInternalServerError, sessError.Error())
+		return
+	}
+
+	report, err := services.GetReservationCoverage(costexplorer.New(sess), params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
 
-	svc := costexplorer.New(sess)
-	input := &costexplorer.GetCostForecastInput{
-		Filter: &costexplorer.Expression{
-			Not: &costexplorer.Expression{
-				Dimensions: &costexplorer.DimensionValues{
-					Key:    aws.String("RECORD_TYPE"),
-					Values: []*string{&credit, &refund},
-				},
-			},
-		},
-		Granularity: aws.String(params.Granularity),
-		Metric:      aws.String(params.Metric),
-		TimePeriod: &costexplorer.DateInterval{
-			End:   aws.String(params.EndDate),
-			Start: aws.String(startDate),
-		},
+	co.SetBody(report)
+	return
+}
+
+// SavingsPlansUtilization report
+// @Summary Savings plans utilization
+// @Description Used and unused commitment per period and per savings plan
+// @Tags CostExporer
+// @Accept json
+// @Produce json
+// @Param spUtilization body form.CostExplorerCommitmentParams true "spUtilization"
+// @Success 200 {object} structs.ResponseBody{body=services.SavingsPlansUtilizationReport}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /sputilization [post]
+func (co *ConstExplorerController) SavingsPlansUtilization(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.CostExplorerCommitmentParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
 	}
 
-	cost, errcost := svc.GetCostForecast(input)
-	if errcost != nil {
-		co.SetError(http.StatusInternalServerError, errcost.Error())
+	sess, sessError := co.DefaultSvc(co.GetAuth(c).Base.ID)
+	if sessError != nil {
+		co.SetError(http.StatusInternalServerError, sessError.Error())
 		return
 	}
 
-	co.SetBody(cost)
+	report, err := services.GetSavingsPlansUtilization(costexplorer.New(sess), params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(report)
+	return
+}
+
+// SavingsPlansCoverage report
+// @Summary Savings plans coverage
+// @Description Spend covered by savings plans per period and per group_by value
+// @Tags CostExporer
+// @Accept json
+// @Produce json
+// @Param spCoverage body form.CostExplorerCommitmentParams true "spCoverage"
+// @Success 200 {object} structs.ResponseBody{body=services.SavingsPlansCoverageReport}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /spcoverage [post]
+func (co *ConstExplorerController) SavingsPlansCoverage(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.CostExplorerCommitmentParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sess, sessError := co.DefaultSvc(co.GetAuth(c).Base.ID)
+	if sessError != nil {
+		co.SetError(http.StatusInternalServerError, sessError.Error())
+		return
+	}
+
+	report, err := services.GetSavingsPlansCoverage(costexplorer.New(sess), params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(report)
+	return
+}
+
+// Rightsizing recommendations
+// @Summary EC2 rightsizing
+// @Description Terminate and modify recommendations of EC2 instances with potential monthly savings per account
+// @Tags CostExporer
+// @Accept json
+// @Produce json
+// @Param rightsizing body form.CostExplorerRightsizingParams true "rightsizing"
+// @Success 200 {object} structs.ResponseBody{body=services.RightsizingReport}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /rightsizing [post]
+func (co *ConstExplorerController) Rightsizing(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.CostExplorerRightsizingParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sess, sessError := co.DefaultSvc(co.GetAuth(c).Base.ID)
+	if sessError != nil {
+		co.SetError(http.StatusInternalServerError, sessError.Error())
+		return
+	}
+
+	report, err := services.Rightsizing(costexplorer.New(sess), params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(report)
 	return
 }
 
@@ -379,84 +669,3 @@ func (co *ConstExplorerController) Forecast(c *gin.Context) {
 // 	response.Body = cost
 // 	return
 // }
-
-// // DescribeReportDefinitionsInput ...
-// // @Title DescribeReportDefinitionsInput
-// // @Description DescribeReportDefinitionsInput
-// // @Param    start_date body    string    true    "start_date"
-// // @Param    end_date body    date    true    "end_date"
-// // @Failure 403
-// // @router /describereportdefinitionsinput [post]
-// func (e *ConstExplorerController) DescribeReportDefinitionsInput() {
-// 	claims, _ := e.CheckToken()
-// 	logger := utils.GetLogger()
-// 	var response models.BaseResponse
-
-// 	defer func() {
-// 		e.Data["json"] = response
-// 		e.ServeJSON()
-// 	}()
-
-// 	// bodyResult := shared.RetrieveDataFromBody(e.Ctx.Request.Body)
-// 	// bodyString := []string{
-// 	// 	"start_date",
-// 	// 	"end_date",
-// 	// }
-
-// 	// if sCod, eMsg := shared.CheckBodyResult(bodyResult, bodyString); sCod == 100 {
-// 	// 	response.StatusCode = sCod
-// 	// 	response.ErrorMsg = eMsg
-// 	// 	return
-// 	// }
-
-// 	userEmail := claims["email"].(string)
-
-// 	sess, sessError := DefaultSvc(userEmail)
-// 	if sessError != nil {
-// 		e.RWMutex.Lock()
-// 		defer e.RWMutex.Unlock()
-// 		utils.SetLumlog(userEmail)
-// 		logger.Error(sessError.Error())
-// 		response.StatusCode = 100
-// 		response.ErrorMsg = sessError.Error()
-// 		return
-// 	}
-
-// 	svc := costandusagereportservice.New(sess)
-// 	input := &costandusagereportservice.DescribeReportDefinitionsInput{
-// 		MaxResults: aws.Int64(5),
-// 	}
-
-// 	result, err := svc.DescribeReportDefinitions(input)
-// 	if err != nil {
-// 		if aerr, ok := err.(awserr.Error); ok {
-// 			switch aerr.Code() {
-// 			case costandusagereportservice.ErrCodeInternalErrorException:
-// 				fmt.Println(costandusagereportservice.ErrCodeInternalErrorException, aerr.Error())
-// 			default:
-// 				fmt.Println(aerr.Error())
-// 			}
-// 		} else {
-// 			// Print the error, cast err to awserr.Error to get the Code and
-// 			// Message from an error.
-// 			fmt.Println(err.Error())
-// 		}
-// 		return
-// 	}
-
-// 	if err != nil {
-// 		e.RWMutex.Lock()
-// 		defer e.RWMutex.Unlock()
-// 		utils.SetLumlog(claims["email"].(string))
-// 		logger.Error(err.Error())
-// 		response.StatusCode = 100
-// 		response.ErrorMsg = err.Error()
-// 		response.Body = true
-// 		return
-// 	}
-
-// 	response.StatusCode = 0
-// 	response.ErrorMsg = ""
-// 	response.Body = result
-// 	return
-// }
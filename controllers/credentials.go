@@ -7,6 +7,7 @@ import (
 	gin "github.com/gin-gonic/gin"
 	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
 	form "gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
 	structs "gitlab.com/fibocloud/aws-billing/api_v2/structs"
 )
 
@@ -118,6 +119,7 @@ func (co CredentialsController) Create(c *gin.Context) {
 		co.SetError(http.StatusInternalServerError, result.Error.Error())
 		return
 	}
+	co.Audit(c, "credentials.create", credentials.ID, nil, credentials)
 
 	co.SetBody(structs.SuccessResponse{
 		Success: true,
@@ -149,6 +151,11 @@ func (co CredentialsController) UpdateDefault(c *gin.Context) {
 		return
 	}
 
+	authUser := co.GetAuth(c)
+	var previous databases.AwsCredentials
+	co.DB.Where("user_id = ? AND is_active = ?", authUser.Base.ID, true).Limit(1).Find(&previous)
+	before := map[string]interface{}{"credential_id": previous.ID, "aws_region": authUser.AwsRegion}
+
 	result := tx.Model(&databases.AwsCredentials{}).Where("user_id = ?", co.GetAuth(c).Base.ID).Update("is_active", false)
 	if result.Error != nil {
 		tx.Rollback()
@@ -174,6 +181,9 @@ func (co CredentialsController) UpdateDefault(c *gin.Context) {
 		Success: true,
 	})
 	tx.Commit()
+
+	after := map[string]interface{}{"credential_id": params.CredentialID, "aws_region": params.RegionCode}
+	co.Audit(c, "credentials.update_default", uint(params.CredentialID), before, after)
 	return
 }
 
@@ -207,6 +217,9 @@ func (co CredentialsController) Update(c *gin.Context) {
 		return
 	}
 
+	before := services.AuditSnapshot(credentials)
+	secretChanged := credentials.SecretKey != params.SecretKey
+
 	credentials.Description = params.Description
 	credentials.IsActive = params.IsActive
 	credentials.SecretKey = params.SecretKey
@@ -220,6 +233,13 @@ func (co CredentialsController) Update(c *gin.Context) {
 		return
 	}
 
+	// secret key is hidden from JSON, only the fact that it changed is logged
+	after := services.AuditSnapshot(credentials)
+	if secretChanged {
+		after["secret_key"] = "changed"
+	}
+	co.Audit(c, "credentials.update", credentials.ID, before, after)
+
 	co.SetBody(structs.SuccessResponse{
 		Success: true,
 	})
@@ -241,11 +261,17 @@ func (co CredentialsController) Delete(c *gin.Context) {
 	defer func() {
 		c.JSON(co.GetBody())
 	}()
+	var credentials databases.AwsCredentials
+	co.DB.Limit(1).Find(&credentials, c.Param("id"))
+
 	result := co.DB.Delete(&databases.AwsCredentials{}, c.Param("id"))
 	if result.Error != nil {
 		co.SetError(http.StatusInternalServerError, result.Error.Error())
 		return
 	}
+	if result.RowsAffected > 0 {
+		co.Audit(c, "credentials.delete", credentials.ID, credentials, nil)
+	}
 	co.SetBody(structs.SuccessResponse{
 		Success: true,
 	})
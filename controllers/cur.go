@@ -0,0 +1,421 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/costandusagereportservice"
+	gin "github.com/gin-gonic/gin"
+	viper "github.com/spf13/viper"
+	"gitlab.com/fibocloud/aws-billing/api_v2/cur"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+	gorm "gorm.io/gorm"
+)
+
+// CurController struct
+type CurController struct {
+	BaseController
+}
+
+// ListCurLineItems ...
+type ListCurLineItems struct {
+	Total int64                   `json:"total"`
+	List  []databases.CurLineItem `json:"list"`
+}
+
+// CurSummaryRow ...
+type CurSummaryRow struct {
+	Key           string  `json:"key"`
+	UsageAmount   float64 `json:"usage_amount"`
+	UnblendedCost float64 `json:"unblended_cost"`
+	BlendedCost   float64 `json:"blended_cost"`
+}
+
+// curGroupColumns group_by => column
+var curGroupColumns = map[string]string{
+	"account":        "usage_account_id",
+	"service":        "service_name",
+	"usage_type":     "usage_type",
+	"operation":      "operation",
+	"region":         "region",
+	"resource":       "resource_id",
+	"line_item_type": "line_item_type",
+	"day":            "to_char(usage_start_date, 'YYYY-MM-DD')",
+}
+
+// Init Controller
+func (co CurController) Init(router *gin.RouterGroup) {
+	router.GET("/definitions", co.Definitions) // Report definitions
+	router.POST("/import", co.Import)          // Import
+	router.POST("/periods", co.Periods)        // Periods found in source
+	router.GET("/imports", co.Imports)         // Import history
+	router.POST("/lineitems", co.LineItems)    // Line items
+	router.POST("/summary", co.Summary)        // Summary
+}
+
+// curRegion AWS region name, region is part of the S3 host name
+var curRegion = regexp.MustCompile(`^[a-z0-9-]*$`)
+
+// curDirectory local reports of the auth user's company, or of the user when
+// not in a company, under cur.directory
+func curDirectory(user databases.SystemUser) string {
+	if user.CompanyID != 0 {
+		return filepath.Join(viper.GetString("cur.directory"), fmt.Sprintf("company_%v", user.CompanyID))
+	}
+	return filepath.Join(viper.GetString("cur.directory"), fmt.Sprintf("user_%v", user.Base.ID))
+}
+
+// curEndpointAllowed S3 compatible endpoint is listed in cur.s3_endpoints
+func curEndpointAllowed(endpoint string) bool {
+	for _, allowed := range viper.GetStringSlice("cur.s3_endpoints") {
+		if strings.TrimSuffix(allowed, "/") == strings.TrimSuffix(endpoint, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// source build report source from params
+func (co CurController) source(c *gin.Context, params form.CurImportParams) (cur.Source, error) {
+	switch params.Source {
+	case "local":
+		if viper.GetString("cur.directory") == "" {
+			return nil, errors.New("cur.directory is not configured")
+		}
+		return cur.NewDirSource(curDirectory(co.GetAuth(c)), params.Path, params.Prefix)
+	case "s3":
+		if params.Endpoint != "" && !curEndpointAllowed(params.Endpoint) {
+			return nil, errors.New("endpoint is not allowed")
+		}
+		if !curRegion.MatchString(params.Region) {
+			return nil, errors.New("invalid region")
+		}
+		var sess *session.Session
+		if params.AccessKey == "" {
+			var err error
+			if sess, err = co.DefaultSvc(co.GetAuth(c).Base.ID); err != nil {
+				return nil, err
+			}
+		}
+		return cur.NewS3Source(sess, cur.S3Config{
+			Bucket:    params.Bucket,
+			Prefix:    params.Prefix,
+			Endpoint:  params.Endpoint,
+			Region:    params.Region,
+			AccessKey: params.AccessKey,
+			SecretKey: params.SecretKey,
+		})
+	}
+	return nil, errors.New("source must be local or s3")
+}
+
+// Definitions report definitions of the account
+// @Summary List CUR report definitions
+// @Description Describe report definitions, shows bucket and prefix to import from
+// @Tags CUR
+// @Accept json
+// @Produce json
+// @Success 200 {object} structs.ResponseBody{body=[]costandusagereportservice.ReportDefinition}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /cur/definitions [get]
+func (co CurController) Definitions(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	sess, sessError := co.DefaultSvc(co.GetAuth(c).Base.ID)
+	if sessError != nil {
+		co.SetError(http.StatusInternalServerError, sessError.Error())
+		return
+	}
+
+	// Cost and Usage Report service is only available in us-east-1
+	svc := costandusagereportservice.New(sess, aws.NewConfig().WithRegion("us-east-1"))
+
+	var definitions []*costandusagereportservice.ReportDefinition
+	err := svc.DescribeReportDefinitionsPages(&costandusagereportservice.DescribeReportDefinitionsInput{},
+		func(page *costandusagereportservice.DescribeReportDefinitionsOutput, last bool) bool {
+			definitions = append(definitions, page.ReportDefinitions...)
+			return true
+		})
+	if err != nil {
+		co.SetError(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	co.SetBody(definitions)
+	return
+}
+
+// Periods list billing periods
+// @Summary List CUR billing periods
+// @Description Discover billing periods in the report location
+// @Tags CUR
+// @Accept json
+// @Produce json
+// @Param source body form.CurImportParams true "source"
+// @Success 200 {object} structs.ResponseBody{body=[]cur.Period}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /cur/periods [post]
+func (co CurController) Periods(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.CurImportParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	src, err := co.source(c, params)
+	if err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	periods, err := cur.Discover(src)
+	if err != nil {
+		co.SetError(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	co.SetBody(periods)
+	return
+}
+
+// Import CUR files
+// @Summary Import CUR files
+// @Description Start import of line items in background, existing rows of the billing period are replaced. Progress is shown in import history.
+// @Tags CUR
+// @Accept json
+// @Produce json
+// @Param source body form.CurImportParams true "source"
+// @Success 200 {object} structs.ResponseBody{body=[]databases.CurImport}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 409 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /cur/import [post]
+func (co CurController) Import(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.CurImportParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	src, err := co.source(c, params)
+	if err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	periods, err := cur.Discover(src)
+	if err != nil {
+		co.SetError(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	authUser := co.GetAuth(c)
+	var selected []*cur.Period
+	for _, period := range periods {
+		if params.BillingPeriod != "" && period.BillingPeriod != params.BillingPeriod {
+			continue
+		}
+		selected = append(selected, period)
+	}
+	if len(selected) == 0 {
+		co.SetError(http.StatusNotFound, "Тайлан олдсонгүй")
+		return
+	}
+
+	// periods start together or not at all when one is running
+	var imports []*databases.CurImport
+	err = co.DB.Transaction(func(tx *gorm.DB) error {
+		for _, period := range selected {
+			record, err := cur.NewImport(tx, authUser, src, period)
+			if err == cur.ErrImportRunning {
+				co.SetError(http.StatusConflict, "Импорт хийгдэж байна: "+period.BillingPeriod)
+				return err
+			}
+			if err != nil {
+				co.SetError(http.StatusInternalServerError, err.Error())
+				return err
+			}
+			imports = append(imports, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// large reports take minutes, periods are ingested one by one in background
+	go func(db *gorm.DB, imports []*databases.CurImport) {
+		for i, record := range imports {
+			if err := cur.Ingest(db, src, selected[i], record, viper.GetInt("cur.batch_size")); err != nil {
+				log.Printf("[cur] import %v: %v", record.ID, err)
+				services.JobFailed(authUser.CompanyID, authUser.Base.ID, "CUR import "+record.BillingPeriod, err)
+			}
+		}
+	}(co.DB, imports)
+
+	co.Audit(c, "cur.import", 0, nil, params)
+
+	co.SetBody(imports)
+	return
+}
+
+// Imports history
+// @Summary List CUR imports
+// @Description Get CUR imports
+// @Tags CUR
+// @Accept json
+// @Produce json
+// @Success 200 {object} structs.ResponseBody{body=[]databases.CurImport}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /cur/imports [get]
+func (co CurController) Imports(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var imports []databases.CurImport
+	co.DB.Scopes(CompanyScope(co.GetAuth(c))).Order("created_date desc").Find(&imports)
+
+	co.SetBody(imports)
+	return
+}
+
+// LineItems list
+// @Summary List CUR line items
+// @Description Get CUR line items
+// @Tags CUR
+// @Accept json
+// @Produce json
+// @Param filter body form.CurLineItemFilter true "filter"
+// @Success 200 {object} structs.ResponseBody{body=ListCurLineItems}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /cur/lineitems [post]
+func (co CurController) LineItems(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.CurLineItemFilter
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+	if params.Sort.Field == "" {
+		params.Sort = form.SortColumn{Field: "usage_start_date", Order: "desc"}
+	}
+
+	if err := CheckSort(params.Sort, "usage_start_date", "billing_period", "usage_account_id", "service_name", "usage_type", "operation", "region", "resource_id", "line_item_type", "usage_amount", "unblended_cost", "blended_cost"); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	db := co.DB.Model(&databases.CurLineItem{}).Scopes(CompanyScope(co.GetAuth(c)))
+	db = db.Scopes(TableSearch(reflect.ValueOf(params.Filter), params.Sort))
+
+	var count int64
+	db.Count(&count)
+
+	var items []databases.CurLineItem
+	result := db.Scopes(Paginate(params.Page, params.Size)).Find(&items)
+	if result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+
+	co.SetBody(ListCurLineItems{Total: count, List: items})
+	return
+}
+
+// Summary grouped cost
+// @Summary CUR cost summary
+// @Description Sum of cost grouped by column
+// @Tags CUR
+// @Accept json
+// @Produce json
+// @Param summary body form.CurSummaryParams true "summary"
+// @Success 200 {object} structs.ResponseBody{body=[]CurSummaryRow}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /cur/summary [post]
+func (co CurController) Summary(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.CurSummaryParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	column, ok := curGroupColumns[params.GroupBy]
+	if !ok {
+		co.SetError(http.StatusBadRequest, "group_by must be one of "+strings.Join(curGroupKeys(), ", "))
+		return
+	}
+
+	db := co.DB.Model(&databases.CurLineItem{}).Scopes(CompanyScope(co.GetAuth(c)))
+	if params.BillingPeriod != "" {
+		db = db.Where("billing_period = ?", params.BillingPeriod)
+	}
+	if params.StartDate != "" {
+		db = db.Where("usage_start_date >= ?", params.StartDate)
+	}
+	if params.EndDate != "" {
+		db = db.Where("usage_start_date < ?", params.EndDate)
+	}
+
+	v := reflect.ValueOf(params.Filter)
+	for i := 0; i < v.NumField(); i++ {
+		if value := v.Field(i).String(); value != "" {
+			db = db.Where(v.Type().Field(i).Tag.Get("json")+" = ?", value)
+		}
+	}
+
+	var rows []CurSummaryRow
+	result := db.Select(column + " as key, sum(usage_amount) as usage_amount, sum(unblended_cost) as unblended_cost, sum(blended_cost) as blended_cost").
+		Group(column).
+		Order("unblended_cost desc").
+		Scan(&rows)
+	if result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+
+	co.SetBody(rows)
+	return
+}
+
+func curGroupKeys() []string {
+	var keys []string
+	for key := range curGroupColumns {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"net/http"
+	"reflect"
+
+	gin "github.com/gin-gonic/gin"
+	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	form "gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+)
+
+// CurrencyController struct
+type CurrencyController struct {
+	BaseController
+}
+
+// ListExchangeRates ...
+type ListExchangeRates struct {
+	Total int64                    `json:"total"`
+	List  []databases.ExchangeRate `json:"list"`
+}
+
+// ImportExchangeRatesResult ...
+type ImportExchangeRatesResult struct {
+	Count int `json:"count"`
+}
+
+// Init Controller
+func (co CurrencyController) Init(router *gin.RouterGroup) {
+	router.POST("/rates/import", co.Import) // Import rates
+	router.POST("/rates/upload", co.Upload) // CSV upload
+	router.POST("/rates/list", co.List)     // List rates
+	router.PUT("/company", co.Company)      // Display currency of company
+}
+
+// reseller only users of the reseller company maintain exchange rates
+func (co CurrencyController) reseller(c *gin.Context) bool {
+	if !services.IsReseller(co.GetAuth(c)) {
+		co.SetError(http.StatusForbidden, "Хандах эрхгүй")
+		return false
+	}
+	return true
+}
+
+// Import exchange rates
+// @Summary Import exchange rates
+// @Description Creates or updates daily rates by date and currency, 1 USD = rate currency
+// @Tags Currency
+// @Accept json
+// @Produce json
+// @Param rates body form.ExchangeRateImportParams true "rates"
+// @Success 200 {object} structs.ResponseBody{body=ImportExchangeRatesResult}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /currencies/rates/import [post]
+func (co CurrencyController) Import(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.reseller(c) {
+		return
+	}
+
+	var params form.ExchangeRateImportParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	count, err := services.ImportExchangeRates(co.DB, params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "exchange_rate.import", 0, nil, map[string]interface{}{"source": params.Source, "count": count})
+
+	co.SetBody(ImportExchangeRatesResult{Count: count})
+	return
+}
+
+// Upload exchange rates CSV
+// @Summary Upload exchange rates
+// @Description CSV file of date,currency,rate rows, header row is optional
+// @Tags Currency
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "CSV file"
+// @Success 200 {object} structs.ResponseBody{body=ImportExchangeRatesResult}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /currencies/rates/upload [post]
+func (co CurrencyController) Upload(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.reseller(c) {
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+	defer file.Close()
+
+	rates, err := services.ParseExchangeRatesCSV(file)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	count, err := services.ImportExchangeRates(co.DB, form.ExchangeRateImportParams{Source: "csv", Rates: rates})
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "exchange_rate.import", 0, nil, map[string]interface{}{"source": "csv", "file": header.Filename, "count": count})
+
+	co.SetBody(ImportExchangeRatesResult{Count: count})
+	return
+}
+
+// List exchange rates
+// @Summary List exchange rates
+// @Description Stored daily exchange rates, latest first
+// @Tags Currency
+// @Accept json
+// @Produce json
+// @Param filter body form.ExchangeRateFilter true "filter"
+// @Success 200 {object} structs.ResponseBody{body=ListExchangeRates}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /currencies/rates/list [post]
+func (co CurrencyController) List(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.ExchangeRateFilter
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+	if params.Sort.Field == "" {
+		params.Sort = form.SortColumn{Field: "date", Order: "desc"}
+	}
+
+	if err := CheckSort(params.Sort, "date", "currency", "rate", "source", "created_date"); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	db := co.DB.Model(&databases.ExchangeRate{})
+	db = db.Scopes(TableSearch(reflect.ValueOf(params.Filter), params.Sort))
+
+	var count int64
+	db.Count(&count)
+
+	var rates []databases.ExchangeRate
+	result := db.Scopes(Paginate(params.Page, params.Size)).Find(&rates)
+	if result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+
+	co.SetBody(ListExchangeRates{Total: count, List: rates})
+	return
+}
+
+// Company display currency
+// @Summary Company display currency
+// @Description Currency costs and forecasts are shown in unless the request sets one
+// @Tags Currency
+// @Accept json
+// @Produce json
+// @Param currency body form.CompanyCurrencyParams true "currency"
+// @Success 200 {object} structs.ResponseBody{body=databases.Company}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /currencies/company [put]
+func (co CurrencyController) Company(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.CompanyCurrencyParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	authUser := co.GetAuth(c)
+	if authUser.CompanyID == 0 {
+		co.SetError(http.StatusBadRequest, "user has no company")
+		return
+	}
+
+	var before databases.Company
+	co.DB.Limit(1).Find(&before, authUser.CompanyID)
+
+	company, err := services.SetCompanyCurrency(co.DB, authUser.CompanyID, params.Currency)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "company.currency", company.ID, before, company)
+
+	co.SetBody(company)
+	return
+}
@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	gin "github.com/gin-gonic/gin"
+	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	form "gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+	structs "gitlab.com/fibocloud/aws-billing/api_v2/structs"
+	gorm "gorm.io/gorm"
+)
+
+// DashboardController struct
+type DashboardController struct {
+	BaseController
+}
+
+// Init Controller
+func (co DashboardController) Init(router *gin.RouterGroup) {
+	router.GET("/list", co.List)     // List own and shared
+	router.GET("get/:id", co.Get)    // Show
+	router.POST("", co.Create)       // Create
+	router.PUT("/:id", co.Update)    // Update
+	router.DELETE("/:id", co.Delete) // Delete
+	router.GET("/run/:id", co.Run)   // Widget results
+}
+
+// find dashboard visible to auth user, owner only when own is set
+func (co DashboardController) find(c *gin.Context, dashboard *databases.Dashboard, own bool) bool {
+	authUser := co.GetAuth(c)
+	result := services.VisibleRows(co.DB, authUser).Preload("Widgets", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).First(dashboard, c.Param("id"))
+	if result.Error != nil {
+		co.SetError(http.StatusNotFound, "Самбар олдсонгүй")
+		return false
+	}
+	if own && dashboard.UserID != authUser.Base.ID {
+		co.SetError(http.StatusForbidden, "Хандах эрхгүй")
+		return false
+	}
+	return true
+}
+
+// List dashboard
+// @Summary List dashboards
+// @Description Own dashboards and dashboards shared with the company
+// @Tags Dashboard
+// @Accept json
+// @Produce json
+// @Success 200 {object} structs.ResponseBody{body=[]databases.Dashboard}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /dashboards/list [get]
+func (co DashboardController) List(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var dashboards []databases.Dashboard
+	services.VisibleRows(co.DB, co.GetAuth(c)).Preload("Widgets").Order("name").Find(&dashboards)
+
+	co.SetBody(dashboards)
+	return
+}
+
+// Get dashboard
+// @Summary Get dashboard
+// @Description Show dashboard with widgets
+// @Tags Dashboard
+// @Accept json
+// @Produce json
+// @Param id path uint true "dashboard ID"
+// @Success 200 {object} structs.ResponseBody{body=databases.Dashboard}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /dashboards/get/{id} [get]
+func (co DashboardController) Get(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var dashboard databases.Dashboard
+	if !co.find(c, &dashboard, false) {
+		return
+	}
+
+	co.SetBody(dashboard)
+	return
+}
+
+// Create dashboard
+// @Summary Create dashboard
+// @Description Add dashboard of saved query widgets
+// @Tags Dashboard
+// @Accept json
+// @Produce json
+// @Param dashboard body form.DashboardParams true "dashboard"
+// @Success 200 {object} structs.ResponseBody{body=databases.Dashboard}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /dashboards [post]
+func (co DashboardController) Create(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.DashboardParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	authUser := co.GetAuth(c)
+	dashboard := databases.Dashboard{
+		CompanyID: authUser.CompanyID,
+		UserID:    authUser.Base.ID,
+		Base: databases.Base{
+			CreatedDate: time.Now(),
+		},
+	}
+	if err := services.DashboardFromParams(co.DB, authUser, &dashboard, params); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	if result := co.DB.Create(&dashboard); result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+
+	co.Audit(c, "dashboard.create", dashboard.ID, nil, dashboard)
+
+	co.SetBody(dashboard)
+	return
+}
+
+// Update dashboard
+// @Summary Update dashboard
+// @Description Edit own dashboard, widgets are replaced
+// @Tags Dashboard
+// @Accept json
+// @Produce json
+// @Param id path uint true "dashboard ID"
+// @Param dashboard body form.DashboardParams true "dashboard"
+// @Success 200 {object} structs.ResponseBody{body=databases.Dashboard}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /dashboards/{id} [put]
+func (co DashboardController) Update(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.DashboardParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var dashboard databases.Dashboard
+	if !co.find(c, &dashboard, true) {
+		return
+	}
+	before := services.AuditSnapshot(dashboard)
+
+	if err := services.DashboardFromParams(co.DB, co.GetAuth(c), &dashboard, params); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+	dashboard.Base.ModifiedDate = time.Now()
+
+	err := co.DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Where("dashboard_id = ?", dashboard.ID).Delete(&databases.DashboardWidget{}); result.Error != nil {
+			return result.Error
+		}
+		return tx.Session(&gorm.Session{FullSaveAssociations: true}).Save(&dashboard).Error
+	})
+	if err != nil {
+		co.SetError(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	co.Audit(c, "dashboard.update", dashboard.ID, before, dashboard)
+
+	co.SetBody(dashboard)
+	return
+}
+
+// Delete dashboard
+// @Summary Delete dashboard
+// @Description Remove own dashboard, saved queries are kept
+// @Tags Dashboard
+// @Accept json
+// @Produce json
+// @Param id path uint true "dashboard ID"
+// @Success 200 {object} structs.ResponseBody{body=structs.SuccessResponse}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /dashboards/{id} [delete]
+func (co DashboardController) Delete(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var dashboard databases.Dashboard
+	if !co.find(c, &dashboard, true) {
+		return
+	}
+
+	err := co.DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Where("dashboard_id = ?", dashboard.ID).Delete(&databases.DashboardWidget{}); result.Error != nil {
+			return result.Error
+		}
+		return tx.Delete(&dashboard).Error
+	})
+	if err != nil {
+		co.SetError(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	co.Audit(c, "dashboard.delete", dashboard.ID, dashboard, nil)
+
+	co.SetBody(structs.SuccessResponse{
+		Success: true,
+	})
+	return
+}
+
+// Run dashboard
+// @Summary Run dashboard
+// @Description Cost of every widget with relative dates resolved as of today, a failing widget has error set
+// @Tags Dashboard
+// @Accept json
+// @Produce json
+// @Param id path uint true "dashboard ID"
+// @Success 200 {object} structs.ResponseBody{body=[]services.WidgetResult}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /dashboards/run/{id} [get]
+func (co DashboardController) Run(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var dashboard databases.Dashboard
+	if !co.find(c, &dashboard, false) {
+		return
+	}
+
+	co.SetBody(services.RunDashboard(co.DB, dashboard, co.GetAuth(c)))
+	return
+}
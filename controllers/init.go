@@ -2,10 +2,13 @@ package controllers
 
 import (
 	"net/http"
+	"strings"
 
 	gin "github.com/gin-gonic/gin"
 	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	jobs "gitlab.com/fibocloud/aws-billing/api_v2/jobs"
 	middlewares "gitlab.com/fibocloud/aws-billing/api_v2/middlewares"
+	services "gitlab.com/fibocloud/aws-billing/api_v2/services"
 	structs "gitlab.com/fibocloud/aws-billing/api_v2/structs"
 )
 
@@ -23,13 +26,41 @@ func Init(router *gin.RouterGroup) {
 		},
 		DB: db,
 	}
-	AuthController{bc}.Init(router.Group("/auth"))
+	services.ListenWebhooks(db)
+	jobs.Start(db)
+
+	// every IP has a limit before authentication, ratelimit.ip, and every
+	// group has own limit, ratelimit.groups.<name>
+	limiter := services.NewRateLimitStore(db)
+	router.Use(middlewares.IPRateLimit(limiter))
+	AuthController{bc}.Init(router.Group("/auth", middlewares.RateLimit(limiter, "auth")))
 	authRouter := router.Group("")
 	authRouter.Use(middlewares.Authenticate(db))
+	group := func(path string) *gin.RouterGroup {
+		return authRouter.Group(path, middlewares.RateLimit(limiter, strings.TrimPrefix(path, "/")))
+	}
 
 	{
-		UserController{bc}.Init(authRouter.Group("/user"))
-		ConstExplorerController{bc}.Init(authRouter.Group("/aws"))
-		CredentialsController{bc}.Init(authRouter.Group("/credentials"))
+		UserController{bc}.Init(group("/user"))
+		ConstExplorerController{bc}.Init(group("/aws"))
+		CredentialsController{bc}.Init(group("/credentials"))
+		CurController{bc}.Init(group("/cur"))
+		BudgetController{bc}.Init(group("/budgets"))
+		AnomalyController{bc}.Init(group("/anomalies"))
+		AwsAnomalyController{bc}.Init(group("/awsanomalies"))
+		RecommendationController{bc}.Init(group("/recommendations"))
+		CostCategoryController{bc}.Init(group("/costcategories"))
+		AllocationController{bc}.Init(group("/allocations"))
+		InvoiceController{bc}.Init(group("/invoices"))
+		CurrencyController{bc}.Init(group("/currencies"))
+		ReportController{bc}.Init(group("/reports"))
+		SubscriptionController{bc}.Init(group("/subscriptions"))
+		SavedQueryController{bc}.Init(group("/queries"))
+		DashboardController{bc}.Init(group("/dashboards"))
+		WebhookController{bc}.Init(group("/webhooks"))
+		AuditController{bc}.Init(group("/audit"))
+		APIKeyController{bc}.Init(group("/apikeys"))
+		SSOController{bc}.Init(group("/sso"))
+		QuotaController{bc}.Init(group("/quota"))
 	}
 }
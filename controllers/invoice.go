@@ -0,0 +1,400 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	gin "github.com/gin-gonic/gin"
+	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	form "gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+	gorm "gorm.io/gorm"
+)
+
+// InvoiceController struct
+type InvoiceController struct {
+	BaseController
+}
+
+// ListInvoices ...
+type ListInvoices struct {
+	Total int64               `json:"total"`
+	List  []databases.Invoice `json:"list"`
+}
+
+// Init Controller
+func (co InvoiceController) Init(router *gin.RouterGroup) {
+	router.GET("/pricing/:company_id", co.Pricing)     // Pricing rule of company
+	router.PUT("/pricing/:company_id", co.SavePricing) // Create or replace pricing rule
+	router.POST("/generate", co.Generate)              // Draft invoice of month
+	router.POST("/regenerate/:id", co.Regenerate)      // Rebuild draft
+	router.POST("/list", co.List)                      // List
+	router.GET("/get/:id", co.Get)                     // Show
+	router.PUT("/status/:id", co.Status)               // Issue, paid
+	router.GET("/download/:id", co.Download)           // Invoice document
+}
+
+// reseller only users of the reseller company manage pricing and invoices
+func (co InvoiceController) reseller(c *gin.Context) bool {
+	if !services.IsReseller(co.GetAuth(c)) {
+		co.SetError(http.StatusForbidden, "Хандах эрхгүй")
+		return false
+	}
+	return true
+}
+
+// invoice loads invoice visible to the user, customers see their own
+// company's issued invoices only
+func (co InvoiceController) invoice(c *gin.Context, lines bool) (*databases.Invoice, bool) {
+	db := co.DB.Preload("Company")
+	if lines {
+		db = db.Preload("Lines", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position")
+		})
+	}
+	if authUser := co.GetAuth(c); !services.IsReseller(authUser) {
+		db = db.Where("company_id = ? AND status <> ?", authUser.CompanyID, databases.InvoiceDraft)
+	}
+
+	var invoice databases.Invoice
+	if result := db.First(&invoice, c.Param("id")); result.Error != nil {
+		co.SetError(http.StatusNotFound, "Олдсонгүй")
+		return nil, false
+	}
+	return &invoice, true
+}
+
+// costExplorer client when the source needs it
+func (co InvoiceController) costExplorer(c *gin.Context, source string) (costexploreriface.CostExplorerAPI, bool) {
+	if source == services.InvoiceSourceCur {
+		return nil, true
+	}
+	sess, sessError := co.DefaultSvc(co.GetAuth(c).Base.ID)
+	if sessError != nil {
+		co.SetError(http.StatusInternalServerError, sessError.Error())
+		return nil, false
+	}
+	return costexplorer.New(sess), true
+}
+
+// Pricing rule of company
+// @Summary Company pricing rule
+// @Description Markup, discount, per service overrides, fixed fees and credits passthrough of the company
+// @Tags Invoice
+// @Accept json
+// @Produce json
+// @Param company_id path uint true "company ID"
+// @Success 200 {object} structs.ResponseBody{body=databases.PricingRule}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /invoices/pricing/{company_id} [get]
+func (co InvoiceController) Pricing(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.reseller(c) {
+		return
+	}
+
+	companyID, err := strconv.ParseUint(c.Param("company_id"), 10, 64)
+	if err != nil {
+		co.SetError(http.StatusBadRequest, "company_id must be a number")
+		return
+	}
+
+	rule, err := services.GetPricingRule(co.DB, uint(companyID))
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(rule)
+	return
+}
+
+// SavePricing create or replace pricing rule
+// @Summary Save company pricing rule
+// @Description Creates or replaces pricing rule of the company
+// @Tags Invoice
+// @Accept json
+// @Produce json
+// @Param company_id path uint true "company ID"
+// @Param pricing body form.PricingRuleParams true "pricing"
+// @Success 200 {object} structs.ResponseBody{body=databases.PricingRule}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /invoices/pricing/{company_id} [put]
+func (co InvoiceController) SavePricing(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.reseller(c) {
+		return
+	}
+
+	companyID, err := strconv.ParseUint(c.Param("company_id"), 10, 64)
+	if err != nil {
+		co.SetError(http.StatusBadRequest, "company_id must be a number")
+		return
+	}
+
+	var params form.PricingRuleParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rule, err := services.SavePricingRule(co.DB, uint(companyID), params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "pricing_rule.save", rule.ID, nil, rule)
+
+	co.SetBody(rule)
+	return
+}
+
+// Generate draft invoice
+// @Summary Generate invoice
+// @Description Prices AWS cost of the company's accounts for the month into a draft invoice, replaces the previous draft
+// @Tags Invoice
+// @Accept json
+// @Produce json
+// @Param generate body form.InvoiceGenerateParams true "generate"
+// @Success 200 {object} structs.ResponseBody{body=databases.Invoice}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /invoices/generate [post]
+func (co InvoiceController) Generate(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.reseller(c) {
+		return
+	}
+
+	var params form.InvoiceGenerateParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	svc, ok := co.costExplorer(c, params.Source)
+	if !ok {
+		return
+	}
+
+	invoice, err := services.GenerateInvoice(co.DB, svc, co.GetAuth(c), params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "invoice.generate", invoice.ID, nil, invoice)
+
+	co.SetBody(invoice)
+	return
+}
+
+// Regenerate draft invoice
+// @Summary Regenerate invoice
+// @Description Rebuilds draft invoice from current cost and pricing rule
+// @Tags Invoice
+// @Accept json
+// @Produce json
+// @Param id path uint true "invoice ID"
+// @Success 200 {object} structs.ResponseBody{body=databases.Invoice}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /invoices/regenerate/{id} [post]
+func (co InvoiceController) Regenerate(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.reseller(c) {
+		return
+	}
+
+	invoice, ok := co.invoice(c, false)
+	if !ok {
+		return
+	}
+
+	svc, ok := co.costExplorer(c, invoice.Source)
+	if !ok {
+		return
+	}
+
+	regenerated, err := services.GenerateInvoice(co.DB, svc, co.GetAuth(c), form.InvoiceGenerateParams{
+		CompanyID: invoice.CompanyID,
+		Month:     invoice.Month,
+		Source:    invoice.Source,
+	})
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "invoice.regenerate", regenerated.ID, invoice, regenerated)
+
+	co.SetBody(regenerated)
+	return
+}
+
+// List invoices
+// @Summary List invoices
+// @Description Invoices of all companies for the reseller, own company's issued invoices otherwise
+// @Tags Invoice
+// @Accept json
+// @Produce json
+// @Param filter body form.InvoiceFilter true "filter"
+// @Success 200 {object} structs.ResponseBody{body=ListInvoices}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /invoices/list [post]
+func (co InvoiceController) List(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.InvoiceFilter
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := CheckSort(params.Sort, "created_date", "month", "number", "status", "total", "usd_total", "issued_date", "due_date", "paid_date"); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	db := co.DB.Model(&databases.Invoice{}).Preload("Company")
+	if authUser := co.GetAuth(c); !services.IsReseller(authUser) {
+		db = db.Where("company_id = ? AND status <> ?", authUser.CompanyID, databases.InvoiceDraft)
+	}
+	db = db.Scopes(TableSearch(reflect.ValueOf(params.Filter), params.Sort))
+
+	var count int64
+	db.Count(&count)
+
+	var invoices []databases.Invoice
+	result := db.Scopes(Paginate(params.Page, params.Size)).Find(&invoices)
+	if result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+
+	co.SetBody(ListInvoices{Total: count, List: invoices})
+	return
+}
+
+// Get invoice
+// @Summary Invoice
+// @Description Invoice with line items
+// @Tags Invoice
+// @Accept json
+// @Produce json
+// @Param id path uint true "invoice ID"
+// @Success 200 {object} structs.ResponseBody{body=databases.Invoice}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /invoices/get/{id} [get]
+func (co InvoiceController) Get(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	invoice, ok := co.invoice(c, true)
+	if !ok {
+		return
+	}
+
+	co.SetBody(invoice)
+	return
+}
+
+// Status of invoice
+// @Summary Change invoice status
+// @Description Draft to issued assigns the invoice number and due date, issued to paid records payment
+// @Tags Invoice
+// @Accept json
+// @Produce json
+// @Param id path uint true "invoice ID"
+// @Param status body form.InvoiceStatusParams true "status"
+// @Success 200 {object} structs.ResponseBody{body=databases.Invoice}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /invoices/status/{id} [put]
+func (co InvoiceController) Status(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.reseller(c) {
+		return
+	}
+
+	var params form.InvoiceStatusParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	invoice, ok := co.invoice(c, false)
+	if !ok {
+		return
+	}
+
+	before := services.AuditSnapshot(invoice)
+	if err := services.SetInvoiceStatus(co.DB, invoice, params.Status); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "invoice.status", invoice.ID, before, invoice)
+
+	co.SetBody(invoice)
+	return
+}
+
+// Download invoice
+// @Summary Download invoice
+// @Description Printable HTML invoice document
+// @Tags Invoice
+// @Produce html
+// @Param id path uint true "invoice ID"
+// @Success 200 {string} string "invoice document"
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /invoices/download/{id} [get]
+func (co InvoiceController) Download(c *gin.Context) {
+	invoice, ok := co.invoice(c, true)
+	if !ok {
+		c.JSON(co.GetBody())
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := services.RenderInvoice(&buf, *invoice); err != nil {
+		co.SetError(http.StatusInternalServerError, err.Error())
+		c.JSON(co.GetBody())
+		return
+	}
+
+	name := invoice.Number
+	if name == "" {
+		name = "draft-" + invoice.Month
+	}
+	c.Header("Content-Disposition", `attachment; filename="invoice-`+name+`.html"`)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
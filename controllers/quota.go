@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	gin "github.com/gin-gonic/gin"
+	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	form "gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+)
+
+// QuotaController struct
+type QuotaController struct {
+	BaseController
+}
+
+// Init Controller
+func (co QuotaController) Init(router *gin.RouterGroup) {
+	router.GET("", co.Usage)                    // Usage of auth company
+	router.GET("/companies", co.Companies)      // Usage of all companies
+	router.PUT("/companies/:id", co.SetCompany) // Quota of company
+}
+
+// Usage Cost Explorer requests
+// @Summary Cost Explorer quota usage
+// @Description Cost Explorer requests and monthly quota of the company for the last months, quota -1 is unlimited
+// @Tags Quota
+// @Accept json
+// @Produce json
+// @Param months query int false "months, default 6"
+// @Success 200 {object} structs.ResponseBody{body=[]services.CostExplorerQuotaUsage}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /quota [get]
+func (co QuotaController) Usage(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	months := 6
+	if value := c.Query("months"); value != "" {
+		var err error
+		if months, err = strconv.Atoi(value); err != nil || months < 1 || months > 24 {
+			co.SetError(http.StatusBadRequest, "months must be 1 to 24")
+			return
+		}
+	}
+
+	report, err := services.CostExplorerUsageReport(co.DB, co.GetAuth(c), months)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(report)
+	return
+}
+
+// Companies Cost Explorer requests
+// @Summary Cost Explorer usage of companies
+// @Description Cost Explorer requests of every company in the month, reseller only
+// @Tags Quota
+// @Accept json
+// @Produce json
+// @Param month query string false "YYYY-MM, default current month"
+// @Success 200 {object} structs.ResponseBody{body=[]services.CostExplorerQuotaUsage}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /quota/companies [get]
+func (co QuotaController) Companies(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !services.IsReseller(co.GetAuth(c)) {
+		co.SetError(http.StatusForbidden, "Хандах эрхгүй")
+		return
+	}
+
+	month := c.Query("month")
+	if month == "" {
+		month = time.Now().Format("2006-01")
+	} else if _, err := time.Parse("2006-01", month); err != nil {
+		co.SetError(http.StatusBadRequest, "month must be YYYY-MM")
+		return
+	}
+
+	report, err := services.CompanyCostExplorerUsage(co.DB, month)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(report)
+	return
+}
+
+// SetCompany Cost Explorer quota
+// @Summary Set company quota
+// @Description Monthly Cost Explorer requests of the company, 0 uses the configured default and -1 is unlimited. Reseller only.
+// @Tags Quota
+// @Accept json
+// @Produce json
+// @Param id path uint true "company ID"
+// @Param quota body form.CostExplorerQuotaParams true "quota"
+// @Success 200 {object} structs.ResponseBody{body=databases.Company}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /quota/companies/{id} [put]
+func (co QuotaController) SetCompany(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.CostExplorerQuotaParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !services.IsReseller(co.GetAuth(c)) {
+		co.SetError(http.StatusForbidden, "Хандах эрхгүй")
+		return
+	}
+
+	var before databases.Company
+	if result := co.DB.Limit(1).Find(&before, c.Param("id")); result.RowsAffected == 0 {
+		co.SetError(http.StatusNotFound, "Байгууллага олдсонгүй")
+		return
+	}
+
+	company, err := services.SetCostExplorerQuota(co.DB, before.ID, params.CostExplorer)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "company.quota", company.ID, before, company)
+
+	co.SetBody(company)
+	return
+}
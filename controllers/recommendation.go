@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	gin "github.com/gin-gonic/gin"
+	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	form "gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+	gorm "gorm.io/gorm"
+)
+
+// RecommendationController struct
+type RecommendationController struct {
+	BaseController
+}
+
+// ListRecommendationFetches ...
+type ListRecommendationFetches struct {
+	Total int64                           `json:"total"`
+	List  []databases.RecommendationFetch `json:"list"`
+}
+
+// Init Controller
+func (co RecommendationController) Init(router *gin.RouterGroup) {
+	router.POST("/purchase", co.Purchase)  // Fetch purchase recommendations
+	router.POST("/history", co.History)    // Fetch history
+	router.GET("/history/:id", co.Compare) // Fetch with change since previous
+}
+
+// Purchase recommendations
+// @Summary Purchase recommendations
+// @Description Savings plans or reserved instance purchase recommendations ranked by estimated monthly savings, stored for history
+// @Tags Recommendation
+// @Accept json
+// @Produce json
+// @Param purchase body form.PurchaseRecommendationParams true "purchase"
+// @Success 200 {object} structs.ResponseBody{body=databases.RecommendationFetch}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /recommendations/purchase [post]
+func (co RecommendationController) Purchase(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.PurchaseRecommendationParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+	authUser := co.GetAuth(c)
+
+	sess, sessError := co.DefaultSvc(authUser.Base.ID)
+	if sessError != nil {
+		co.SetError(http.StatusInternalServerError, sessError.Error())
+		return
+	}
+
+	fetch, err := services.PurchaseRecommendations(co.DB, costexplorer.New(sess), authUser, params)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "recommendation.fetch", fetch.ID, nil, params)
+
+	co.SetBody(fetch)
+	return
+}
+
+// History of recommendations
+// @Summary Recommendation history
+// @Description Stored recommendation fetches without items
+// @Tags Recommendation
+// @Accept json
+// @Produce json
+// @Param filter body form.RecommendationFilter true "filter"
+// @Success 200 {object} structs.ResponseBody{body=ListRecommendationFetches}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /recommendations/history [post]
+func (co RecommendationController) History(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.RecommendationFilter
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := CheckSort(params.Sort, "created_date", "generation_date", "kind", "service", "term", "payment_option", "count", "total_monthly_savings", "total_upfront_cost"); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	db := co.DB.Model(&databases.RecommendationFetch{}).Scopes(CompanyScope(co.GetAuth(c)))
+	db = db.Scopes(TableSearch(reflect.ValueOf(params.Filter), params.Sort))
+
+	var count int64
+	db.Count(&count)
+
+	var fetches []databases.RecommendationFetch
+	result := db.Scopes(Paginate(params.Page, params.Size)).Find(&fetches)
+	if result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+
+	co.SetBody(ListRecommendationFetches{Total: count, List: fetches})
+	return
+}
+
+// Compare recommendations
+// @Summary Recommendation fetch
+// @Description Stored fetch with ranked items and change since the previous fetch of the same options
+// @Tags Recommendation
+// @Accept json
+// @Produce json
+// @Param id path uint true "fetch ID"
+// @Success 200 {object} structs.ResponseBody{body=services.RecommendationChange}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /recommendations/history/{id} [get]
+func (co RecommendationController) Compare(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var fetch databases.RecommendationFetch
+	result := co.DB.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("rank")
+	}).Scopes(CompanyScope(co.GetAuth(c))).First(&fetch, c.Param("id"))
+	if result.Error != nil {
+		co.SetError(http.StatusNotFound, "Олдсонгүй")
+		return
+	}
+
+	change, err := services.CompareRecommendations(co.DB, fetch)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(change)
+	return
+}
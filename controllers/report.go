@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	gin "github.com/gin-gonic/gin"
+	form "gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/report"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+)
+
+// ReportController struct
+type ReportController struct {
+	BaseController
+}
+
+// Init Controller
+func (co ReportController) Init(router *gin.RouterGroup) {
+	router.POST("/monthly", co.Monthly) // Monthly PDF report
+}
+
+// Monthly report
+// @Summary Monthly cost report
+// @Description PDF of month total, month over month change, top services, daily spend, forecast and budgets of the company or one linked account
+// @Tags Report
+// @Accept json
+// @Produce application/pdf
+// @Param report body form.MonthlyReportParams true "report"
+// @Success 200 {file} file "PDF report"
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /reports/monthly [post]
+func (co ReportController) Monthly(c *gin.Context) {
+	var params form.MonthlyReportParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		c.JSON(co.GetBody())
+		return
+	}
+	authUser := co.GetAuth(c)
+
+	sess, sessError := co.DefaultSvc(authUser.Base.ID)
+	if sessError != nil {
+		co.SetError(http.StatusInternalServerError, sessError.Error())
+		c.JSON(co.GetBody())
+		return
+	}
+
+	data, err := services.MonthlyReport(co.DB, costexplorer.New(sess), authUser, params)
+	if err != nil {
+		co.SetServiceError(err)
+		c.JSON(co.GetBody())
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := report.RenderMonthly(&buf, *data); err != nil {
+		co.SetError(http.StatusInternalServerError, err.Error())
+		c.JSON(co.GetBody())
+		return
+	}
+
+	name := "cost-report-" + params.Month
+	if params.LinkedAccount != "" {
+		name += "-" + params.LinkedAccount
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+name+`.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	gin "github.com/gin-gonic/gin"
+	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	form "gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+	structs "gitlab.com/fibocloud/aws-billing/api_v2/structs"
+)
+
+// SavedQueryController struct
+type SavedQueryController struct {
+	BaseController
+}
+
+// SavedQueryResult ...
+type SavedQueryResult struct {
+	StartDate string                          `json:"start_date"`
+	EndDate   string                          `json:"end_date"`
+	Result    *services.ConvertedCostAndUsage `json:"result"`
+}
+
+// Init Controller
+func (co SavedQueryController) Init(router *gin.RouterGroup) {
+	router.GET("/list", co.List)     // List own and shared
+	router.GET("get/:id", co.Get)    // Show
+	router.POST("", co.Create)       // Create
+	router.PUT("/:id", co.Update)    // Update
+	router.DELETE("/:id", co.Delete) // Delete
+	router.GET("/run/:id", co.Run)   // Run with resolved dates
+}
+
+// find saved query visible to auth user, owner only when own is set
+func (co SavedQueryController) find(c *gin.Context, query *databases.SavedQuery, own bool) bool {
+	authUser := co.GetAuth(c)
+	result := services.VisibleRows(co.DB, authUser).First(query, c.Param("id"))
+	if result.Error != nil {
+		co.SetError(http.StatusNotFound, "Хайлт олдсонгүй")
+		return false
+	}
+	if own && query.UserID != authUser.Base.ID {
+		co.SetError(http.StatusForbidden, "Хандах эрхгүй")
+		return false
+	}
+	return true
+}
+
+// List saved query
+// @Summary List saved queries
+// @Description Own saved queries and queries shared with the company
+// @Tags SavedQuery
+// @Accept json
+// @Produce json
+// @Success 200 {object} structs.ResponseBody{body=[]databases.SavedQuery}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /queries/list [get]
+func (co SavedQueryController) List(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var queries []databases.SavedQuery
+	services.VisibleRows(co.DB, co.GetAuth(c)).Order("name").Find(&queries)
+
+	co.SetBody(queries)
+	return
+}
+
+// Get saved query
+// @Summary Get saved query
+// @Description Show saved query
+// @Tags SavedQuery
+// @Accept json
+// @Produce json
+// @Param id path uint true "saved query ID"
+// @Success 200 {object} structs.ResponseBody{body=databases.SavedQuery}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /queries/get/{id} [get]
+func (co SavedQueryController) Get(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var query databases.SavedQuery
+	if !co.find(c, &query, false) {
+		return
+	}
+
+	co.SetBody(query)
+	return
+}
+
+// Create saved query
+// @Summary Create saved query
+// @Description Save cost query, date_range is resolved each time the query runs
+// @Tags SavedQuery
+// @Accept json
+// @Produce json
+// @Param query body form.SavedQueryParams true "query"
+// @Success 200 {object} structs.ResponseBody{body=databases.SavedQuery}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /queries [post]
+func (co SavedQueryController) Create(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.SavedQueryParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	authUser := co.GetAuth(c)
+	query := databases.SavedQuery{
+		CompanyID: authUser.CompanyID,
+		UserID:    authUser.Base.ID,
+		Base: databases.Base{
+			CreatedDate: time.Now(),
+		},
+	}
+	if err := services.SavedQueryFromParams(&query, params); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+	if err := services.ValidateSavedQuery(query); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	if result := co.DB.Create(&query); result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+
+	co.Audit(c, "saved_query.create", query.ID, nil, query)
+
+	co.SetBody(query)
+	return
+}
+
+// Update saved query
+// @Summary Update saved query
+// @Description Edit own saved query
+// @Tags SavedQuery
+// @Accept json
+// @Produce json
+// @Param id path uint true "saved query ID"
+// @Param query body form.SavedQueryParams true "query"
+// @Success 200 {object} structs.ResponseBody{body=databases.SavedQuery}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /queries/{id} [put]
+func (co SavedQueryController) Update(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.SavedQueryParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var query databases.SavedQuery
+	if !co.find(c, &query, true) {
+		return
+	}
+	before := services.AuditSnapshot(query)
+
+	if err := services.SavedQueryFromParams(&query, params); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+	if err := services.ValidateSavedQuery(query); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+	query.Base.ModifiedDate = time.Now()
+
+	if result := co.DB.Save(&query); result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+
+	co.Audit(c, "saved_query.update", query.ID, before, query)
+
+	co.SetBody(query)
+	return
+}
+
+// Delete saved query
+// @Summary Delete saved query
+// @Description Remove own saved query that is not used by a dashboard
+// @Tags SavedQuery
+// @Accept json
+// @Produce json
+// @Param id path uint true "saved query ID"
+// @Success 200 {object} structs.ResponseBody{body=structs.SuccessResponse}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /queries/{id} [delete]
+func (co SavedQueryController) Delete(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var query databases.SavedQuery
+	if !co.find(c, &query, true) {
+		return
+	}
+
+	var widgets int64
+	co.DB.Model(&databases.DashboardWidget{}).Where("saved_query_id = ?", query.ID).Count(&widgets)
+	if widgets > 0 {
+		co.SetError(http.StatusBadRequest, "saved query is used by dashboard")
+		return
+	}
+
+	if result := co.DB.Delete(&query); result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+
+	co.Audit(c, "saved_query.delete", query.ID, query, nil)
+
+	co.SetBody(structs.SuccessResponse{
+		Success: true,
+	})
+	return
+}
+
+// Run saved query
+// @Summary Run saved query
+// @Description Cost of the saved query with relative date range resolved as of today
+// @Tags SavedQuery
+// @Accept json
+// @Produce json
+// @Param id path uint true "saved query ID"
+// @Success 200 {object} structs.ResponseBody{body=SavedQueryResult}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /queries/run/{id} [get]
+func (co SavedQueryController) Run(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var query databases.SavedQuery
+	if !co.find(c, &query, false) {
+		return
+	}
+
+	params, result, err := services.RunSavedQuery(co.DB, query, co.GetAuth(c))
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(SavedQueryResult{StartDate: params.StartDate, EndDate: params.EndDate, Result: result})
+	return
+}
@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	gin "github.com/gin-gonic/gin"
+	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	form "gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+	structs "gitlab.com/fibocloud/aws-billing/api_v2/structs"
+)
+
+// SSOController struct
+type SSOController struct {
+	BaseController
+}
+
+// Init Controller
+func (co SSOController) Init(router *gin.RouterGroup) {
+	router.GET("", co.Get)                         // Show
+	router.PUT("", co.Save)                        // Create or replace
+	router.DELETE("", co.Delete)                   // Delete
+	router.POST("/link/start", co.LinkStart)       // Start linking auth user
+	router.POST("/link/callback", co.LinkCallback) // Finish linking auth user
+}
+
+// admin only company admins configure single sign-on
+func (co SSOController) admin(c *gin.Context) bool {
+	authUser := co.GetAuth(c)
+	if !services.IsAdmin(authUser) {
+		co.SetError(http.StatusForbidden, "Хандах эрхгүй")
+		return false
+	}
+	return true
+}
+
+// Get SSO provider
+// @Summary Get single sign-on provider
+// @Description OpenID Connect provider of auth user's company, client secret is not returned
+// @Tags SSO
+// @Accept json
+// @Produce json
+// @Success 200 {object} structs.ResponseBody{body=databases.SSOProvider}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /sso [get]
+func (co SSOController) Get(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.admin(c) {
+		return
+	}
+
+	var provider databases.SSOProvider
+	if result := co.DB.Where("company_id = ?", co.GetAuth(c).CompanyID).First(&provider); result.Error != nil {
+		co.SetError(http.StatusNotFound, "SSO тохиргоо олдсонгүй")
+		return
+	}
+
+	co.SetBody(provider)
+	return
+}
+
+// Save SSO provider
+// @Summary Save single sign-on provider
+// @Description Create or replace OpenID Connect provider of the company. Register /auth/sso/callback page of the dashboard as redirect URI at the provider.
+// @Tags SSO
+// @Accept json
+// @Produce json
+// @Param provider body form.SSOProviderParams true "provider"
+// @Success 200 {object} structs.ResponseBody{body=databases.SSOProvider}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /sso [put]
+func (co SSOController) Save(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.admin(c) {
+		return
+	}
+
+	var params form.SSOProviderParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	authUser := co.GetAuth(c)
+	now := time.Now()
+	provider := databases.SSOProvider{
+		CompanyID: authUser.CompanyID,
+		Base:      databases.Base{CreatedDate: now},
+	}
+	co.DB.Where("company_id = ?", authUser.CompanyID).Limit(1).Find(&provider)
+	before := services.AuditSnapshot(provider)
+	if provider.ID == 0 {
+		before = nil
+	}
+
+	if err := services.SSOProviderFromParams(&provider, params); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+	if provider.ClientSecret == "" {
+		co.SetServiceError(services.NewParamError("client_secret", "is required"))
+		return
+	}
+
+	provider.Base.ModifiedDate = now
+	if result := co.DB.Save(&provider); result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+	co.Audit(c, "sso_provider.save", provider.ID, before, provider)
+
+	co.SetBody(provider)
+	return
+}
+
+// Delete SSO provider
+// @Summary Delete single sign-on provider
+// @Description Remove provider, single sign-on stops working for the company
+// @Tags SSO
+// @Accept json
+// @Produce json
+// @Success 200 {object} structs.ResponseBody{body=structs.SuccessResponse}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /sso [delete]
+func (co SSOController) Delete(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.admin(c) {
+		return
+	}
+
+	var provider databases.SSOProvider
+	if result := co.DB.Where("company_id = ?", co.GetAuth(c).CompanyID).First(&provider); result.Error != nil {
+		co.SetError(http.StatusNotFound, "SSO тохиргоо олдсонгүй")
+		return
+	}
+
+	if result := co.DB.Delete(&provider); result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+	co.Audit(c, "sso_provider.delete", provider.ID, provider, nil)
+
+	co.SetBody(structs.SuccessResponse{
+		Success: true,
+	})
+	return
+}
+
+// LinkStart SSO identity
+// @Summary Start linking single sign-on
+// @Description Authorization URL of the company's identity provider to link its identity to auth user. Existing accounts sign in with single sign-on after linking.
+// @Tags SSO
+// @Accept json
+// @Produce json
+// @Param link body form.SSOLinkParams true "link"
+// @Success 200 {object} structs.ResponseBody{body=SSOStartResult}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /sso/link/start [post]
+func (co SSOController) LinkStart(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.SSOLinkParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	authUser := co.GetAuth(c)
+	if authUser.CompanyID == 0 {
+		co.SetError(http.StatusNotFound, services.ErrSSONotConfigured.Error())
+		return
+	}
+	provider, err := services.FindSSOProvider(co.DB, form.SSOStartParams{CompanyID: authUser.CompanyID})
+	if err == services.ErrSSONotConfigured {
+		co.SetError(http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	authorizationURL, err := services.StartSSO(co.DB, *provider, form.SSOStartParams{
+		Email:       authUser.Email,
+		CompanyID:   authUser.CompanyID,
+		RedirectURI: params.RedirectURI,
+	}, authUser.ID)
+	if err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.SetBody(SSOStartResult{AuthorizationURL: authorizationURL})
+	return
+}
+
+// LinkCallback SSO identity
+// @Summary Finish linking single sign-on
+// @Description Links identity of the identity provider redirect to auth user, login has to be started by the same user
+// @Tags SSO
+// @Accept json
+// @Produce json
+// @Param sso body form.SSOCallbackParams true "SSO"
+// @Success 200 {object} structs.ResponseBody{body=structs.SuccessResponse}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /sso/link/callback [post]
+func (co SSOController) LinkCallback(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var params form.SSOCallbackParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sso, err := services.FinishSSO(co.DB, params, co.GetAuth(c).ID)
+	if err != nil {
+		co.SetError(http.StatusUnauthorized, err.Error())
+		return
+	}
+	if sso.Linked {
+		co.Audit(c, "user.sso_link", sso.User.ID, nil, map[string]interface{}{"company_id": sso.User.CompanyID})
+	}
+
+	co.SetBody(structs.SuccessResponse{
+		Success: true,
+	})
+	return
+}
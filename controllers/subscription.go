@@ -0,0 +1,304 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	gin "github.com/gin-gonic/gin"
+	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	form "gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+	structs "gitlab.com/fibocloud/aws-billing/api_v2/structs"
+	gorm "gorm.io/gorm"
+)
+
+// SubscriptionController struct
+type SubscriptionController struct {
+	BaseController
+}
+
+// Init Controller
+func (co SubscriptionController) Init(router *gin.RouterGroup) {
+	router.GET("/list", co.List)                 // List
+	router.GET("get/:id", co.Get)                // Show
+	router.POST("", co.Create)                   // Create
+	router.PUT("/:id", co.Update)                // Update
+	router.DELETE("/:id", co.Delete)             // Delete
+	router.POST("/run/:id", co.Run)              // Deliver now
+	router.GET("/deliveries/:id", co.Deliveries) // Delivery history
+}
+
+// find subscription of auth user's company
+func (co SubscriptionController) find(c *gin.Context, subscription *databases.ReportSubscription) bool {
+	result := co.DB.Scopes(CompanyScope(co.GetAuth(c))).First(subscription, c.Param("id"))
+	if result.Error != nil {
+		co.SetError(http.StatusNotFound, "Захиалга олдсонгүй")
+		return false
+	}
+	return true
+}
+
+// List subscription
+// @Summary List report subscriptions
+// @Description Get report subscriptions
+// @Tags Subscription
+// @Accept json
+// @Produce json
+// @Success 200 {object} structs.ResponseBody{body=[]databases.ReportSubscription}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /subscriptions/list [get]
+func (co SubscriptionController) List(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var subscriptions []databases.ReportSubscription
+	co.DB.Scopes(CompanyScope(co.GetAuth(c))).Order("created_date desc").Find(&subscriptions)
+
+	co.SetBody(subscriptions)
+	return
+}
+
+// Get subscription
+// @Summary Get report subscription
+// @Description Show report subscription
+// @Tags Subscription
+// @Accept json
+// @Produce json
+// @Param id path uint true "subscription ID"
+// @Success 200 {object} structs.ResponseBody{body=databases.ReportSubscription}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /subscriptions/get/{id} [get]
+func (co SubscriptionController) Get(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var subscription databases.ReportSubscription
+	if !co.find(c, &subscription) {
+		return
+	}
+
+	co.SetBody(subscription)
+	return
+}
+
+// save validates subscription, schedules its next run and saves it
+func (co SubscriptionController) save(subscription *databases.ReportSubscription, params form.ReportSubscriptionParams) bool {
+	if err := services.SubscriptionFromParams(subscription, params); err != nil {
+		co.SetServiceError(err)
+		return false
+	}
+	if err := services.ValidateSubscription(*subscription); err != nil {
+		co.SetServiceError(err)
+		return false
+	}
+	if err := services.ScheduleNext(subscription, time.Now()); err != nil {
+		co.SetServiceError(err)
+		return false
+	}
+
+	if result := co.DB.Save(subscription); result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return false
+	}
+	return true
+}
+
+// Create subscription
+// @Summary Create report subscription
+// @Description Add scheduled report, schedule is cron in timezone or database.timezone, company admin only
+// @Tags Subscription
+// @Accept json
+// @Produce json
+// @Param subscription body form.ReportSubscriptionParams true "subscription"
+// @Success 200 {object} structs.ResponseBody{body=databases.ReportSubscription}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 403 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /subscriptions [post]
+func (co SubscriptionController) Create(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.checkManager(c) {
+		return
+	}
+
+	var params form.ReportSubscriptionParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	authUser := co.GetAuth(c)
+	subscription := databases.ReportSubscription{
+		CompanyID: authUser.CompanyID,
+		UserID:    authUser.Base.ID,
+		Base: databases.Base{
+			CreatedDate: time.Now(),
+		},
+	}
+	if !co.save(&subscription, params) {
+		return
+	}
+
+	co.Audit(c, "subscription.create", subscription.ID, nil, subscription)
+
+	co.SetBody(subscription)
+	return
+}
+
+// Update subscription
+// @Summary Update report subscription
+// @Description Edit scheduled report, next run is recalculated, company admin only
+// @Tags Subscription
+// @Accept json
+// @Produce json
+// @Param id path uint true "subscription ID"
+// @Param subscription body form.ReportSubscriptionParams true "subscription"
+// @Success 200 {object} structs.ResponseBody{body=databases.ReportSubscription}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 403 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /subscriptions/{id} [put]
+func (co SubscriptionController) Update(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.checkManager(c) {
+		return
+	}
+
+	var params form.ReportSubscriptionParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var subscription databases.ReportSubscription
+	if !co.find(c, &subscription) {
+		return
+	}
+	before := services.AuditSnapshot(subscription)
+
+	subscription.Base.ModifiedDate = time.Now()
+	if !co.save(&subscription, params) {
+		return
+	}
+
+	co.Audit(c, "subscription.update", subscription.ID, before, subscription)
+
+	co.SetBody(subscription)
+	return
+}
+
+// Delete subscription
+// @Summary Delete report subscription
+// @Description Remove scheduled report and its delivery history, company admin only
+// @Tags Subscription
+// @Accept json
+// @Produce json
+// @Param id path uint true "subscription ID"
+// @Success 200 {object} structs.ResponseBody{body=structs.SuccessResponse}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 403 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /subscriptions/{id} [delete]
+func (co SubscriptionController) Delete(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.checkManager(c) {
+		return
+	}
+
+	var subscription databases.ReportSubscription
+	if !co.find(c, &subscription) {
+		return
+	}
+
+	err := co.DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Where("subscription_id = ?", subscription.ID).Delete(&databases.ReportDelivery{}); result.Error != nil {
+			return result.Error
+		}
+		return tx.Delete(&subscription).Error
+	})
+	if err != nil {
+		co.SetError(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	co.Audit(c, "subscription.delete", subscription.ID, subscription, nil)
+
+	co.SetBody(structs.SuccessResponse{
+		Success: true,
+	})
+	return
+}
+
+// Run subscription
+// @Summary Deliver report now
+// @Description Renders and delivers the report outside its schedule, failures are retried like scheduled runs
+// @Tags Subscription
+// @Accept json
+// @Produce json
+// @Param id path uint true "subscription ID"
+// @Success 200 {object} structs.ResponseBody{body=databases.ReportDelivery}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /subscriptions/run/{id} [post]
+func (co SubscriptionController) Run(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var subscription databases.ReportSubscription
+	if !co.find(c, &subscription) {
+		return
+	}
+
+	// delivery error is kept in the delivery history
+	delivery, err := services.RunSubscription(co.DB, subscription, time.Now(), false)
+	if delivery == nil {
+		co.SetError(http.StatusInternalServerError, err.Error())
+		return
+	}
+	co.Audit(c, "subscription.run", subscription.ID, nil, delivery)
+
+	co.SetBody(delivery)
+	return
+}
+
+// Deliveries of subscription
+// @Summary Report delivery history
+// @Description Deliveries of the subscription with attempts and failures, latest first
+// @Tags Subscription
+// @Accept json
+// @Produce json
+// @Param id path uint true "subscription ID"
+// @Success 200 {object} structs.ResponseBody{body=[]databases.ReportDelivery}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /subscriptions/deliveries/{id} [get]
+func (co SubscriptionController) Deliveries(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var subscription databases.ReportSubscription
+	if !co.find(c, &subscription) {
+		return
+	}
+
+	var deliveries []databases.ReportDelivery
+	co.DB.Where("subscription_id = ?", subscription.ID).Order("created_date desc").Limit(100).Find(&deliveries)
+
+	co.SetBody(deliveries)
+	return
+}
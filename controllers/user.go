@@ -8,8 +8,10 @@ import (
 	gin "github.com/gin-gonic/gin"
 	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
 	form "gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
 	structs "gitlab.com/fibocloud/aws-billing/api_v2/structs"
 	utils "gitlab.com/fibocloud/aws-billing/api_v2/utils"
+	gorm "gorm.io/gorm"
 )
 
 // UserController struct
@@ -25,12 +27,13 @@ type ListSystemUsers struct {
 
 // Init Controller
 func (co UserController) Init(router *gin.RouterGroup) {
-	router.POST("/list", co.List)    // List
-	router.GET("get/:id", co.Get)    // Show
-	router.POST("", co.Create)       // Create
-	router.PUT("/:id", co.Update)    // Update
-	router.DELETE("/:id", co.Delete) // Delete
-	router.GET("/me", co.Me)         // Me
+	router.POST("/list", co.List)        // List
+	router.GET("get/:id", co.Get)        // Show
+	router.POST("", co.Create)           // Create
+	router.PUT("/:id", co.Update)        // Update
+	router.DELETE("/:id", co.Delete)     // Delete
+	router.GET("/me", co.Me)             // Me
+	router.PUT("/:id/unlock", co.Unlock) // Unlock login
 }
 
 // List systemUser
@@ -56,12 +59,18 @@ func (co UserController) List(c *gin.Context) {
 		return
 	}
 
-	db := co.DB
+	if err := CheckSort(params.Sort, "created_date", "email", "role", "is_active"); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	db := co.DB.Model(&databases.SystemUser{}).Scopes(userScope(co.GetAuth(c)))
 
 	// filter hiij bgaa heseg
 	v := reflect.ValueOf(params.Filter)
 
 	db = db.Scopes(TableSearch(v, params.Sort))
+	db.Count(&count)
 	db = db.Scopes(Paginate(params.Page, params.Size))
 
 	var listRepsonse ListSystemUsers
@@ -69,8 +78,6 @@ func (co UserController) List(c *gin.Context) {
 	var systemUsers []databases.SystemUser
 	db.Find(&systemUsers)
 
-	db.Table("med_base_systemUser").Count(&count)
-
 	listRepsonse.List = systemUsers
 	listRepsonse.Total = count
 
@@ -95,9 +102,8 @@ func (co UserController) Get(c *gin.Context) {
 	}()
 
 	var systemUser databases.SystemUser
-	result := co.DB.First(&systemUser, c.Param("id"))
-	if result.Error != nil {
-		co.SetError(http.StatusInternalServerError, result.Error.Error())
+	if result := co.DB.Scopes(userScope(co.GetAuth(c))).Limit(1).Find(&systemUser, c.Param("id")); result.RowsAffected == 0 {
+		co.SetError(http.StatusNotFound, "Хэрэглэгч олдсонгүй")
 		return
 	}
 
@@ -107,13 +113,14 @@ func (co UserController) Get(c *gin.Context) {
 
 // Create systemUser
 // @Summary Create systemUser
-// @Description Add systemUser
+// @Description Add systemUser to the company, company admin only
 // @Tags SystemUser
 // @Accept json
 // @Produce json
 // @Param systemUser body form.SystemUserParams true "systemUser"
 // @Success 200 {object} structs.ResponseBody{body=structs.SuccessResponse}
 // @Failure 400 {object} structs.ErrorResponse
+// @Failure 403 {object} structs.ErrorResponse
 // @Failure 500 {object} structs.ErrorResponse
 // @Router /systemUser [post]
 func (co UserController) Create(c *gin.Context) {
@@ -127,6 +134,16 @@ func (co UserController) Create(c *gin.Context) {
 		return
 	}
 
+	// company admins add users to their company
+	authUser := co.GetAuth(c)
+	if !services.IsAdmin(authUser) {
+		co.SetError(http.StatusForbidden, "Хандах эрхгүй")
+		return
+	}
+	if !co.checkRole(c, params.Role, databases.SystemUser{Role: databases.RoleMember, CompanyID: authUser.CompanyID}) {
+		return
+	}
+
 	hashPwd, err := utils.GenerateHash(params.Password)
 	if err != nil {
 		co.SetError(http.StatusInternalServerError, err.Error())
@@ -134,19 +151,25 @@ func (co UserController) Create(c *gin.Context) {
 	}
 
 	systemUser := databases.SystemUser{
-		IsActive: params.IsActive,
-		Email:    params.Email,
-		Password: hashPwd,
+		IsActive:  params.IsActive,
+		Email:     params.Email,
+		Password:  hashPwd,
+		Role:      databases.RoleMember,
+		CompanyID: authUser.CompanyID,
 		Base: databases.Base{
 			CreatedDate: time.Now(),
 		},
 	}
+	if params.Role != "" {
+		systemUser.Role = params.Role
+	}
 
 	result := co.DB.Create(&systemUser)
 	if result.Error != nil {
 		co.SetError(http.StatusInternalServerError, result.Error.Error())
 		return
 	}
+	co.Audit(c, "user.create", systemUser.ID, nil, systemUser)
 
 	co.SetBody(structs.SuccessResponse{
 		Success: true,
@@ -184,8 +207,23 @@ func (co UserController) Update(c *gin.Context) {
 		return
 	}
 
+	// users edit themselves, company admins edit users of their company
+	authUser := co.GetAuth(c)
+	if systemUser.ID != authUser.ID && !(services.IsAdmin(authUser) && systemUser.CompanyID == authUser.CompanyID) {
+		co.SetError(http.StatusForbidden, "Хандах эрхгүй")
+		return
+	}
+
+	if !co.checkRole(c, params.Role, systemUser) {
+		return
+	}
+
+	before := services.AuditSnapshot(systemUser)
 	systemUser.IsActive = params.IsActive
 	systemUser.Email = params.Email
+	if params.Role != "" {
+		systemUser.Role = params.Role
+	}
 
 	systemUser.Base.ModifiedDate = time.Now()
 
@@ -194,6 +232,7 @@ func (co UserController) Update(c *gin.Context) {
 		co.SetError(http.StatusInternalServerError, result.Error.Error())
 		return
 	}
+	co.Audit(c, "user.update", systemUser.ID, before, systemUser)
 
 	co.SetBody(structs.SuccessResponse{
 		Success: true,
@@ -203,13 +242,14 @@ func (co UserController) Update(c *gin.Context) {
 
 // Delete systemUser
 // @Summary Delete systemUser
-// @Description Remove systemUser
+// @Description Remove systemUser of the company, company admin only
 // @Tags SystemUser
 // @Accept json
 // @Produce json
 // @Param systemUser body form.DeleteParams true "systemUser"
 // @Success 200 {object} structs.ResponseBody{body=structs.SuccessResponse}
 // @Failure 400 {object} structs.ErrorResponse
+// @Failure 403 {object} structs.ErrorResponse
 // @Failure 500 {object} structs.ErrorResponse
 // @Router /systemUser/{id} [delete]
 func (co UserController) Delete(c *gin.Context) {
@@ -223,12 +263,24 @@ func (co UserController) Delete(c *gin.Context) {
 		return
 	}
 
+	// company admins delete users of their company
+	authUser := co.GetAuth(c)
+	if !services.IsAdmin(authUser) {
+		co.SetError(http.StatusForbidden, "Хандах эрхгүй")
+		return
+	}
+
 	for _, v := range params.IDs {
+		var systemUser databases.SystemUser
+		if result := co.DB.Where("company_id = ?", authUser.CompanyID).Limit(1).Find(&systemUser, v); result.RowsAffected == 0 {
+			continue
+		}
 		result := co.DB.Delete(&databases.SystemUser{}, v)
 		if result.Error != nil {
 			co.SetError(http.StatusInternalServerError, result.Error.Error())
 			return
 		}
+		co.Audit(c, "user.delete", v, systemUser, nil)
 	}
 
 	co.SetBody(structs.SuccessResponse{
@@ -238,6 +290,76 @@ func (co UserController) Delete(c *gin.Context) {
 	return
 }
 
+// Unlock systemUser login
+// @Summary Unlock login
+// @Description Remove lockout and failed login attempts of company user, company admin only
+// @Tags SystemUser
+// @Accept json
+// @Produce json
+// @Param id path uint true "systemUser ID"
+// @Success 200 {object} structs.ResponseBody{body=structs.SuccessResponse}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 403 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /user/{id}/unlock [put]
+func (co UserController) Unlock(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var systemUser databases.SystemUser
+	if result := co.DB.Limit(1).Find(&systemUser, c.Param("id")); result.RowsAffected == 0 {
+		co.SetError(http.StatusNotFound, "Хэрэглэгч олдсонгүй")
+		return
+	}
+
+	authUser := co.GetAuth(c)
+	if !services.IsAdmin(authUser) || systemUser.CompanyID != authUser.CompanyID {
+		co.SetError(http.StatusForbidden, "Хандах эрхгүй")
+		return
+	}
+
+	if err := services.UnlockLogin(co.DB, systemUser.Email); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	co.Audit(c, "user.unlock", systemUser.Base.ID, nil, nil)
+
+	co.SetBody(structs.SuccessResponse{
+		Success: true,
+	})
+	return
+}
+
+// userScope users of the company, users without company see themselves
+func userScope(user databases.SystemUser) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if user.CompanyID != 0 {
+			return db.Where("company_id = ?", user.CompanyID)
+		}
+		return db.Where("id = ?", user.Base.ID)
+	}
+}
+
+// checkRole role can be changed by admin of the target's company only,
+// target has the role before change
+func (co UserController) checkRole(c *gin.Context, role string, target databases.SystemUser) bool {
+	if role == "" || role == target.Role {
+		return true
+	}
+	if err := services.ValidateRole(role); err != nil {
+		co.SetServiceError(err)
+		return false
+	}
+	authUser := co.GetAuth(c)
+	if !services.IsAdmin(authUser) || target.CompanyID != authUser.CompanyID {
+		co.SetError(http.StatusForbidden, "Хандах эрхгүй")
+		return false
+	}
+	return true
+}
+
 // Me get auth systemUser
 // @Summary Get auth
 // @Description Show auth
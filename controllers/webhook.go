@@ -0,0 +1,361 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	gin "github.com/gin-gonic/gin"
+	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	form "gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/notifications"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+	structs "gitlab.com/fibocloud/aws-billing/api_v2/structs"
+	gorm "gorm.io/gorm"
+)
+
+// WebhookController struct
+type WebhookController struct {
+	BaseController
+}
+
+// WebhookSecret webhook with its signing secret, returned on create and rotate only
+type WebhookSecret struct {
+	databases.Webhook
+	Secret string `json:"secret"`
+}
+
+// Init Controller
+func (co WebhookController) Init(router *gin.RouterGroup) {
+	router.GET("/list", co.List)                 // List
+	router.GET("get/:id", co.Get)                // Show
+	router.POST("", co.Create)                   // Create
+	router.PUT("/:id", co.Update)                // Update
+	router.DELETE("/:id", co.Delete)             // Delete
+	router.POST("/rotate/:id", co.Rotate)        // New secret
+	router.POST("/test/:id", co.Test)            // Test fire
+	router.GET("/deliveries/:id", co.Deliveries) // Delivery log
+}
+
+// find webhook of auth user's company
+func (co WebhookController) find(c *gin.Context, webhook *databases.Webhook) bool {
+	result := co.DB.Scopes(CompanyScope(co.GetAuth(c))).First(webhook, c.Param("id"))
+	if result.Error != nil {
+		co.SetError(http.StatusNotFound, "Webhook олдсонгүй")
+		return false
+	}
+	return true
+}
+
+// List webhook
+// @Summary List webhooks
+// @Description Get webhooks of the company
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Success 200 {object} structs.ResponseBody{body=[]databases.Webhook}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /webhooks/list [get]
+func (co WebhookController) List(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var webhooks []databases.Webhook
+	co.DB.Scopes(CompanyScope(co.GetAuth(c))).Order("created_date desc").Find(&webhooks)
+
+	co.SetBody(webhooks)
+	return
+}
+
+// Get webhook
+// @Summary Get webhook
+// @Description Show webhook, secret is not returned
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param id path uint true "webhook ID"
+// @Success 200 {object} structs.ResponseBody{body=databases.Webhook}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /webhooks/get/{id} [get]
+func (co WebhookController) Get(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var webhook databases.Webhook
+	if !co.find(c, &webhook) {
+		return
+	}
+
+	co.SetBody(webhook)
+	return
+}
+
+// Create webhook
+// @Summary Create webhook
+// @Description Register endpoint for events, payloads are signed with the returned secret which is shown only once, company admin only
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param webhook body form.WebhookParams true "webhook"
+// @Success 200 {object} structs.ResponseBody{body=WebhookSecret}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 403 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /webhooks [post]
+func (co WebhookController) Create(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.checkManager(c) {
+		return
+	}
+
+	var params form.WebhookParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	authUser := co.GetAuth(c)
+	webhook := databases.Webhook{
+		CompanyID: authUser.CompanyID,
+		UserID:    authUser.Base.ID,
+		Base: databases.Base{
+			CreatedDate: time.Now(),
+		},
+	}
+	if err := services.WebhookFromParams(&webhook, params); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+	secret, err := services.NewWebhookSecret()
+	if err != nil {
+		co.SetError(http.StatusInternalServerError, err.Error())
+		return
+	}
+	webhook.Secret = secret
+
+	if result := co.DB.Create(&webhook); result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+
+	co.Audit(c, "webhook.create", webhook.ID, nil, webhook)
+
+	co.SetBody(WebhookSecret{Webhook: webhook, Secret: secret})
+	return
+}
+
+// Update webhook
+// @Summary Update webhook
+// @Description Edit webhook, secret is kept, company admin only
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param id path uint true "webhook ID"
+// @Param webhook body form.WebhookParams true "webhook"
+// @Success 200 {object} structs.ResponseBody{body=databases.Webhook}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 403 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /webhooks/{id} [put]
+func (co WebhookController) Update(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.checkManager(c) {
+		return
+	}
+
+	var params form.WebhookParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		co.SetError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var webhook databases.Webhook
+	if !co.find(c, &webhook) {
+		return
+	}
+	before := services.AuditSnapshot(webhook)
+	if err := services.WebhookFromParams(&webhook, params); err != nil {
+		co.SetServiceError(err)
+		return
+	}
+
+	webhook.Base.ModifiedDate = time.Now()
+	if result := co.DB.Save(&webhook); result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+
+	co.Audit(c, "webhook.update", webhook.ID, before, webhook)
+
+	co.SetBody(webhook)
+	return
+}
+
+// Delete webhook
+// @Summary Delete webhook
+// @Description Remove webhook and its delivery log, company admin only
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param id path uint true "webhook ID"
+// @Success 200 {object} structs.ResponseBody{body=structs.SuccessResponse}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 403 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /webhooks/{id} [delete]
+func (co WebhookController) Delete(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.checkManager(c) {
+		return
+	}
+
+	var webhook databases.Webhook
+	if !co.find(c, &webhook) {
+		return
+	}
+
+	err := co.DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Where("webhook_id = ?", webhook.ID).Delete(&databases.WebhookDelivery{}); result.Error != nil {
+			return result.Error
+		}
+		return tx.Delete(&webhook).Error
+	})
+	if err != nil {
+		co.SetError(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	co.Audit(c, "webhook.delete", webhook.ID, webhook, nil)
+
+	co.SetBody(structs.SuccessResponse{
+		Success: true,
+	})
+	return
+}
+
+// Rotate webhook secret
+// @Summary Rotate webhook secret
+// @Description Replace signing secret, the old one stops working immediately, company admin only
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param id path uint true "webhook ID"
+// @Success 200 {object} structs.ResponseBody{body=WebhookSecret}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 403 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /webhooks/rotate/{id} [post]
+func (co WebhookController) Rotate(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	if !co.checkManager(c) {
+		return
+	}
+
+	var webhook databases.Webhook
+	if !co.find(c, &webhook) {
+		return
+	}
+
+	secret, err := services.NewWebhookSecret()
+	if err != nil {
+		co.SetError(http.StatusInternalServerError, err.Error())
+		return
+	}
+	result := co.DB.Model(&webhook).Updates(map[string]interface{}{"secret": secret, "modified_date": time.Now()})
+	if result.Error != nil {
+		co.SetError(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+
+	co.Audit(c, "webhook.rotate_secret", webhook.ID, nil, map[string]interface{}{"secret": "rotated"})
+
+	co.SetBody(WebhookSecret{Webhook: webhook, Secret: secret})
+	return
+}
+
+// Test webhook
+// @Summary Test fire webhook
+// @Description Sends signed webhook.test event now, test deliveries are not retried
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param id path uint true "webhook ID"
+// @Success 200 {object} structs.ResponseBody{body=databases.WebhookDelivery}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /webhooks/test/{id} [post]
+func (co WebhookController) Test(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var webhook databases.Webhook
+	if !co.find(c, &webhook) {
+		return
+	}
+
+	authUser := co.GetAuth(c)
+	delivery, err := services.QueueWebhook(co.DB, webhook, notifications.Notification{
+		Event:     services.EventWebhookTest,
+		CompanyID: webhook.CompanyID,
+		UserID:    authUser.Base.ID,
+		Subject:   "Test webhook " + webhook.Name,
+		Message:   "Webhook is configured correctly.",
+		Data:      map[string]interface{}{"webhook_id": webhook.ID},
+		Date:      time.Now(),
+	}, true)
+	if err != nil {
+		co.SetError(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// response code and error of the endpoint are in the delivery
+	services.DeliverWebhook(co.DB, webhook, delivery)
+	co.Audit(c, "webhook.test", webhook.ID, nil, delivery)
+
+	co.SetBody(delivery)
+	return
+}
+
+// Deliveries of webhook
+// @Summary Webhook delivery log
+// @Description Deliveries with response codes and attempts, latest first
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param id path uint true "webhook ID"
+// @Success 200 {object} structs.ResponseBody{body=[]databases.WebhookDelivery}
+// @Failure 400 {object} structs.ErrorResponse
+// @Failure 500 {object} structs.ErrorResponse
+// @Router /webhooks/deliveries/{id} [get]
+func (co WebhookController) Deliveries(c *gin.Context) {
+	defer func() {
+		c.JSON(co.GetBody())
+	}()
+
+	var webhook databases.Webhook
+	if !co.find(c, &webhook) {
+		return
+	}
+
+	var deliveries []databases.WebhookDelivery
+	co.DB.Where("webhook_id = ?", webhook.ID).Order("created_date desc").Limit(100).Find(&deliveries)
+
+	co.SetBody(deliveries)
+	return
+}
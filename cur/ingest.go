@@ -0,0 +1,246 @@
+package cur
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	gorm "gorm.io/gorm"
+)
+
+// Import statuses
+const (
+	ImportRunning = "running"
+	ImportSuccess = "success"
+	ImportFailed  = "failed"
+)
+
+// columnFields canonical column => line item field
+var columnFields = map[string]func(item *databases.CurLineItem, value string){
+	"identity_line_item_id":           func(item *databases.CurLineItem, value string) { item.LineItemID = value },
+	"line_item_line_item_type":        func(item *databases.CurLineItem, value string) { item.LineItemType = value },
+	"line_item_usage_account_id":      func(item *databases.CurLineItem, value string) { item.UsageAccountID = value },
+	"line_item_usage_start_date":      func(item *databases.CurLineItem, value string) { item.UsageStartDate, _ = parseTime(value) },
+	"line_item_usage_end_date":        func(item *databases.CurLineItem, value string) { item.UsageEndDate, _ = parseTime(value) },
+	"line_item_product_code":          func(item *databases.CurLineItem, value string) { item.ProductCode = value },
+	"product_product_name":            func(item *databases.CurLineItem, value string) { item.ServiceName = value },
+	"line_item_usage_type":            func(item *databases.CurLineItem, value string) { item.UsageType = value },
+	"line_item_operation":             func(item *databases.CurLineItem, value string) { item.Operation = value },
+	"product_region":                  func(item *databases.CurLineItem, value string) { item.Region = value },
+	"line_item_resource_id":           func(item *databases.CurLineItem, value string) { item.ResourceID = value },
+	"line_item_line_item_description": func(item *databases.CurLineItem, value string) { item.Description = value },
+	"line_item_usage_amount":          func(item *databases.CurLineItem, value string) { item.UsageAmount = parseFloat(value) },
+	"line_item_unblended_cost":        func(item *databases.CurLineItem, value string) { item.UnblendedCost = parseFloat(value) },
+	"line_item_blended_cost":          func(item *databases.CurLineItem, value string) { item.BlendedCost = parseFloat(value) },
+	"line_item_currency_code":         func(item *databases.CurLineItem, value string) { item.CurrencyCode = value },
+}
+
+// LineItem maps report row to line item
+func LineItem(row Row) databases.CurLineItem {
+	var item databases.CurLineItem
+	tags := map[string]string{}
+	for column, value := range row {
+		if setter, ok := columnFields[column]; ok {
+			setter(&item, value)
+			continue
+		}
+		if strings.HasPrefix(column, TagPrefix) {
+			tags[strings.TrimPrefix(column, TagPrefix)] = value
+		}
+	}
+	if item.ServiceName == "" {
+		item.ServiceName = item.ProductCode
+	}
+	if len(tags) > 0 {
+		if data, err := json.Marshal(tags); err == nil {
+			item.Tags = string(data)
+		}
+	}
+	return item
+}
+
+// ErrImportRunning import of the billing period has not finished
+var ErrImportRunning = errors.New("import of the billing period is running")
+
+// runningTimeout running imports older than this are treated as stopped,
+// the server was restarted during the import
+const runningTimeout = 6 * time.Hour
+
+// runningKey one import of the period runs at a time per company, or per
+// user without company
+func runningKey(user databases.SystemUser, billingPeriod string) string {
+	if user.CompanyID != 0 {
+		return fmt.Sprintf("company_%v/%v", user.CompanyID, billingPeriod)
+	}
+	return fmt.Sprintf("user_%v/%v", user.Base.ID, billingPeriod)
+}
+
+// NewImport import record of the period, running until Ingest finishes.
+// ErrImportRunning when an import of the period is running, unique
+// running_key keeps parallel requests from starting two.
+func NewImport(db *gorm.DB, user databases.SystemUser, src Source, period *Period) (*databases.CurImport, error) {
+	now := time.Now()
+	key := runningKey(user, period.BillingPeriod)
+	record := databases.CurImport{
+		UserID:        user.Base.ID,
+		CompanyID:     user.CompanyID,
+		Source:        sourceName(src),
+		Location:      src.Location(),
+		BillingPeriod: period.BillingPeriod,
+		AssemblyID:    period.AssemblyID,
+		Format:        period.Format,
+		Files:         len(period.Keys),
+		Status:        ImportRunning,
+		RunningKey:    &key,
+		Base: databases.Base{
+			CreatedDate: now,
+		},
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&databases.CurImport{}).
+			Where("running_key = ? AND created_date <= ?", key, now.Add(-runningTimeout)).
+			Updates(map[string]interface{}{"status": ImportFailed, "error_msg": "import stopped", "running_key": nil, "finished_date": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		if Running(db, user, period.BillingPeriod) {
+			return nil, ErrImportRunning
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Running import of the billing period has not finished
+func Running(db *gorm.DB, user databases.SystemUser, billingPeriod string) bool {
+	var count int64
+	db.Model(&databases.CurImport{}).
+		Where("running_key = ? AND created_date > ?", runningKey(user, billingPeriod), time.Now().Add(-runningTimeout)).
+		Count(&count)
+	return count > 0
+}
+
+// Ingest replaces line items of the billing period with the period's report
+// files. Rows of the previous import are removed in the same transaction, so
+// running the same period twice is safe.
+func Ingest(db *gorm.DB, src Source, period *Period, record *databases.CurImport, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	owner := ownerScope(record)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Scopes(owner).Where("billing_period = ?", period.BillingPeriod).Delete(&databases.CurLineItem{})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		for _, key := range period.Keys {
+			rows, err := ingestFile(tx, src, key, *record, batchSize)
+			record.Rows += rows
+			if err != nil {
+				return fmt.Errorf("%v: %v", key, err)
+			}
+		}
+		return nil
+	})
+
+	now := time.Now()
+	record.FinishedDate = &now
+	record.ModifiedDate = now
+	record.Status = ImportSuccess
+	record.RunningKey = nil
+	if err != nil {
+		record.Status = ImportFailed
+		record.ErrorMsg = err.Error()
+		record.Rows = 0
+	}
+	db.Save(record)
+	return err
+}
+
+func ingestFile(tx *gorm.DB, src Source, key string, record databases.CurImport, batchSize int) (int64, error) {
+	reader, err := NewRowReader(src, key)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	var count int64
+	batch := make([]databases.CurLineItem, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if result := tx.Create(&batch); result.Error != nil {
+			return result.Error
+		}
+		count += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+
+		item := LineItem(row)
+		item.UserID = record.UserID
+		item.CompanyID = record.CompanyID
+		item.BillingPeriod = record.BillingPeriod
+		item.ImportID = record.ID
+		batch = append(batch, item)
+
+		if len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, flush()
+}
+
+// ownerScope line items of the import's company, or of the user without
+// company
+func ownerScope(record *databases.CurImport) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if record.CompanyID != 0 {
+			return db.Where("company_id = ?", record.CompanyID)
+		}
+		return db.Where("user_id = ?", record.UserID)
+	}
+}
+
+func sourceName(src Source) string {
+	if _, ok := src.(*S3Source); ok {
+		return "s3"
+	}
+	return "local"
+}
+
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+func parseFloat(value string) float64 {
+	f, _ := strconv.ParseFloat(value, 64)
+	return f
+}
@@ -0,0 +1,346 @@
+package cur
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xitongsys/parquet-go/writer"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gorm.io/driver/sqlite"
+	gorm "gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB in memory sqlite of the test with CUR tables
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%v?mode=memory&cache=shared", name)), &gorm.Config{
+		DisableForeignKeyConstraintWhenMigrating: true,
+		Logger:                                   logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&databases.CurImport{}, &databases.CurLineItem{}); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// parquetRow columns of a parquet CUR file
+type parquetRow struct {
+	LineItemID     string  `parquet:"name=identity_line_item_id, type=UTF8"`
+	UsageAccountID string  `parquet:"name=line_item_usage_account_id, type=UTF8"`
+	UsageStartDate int64   `parquet:"name=line_item_usage_start_date, type=TIMESTAMP_MILLIS"`
+	ProductCode    string  `parquet:"name=line_item_product_code, type=UTF8"`
+	UnblendedCost  float64 `parquet:"name=line_item_unblended_cost, type=DOUBLE"`
+	Team           string  `parquet:"name=resource_tags_user_team, type=UTF8"`
+}
+
+func writeFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeReports CSV report of 2021-01 with manifest and parquet partition of
+// 2021-02 with rows line items of 0.01
+func writeReports(t *testing.T, dir string, rows int) {
+	t.Helper()
+	var csv bytes.Buffer
+	gz := gzip.NewWriter(&csv)
+	gz.Write([]byte("identity/LineItemId,lineItem/UsageAccountId,lineItem/UsageStartDate,lineItem/ProductCode,lineItem/UnblendedCost,resourceTags/user:Team\n" +
+		"a1,111111111111,2021-01-01T00:00:00Z,AmazonEC2,1.5,web\n" +
+		"a2,111111111111,2021-01-02T00:00:00Z,AmazonS3,2.5,\n"))
+	gz.Close()
+	writeFile(t, filepath.Join(dir, "report/20210101-20210201/abc/report-1.csv.gz"), csv.Bytes())
+
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"assemblyId":    "abc",
+		"bucket":        "bucket",
+		"contentType":   "text/csv",
+		"reportKeys":    []string{"report/20210101-20210201/abc/report-1.csv.gz"},
+		"billingPeriod": map[string]string{"start": "20210101T000000.000Z", "end": "20210201T000000.000Z"},
+	})
+	writeFile(t, filepath.Join(dir, "report/20210101-20210201/report-Manifest.json"), manifest)
+
+	var parquet bytes.Buffer
+	pw, err := writer.NewParquetWriterFromWriter(&parquet, new(parquetRow), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw.RowGroupSize = 16 * 1024
+	start := time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < rows; i++ {
+		row := parquetRow{
+			LineItemID:     fmt.Sprintf("b%v", i),
+			UsageAccountID: "222222222222",
+			UsageStartDate: start.Add(time.Duration(i%28)*24*time.Hour).UnixNano() / int64(time.Millisecond),
+			ProductCode:    "AmazonRDS",
+			UnblendedCost:  0.01,
+			Team:           "db",
+		}
+		if err := pw.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "report/year=2021/month=2/part-0.parquet"), parquet.Bytes())
+}
+
+// importer company user running the test imports
+var importer = databases.SystemUser{Base: databases.Base{ID: 2}, CompanyID: 1}
+
+// ingestAll imports every period found in src
+func ingestAll(t *testing.T, db *gorm.DB, src Source) []*databases.CurImport {
+	t.Helper()
+	periods, err := Discover(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var imports []*databases.CurImport
+	for _, period := range periods {
+		record, err := NewImport(db, importer, src, period)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if Running(db, importer, period.BillingPeriod) != true {
+			t.Fatal("new import is not running")
+		}
+		if err := Ingest(db, src, period, record, 100); err != nil {
+			t.Fatal(err)
+		}
+		imports = append(imports, record)
+	}
+	return imports
+}
+
+// checkImports line items of writeReports
+func checkImports(t *testing.T, db *gorm.DB, imports []*databases.CurImport, rows int) {
+	t.Helper()
+	if len(imports) != 2 || imports[0].BillingPeriod != "2021-01" || imports[1].BillingPeriod != "2021-02" {
+		t.Fatalf("unexpected imports %+v", imports)
+	}
+	for _, record := range imports {
+		if record.Status != ImportSuccess || record.CompanyID != importer.CompanyID || Running(db, importer, record.BillingPeriod) {
+			t.Fatalf("import %v not finished: %v %v", record.BillingPeriod, record.Status, record.ErrorMsg)
+		}
+	}
+	if imports[0].Rows != 2 || imports[1].Rows != int64(rows) {
+		t.Fatalf("unexpected rows %v %v", imports[0].Rows, imports[1].Rows)
+	}
+
+	var items []databases.CurLineItem
+	db.Where("billing_period = ?", "2021-02").Order("id").Find(&items)
+	if len(items) != rows {
+		t.Fatalf("expected %v line items, got %v", rows, len(items))
+	}
+	last := items[rows-1]
+	if last.LineItemID != fmt.Sprintf("b%v", rows-1) || last.ServiceName != "AmazonRDS" || last.Tags != `{"user_team":"db"}` ||
+		!last.UsageStartDate.Equal(time.Date(2021, 2, 1+(rows-1)%28, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected line item %+v", last)
+	}
+
+	var total float64
+	db.Model(&databases.CurLineItem{}).Where("billing_period = ?", "2021-01").Select("sum(unblended_cost)").Scan(&total)
+	if total != 4 {
+		t.Fatalf("expected 2021-01 cost 4, got %v", total)
+	}
+}
+
+func TestIngestDirSource(t *testing.T) {
+	root := t.TempDir()
+	writeReports(t, filepath.Join(root, "company_1"), 2500)
+	db := testDB(t)
+
+	src, err := NewDirSource(filepath.Join(root, "company_1"), "report", "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImports(t, db, ingestAll(t, db, src), 2500)
+
+	// import again replaces rows of the company's period only
+	db.Create(&databases.CurLineItem{UserID: 3, CompanyID: 2, BillingPeriod: "2021-02"})
+	ingestAll(t, db, src)
+	var count int64
+	db.Model(&databases.CurLineItem{}).Where("company_id = ?", importer.CompanyID).Count(&count)
+	if count != 2502 {
+		t.Fatalf("expected 2502 line items after reimport, got %v", count)
+	}
+	db.Model(&databases.CurLineItem{}).Where("company_id = ?", 2).Count(&count)
+	if count != 1 {
+		t.Fatalf("reimport removed line items of other company")
+	}
+}
+
+func TestNewImportRunning(t *testing.T) {
+	root := t.TempDir()
+	writeReports(t, root, 10)
+	db := testDB(t)
+	src, err := NewDirSource(root, "report", "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	periods, err := Discover(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	period := periods[0]
+
+	record, err := NewImport(db, importer, src, period)
+	if err != nil {
+		t.Fatal(err)
+	}
+	colleague := databases.SystemUser{Base: databases.Base{ID: 3}, CompanyID: importer.CompanyID}
+	if _, err := NewImport(db, colleague, src, period); err != ErrImportRunning {
+		t.Fatalf("expected running import of the company, got %v", err)
+	}
+	if _, err := NewImport(db, databases.SystemUser{Base: databases.Base{ID: 4}}, src, period); err != nil {
+		t.Fatalf("user without company was blocked: %v", err)
+	}
+
+	if err := Ingest(db, src, period, record, 100); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := NewImport(db, colleague, src, period)
+	if err != nil {
+		t.Fatalf("finished import still blocks: %v", err)
+	}
+
+	// import left running by a restart stops blocking after the timeout
+	db.Model(stale).Update("created_date", time.Now().Add(-runningTimeout-time.Minute))
+	if _, err := NewImport(db, importer, src, period); err != nil {
+		t.Fatalf("stale import still blocks: %v", err)
+	}
+	db.First(stale, stale.ID)
+	if stale.Status != ImportFailed || stale.RunningKey != nil {
+		t.Fatalf("stale import was not stopped %+v", stale)
+	}
+}
+
+func TestNewDirSourceStaysInRoot(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "company_1", "report"), 0755)
+	os.MkdirAll(filepath.Join(root, "company_2", "report"), 0755)
+	tenant := filepath.Join(root, "company_1")
+
+	for _, dir := range []string{"../company_2", "../../", "/company_2", "report/../../company_2"} {
+		src, err := NewDirSource(tenant, dir, "")
+		if err == nil && !strings.HasPrefix(src.Root, tenant) {
+			t.Errorf("%q escaped to %v", dir, src.Root)
+		}
+	}
+}
+
+// fakeS3 path style S3 stand-in serving files of dir, records Range headers
+type fakeS3 struct {
+	dir    string
+	mu     sync.Mutex
+	ranges []string
+	full   []string // objects downloaded without range
+}
+
+type listBucketResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string
+	IsTruncated bool
+	Contents    []struct{ Key string }
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if parts[0] != "bucket" {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	if len(parts) == 1 || parts[1] == "" {
+		result := listBucketResult{Name: "bucket"}
+		prefix := r.URL.Query().Get("prefix")
+		filepath.Walk(s.dir, func(p string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				key, _ := filepath.Rel(s.dir, p)
+				if key = filepath.ToSlash(key); strings.HasPrefix(key, prefix) {
+					result.Contents = append(result.Contents, struct{ Key string }{key})
+				}
+			}
+			return nil
+		})
+		w.Header().Set("Content-Type", "application/xml")
+		xml.NewEncoder(w).Encode(result)
+		return
+	}
+
+	file, err := os.Open(filepath.Join(s.dir, filepath.FromSlash(parts[1])))
+	if err != nil {
+		http.Error(w, "NoSuchKey", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+	info, _ := file.Stat()
+	if r.Method == http.MethodGet {
+		s.mu.Lock()
+		if value := r.Header.Get("Range"); value != "" {
+			s.ranges = append(s.ranges, value)
+		} else {
+			s.full = append(s.full, parts[1])
+		}
+		s.mu.Unlock()
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+func TestIngestS3Source(t *testing.T) {
+	dir := t.TempDir()
+	writeReports(t, dir, 2500)
+	s3 := &fakeS3{dir: dir}
+	server := httptest.NewServer(s3)
+	defer server.Close()
+
+	// several ranged requests per column chunk
+	defer func(size int64) { s3BlockSize = size }(s3BlockSize)
+	s3BlockSize = 1024
+
+	src, err := NewS3Source(nil, S3Config{
+		Bucket:    "bucket",
+		Prefix:    "report",
+		Endpoint:  server.URL,
+		AccessKey: "key",
+		SecretKey: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := testDB(t)
+	checkImports(t, db, ingestAll(t, db, src), 2500)
+
+	for _, key := range s3.full {
+		if strings.HasSuffix(key, ".parquet") {
+			t.Fatalf("parquet file %v was downloaded whole", key)
+		}
+	}
+	if len(s3.ranges) < 2 {
+		t.Fatalf("expected ranged requests, got %v", s3.ranges)
+	}
+}
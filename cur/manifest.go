@@ -0,0 +1,171 @@
+package cur
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format of report files
+const (
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+type (
+	// Manifest CUR manifest json
+	Manifest struct {
+		AssemblyID    string   `json:"assemblyId"`
+		Account       string   `json:"account"`
+		Bucket        string   `json:"bucket"`
+		ReportName    string   `json:"reportName"`
+		Compression   string   `json:"compression"`
+		ContentType   string   `json:"contentType"`
+		ReportKeys    []string `json:"reportKeys"`
+		BillingPeriod struct {
+			Start string `json:"start"`
+			End   string `json:"end"`
+		} `json:"billingPeriod"`
+		Columns []struct {
+			Category string `json:"category"`
+			Name     string `json:"name"`
+		} `json:"columns"`
+	}
+
+	// Period billing period with its report files
+	Period struct {
+		BillingPeriod string   `json:"billing_period"` // 2021-01
+		AssemblyID    string   `json:"assembly_id"`
+		Format        string   `json:"format"`
+		Keys          []string `json:"keys"`
+	}
+)
+
+var (
+	manifestDir      = regexp.MustCompile(`(^|/)(\d{8})-(\d{8})/[^/]+-Manifest\.json$`)
+	parquetPartition = regexp.MustCompile(`(^|/)year=(\d{4})/month=(\d{1,2})/[^/]+\.parquet$`)
+)
+
+// ParseManifest read manifest json
+func ParseManifest(r io.Reader) (*Manifest, error) {
+	var manifest Manifest
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if len(manifest.ReportKeys) == 0 {
+		return nil, fmt.Errorf("manifest %v has no report keys", manifest.AssemblyID)
+	}
+	return &manifest, nil
+}
+
+// Period billing period of manifest
+func (m *Manifest) Period(base string) (*Period, error) {
+	start, err := parsePeriodStart(m.BillingPeriod.Start)
+	if err != nil {
+		return nil, err
+	}
+
+	format := FormatCSV
+	if strings.Contains(strings.ToLower(m.ContentType), "parquet") {
+		format = FormatParquet
+	}
+
+	period := &Period{
+		BillingPeriod: start.Format("2006-01"),
+		AssemblyID:    m.AssemblyID,
+		Format:        format,
+	}
+	for _, key := range m.ReportKeys {
+		period.Keys = append(period.Keys, relativeKey(base, m.Bucket, key))
+	}
+	return period, nil
+}
+
+// Discover finds billing periods in source. Manifests are preferred; parquet
+// partitions (year=/month=) are used when no manifest covers the period.
+func Discover(src Source) ([]*Period, error) {
+	keys, err := src.List()
+	if err != nil {
+		return nil, err
+	}
+
+	periods := map[string]*Period{}
+	for _, key := range keys {
+		if !manifestDir.MatchString(key) {
+			continue
+		}
+
+		reader, err := src.Open(key)
+		if err != nil {
+			return nil, err
+		}
+		manifest, err := ParseManifest(reader)
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", key, err)
+		}
+
+		period, err := manifest.Period(src.Base())
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", key, err)
+		}
+		periods[period.BillingPeriod] = period
+	}
+
+	partitions := map[string]*Period{}
+	for _, key := range keys {
+		match := parquetPartition.FindStringSubmatch(key)
+		if match == nil {
+			continue
+		}
+		month, _ := strconv.Atoi(match[3])
+		billingPeriod := fmt.Sprintf("%v-%02d", match[2], month)
+		if _, ok := periods[billingPeriod]; ok {
+			continue
+		}
+		if _, ok := partitions[billingPeriod]; !ok {
+			partitions[billingPeriod] = &Period{BillingPeriod: billingPeriod, Format: FormatParquet}
+		}
+		partitions[billingPeriod].Keys = append(partitions[billingPeriod].Keys, key)
+	}
+
+	var result []*Period
+	for _, period := range periods {
+		result = append(result, period)
+	}
+	for _, period := range partitions {
+		sort.Strings(period.Keys)
+		result = append(result, period)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].BillingPeriod < result[j].BillingPeriod
+	})
+	return result, nil
+}
+
+// parsePeriodStart manifest date 20210101T000000.000Z
+func parsePeriodStart(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405.000Z", "20060102T150405Z", time.RFC3339, "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid billing period start %q", value)
+}
+
+// relativeKey manifest keys are absolute within the bucket; make them
+// relative to the source base so a local copy of the bucket works as well.
+func relativeKey(base, bucket, key string) string {
+	key = strings.TrimPrefix(key, "s3://"+bucket+"/")
+	base = strings.Trim(base, "/")
+	if base != "" && strings.HasPrefix(key, base+"/") {
+		return strings.TrimPrefix(key, base+"/")
+	}
+	return path.Clean(key)
+}
@@ -0,0 +1,253 @@
+package cur
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// Row line item values by canonical column name (line_item_usage_account_id)
+type Row map[string]string
+
+// RowReader reads line items from one report file
+type RowReader interface {
+	Read() (Row, error) // io.EOF at the end
+	Close() error
+}
+
+// TagPrefix canonical prefix of resource tag columns
+const TagPrefix = "resource_tags_"
+
+// CanonicalColumn converts both CSV (lineItem/UsageAccountId) and parquet
+// (line_item_usage_account_id) column names to the same snake case name.
+func CanonicalColumn(name string) string {
+	var b strings.Builder
+	runes := []rune(strings.TrimSpace(name))
+	for i, r := range runes {
+		switch {
+		case r == '/' || r == ':' || r == '-' || r == ' ' || r == '.':
+			b.WriteRune('_')
+		case unicode.IsUpper(r):
+			if i > 0 {
+				prev := runes[i-1]
+				nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+				if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+					b.WriteRune('_')
+				}
+			}
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return strings.Trim(strings.Replace(b.String(), "__", "_", -1), "_")
+}
+
+// NewRowReader opens report file by its format
+func NewRowReader(src Source, key string) (RowReader, error) {
+	if strings.HasSuffix(strings.ToLower(key), ".parquet") {
+		file, err := src.OpenFile(key)
+		if err != nil {
+			return nil, err
+		}
+		return newParquetReader(file)
+	}
+
+	file, err := src.Open(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCSVReader(file, strings.HasSuffix(strings.ToLower(key), ".gz"))
+}
+
+type csvReader struct {
+	file    io.ReadCloser
+	gz      *gzip.Reader
+	reader  *csv.Reader
+	columns []string
+}
+
+func newCSVReader(file io.ReadCloser, compressed bool) (*csvReader, error) {
+	r := &csvReader{file: file}
+	var input io.Reader = file
+	if compressed {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		r.gz = gz
+		input = gz
+	}
+
+	r.reader = csv.NewReader(input)
+	r.reader.ReuseRecord = true
+	r.reader.FieldsPerRecord = -1
+
+	header, err := r.reader.Read()
+	if err != nil {
+		r.Close()
+		return nil, fmt.Errorf("invalid csv header: %v", err)
+	}
+	for _, column := range header {
+		r.columns = append(r.columns, CanonicalColumn(column))
+	}
+	return r, nil
+}
+
+func (r *csvReader) Read() (Row, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	row := Row{}
+	for i, value := range record {
+		if i < len(r.columns) && value != "" {
+			row[r.columns[i]] = value
+		}
+	}
+	return row, nil
+}
+
+func (r *csvReader) Close() error {
+	if r.gz != nil {
+		r.gz.Close()
+	}
+	return r.file.Close()
+}
+
+// parquetBatch rows read from each column at once
+const parquetBatch = 1000
+
+type parquetReader struct {
+	file    source.ParquetFile
+	reader  *reader.ParquetReader
+	columns map[string]string // canonical name => schema path
+	total   int64
+	read    int64
+	batch   []Row
+}
+
+// newParquetReader reads columns from the file in batches, the file is not
+// loaded into memory
+func newParquetReader(file source.ParquetFile) (*parquetReader, error) {
+	pr, err := reader.NewParquetColumnReader(file, 4)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("invalid parquet file: %v", err)
+	}
+
+	r := &parquetReader{
+		file:    file,
+		reader:  pr,
+		columns: map[string]string{},
+		total:   pr.GetNumRows(),
+	}
+	for _, inPath := range pr.SchemaHandler.ValueColumns {
+		exPath := pr.SchemaHandler.InPathToExPath[inPath]
+		path := common.StrToPath(exPath)
+		name := CanonicalColumn(path[len(path)-1])
+		if _, ok := columnFields[name]; ok || strings.HasPrefix(name, TagPrefix) {
+			r.columns[name] = exPath
+		}
+	}
+	return r, nil
+}
+
+func (r *parquetReader) Read() (Row, error) {
+	if len(r.batch) == 0 {
+		if r.read >= r.total {
+			return nil, io.EOF
+		}
+		if err := r.readBatch(); err != nil {
+			return nil, err
+		}
+	}
+	row := r.batch[0]
+	r.batch = r.batch[1:]
+	return row, nil
+}
+
+func (r *parquetReader) readBatch() error {
+	size := r.total - r.read
+	if size > parquetBatch {
+		size = parquetBatch
+	}
+
+	r.batch = make([]Row, size)
+	for i := range r.batch {
+		r.batch[i] = Row{}
+	}
+	for name, path := range r.columns {
+		values, _, _, err := r.reader.ReadColumnByPath(path, size)
+		if err != nil {
+			return err
+		}
+		for i, value := range values {
+			if int64(i) >= size {
+				break
+			}
+			if text := parquetValue(name, value); text != "" {
+				r.batch[i][name] = text
+			}
+		}
+	}
+	r.read += size
+	return nil
+}
+
+func (r *parquetReader) Close() error {
+	r.reader.ReadStop()
+	return r.file.Close()
+}
+
+// parquetValue converts parquet values to the CSV text representation
+func parquetValue(name string, value interface{}) string {
+	isDate := strings.HasSuffix(name, "_date")
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		if isDate && len(v) == 12 {
+			if _, err := parseTime(v); err != nil {
+				return int96ToTime([]byte(v)).Format(time.RFC3339)
+			}
+		}
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		// timestamp(millis) columns
+		if isDate {
+			return time.Unix(0, v*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+		}
+		return strconv.FormatInt(v, 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(value)
+}
+
+// int96ToTime legacy parquet timestamp: nanoseconds of day + julian day
+func int96ToTime(b []byte) time.Time {
+	nanos := int64(binary.LittleEndian.Uint64(b[:8]))
+	days := int64(binary.LittleEndian.Uint32(b[8:]))
+	return time.Unix((days-2440588)*86400, nanos).UTC()
+}
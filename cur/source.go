@@ -0,0 +1,326 @@
+package cur
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awsCredentials "github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// Source where report files are stored. Keys are slash separated and
+// relative to the source base.
+type Source interface {
+	Base() string
+	Location() string
+	List() ([]string, error)
+	Open(key string) (io.ReadCloser, error)
+	OpenFile(key string) (source.ParquetFile, error) // seekable, parquet footer is read first
+}
+
+// readOnlyFile parquet file that can not be written
+type readOnlyFile struct{}
+
+func (readOnlyFile) Create(name string) (source.ParquetFile, error) {
+	return nil, errors.New("parquet file is read only")
+}
+
+func (readOnlyFile) Write(p []byte) (int, error) {
+	return 0, errors.New("parquet file is read only")
+}
+
+// DirSource local directory
+type DirSource struct {
+	Root   string
+	Prefix string // report path prefix used in manifest keys
+}
+
+// NewDirSource local directory source, path must stay inside root
+func NewDirSource(root, dir, prefix string) (*DirSource, error) {
+	if root == "" {
+		return nil, errors.New("cur.directory is not configured")
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	full := filepath.Join(absRoot, filepath.Clean("/"+dir))
+	if info, err := os.Stat(full); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("directory %v not found", dir)
+	}
+	return &DirSource{Root: full, Prefix: prefix}, nil
+}
+
+// Base ...
+func (s *DirSource) Base() string {
+	return s.Prefix
+}
+
+// Location ...
+func (s *DirSource) Location() string {
+	return s.Root
+}
+
+// List all files
+func (s *DirSource) List() ([]string, error) {
+	var keys []string
+	err := filepath.Walk(s.Root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Root, p)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, filepath.ToSlash(rel))
+		return nil
+	})
+	return keys, err
+}
+
+// Open file
+func (s *DirSource) Open(key string) (io.ReadCloser, error) {
+	return os.Open(s.path(key))
+}
+
+// OpenFile file read from disk
+func (s *DirSource) OpenFile(key string) (source.ParquetFile, error) {
+	file, err := os.Open(s.path(key))
+	if err != nil {
+		return nil, err
+	}
+	return &dirFile{File: file}, nil
+}
+
+// path of key, always inside root
+func (s *DirSource) path(key string) string {
+	return filepath.Join(s.Root, filepath.FromSlash(filepath.Clean("/"+key)))
+}
+
+// dirFile local parquet file, columns are read with own handles
+type dirFile struct {
+	readOnlyFile
+	*os.File
+}
+
+func (f *dirFile) Open(name string) (source.ParquetFile, error) {
+	file, err := os.Open(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &dirFile{File: file}, nil
+}
+
+func (f *dirFile) Write(p []byte) (int, error) {
+	return f.readOnlyFile.Write(p)
+}
+
+// S3Source S3 or S3 compatible (MinIO) bucket
+type S3Source struct {
+	Bucket string
+	Prefix string
+	svc    *s3.S3
+}
+
+// S3Config connection of S3 compatible storage
+type S3Config struct {
+	Bucket    string
+	Prefix    string
+	Endpoint  string // empty for AWS
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// NewS3Source s3 source, sess is used when no static keys are given
+func NewS3Source(sess *session.Session, config S3Config) (*S3Source, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("bucket is required")
+	}
+
+	awsConfig := &aws.Config{}
+	if config.Region != "" {
+		awsConfig.Region = aws.String(config.Region)
+	}
+	if config.Endpoint != "" {
+		awsConfig.Endpoint = aws.String(config.Endpoint)
+		awsConfig.S3ForcePathStyle = aws.Bool(true)
+		if config.Region == "" {
+			awsConfig.Region = aws.String("us-east-1")
+		}
+	}
+	if config.AccessKey != "" {
+		awsConfig.Credentials = awsCredentials.NewStaticCredentials(config.AccessKey, config.SecretKey, "")
+	}
+
+	if sess == nil || config.AccessKey != "" {
+		var err error
+		sess, err = session.NewSession(awsConfig)
+		if err != nil {
+			return nil, err
+		}
+		awsConfig = &aws.Config{}
+	}
+
+	return &S3Source{
+		Bucket: config.Bucket,
+		Prefix: strings.Trim(config.Prefix, "/"),
+		svc:    s3.New(sess, awsConfig),
+	}, nil
+}
+
+// Base ...
+func (s *S3Source) Base() string {
+	return s.Prefix
+}
+
+// Location ...
+func (s *S3Source) Location() string {
+	return "s3://" + s.Bucket + "/" + s.Prefix
+}
+
+// List all objects under prefix
+func (s *S3Source) List() ([]string, error) {
+	var keys []string
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(s.Bucket)}
+	if s.Prefix != "" {
+		input.Prefix = aws.String(s.Prefix + "/")
+	}
+	err := s.svc.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, object := range page.Contents {
+			key := aws.StringValue(object.Key)
+			if s.Prefix != "" {
+				key = strings.TrimPrefix(key, s.Prefix+"/")
+			}
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys, err
+}
+
+// Open object
+func (s *S3Source) Open(key string) (io.ReadCloser, error) {
+	output, err := s.svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.key(key)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.Body, nil
+}
+
+// OpenFile object read with ranged requests, only the footer and column
+// chunks are downloaded
+func (s *S3Source) OpenFile(key string) (source.ParquetFile, error) {
+	output, err := s.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.key(key)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3File{src: s, key: s.key(key), size: aws.Int64Value(output.ContentLength)}, nil
+}
+
+// key of object with prefix
+func (s *S3Source) key(key string) string {
+	if s.Prefix != "" {
+		return s.Prefix + "/" + key
+	}
+	return key
+}
+
+// s3BlockSize bytes of one ranged request
+var s3BlockSize int64 = 4 << 20
+
+// s3File S3 object read in blocks, each column reader opens own file
+type s3File struct {
+	readOnlyFile
+	src    *S3Source
+	key    string
+	size   int64
+	offset int64
+	block  []byte
+	start  int64 // offset of block
+}
+
+func (f *s3File) Open(name string) (source.ParquetFile, error) {
+	return &s3File{src: f.src, key: f.key, size: f.size}, nil
+}
+
+func (f *s3File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Read fills p unless the object ends, parquet reader does not retry short
+// reads
+func (f *s3File) Read(p []byte) (int, error) {
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+	read := 0
+	for read < len(p) && f.offset < f.size {
+		if f.offset < f.start || f.offset >= f.start+int64(len(f.block)) {
+			if err := f.fetch(int64(len(p) - read)); err != nil {
+				return read, err
+			}
+		}
+		n := copy(p[read:], f.block[f.offset-f.start:])
+		f.offset += int64(n)
+		read += n
+	}
+	return read, nil
+}
+
+// fetch block at offset, at least s3BlockSize bytes or want
+func (f *s3File) fetch(want int64) error {
+	if want < s3BlockSize {
+		want = s3BlockSize
+	}
+	end := f.offset + want
+	if end > f.size {
+		end = f.size
+	}
+	output, err := f.src.svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(f.src.Bucket),
+		Key:    aws.String(f.key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", f.offset, end-1)),
+	})
+	if err != nil {
+		return err
+	}
+	defer output.Body.Close()
+	block := make([]byte, end-f.offset)
+	if _, err := io.ReadFull(output.Body, block); err != nil {
+		return err
+	}
+	f.block, f.start = block, f.offset
+	return nil
+}
+
+func (f *s3File) Close() error {
+	f.block = nil
+	return nil
+}
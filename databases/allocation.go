@@ -0,0 +1,72 @@
+package databases
+
+// Allocation match type
+const (
+	AllocationMatchAccount   = "account"
+	AllocationMatchTag       = "tag"
+	AllocationMatchService   = "service"
+	AllocationMatchUsageType = "usage_type"
+)
+
+// Allocation split method
+const (
+	SplitProportional = "proportional"
+	SplitFixed        = "fixed"
+	SplitEven         = "even"
+)
+
+type (
+	// AllocationRuleSet [ Зардал хуваарилах дүрмийн хувилбар ]
+	AllocationRuleSet struct {
+		Base
+		CompanyID     uint              `gorm:"column:company_id;index" json:"company_id"`   // Байгууллага
+		UserID        uint              `gorm:"column:user_id;index" json:"user_id"`         // Үүсгэсэн хэрэглэгч
+		Version       int               `gorm:"column:version" json:"version"`               // байгууллага дотор дараалсан дугаар
+		Name          string            `gorm:"column:name" json:"name"`                     //
+		EffectiveFrom string            `gorm:"column:effective_from" json:"effective_from"` // 2021-01, энэ сараас эхлэн
+		EffectiveTo   string            `gorm:"column:effective_to" json:"effective_to"`     // 2021-06, энэ сарыг оролцуулахгүй, хоосон бол хязгааргүй
+		Note          string            `gorm:"column:note" json:"note"`                     //
+		Rules         []AllocationRule  `gorm:"foreignKey:RuleSetID" json:"rules"`           //
+		Splits        []AllocationSplit `gorm:"foreignKey:RuleSetID" json:"splits"`          //
+	}
+
+	// AllocationRule [ Зардлыг cost center-т оноох дүрэм ]
+	AllocationRule struct {
+		Base
+		RuleSetID  uint   `gorm:"column:rule_set_id;index" json:"rule_set_id"` //
+		Priority   int    `gorm:"column:priority" json:"priority"`             // бага нь эхэлж шалгагдана
+		CostCenter string `gorm:"column:cost_center" json:"cost_center"`       //
+		MatchType  string `gorm:"column:match_type" json:"match_type"`         // account, tag, service, usage_type
+		MatchKey   string `gorm:"column:match_key" json:"match_key"`           // tag key
+		Values     string `gorm:"column:match_values" json:"values"`           // таслалаар, төгсгөлийн * нь prefix
+	}
+
+	// AllocationSplit [ Хуваалцах зардлыг хуваах дүрэм ]
+	AllocationSplit struct {
+		Base
+		RuleSetID   uint   `gorm:"column:rule_set_id;index" json:"rule_set_id"` //
+		Name        string `gorm:"column:name" json:"name"`                     // Support, Data transfer
+		MatchType   string `gorm:"column:match_type" json:"match_type"`         // account, tag, service, usage_type
+		MatchKey    string `gorm:"column:match_key" json:"match_key"`           // tag key
+		Values      string `gorm:"column:match_values" json:"values"`           // таслалаар, төгсгөлийн * нь prefix
+		Method      string `gorm:"column:method" json:"method"`                 // proportional, fixed, even
+		Targets     string `gorm:"column:targets" json:"targets"`               // cost center-үүд таслалаар, хоосон бол бүгд
+		Percentages string `gorm:"column:percentages" json:"percentages"`       // fixed үед targets-ийн дарааллаар
+	}
+
+	// AllocationStatement [ Cost center-ийн сарын тайлан ]
+	AllocationStatement struct {
+		Base
+		CompanyID  uint    `gorm:"column:company_id;uniqueIndex:idx_allocation_statement" json:"company_id"`   //
+		UserID     uint    `gorm:"column:user_id;uniqueIndex:idx_allocation_statement" json:"user_id"`         // байгууллагагүй хэрэглэгч
+		Month      string  `gorm:"column:month;uniqueIndex:idx_allocation_statement" json:"month"`             // 2021-01
+		CostCenter string  `gorm:"column:cost_center;uniqueIndex:idx_allocation_statement" json:"cost_center"` //
+		RuleSetID  uint    `gorm:"column:rule_set_id" json:"rule_set_id"`                                      // ашигласан хувилбар
+		Version    int     `gorm:"column:version" json:"version"`                                              //
+		Source     string  `gorm:"column:source" json:"source"`                                                // cur, costexplorer
+		Direct     float64 `gorm:"column:direct" json:"direct"`                                                // шууд оноогдсон
+		Shared     float64 `gorm:"column:shared" json:"shared"`                                                // хуваалцсан зардлаас
+		Total      float64 `gorm:"column:total" json:"total"`                                                  //
+		Details    string  `gorm:"column:details;type:text" json:"details"`                                    // JSON, service-ээр задаргаа
+	}
+)
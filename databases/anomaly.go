@@ -0,0 +1,45 @@
+package databases
+
+import "time"
+
+// Anomaly status
+const (
+	AnomalyOpen         = "open"
+	AnomalyAcknowledged = "acknowledged"
+	AnomalyDismissed    = "dismissed"
+)
+
+type (
+	// DailyCost [ Өдрийн зардлын хуулбар ]
+	DailyCost struct {
+		ID            uint      `gorm:"primary_key" json:"id"`
+		UserID        uint      `gorm:"column:user_id;uniqueIndex:idx_daily_cost" json:"user_id"`
+		Date          string    `gorm:"column:date;uniqueIndex:idx_daily_cost" json:"date"` // 2021-01-31
+		Service       string    `gorm:"column:service;uniqueIndex:idx_daily_cost" json:"service"`
+		LinkedAccount string    `gorm:"column:linked_account;uniqueIndex:idx_daily_cost" json:"linked_account"`
+		Amount        float64   `gorm:"column:amount" json:"amount"`
+		Source        string    `gorm:"column:source" json:"source"` // costexplorer, cur
+		ModifiedDate  time.Time `gorm:"column:modified_date" json:"modified_date"`
+	}
+
+	// CostAnomaly [ Зардлын хэвийн бус өөрчлөлт ]
+	CostAnomaly struct {
+		Base
+		User               *SystemUser `gorm:"foreignKey:UserID" json:"user"`                              //
+		UserID             uint        `gorm:"column:user_id;uniqueIndex:idx_cost_anomaly" json:"user_id"` //
+		CompanyID          uint        `gorm:"column:company_id;index" json:"company_id"`                  //
+		Date               string      `gorm:"column:date;uniqueIndex:idx_cost_anomaly" json:"date"`       //
+		Service            string      `gorm:"column:service;uniqueIndex:idx_cost_anomaly" json:"service"` //
+		Expected           float64     `gorm:"column:expected" json:"expected"`                            // Хүлээгдэж байсан
+		Actual             float64     `gorm:"column:actual" json:"actual"`                                // Бодит
+		Impact             float64     `gorm:"column:impact" json:"impact"`                                // actual - expected
+		Score              float64     `gorm:"column:score" json:"score"`                                  // deviations from expected
+		RootCauseDimension string      `gorm:"column:root_cause_dimension" json:"root_cause_dimension"`    // LINKED_ACCOUNT
+		RootCauseValue     string      `gorm:"column:root_cause_value" json:"root_cause_value"`            //
+		RootCauseImpact    float64     `gorm:"column:root_cause_impact" json:"root_cause_impact"`          //
+		Status             string      `gorm:"column:status;index" json:"status"`                          // open, acknowledged, dismissed
+		StatusUserID       uint        `gorm:"column:status_user_id" json:"status_user_id"`                //
+		StatusDate         *time.Time  `gorm:"column:status_date" json:"status_date"`                      //
+		Note               string      `gorm:"column:note" json:"note"`                                    //
+	}
+)
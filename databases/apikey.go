@@ -0,0 +1,31 @@
+package databases
+
+import "time"
+
+// API key scope
+const (
+	ScopeRead  = "read"  // GET and read-only cost queries
+	ScopeWrite = "write" // everything except API key management
+)
+
+type (
+	// APIKey [ API түлхүүр ]
+	APIKey struct {
+		Base
+		Company      *Company    `gorm:"foreignKey:CompanyID" json:"company"`         // Байгууллага
+		CompanyID    uint        `gorm:"column:company_id;index" json:"company_id"`   //
+		User         *SystemUser `gorm:"foreignKey:UserID" json:"user"`               // Түлхүүрээр нэвтрэх хэрэглэгч
+		UserID       uint        `gorm:"column:user_id;index" json:"user_id"`         //
+		Name         string      `gorm:"column:name;not null" json:"name"`            // Нэр, grafana
+		Prefix       string      `gorm:"column:prefix;uniqueIndex" json:"prefix"`     // ak_1a2b3c4d, түлхүүрийн эхлэл
+		KeyHash      string      `gorm:"column:key_hash;not null" json:"-"`           // SHA-256
+		Scope        string      `gorm:"column:scope;not null" json:"scope"`          // read, write
+		IsCompany    bool        `gorm:"column:is_company" json:"is_company"`         // Байгууллагын түлхүүр эсэх
+		AllowedIPs   string      `gorm:"column:allowed_ips" json:"allowed_ips"`       // 10.0.0.0/8,1.2.3.4, хоосон бол бүх IP
+		ExpiresDate  *time.Time  `gorm:"column:expires_date" json:"expires_date"`     // Дуусах хугацаа
+		LastUsedDate *time.Time  `gorm:"column:last_used_date" json:"last_used_date"` //
+		LastUsedIP   string      `gorm:"column:last_used_ip" json:"last_used_ip"`     //
+		RevokedDate  *time.Time  `gorm:"column:revoked_date" json:"revoked_date"`     // Цуцалсан огноо
+		RateLimit    int         `gorm:"column:rate_limit" json:"rate_limit"`         // Минутын хүсэлт, 0 бол зөвхөн бүлгийн хязгаар
+	}
+)
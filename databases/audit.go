@@ -0,0 +1,37 @@
+package databases
+
+import (
+	"errors"
+
+	gorm "gorm.io/gorm"
+)
+
+// ErrAuditAppendOnly audit rows are never changed or removed
+var ErrAuditAppendOnly = errors.New("audit log is append-only")
+
+type (
+	// AuditLog [ Аудитын бүртгэл ]
+	AuditLog struct {
+		Base
+		CompanyID  uint   `gorm:"column:company_id;index" json:"company_id"` // Байгууллага
+		ActorID    uint   `gorm:"column:actor_id;index" json:"actor_id"`     // Үйлдэл хийсэн хэрэглэгч
+		ActorEmail string `gorm:"column:actor_email" json:"actor_email"`     //
+		APIKeyID   uint   `gorm:"column:api_key_id" json:"api_key_id"`       // API түлхүүрээр хийсэн бол
+		Action     string `gorm:"column:action;index" json:"action"`         // user.create, credentials.delete
+		Target     string `gorm:"column:target;index" json:"target"`         // user, credentials
+		TargetID   uint   `gorm:"column:target_id;index" json:"target_id"`   //
+		Changes    string `gorm:"column:changes;type:text" json:"changes"`   // {"field": {"before": x, "after": y}}, нууц утгууд далдлагдсан
+		IP         string `gorm:"column:ip" json:"ip"`                       //
+		UserAgent  string `gorm:"column:user_agent" json:"user_agent"`       //
+	}
+)
+
+// BeforeUpdate keeps audit log append-only
+func (AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditAppendOnly
+}
+
+// BeforeDelete keeps audit log append-only
+func (AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditAppendOnly
+}
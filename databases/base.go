@@ -56,12 +56,52 @@ func InitDB() *gorm.DB {
 	if err != nil {
 		panic(err.Error())
 	}
+	if err := migrateBudgetAlerts(db); err != nil {
+		fmt.Println("migrate budget alerts", err)
+	}
 	db.AutoMigrate(
 		&SystemUser{},
 		&Company{},
 		&AwsCredentials{},
 		&ConfirmUser{},
+		&CurImport{},
+		&CurLineItem{},
+		&Budget{},
+		&BudgetThreshold{},
+		&BudgetAlert{},
+		&DailyCost{},
+		&CostAnomaly{},
+		&RecommendationFetch{},
+		&PurchaseRecommendation{},
+		&AllocationRuleSet{},
+		&AllocationRule{},
+		&AllocationSplit{},
+		&AllocationStatement{},
+		&PricingRule{},
+		&PricingOverride{},
+		&PricingFee{},
+		&Invoice{},
+		&InvoiceLine{},
+		&ExchangeRate{},
+		&ReportSubscription{},
+		&ReportDelivery{},
+		&SavedQuery{},
+		&Dashboard{},
+		&DashboardWidget{},
+		&Webhook{},
+		&WebhookDelivery{},
+		&AuditLog{},
+		&APIKey{},
+		&SSOProvider{},
+		&SSOIdentity{},
+		&SSOLogin{},
+		&LoginThrottle{},
+		&RateLimitBucket{},
+		&CostExplorerUsage{},
 	)
+	if err := migrateCurCompany(db); err != nil {
+		fmt.Println("migrate cur company", err)
+	}
 	return db
 }
 
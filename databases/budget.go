@@ -0,0 +1,86 @@
+package databases
+
+import (
+	"time"
+
+	gorm "gorm.io/gorm"
+)
+
+// Budget scope
+const (
+	BudgetScopeCompany = "company"
+	BudgetScopeAccount = "account"
+	BudgetScopeService = "service"
+	BudgetScopeTag     = "tag"
+)
+
+// Budget threshold type
+const (
+	ThresholdActual     = "ACTUAL"
+	ThresholdForecasted = "FORECASTED"
+)
+
+type (
+	// Budget [ Төсөв ]
+	Budget struct {
+		Base
+		Company       *Company          `gorm:"foreignKey:CompanyID" json:"company"`          // Байгууллага
+		CompanyID     uint              `gorm:"column:company_id;index" json:"company_id"`    //
+		User          *SystemUser       `gorm:"foreignKey:UserID" json:"user"`                // AWS эрх нь ашиглагдах хэрэглэгч
+		UserID        uint              `gorm:"column:user_id;index" json:"user_id"`          //
+		Name          string            `gorm:"column:name;not null" json:"name"`             // Нэр
+		ScopeType     string            `gorm:"column:scope_type;not null" json:"scope_type"` // company, account, service, tag
+		ScopeKey      string            `gorm:"column:scope_key" json:"scope_key"`            // tag key
+		ScopeValue    string            `gorm:"column:scope_value" json:"scope_value"`        // account id, service, tag value
+		Period        string            `gorm:"column:period;not null" json:"period"`         // MONTHLY, QUARTERLY, ANNUALLY
+		Amount        float64           `gorm:"column:amount;not null" json:"amount"`         // Төсөвлөсөн дүн
+		Metric        string            `gorm:"column:metric" json:"metric"`                  // UnblendedCost
+		Channels      string            `gorm:"column:channels" json:"channels"`              // log,webhook
+		WebhookURL    string            `gorm:"column:webhook_url" json:"webhook_url"`        //
+		IsActive      bool              `gorm:"column:is_active" json:"is_active"`            // Идэвхтэй эсэх
+		Actual        float64           `gorm:"column:actual" json:"actual"`                  // Сүүлд шалгасан бодит зардал
+		Forecast      float64           `gorm:"column:forecast" json:"forecast"`              // Сүүлд шалгасан таамаг
+		EvaluatedDate *time.Time        `gorm:"column:evaluated_date" json:"evaluated_date"`  //
+		EvaluateError string            `gorm:"column:evaluate_error" json:"evaluate_error"`  //
+		Thresholds    []BudgetThreshold `gorm:"foreignKey:BudgetID" json:"thresholds"`        //
+	}
+
+	// BudgetThreshold [ Төсвийн босго ]
+	BudgetThreshold struct {
+		Base
+		BudgetID   uint    `gorm:"column:budget_id;index" json:"budget_id"` //
+		Percentage float64 `gorm:"column:percentage" json:"percentage"`     // 80, 100
+		Type       string  `gorm:"column:type" json:"type"`                 // ACTUAL, FORECASTED
+	}
+
+	// BudgetAlert [ Төсвийн сануулга ]
+	BudgetAlert struct {
+		Base
+		Budget        *Budget `gorm:"foreignKey:BudgetID" json:"budget"`                                           //
+		BudgetID      uint    `gorm:"column:budget_id;uniqueIndex:idx_budget_alert_period" json:"budget_id"`       //
+		ThresholdID   uint    `gorm:"column:threshold_id" json:"threshold_id"`                                     //
+		PeriodStart   string  `gorm:"column:period_start;uniqueIndex:idx_budget_alert_period" json:"period_start"` // нэг үед нэг босго нэг л удаа
+		Type          string  `gorm:"column:type;uniqueIndex:idx_budget_alert_period" json:"type"`                 //
+		Percentage    float64 `gorm:"column:percentage;uniqueIndex:idx_budget_alert_period" json:"percentage"`     //
+		BudgetAmount  float64 `gorm:"column:budget_amount" json:"budget_amount"`                                   //
+		Actual        float64 `gorm:"column:actual" json:"actual"`                                                 //
+		Forecast      float64 `gorm:"column:forecast" json:"forecast"`                                             //
+		Channels      string  `gorm:"column:channels" json:"channels"`                                             //
+		DeliveryError string  `gorm:"column:delivery_error" json:"delivery_error"`                                 //
+	}
+)
+
+// migrateBudgetAlerts alerts were unique per threshold row, thresholds get
+// new rows on edit so alerts are unique per threshold value now
+func migrateBudgetAlerts(db *gorm.DB) error {
+	if !db.Migrator().HasIndex(&BudgetAlert{}, "idx_budget_alert_crossing") {
+		return nil
+	}
+	result := db.Exec(`DELETE FROM budget_alerts a USING budget_alerts b
+		WHERE a.id > b.id AND a.budget_id = b.budget_id AND a.type = b.type
+		AND a.percentage = b.percentage AND a.period_start = b.period_start`)
+	if result.Error != nil {
+		return result.Error
+	}
+	return db.Migrator().DropIndex(&BudgetAlert{}, "idx_budget_alert_crossing")
+}
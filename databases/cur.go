@@ -0,0 +1,67 @@
+package databases
+
+import (
+	"time"
+
+	gorm "gorm.io/gorm"
+)
+
+type (
+	// CurImport [ CUR файл импортлосон түүх ]
+	CurImport struct {
+		Base
+		User          *SystemUser `gorm:"foreignKey:UserID" json:"user"`                     // Үүсгэсэн хэрэглэгч
+		UserID        uint        `gorm:"column:user_id;index" json:"user_id"`               //
+		CompanyID     uint        `gorm:"column:company_id;index" json:"company_id"`         // Байгууллага, байхгүй бол хэрэглэгчийнх
+		Source        string      `gorm:"column:source" json:"source"`                       // local, s3
+		Location      string      `gorm:"column:location" json:"location"`                   // directory or bucket/prefix
+		BillingPeriod string      `gorm:"column:billing_period;index" json:"billing_period"` // 2021-01
+		AssemblyID    string      `gorm:"column:assembly_id" json:"assembly_id"`             //
+		Format        string      `gorm:"column:format" json:"format"`                       // csv, parquet
+		Files         int         `gorm:"column:files" json:"files"`                         //
+		Rows          int64       `gorm:"column:rows" json:"rows"`                           //
+		Status        string      `gorm:"column:status" json:"status"`                       // running, success, failed
+		ErrorMsg      string      `gorm:"column:error_msg" json:"error_msg"`                 //
+		FinishedDate  *time.Time  `gorm:"column:finished_date" json:"finished_date"`         //
+		RunningKey    *string     `gorm:"column:running_key;uniqueIndex" json:"-"`           // company_1/2021-01, дуустал давхцахгүй
+	}
+
+	// CurLineItem [ CUR line item ]
+	CurLineItem struct {
+		ID             uint      `gorm:"primary_key" json:"id"`
+		UserID         uint      `gorm:"column:user_id;index:idx_cur_line_item_period" json:"user_id"`
+		CompanyID      uint      `gorm:"column:company_id;index:idx_cur_line_item_company" json:"company_id"`
+		BillingPeriod  string    `gorm:"column:billing_period;index:idx_cur_line_item_period;index:idx_cur_line_item_company" json:"billing_period"`
+		ImportID       uint      `gorm:"column:import_id" json:"import_id"`
+		LineItemID     string    `gorm:"column:line_item_id" json:"line_item_id"`
+		LineItemType   string    `gorm:"column:line_item_type" json:"line_item_type"`
+		UsageAccountID string    `gorm:"column:usage_account_id" json:"usage_account_id"`
+		UsageStartDate time.Time `gorm:"column:usage_start_date;index" json:"usage_start_date"`
+		UsageEndDate   time.Time `gorm:"column:usage_end_date" json:"usage_end_date"`
+		ProductCode    string    `gorm:"column:product_code" json:"product_code"`
+		ServiceName    string    `gorm:"column:service_name" json:"service_name"`
+		UsageType      string    `gorm:"column:usage_type" json:"usage_type"`
+		Operation      string    `gorm:"column:operation" json:"operation"`
+		Region         string    `gorm:"column:region" json:"region"`
+		ResourceID     string    `gorm:"column:resource_id" json:"resource_id"`
+		Description    string    `gorm:"column:description" json:"description"`
+		UsageAmount    float64   `gorm:"column:usage_amount" json:"usage_amount"`
+		UnblendedCost  float64   `gorm:"column:unblended_cost" json:"unblended_cost"`
+		BlendedCost    float64   `gorm:"column:blended_cost" json:"blended_cost"`
+		CurrencyCode   string    `gorm:"column:currency_code" json:"currency_code"`
+		Tags           string    `gorm:"column:tags;type:text" json:"tags"` // JSON object
+	}
+)
+
+// migrateCurCompany sets company of imports and line items saved before they
+// were kept by company
+func migrateCurCompany(db *gorm.DB) error {
+	for _, table := range []string{"cur_imports", "cur_line_items"} {
+		result := db.Exec(`UPDATE ` + table + ` t SET company_id = COALESCE(u.company_id, 0)
+			FROM system_users u WHERE u.id = t.user_id AND t.company_id IS NULL`)
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+	return nil
+}
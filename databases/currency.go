@@ -0,0 +1,10 @@
+package databases
+
+// ExchangeRate [ Ханш, 1 USD-тэй тэнцэх валютын дүн ]
+type ExchangeRate struct {
+	Base
+	Date     string  `gorm:"column:date;uniqueIndex:idx_exchange_rate" json:"date"`         // 2021-01-31
+	Currency string  `gorm:"column:currency;uniqueIndex:idx_exchange_rate" json:"currency"` // MNT
+	Rate     float64 `gorm:"column:rate" json:"rate"`                                       // 1 USD = rate currency
+	Source   string  `gorm:"column:source" json:"source"`                                   // import, csv, mongolbank
+}
@@ -0,0 +1,42 @@
+package databases
+
+type (
+	// SavedQuery [ Хадгалсан хайлт ]
+	SavedQuery struct {
+		Base
+		Company     *Company    `gorm:"foreignKey:CompanyID" json:"company"`            // Байгууллага
+		CompanyID   uint        `gorm:"column:company_id;index" json:"company_id"`      //
+		User        *SystemUser `gorm:"foreignKey:UserID" json:"user"`                  // Үүсгэсэн, AWS эрх нь ашиглагдах хэрэглэгч
+		UserID      uint        `gorm:"column:user_id;index" json:"user_id"`            //
+		Name        string      `gorm:"column:name;not null" json:"name"`               // Нэр
+		Description string      `gorm:"column:description" json:"description"`          //
+		Params      string      `gorm:"column:params;type:text;not null" json:"params"` // form.CostExplorerParams JSON
+		DateRange   string      `gorm:"column:date_range" json:"date_range"`            // last_30_days, mtd, хоосон бол params-ийн огноо
+		IsShared    bool        `gorm:"column:is_shared" json:"is_shared"`              // Байгууллагын хэрэглэгчид харах эсэх
+	}
+
+	// Dashboard [ Хянах самбар ]
+	Dashboard struct {
+		Base
+		Company     *Company          `gorm:"foreignKey:CompanyID" json:"company"`       // Байгууллага
+		CompanyID   uint              `gorm:"column:company_id;index" json:"company_id"` //
+		User        *SystemUser       `gorm:"foreignKey:UserID" json:"user"`             // Үүсгэсэн хэрэглэгч
+		UserID      uint              `gorm:"column:user_id;index" json:"user_id"`       //
+		Name        string            `gorm:"column:name;not null" json:"name"`          // Нэр
+		Description string            `gorm:"column:description" json:"description"`     //
+		IsShared    bool              `gorm:"column:is_shared" json:"is_shared"`         // Байгууллагын хэрэглэгчид харах эсэх
+		Widgets     []DashboardWidget `gorm:"foreignKey:DashboardID" json:"widgets"`     //
+	}
+
+	// DashboardWidget [ Самбарын хэсэг ]
+	DashboardWidget struct {
+		Base
+		DashboardID  uint        `gorm:"column:dashboard_id;index" json:"dashboard_id"`     //
+		SavedQuery   *SavedQuery `gorm:"foreignKey:SavedQueryID" json:"saved_query"`        //
+		SavedQueryID uint        `gorm:"column:saved_query_id;index" json:"saved_query_id"` //
+		Title        string      `gorm:"column:title" json:"title"`                         // хоосон бол хайлтын нэр
+		Chart        string      `gorm:"column:chart" json:"chart"`                         // line, bar, stacked_bar, pie, table
+		Position     int         `gorm:"column:position" json:"position"`                   // Дараалал
+		Width        int         `gorm:"column:width" json:"width"`                         // 1-12 багана
+	}
+)
@@ -0,0 +1,90 @@
+package databases
+
+import "time"
+
+// Invoice status
+const (
+	InvoiceDraft  = "draft"
+	InvoiceIssued = "issued"
+	InvoicePaid   = "paid"
+)
+
+// Invoice line kind
+const (
+	InvoiceLineUsage    = "usage"
+	InvoiceLineDiscount = "discount"
+	InvoiceLineFee      = "fee"
+	InvoiceLineCredit   = "credit"
+)
+
+type (
+	// PricingRule [ Байгууллагад дахин борлуулах үнийн дүрэм ]
+	PricingRule struct {
+		Base
+		CompanyID          uint              `gorm:"column:company_id;uniqueIndex" json:"company_id"`       // Байгууллага
+		Accounts           string            `gorm:"column:accounts" json:"accounts"`                       // linked account-ууд таслалаар
+		MarkupPercent      float64           `gorm:"column:markup_percent" json:"markup_percent"`           // AWS зардал дээр нэмэх хувь
+		DiscountPercent    float64           `gorm:"column:discount_percent" json:"discount_percent"`       // usage дүнгээс хасах хувь
+		TaxPercent         float64           `gorm:"column:tax_percent" json:"tax_percent"`                 // НӨАТ
+		CreditsPassthrough bool              `gorm:"column:credits_passthrough" json:"credits_passthrough"` // AWS credit, refund-ийг нэхэмжлэлд хасах эсэх
+		Currency           string            `gorm:"column:currency" json:"currency"`                       //
+		PaymentTermDays    int               `gorm:"column:payment_term_days" json:"payment_term_days"`     // төлөх хугацаа
+		Note               string            `gorm:"column:note" json:"note"`                               //
+		Overrides          []PricingOverride `gorm:"foreignKey:PricingRuleID" json:"overrides"`             //
+		Fees               []PricingFee      `gorm:"foreignKey:PricingRuleID" json:"fees"`                  //
+	}
+
+	// PricingOverride [ Service-ийн тусгай markup ]
+	PricingOverride struct {
+		Base
+		PricingRuleID uint    `gorm:"column:pricing_rule_id;index" json:"pricing_rule_id"` //
+		Service       string  `gorm:"column:service" json:"service"`                       // Amazon Elastic Compute Cloud - Compute
+		MarkupPercent float64 `gorm:"column:markup_percent" json:"markup_percent"`         //
+	}
+
+	// PricingFee [ Сар бүрийн тогтмол төлбөр ]
+	PricingFee struct {
+		Base
+		PricingRuleID uint    `gorm:"column:pricing_rule_id;index" json:"pricing_rule_id"` //
+		Name          string  `gorm:"column:name" json:"name"`                             // Support, Management fee
+		Amount        float64 `gorm:"column:amount" json:"amount"`                         //
+	}
+
+	// Invoice [ Байгууллагын сарын нэхэмжлэл ]
+	Invoice struct {
+		Base
+		Company    *Company      `gorm:"foreignKey:CompanyID" json:"company,omitempty"` //
+		CompanyID  uint          `gorm:"column:company_id;index" json:"company_id"`     // Байгууллага
+		UserID     uint          `gorm:"column:user_id" json:"user_id"`                 // Үүсгэсэн хэрэглэгч
+		Month      string        `gorm:"column:month;index" json:"month"`               // 2021-01
+		Number     string        `gorm:"column:number;index" json:"number"`             // issued үед олгоно, INV-2021-0001
+		Sequence   int           `gorm:"column:sequence" json:"sequence"`               // жил доторх дугаар
+		Status     string        `gorm:"column:status;index" json:"status"`             // draft, issued, paid
+		Source     string        `gorm:"column:source" json:"source"`                   // cur, costexplorer
+		Currency   string        `gorm:"column:currency" json:"currency"`               //
+		Rate       float64       `gorm:"column:rate" json:"rate"`                       // 1 USD = rate currency, сарын дундаж
+		Cost       float64       `gorm:"column:cost" json:"cost"`                       // AWS зардал
+		Subtotal   float64       `gorm:"column:subtotal" json:"subtotal"`               //
+		TaxPercent float64       `gorm:"column:tax_percent" json:"tax_percent"`         //
+		Tax        float64       `gorm:"column:tax" json:"tax"`                         //
+		Total      float64       `gorm:"column:total" json:"total"`                     //
+		UsdTotal   float64       `gorm:"column:usd_total" json:"usd_total"`             // USD-ээр
+		IssuedDate *time.Time    `gorm:"column:issued_date" json:"issued_date"`         //
+		DueDate    *time.Time    `gorm:"column:due_date" json:"due_date"`               //
+		PaidDate   *time.Time    `gorm:"column:paid_date" json:"paid_date"`             //
+		Lines      []InvoiceLine `gorm:"foreignKey:InvoiceID" json:"lines,omitempty"`   //
+	}
+
+	// InvoiceLine [ Нэхэмжлэлийн мөр ]
+	InvoiceLine struct {
+		Base
+		InvoiceID     uint    `gorm:"column:invoice_id;index" json:"invoice_id"`   //
+		Position      int     `gorm:"column:position" json:"position"`             //
+		Kind          string  `gorm:"column:kind" json:"kind"`                     // usage, discount, fee, credit
+		Description   string  `gorm:"column:description" json:"description"`       //
+		Cost          float64 `gorm:"column:cost" json:"cost"`                     // AWS зардал
+		MarkupPercent float64 `gorm:"column:markup_percent" json:"markup_percent"` //
+		Amount        float64 `gorm:"column:amount" json:"amount"`                 // нэхэмжлэх дүн
+		UsdAmount     float64 `gorm:"column:usd_amount" json:"usd_amount"`         // USD-ээр
+	}
+)
@@ -0,0 +1,14 @@
+package databases
+
+import "time"
+
+type (
+	// LoginThrottle [ Нэвтрэх оролдлого ] failed logins of one email or IP
+	LoginThrottle struct {
+		Base
+		Key             string     `gorm:"column:key;uniqueIndex" json:"key"`                 // email:a@b.mn, ip:1.2.3.4
+		Failures        int        `gorm:"column:failures" json:"failures"`                   // Дараалсан буруу оролдлого
+		LastFailureDate *time.Time `gorm:"column:last_failure_date" json:"last_failure_date"` //
+		LockedUntil     *time.Time `gorm:"column:locked_until" json:"locked_until"`           // Түгжигдсэн хугацаа
+	}
+)
@@ -0,0 +1,20 @@
+package databases
+
+type (
+	// RateLimitBucket [ Хүсэлтийн хязгаар ] shared token bucket of postgres rate limit store
+	RateLimitBucket struct {
+		Base
+		Key    string  `gorm:"column:key;uniqueIndex" json:"key"` // aws:user:1, auth:ip:1.2.3.4
+		Tokens float64 `gorm:"column:tokens" json:"tokens"`       // modified_date үеийн үлдэгдэл
+	}
+
+	// CostExplorerUsage [ Cost Explorer хэрэглээ ] requests of a company in a month
+	CostExplorerUsage struct {
+		Base
+		CompanyID   uint   `gorm:"column:company_id;uniqueIndex:idx_ce_usage" json:"company_id"` // Байгууллага
+		UserID      uint   `gorm:"column:user_id;uniqueIndex:idx_ce_usage" json:"user_id"`       // Байгууллагагүй хэрэглэгч, байгууллагын мөрөнд 0
+		Month       string `gorm:"column:month;uniqueIndex:idx_ce_usage" json:"month"`           // 2021-01
+		Requests    int    `gorm:"column:requests" json:"requests"`                              // Хүсэлтийн тоо
+		JobRequests int    `gorm:"column:job_requests" json:"job_requests"`                      // Ажлын хүсэлт, хязгаарт тооцохгүй
+	}
+)
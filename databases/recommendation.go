@@ -0,0 +1,51 @@
+package databases
+
+// Recommendation kind
+const (
+	RecommendationSavingsPlans = "savings_plans"
+	RecommendationReservation  = "reservation"
+)
+
+type (
+	// RecommendationFetch [ Худалдан авалтын зөвлөмж татсан түүх ]
+	RecommendationFetch struct {
+		Base
+		CompanyID           uint                     `gorm:"column:company_id;index" json:"company_id"`           // Байгууллага
+		UserID              uint                     `gorm:"column:user_id;index" json:"user_id"`                 // AWS эрх нь ашиглагдсан хэрэглэгч
+		Kind                string                   `gorm:"column:kind;index" json:"kind"`                       // savings_plans, reservation
+		Service             string                   `gorm:"column:service" json:"service"`                       // reservation service
+		SavingsPlansType    string                   `gorm:"column:savings_plans_type" json:"savings_plans_type"` // COMPUTE_SP, EC2_INSTANCE_SP, SAGEMAKER_SP
+		LookbackPeriod      string                   `gorm:"column:lookback_period" json:"lookback_period"`       // SEVEN_DAYS, THIRTY_DAYS, SIXTY_DAYS
+		Term                string                   `gorm:"column:term" json:"term"`                             // ONE_YEAR, THREE_YEARS
+		PaymentOption       string                   `gorm:"column:payment_option" json:"payment_option"`         // NO_UPFRONT, PARTIAL_UPFRONT, ALL_UPFRONT
+		AccountScope        string                   `gorm:"column:account_scope" json:"account_scope"`           // PAYER, LINKED
+		RecommendationID    string                   `gorm:"column:recommendation_id" json:"recommendation_id"`   // AWS recommendation ID
+		GenerationDate      string                   `gorm:"column:generation_date" json:"generation_date"`       // AWS тооцоолсон огноо
+		Currency            string                   `gorm:"column:currency" json:"currency"`                     //
+		Count               int                      `gorm:"column:count" json:"count"`                           //
+		TotalMonthlySavings float64                  `gorm:"column:total_monthly_savings" json:"total_monthly_savings"`
+		TotalUpfrontCost    float64                  `gorm:"column:total_upfront_cost" json:"total_upfront_cost"`
+		Items               []PurchaseRecommendation `gorm:"foreignKey:FetchID" json:"items,omitempty"`
+	}
+
+	// PurchaseRecommendation [ Худалдан авалтын зөвлөмж ]
+	PurchaseRecommendation struct {
+		Base
+		FetchID                 uint    `gorm:"column:fetch_id;index" json:"fetch_id"`                             //
+		Rank                    int     `gorm:"column:rank" json:"rank"`                                           // хэмнэлтээр эрэмбэлсэн
+		AccountID               string  `gorm:"column:account_id" json:"account_id"`                               //
+		Region                  string  `gorm:"column:region" json:"region"`                                       //
+		InstanceFamily          string  `gorm:"column:instance_family" json:"instance_family"`                     //
+		InstanceType            string  `gorm:"column:instance_type" json:"instance_type"`                         // reservation
+		Platform                string  `gorm:"column:platform" json:"platform"`                                   // reservation
+		Quantity                float64 `gorm:"column:quantity" json:"quantity"`                                   // instances to purchase
+		HourlyCommitment        float64 `gorm:"column:hourly_commitment" json:"hourly_commitment"`                 // savings plans
+		UpfrontCost             float64 `gorm:"column:upfront_cost" json:"upfront_cost"`                           //
+		RecurringMonthlyCost    float64 `gorm:"column:recurring_monthly_cost" json:"recurring_monthly_cost"`       //
+		EstimatedMonthlySavings float64 `gorm:"column:estimated_monthly_savings" json:"estimated_monthly_savings"` //
+		EstimatedSavingsPercent float64 `gorm:"column:estimated_savings_percent" json:"estimated_savings_percent"` //
+		EstimatedUtilization    float64 `gorm:"column:estimated_utilization" json:"estimated_utilization"`         //
+		BreakEvenMonths         float64 `gorm:"column:break_even_months" json:"break_even_months"`                 // 0 when no upfront cost
+		Currency                string  `gorm:"column:currency" json:"currency"`                                   //
+	}
+)
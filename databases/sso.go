@@ -0,0 +1,42 @@
+package databases
+
+import "time"
+
+type (
+	// SSOProvider [ Байгууллагын OpenID Connect нэвтрэлт ]
+	SSOProvider struct {
+		Base
+		Company        *Company `gorm:"foreignKey:CompanyID" json:"company"`             // Байгууллага
+		CompanyID      uint     `gorm:"column:company_id;uniqueIndex" json:"company_id"` //
+		Issuer         string   `gorm:"column:issuer;not null" json:"issuer"`            // https://accounts.google.com
+		ClientID       string   `gorm:"column:client_id;not null" json:"client_id"`      //
+		ClientSecret   string   `gorm:"column:client_secret" json:"-"`                   //
+		AllowedDomains string   `gorm:"column:allowed_domains" json:"allowed_domains"`   // acme.mn,acme.com
+		DefaultRole    string   `gorm:"column:default_role" json:"default_role"`         // шинээр үүсэх хэрэглэгчийн эрх
+		IsActive       bool     `gorm:"column:is_active" json:"is_active"`               // Идэвхтэй эсэх
+	}
+
+	// SSOIdentity [ IdP хэрэглэгчийн холбоос ]
+	SSOIdentity struct {
+		Base
+		User       *SystemUser `gorm:"foreignKey:UserID" json:"user"`                                      //
+		UserID     uint        `gorm:"column:user_id;index" json:"user_id"`                                //
+		ProviderID uint        `gorm:"column:provider_id;uniqueIndex:idx_sso_identity" json:"provider_id"` //
+		Subject    string      `gorm:"column:subject;uniqueIndex:idx_sso_identity" json:"subject"`         // id_token sub
+		Email      string      `gorm:"column:email" json:"email"`                                          //
+	}
+
+	// SSOLogin [ Эхэлсэн нэвтрэлт ] state, nonce and PKCE verifier between
+	// redirect and callback
+	SSOLogin struct {
+		Base
+		ProviderID   uint      `gorm:"column:provider_id;index" json:"provider_id"` //
+		State        string    `gorm:"column:state;uniqueIndex" json:"state"`       //
+		Nonce        string    `gorm:"column:nonce" json:"-"`                       //
+		CodeVerifier string    `gorm:"column:code_verifier" json:"-"`               // PKCE
+		RedirectURI  string    `gorm:"column:redirect_uri" json:"redirect_uri"`     //
+		ExpiresDate  time.Time `gorm:"column:expires_date" json:"expires_date"`     //
+		IsUsed       bool      `gorm:"column:is_used" json:"is_used"`               //
+		LinkUserID   uint      `gorm:"column:link_user_id" json:"-"`                // Холбох гэж буй нэвтэрсэн хэрэглэгч, нэвтрэлтэд 0
+	}
+)
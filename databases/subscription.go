@@ -0,0 +1,57 @@
+package databases
+
+import "time"
+
+// Report subscription template
+const (
+	TemplateMonthlyReport = "monthly_report" // PDF of month to date, of last month when run on the 1st
+	TemplateCostQuery     = "cost_query"     // cost table of the last days
+)
+
+// Report delivery status
+const (
+	DeliveryPending = "pending"
+	DeliverySuccess = "success"
+	DeliveryFailed  = "failed"
+)
+
+type (
+	// ReportSubscription [ Тайлангийн захиалга ]
+	ReportSubscription struct {
+		Base
+		Company     *Company         `gorm:"foreignKey:CompanyID" json:"company"`             // Байгууллага
+		CompanyID   uint             `gorm:"column:company_id;index" json:"company_id"`       //
+		User        *SystemUser      `gorm:"foreignKey:UserID" json:"user"`                   // AWS эрх нь ашиглагдах хэрэглэгч
+		UserID      uint             `gorm:"column:user_id;index" json:"user_id"`             //
+		Name        string           `gorm:"column:name;not null" json:"name"`                // Нэр
+		Template    string           `gorm:"column:template;not null" json:"template"`        // monthly_report, cost_query
+		Query       string           `gorm:"column:query;type:text" json:"query"`             // cost_query-ийн form.CostExplorerParams JSON
+		Days        int              `gorm:"column:days" json:"days"`                         // cost_query-ийн сүүлийн хоногууд
+		Schedule    string           `gorm:"column:schedule;not null" json:"schedule"`        // cron, 0 8 * * 1
+		Timezone    string           `gorm:"column:timezone" json:"timezone"`                 // хоосон бол database.timezone
+		Format      string           `gorm:"column:format;not null" json:"format"`            // pdf, csv, xlsx, json
+		Channel     string           `gorm:"column:channel;not null" json:"channel"`          // email, webhook
+		Recipients  string           `gorm:"column:recipients" json:"recipients"`             // a@b.mn,c@d.mn
+		WebhookURL  string           `gorm:"column:webhook_url" json:"webhook_url"`           //
+		IsActive    bool             `gorm:"column:is_active" json:"is_active"`               // Идэвхтэй эсэх
+		NextRunDate *time.Time       `gorm:"column:next_run_date;index" json:"next_run_date"` // Дараагийн ажиллах хугацаа
+		LastRunDate *time.Time       `gorm:"column:last_run_date" json:"last_run_date"`       //
+		LastStatus  string           `gorm:"column:last_status" json:"last_status"`           // success, failed
+		Deliveries  []ReportDelivery `gorm:"foreignKey:SubscriptionID" json:"deliveries,omitempty"`
+	}
+
+	// ReportDelivery [ Тайлан илгээлт ]
+	ReportDelivery struct {
+		Base
+		Subscription   *ReportSubscription `gorm:"foreignKey:SubscriptionID" json:"subscription,omitempty"` //
+		SubscriptionID uint                `gorm:"column:subscription_id;index" json:"subscription_id"`     //
+		ScheduledDate  time.Time           `gorm:"column:scheduled_date" json:"scheduled_date"`             // Товлосон хугацаа
+		Status         string              `gorm:"column:status;index" json:"status"`                       // pending, success, failed
+		Attempts       int                 `gorm:"column:attempts" json:"attempts"`                         // Оролдлогын тоо
+		NextRetryDate  *time.Time          `gorm:"column:next_retry_date" json:"next_retry_date"`           // Дахин оролдох хугацаа
+		DeliveredDate  *time.Time          `gorm:"column:delivered_date" json:"delivered_date"`             //
+		FileName       string              `gorm:"column:file_name" json:"file_name"`                       //
+		Size           int                 `gorm:"column:size" json:"size"`                                 // bytes
+		Error          string              `gorm:"column:error" json:"error"`                               // Сүүлийн алдаа
+	}
+)
@@ -2,6 +2,12 @@ package databases
 
 import "time"
 
+// User role in company
+const (
+	RoleAdmin  = "admin"  // manages users, credentials and reads audit log
+	RoleMember = "member" //
+)
+
 type (
 	// SystemUser [ Хэрэглэгч ]
 	SystemUser struct {
@@ -11,6 +17,9 @@ type (
 		Password       string          `gorm:"column:password;" json:"password"`                // Password
 		AwsCredentials *AwsCredentials `gorm:"foreignKey:UserID" json:"aws_credentials"`        //
 		AwsRegion      string          `gorm:"column:aws_region" json:"aws_region"`
+		Company        *Company        `gorm:"foreignKey:CompanyID" json:"company"` // Байгууллага
+		CompanyID      uint            `gorm:"column:company_id" json:"company_id"` //
+		Role           string          `gorm:"column:role" json:"role"`             // admin, member
 	}
 
 	// ConfirmUser ...
@@ -38,7 +47,9 @@ type (
 	// Company ...
 	Company struct {
 		Base
-		IsActive bool   `gorm:"column:is_active;default:false" json:"is_active"` // Идэвхтэй эсэх
-		Name     string `gorm:"column:name;unique;not null" json:"name"`         // Нэвтрэх нэр
+		IsActive          bool   `gorm:"column:is_active;default:false" json:"is_active"`       // Идэвхтэй эсэх
+		Name              string `gorm:"column:name;unique;not null" json:"name"`               // Нэвтрэх нэр
+		Currency          string `gorm:"column:currency" json:"currency"`                       // Харуулах валют, хоосон бол USD
+		CostExplorerQuota int    `gorm:"column:cost_explorer_quota" json:"cost_explorer_quota"` // Сарын Cost Explorer хүсэлт, 0 бол тохиргооны утга, -1 бол хязгааргүй
 	}
 )
@@ -0,0 +1,43 @@
+package databases
+
+import "time"
+
+// Webhook payload format
+const (
+	WebhookJSON  = "json"
+	WebhookSlack = "slack"
+	WebhookTeams = "teams"
+)
+
+type (
+	// Webhook [ Байгууллагын webhook ]
+	Webhook struct {
+		Base
+		Company   *Company    `gorm:"foreignKey:CompanyID" json:"company"`       // Байгууллага
+		CompanyID uint        `gorm:"column:company_id;index" json:"company_id"` //
+		User      *SystemUser `gorm:"foreignKey:UserID" json:"user"`             // Бүртгэсэн хэрэглэгч
+		UserID    uint        `gorm:"column:user_id;index" json:"user_id"`       //
+		Name      string      `gorm:"column:name;not null" json:"name"`          // Нэр
+		URL       string      `gorm:"column:url;not null" json:"url"`            //
+		Secret    string      `gorm:"column:secret;not null" json:"-"`           // HMAC-SHA256 түлхүүр
+		Events    string      `gorm:"column:events;not null" json:"events"`      // budget.threshold,anomaly.detected эсвэл *
+		Format    string      `gorm:"column:format;not null" json:"format"`      // json, slack, teams
+		IsActive  bool        `gorm:"column:is_active" json:"is_active"`         // Идэвхтэй эсэх
+	}
+
+	// WebhookDelivery [ Webhook илгээлт ]
+	WebhookDelivery struct {
+		Base
+		Webhook       *Webhook   `gorm:"foreignKey:WebhookID" json:"webhook,omitempty"` //
+		WebhookID     uint       `gorm:"column:webhook_id;index" json:"webhook_id"`     //
+		Event         string     `gorm:"column:event" json:"event"`                     //
+		Payload       string     `gorm:"column:payload;type:text" json:"payload"`       // илгээсэн body
+		Status        string     `gorm:"column:status;index" json:"status"`             // pending, success, failed
+		Attempts      int        `gorm:"column:attempts" json:"attempts"`               // Оролдлогын тоо
+		ResponseCode  int        `gorm:"column:response_code" json:"response_code"`     // Сүүлийн хариуны код
+		Error         string     `gorm:"column:error" json:"error"`                     // Сүүлийн алдаа
+		NextRetryDate *time.Time `gorm:"column:next_retry_date" json:"next_retry_date"` // Дахин оролдох хугацаа
+		DeliveredDate *time.Time `gorm:"column:delivered_date" json:"delivered_date"`   //
+		IsTest        bool       `gorm:"column:is_test" json:"is_test"`                 // Туршилтын илгээлт
+	}
+)
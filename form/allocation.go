@@ -0,0 +1,39 @@
+package form
+
+// AllocationRuleParams ...
+type AllocationRuleParams struct {
+	Priority   int      `json:"priority"`                       // бага нь эхэлж шалгагдана
+	CostCenter string   `json:"cost_center" binding:"required"` //
+	MatchType  string   `json:"match_type" binding:"required"`  // account, tag, service, usage_type
+	MatchKey   string   `json:"match_key"`                      // tag key
+	Values     []string `json:"values" binding:"required"`      // төгсгөлийн * нь prefix
+}
+
+// AllocationSplitParams ...
+type AllocationSplitParams struct {
+	Name        string    `json:"name" binding:"required"`
+	MatchType   string    `json:"match_type" binding:"required"` // account, tag, service, usage_type
+	MatchKey    string    `json:"match_key"`                     // tag key
+	Values      []string  `json:"values" binding:"required"`     //
+	Method      string    `json:"method" binding:"required"`     // proportional, fixed, even
+	Targets     []string  `json:"targets"`                       // хоосон бол бүх cost center
+	Percentages []float64 `json:"percentages"`                   // fixed үед targets-ийн дарааллаар
+}
+
+// AllocationRuleSetParams new version of allocation rules
+type AllocationRuleSetParams struct {
+	Name          string                  `json:"name"`
+	EffectiveFrom string                  `json:"effective_from" binding:"required"` // 2021-01
+	EffectiveTo   string                  `json:"effective_to"`                      // 2021-06, хоосон бол хязгааргүй
+	Note          string                  `json:"note"`
+	Rules         []AllocationRuleParams  `json:"rules"`
+	Splits        []AllocationSplitParams `json:"splits"`
+}
+
+// AllocationRunParams ...
+type AllocationRunParams struct {
+	Month     string                   `json:"month" binding:"required"` // 2021-01
+	Source    string                   `json:"source"`                   // cur, costexplorer, default cur
+	RuleSetID uint                     `json:"rule_set_id"`              // preview: тухайн хувилбар, хоосон бол сард хүчинтэй хувилбар
+	RuleSet   *AllocationRuleSetParams `json:"rule_set"`                 // preview: хадгалаагүй дүрэм
+}
@@ -0,0 +1,30 @@
+package form
+
+// AnomalyDetectParams ...
+type AnomalyDetectParams struct {
+	Source      string  `json:"source"`      // costexplorer, cur
+	Days        int     `json:"days"`        // шалгах сүүлийн өдрүүд, default 7
+	Window      int     `json:"window"`      // baseline days, default 56
+	Sensitivity float64 `json:"sensitivity"` // default 3, бага байх тусам мэдрэмтгий
+	MinImpact   float64 `json:"min_impact"`  // default 1
+}
+
+// AnomalyFilterCols filter hiih bolomjtoi column
+type AnomalyFilterCols struct {
+	Status  string `json:"status"`
+	Service string `json:"service"`
+	Date    string `json:"date"`
+}
+
+// AnomalyFilter sort hiigdej boloh zuils
+type AnomalyFilter struct {
+	Page   int               `json:"page"`
+	Size   int               `json:"size"`
+	Sort   SortColumn        `json:"sort"`
+	Filter AnomalyFilterCols `json:"filter"`
+}
+
+// AnomalyStatusParams ...
+type AnomalyStatusParams struct {
+	Note string `json:"note"`
+}
@@ -0,0 +1,11 @@
+package form
+
+// APIKeyParams create body params
+type APIKeyParams struct {
+	Name        string   `json:"name" binding:"required"`
+	Scope       string   `json:"scope"`        // read, write, default read
+	IsCompany   bool     `json:"is_company"`   // байгууллагын түлхүүр, зөвхөн admin
+	ExpiresDate string   `json:"expires_date"` // YYYY-MM-DD, хоосон бол хугацаагүй
+	AllowedIPs  []string `json:"allowed_ips"`  // IP эсвэл CIDR
+	RateLimit   int      `json:"rate_limit"`   // минутын хүсэлт, 0 бол зөвхөн бүлгийн хязгаар
+}
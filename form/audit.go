@@ -0,0 +1,21 @@
+package form
+
+// AuditFilterCols filter hiih bolomjtoi column
+type AuditFilterCols struct {
+	ActorID     int    `json:"actor_id"`
+	ActorEmail  string `json:"actor_email"`
+	Action      string `json:"action"` // user.create, credentials
+	Target      string `json:"target"`
+	TargetID    int    `json:"target_id"`
+	IP          string `json:"ip"`
+	CreatedDate string `json:"created_date"` // YYYY-MM-DD-ээс хойш
+}
+
+// AuditFilter sort hiigdej boloh zuils
+type AuditFilter struct {
+	Page    int             `json:"page"`
+	Size    int             `json:"size"`
+	Sort    SortColumn      `json:"sort"`
+	Filter  AuditFilterCols `json:"filter"`
+	EndDate string          `json:"end_date"` // YYYY-MM-DD хүртэл, орохгүй
+}
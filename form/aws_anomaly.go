@@ -0,0 +1,42 @@
+package form
+
+// AwsAnomaliesParams ...
+type AwsAnomaliesParams struct {
+	StartDate  string  `json:"start_date" binding:"required"`
+	EndDate    string  `json:"end_date"`
+	MonitorArn string  `json:"monitor_arn"`
+	Feedback   string  `json:"feedback"`   // YES, NO, PLANNED_ACTIVITY
+	MinImpact  float64 `json:"min_impact"` // total impact >= min_impact
+}
+
+// AwsAnomalyMonitorParams ...
+type AwsAnomalyMonitorParams struct {
+	MonitorArn     string   `json:"monitor_arn"` // update үед
+	Name           string   `json:"name" binding:"required"`
+	Type           string   `json:"type"`            // DIMENSIONAL, CUSTOM
+	LinkedAccounts []string `json:"linked_accounts"` // CUSTOM
+	TagKey         string   `json:"tag_key"`         // CUSTOM
+	TagValues      []string `json:"tag_values"`      // CUSTOM
+}
+
+// AwsAnomalySubscriberParams ...
+type AwsAnomalySubscriberParams struct {
+	Type    string `json:"type" binding:"required"` // EMAIL, SNS
+	Address string `json:"address" binding:"required"`
+}
+
+// AwsAnomalySubscriptionParams ...
+type AwsAnomalySubscriptionParams struct {
+	SubscriptionArn string                       `json:"subscription_arn"` // update үед
+	Name            string                       `json:"name" binding:"required"`
+	Frequency       string                       `json:"frequency"` // DAILY, IMMEDIATE, WEEKLY
+	Threshold       float64                      `json:"threshold"`
+	MonitorArns     []string                     `json:"monitor_arns" binding:"required"`
+	Subscribers     []AwsAnomalySubscriberParams `json:"subscribers" binding:"required"`
+}
+
+// AwsAnomalyFeedbackParams ...
+type AwsAnomalyFeedbackParams struct {
+	AnomalyID string `json:"anomaly_id" binding:"required"`
+	Feedback  string `json:"feedback" binding:"required"` // YES, NO, PLANNED_ACTIVITY
+}
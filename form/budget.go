@@ -0,0 +1,22 @@
+package form
+
+// BudgetThresholdParams ...
+type BudgetThresholdParams struct {
+	Percentage float64 `json:"percentage" binding:"required"` // 80, 100
+	Type       string  `json:"type" binding:"required"`       // ACTUAL, FORECASTED
+}
+
+// BudgetParams create body params
+type BudgetParams struct {
+	Name       string                  `json:"name" binding:"required"`
+	ScopeType  string                  `json:"scope_type" binding:"required"` // company, account, service, tag
+	ScopeKey   string                  `json:"scope_key"`                     // tag key
+	ScopeValue string                  `json:"scope_value"`                   //
+	Period     string                  `json:"period" binding:"required"`     // MONTHLY, QUARTERLY, ANNUALLY
+	Amount     float64                 `json:"amount" binding:"required"`     //
+	Metric     string                  `json:"metric"`                        // UnblendedCost
+	Channels   []string                `json:"channels"`                      // log, webhook
+	WebhookURL string                  `json:"webhook_url"`                   //
+	IsActive   bool                    `json:"is_active"`                     //
+	Thresholds []BudgetThresholdParams `json:"thresholds"`                    //
+}
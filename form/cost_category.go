@@ -0,0 +1,36 @@
+package form
+
+// CostCategoryConditionParams one condition of a cost category rule
+type CostCategoryConditionParams struct {
+	Type         string   `json:"type" binding:"required"` // DIMENSION, TAG, COST_CATEGORY
+	Key          string   `json:"key" binding:"required"`  // LINKED_ACCOUNT, SERVICE ..., tag key, cost category name
+	Values       []string `json:"values"`                  //
+	MatchOptions []string `json:"match_options"`           // EQUALS, ABSENT, STARTS_WITH, ENDS_WITH, CONTAINS, CASE_SENSITIVE, CASE_INSENSITIVE
+}
+
+// CostCategoryRuleParams ...
+type CostCategoryRuleParams struct {
+	Value              string                        `json:"value"`               // REGULAR rule-ийн утга
+	Type               string                        `json:"type"`                // REGULAR, INHERITED_VALUE, default REGULAR
+	Operator           string                        `json:"operator"`            // AND, OR, default AND
+	Conditions         []CostCategoryConditionParams `json:"conditions"`          // REGULAR
+	InheritedDimension string                        `json:"inherited_dimension"` // INHERITED_VALUE: LINKED_ACCOUNT_NAME, TAG
+	InheritedKey       string                        `json:"inherited_key"`       // INHERITED_VALUE: tag key
+}
+
+// CostCategorySplitChargeParams ...
+type CostCategorySplitChargeParams struct {
+	Source      string    `json:"source" binding:"required"`  // хуваарилах cost category утга
+	Targets     []string  `json:"targets" binding:"required"` // хүлээн авах утгууд
+	Method      string    `json:"method" binding:"required"`  // FIXED, PROPORTIONAL, EVEN
+	Percentages []float64 `json:"percentages"`                // FIXED үед targets-ийн дарааллаар
+}
+
+// CostCategoryParams create, update body params
+type CostCategoryParams struct {
+	Arn              string                          `json:"arn"` // update үед
+	Name             string                          `json:"name"`
+	DefaultValue     string                          `json:"default_value"`
+	Rules            []CostCategoryRuleParams        `json:"rules" binding:"required"`
+	SplitChargeRules []CostCategorySplitChargeParams `json:"split_charge_rules"`
+}
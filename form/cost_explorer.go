@@ -1,19 +1,89 @@
 package form
 
+// CostCategoryFilter cost category values filter
+type CostCategoryFilter struct {
+	Key    string    `json:"key" binding:"required"` // cost category name
+	Values []*string `json:"values" binding:"required"`
+}
+
 // CostExplorerParams ...
 type CostExplorerParams struct {
-	StartDate   string    `json:"start_date"`
-	EndDate     string    `json:"end_date"`
-	Granularity string    `json:"granularity"`
-	Metric      []*string `json:"metric"`
-	Services    []*string `json:"services"`
-	GroupName   string    `json:"group_name"`
+	StartDate    string              `json:"start_date"` // YYYY-MM-DD, today, yesterday
+	EndDate      string              `json:"end_date"`   // exclusive, YYYY-MM-DD, today, tomorrow
+	DateRange    string              `json:"date_range"` // mtd, qtd, ytd, previous_month, last_30_days ..., start_date, end_date-г орлоно
+	Granularity  string              `json:"granularity"`
+	Metric       []*string           `json:"metric"`
+	Services     []*string           `json:"services"`
+	GroupName    string              `json:"group_name"`
+	GroupType    string              `json:"group_type"` // DIMENSION, TAG, COST_CATEGORY, default DIMENSION
+	CostCategory *CostCategoryFilter `json:"cost_category"`
+	Currency     string              `json:"currency"` // харуулах валют, хоосон бол байгууллагын валют
+}
+
+// CostExplorerExportParams cost query exported as a flat table
+type CostExplorerExportParams struct {
+	CostExplorerParams
+	Format string `json:"format"` // json, csv, xlsx, default csv
 }
 
 // CostExplorerForcastParams ...
 type CostExplorerForcastParams struct {
-	EndDate     string `json:"end_date"`
-	Granularity string `json:"granularity"`
-	Metric      string `json:"metric"`
-	StartDate   string `json:"start_date"`
+	EndDate                 string              `json:"end_date" binding:"required"`
+	Granularity             string              `json:"granularity"`
+	Metric                  string              `json:"metric"`
+	StartDate               string              `json:"start_date"`                // өнгөрсөн огноо бол өнөөдрийг хүртэлх бодит зардал
+	PredictionIntervalLevel int64               `json:"prediction_interval_level"` // 51-99, default 80
+	Services                []*string           `json:"services"`
+	LinkedAccounts          []*string           `json:"linked_accounts"`
+	CostCategory            *CostCategoryFilter `json:"cost_category"`
+	Currency                string              `json:"currency"` // харуулах валют, хоосон бол байгууллагын валют
+}
+
+// CostExplorerMonthEndParams ...
+type CostExplorerMonthEndParams struct {
+	Metric         string              `json:"metric"` // default UnblendedCost
+	Services       []*string           `json:"services"`
+	LinkedAccounts []*string           `json:"linked_accounts"`
+	CostCategory   *CostCategoryFilter `json:"cost_category"`
+	Currency       string              `json:"currency"` // харуулах валют, хоосон бол байгууллагын валют
+}
+
+// DateRange ...
+type DateRange struct {
+	StartDate string `json:"start_date" binding:"required"`
+	EndDate   string `json:"end_date" binding:"required"`
+}
+
+// CostExplorerMoversParams ...
+type CostExplorerMoversParams struct {
+	PeriodA         DateRange           `json:"period_a" binding:"required"`
+	PeriodB         DateRange           `json:"period_b" binding:"required"`
+	Dimension       string              `json:"dimension"`         // SERVICE, LINKED_ACCOUNT, REGION, USAGE_TYPE, COST_CATEGORY
+	CostCategoryKey string              `json:"cost_category_key"` // dimension COST_CATEGORY үед
+	Metric          string              `json:"metric"`
+	SortBy          string              `json:"sort_by"` // absolute, relative
+	Limit           int                 `json:"limit"`
+	Services        []*string           `json:"services"`
+	LinkedAccounts  []*string           `json:"linked_accounts"`
+	CostCategory    *CostCategoryFilter `json:"cost_category"`
+}
+
+// CostExplorerCommitmentParams reservation and savings plans utilization, coverage
+type CostExplorerCommitmentParams struct {
+	StartDate      string    `json:"start_date" binding:"required"`
+	EndDate        string    `json:"end_date" binding:"required"`
+	Granularity    string    `json:"granularity"` // DAILY, MONTHLY
+	GroupBy        string    `json:"group_by"`    // coverage only: INSTANCE_TYPE, LINKED_ACCOUNT, REGION ...
+	Services       []*string `json:"services"`    // reservation only
+	LinkedAccounts []*string `json:"linked_accounts"`
+	Regions        []*string `json:"regions"`
+}
+
+// CostExplorerRightsizingParams ...
+type CostExplorerRightsizingParams struct {
+	Type                string    `json:"type"`                  // TERMINATE, MODIFY, хоосон бол бүгд
+	CrossInstanceFamily bool      `json:"cross_instance_family"` // өөр instance family санал болгох эсэх
+	BenefitsConsidered  *bool     `json:"benefits_considered"`   // RI, Savings Plans хөнгөлөлт тооцох эсэх, default true
+	LinkedAccounts      []*string `json:"linked_accounts"`
+	Regions             []*string `json:"regions"`
 }
@@ -0,0 +1,43 @@
+package form
+
+// CurImportParams import body params
+type CurImportParams struct {
+	Source        string `json:"source" binding:"required"` // local, s3
+	Path          string `json:"path"`                      // directory under cur.directory
+	Bucket        string `json:"bucket"`                    //
+	Prefix        string `json:"prefix"`                    // report path prefix
+	Endpoint      string `json:"endpoint"`                  // S3 compatible endpoint (MinIO), cur.s3_endpoints
+	Region        string `json:"region"`                    //
+	AccessKey     string `json:"access_key"`                //
+	SecretKey     string `json:"secret_key"`                //
+	BillingPeriod string `json:"billing_period"`            // 2021-01, хоосон бол бүх сар
+}
+
+// CurLineItemFilterCols filter hiih bolomjtoi column
+type CurLineItemFilterCols struct {
+	BillingPeriod  string `json:"billing_period"`
+	UsageAccountID string `json:"usage_account_id"`
+	ServiceName    string `json:"service_name"`
+	UsageType      string `json:"usage_type"`
+	Operation      string `json:"operation"`
+	Region         string `json:"region"`
+	ResourceID     string `json:"resource_id"`
+	LineItemType   string `json:"line_item_type"`
+}
+
+// CurLineItemFilter sort hiigdej boloh zuils
+type CurLineItemFilter struct {
+	Page   int                   `json:"page"`
+	Size   int                   `json:"size"`
+	Sort   SortColumn            `json:"sort"`
+	Filter CurLineItemFilterCols `json:"filter"`
+}
+
+// CurSummaryParams ...
+type CurSummaryParams struct {
+	BillingPeriod string                `json:"billing_period"`
+	StartDate     string                `json:"start_date"`
+	EndDate       string                `json:"end_date"`
+	GroupBy       string                `json:"group_by" binding:"required"` // account, service, usage_type, operation, region, resource, line_item_type, day
+	Filter        CurLineItemFilterCols `json:"filter"`
+}
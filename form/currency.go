@@ -0,0 +1,33 @@
+package form
+
+// ExchangeRateParams ...
+type ExchangeRateParams struct {
+	Date     string  `json:"date" binding:"required"`     // 2021-01-31
+	Currency string  `json:"currency" binding:"required"` // MNT
+	Rate     float64 `json:"rate" binding:"required"`     // 1 USD = rate currency
+}
+
+// ExchangeRateImportParams ...
+type ExchangeRateImportParams struct {
+	Source string               `json:"source"` // default import
+	Rates  []ExchangeRateParams `json:"rates" binding:"required"`
+}
+
+// CompanyCurrencyParams ...
+type CompanyCurrencyParams struct {
+	Currency string `json:"currency"` // хоосон бол USD
+}
+
+// ExchangeRateFilterCols filter hiih bolomjtoi column
+type ExchangeRateFilterCols struct {
+	Currency string `json:"currency"`
+	Date     string `json:"date"`
+}
+
+// ExchangeRateFilter sort hiigdej boloh zuils
+type ExchangeRateFilter struct {
+	Page   int                    `json:"page"`
+	Size   int                    `json:"size"`
+	Sort   SortColumn             `json:"sort"`
+	Filter ExchangeRateFilterCols `json:"filter"`
+}
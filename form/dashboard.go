@@ -0,0 +1,27 @@
+package form
+
+// SavedQueryParams create body params
+type SavedQueryParams struct {
+	Name        string             `json:"name" binding:"required"`
+	Description string             `json:"description"`
+	Params      CostExplorerParams `json:"params"`     // start_date, end_date are ignored when date_range is set
+	DateRange   string             `json:"date_range"` // mtd, qtd, ytd, previous_month, trailing_12_months, last_N_days, last_N_months
+	IsShared    bool               `json:"is_shared"`  // visible to the company
+}
+
+// DashboardWidgetParams ...
+type DashboardWidgetParams struct {
+	SavedQueryID uint   `json:"saved_query_id" binding:"required"`
+	Title        string `json:"title"`
+	Chart        string `json:"chart"`    // line, bar, stacked_bar, pie, table, default bar
+	Position     int    `json:"position"` //
+	Width        int    `json:"width"`    // 1-12, default 6
+}
+
+// DashboardParams create body params
+type DashboardParams struct {
+	Name        string                  `json:"name" binding:"required"`
+	Description string                  `json:"description"`
+	IsShared    bool                    `json:"is_shared"` // visible to the company
+	Widgets     []DashboardWidgetParams `json:"widgets"`
+}
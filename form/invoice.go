@@ -0,0 +1,55 @@
+package form
+
+// PricingOverrideParams ...
+type PricingOverrideParams struct {
+	Service       string  `json:"service" binding:"required"` // Amazon Elastic Compute Cloud - Compute
+	MarkupPercent float64 `json:"markup_percent"`             //
+}
+
+// PricingFeeParams ...
+type PricingFeeParams struct {
+	Name   string  `json:"name" binding:"required"`
+	Amount float64 `json:"amount"`
+}
+
+// PricingRuleParams pricing of a company, replaces the previous rule
+type PricingRuleParams struct {
+	Accounts           []string                `json:"accounts" binding:"required"` // linked accounts of the company
+	MarkupPercent      float64                 `json:"markup_percent"`              //
+	DiscountPercent    float64                 `json:"discount_percent"`            //
+	TaxPercent         float64                 `json:"tax_percent"`                 //
+	CreditsPassthrough bool                    `json:"credits_passthrough"`         //
+	Currency           string                  `json:"currency"`                    // default USD
+	PaymentTermDays    int                     `json:"payment_term_days"`           // default invoice.payment_term_days
+	Note               string                  `json:"note"`                        //
+	Overrides          []PricingOverrideParams `json:"overrides"`                   //
+	Fees               []PricingFeeParams      `json:"fees"`                        //
+}
+
+// InvoiceGenerateParams ...
+type InvoiceGenerateParams struct {
+	CompanyID uint   `json:"company_id" binding:"required"`
+	Month     string `json:"month" binding:"required"` // 2021-01
+	Source    string `json:"source"`                   // cur, costexplorer, default costexplorer
+}
+
+// InvoiceStatusParams ...
+type InvoiceStatusParams struct {
+	Status string `json:"status" binding:"required"` // issued, paid
+}
+
+// InvoiceFilterCols filter hiih bolomjtoi column
+type InvoiceFilterCols struct {
+	CompanyID int    `json:"company_id"`
+	Month     string `json:"month"`
+	Number    string `json:"number"`
+	Status    string `json:"status"`
+}
+
+// InvoiceFilter sort hiigdej boloh zuils
+type InvoiceFilter struct {
+	Page   int               `json:"page"`
+	Size   int               `json:"size"`
+	Sort   SortColumn        `json:"sort"`
+	Filter InvoiceFilterCols `json:"filter"`
+}
@@ -0,0 +1,6 @@
+package form
+
+// CostExplorerQuotaParams ...
+type CostExplorerQuotaParams struct {
+	CostExplorer int `json:"cost_explorer"` // сарын хүсэлт, 0 бол тохиргооны утга, -1 бол хязгааргүй
+}
@@ -0,0 +1,28 @@
+package form
+
+// PurchaseRecommendationParams ...
+type PurchaseRecommendationParams struct {
+	Kind             string `json:"kind" binding:"required"` // savings_plans, reservation
+	LookbackPeriod   string `json:"lookback_period"`         // SEVEN_DAYS, THIRTY_DAYS, SIXTY_DAYS, default THIRTY_DAYS
+	Term             string `json:"term"`                    // ONE_YEAR, THREE_YEARS, default ONE_YEAR
+	PaymentOption    string `json:"payment_option"`          // NO_UPFRONT, PARTIAL_UPFRONT, ALL_UPFRONT, default NO_UPFRONT
+	AccountScope     string `json:"account_scope"`           // PAYER, LINKED
+	SavingsPlansType string `json:"savings_plans_type"`      // savings_plans: COMPUTE_SP, EC2_INSTANCE_SP, SAGEMAKER_SP
+	Service          string `json:"service"`                 // reservation: Amazon Elastic Compute Cloud - Compute, Amazon Relational Database Service ...
+	OfferingClass    string `json:"offering_class"`          // reservation EC2: STANDARD, CONVERTIBLE
+}
+
+// RecommendationFilterCols filter hiih bolomjtoi column
+type RecommendationFilterCols struct {
+	Kind    string `json:"kind"`
+	Service string `json:"service"`
+	Term    string `json:"term"`
+}
+
+// RecommendationFilter sort hiigdej boloh zuils
+type RecommendationFilter struct {
+	Page   int                      `json:"page"`
+	Size   int                      `json:"size"`
+	Sort   SortColumn               `json:"sort"`
+	Filter RecommendationFilterCols `json:"filter"`
+}
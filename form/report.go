@@ -0,0 +1,9 @@
+package form
+
+// MonthlyReportParams ...
+type MonthlyReportParams struct {
+	Month         string `json:"month" binding:"required"` // 2021-01
+	LinkedAccount string `json:"linked_account"`           // хоосон бол бүх данс
+	Metric        string `json:"metric"`                   // default UnblendedCost
+	Currency      string `json:"currency"`                 // харуулах валют, хоосон бол байгууллагын валют
+}
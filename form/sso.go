@@ -0,0 +1,29 @@
+package form
+
+// SSOProviderParams create body params
+type SSOProviderParams struct {
+	Issuer         string   `json:"issuer" binding:"required"`    // https://accounts.google.com, https://login.microsoftonline.com/<tenant>/v2.0
+	ClientID       string   `json:"client_id" binding:"required"` //
+	ClientSecret   string   `json:"client_secret"`                // хоосон бол хуучин нь хадгалагдана
+	AllowedDomains []string `json:"allowed_domains"`              // acme.mn, заавал
+	DefaultRole    string   `json:"default_role"`                 // admin, member, default member
+	IsActive       bool     `json:"is_active"`                    //
+}
+
+// SSOStartParams ...
+type SSOStartParams struct {
+	Email       string `json:"email"`                           // имэйлийн домэйноор байгууллагыг олно
+	CompanyID   uint   `json:"company_id"`                      // эсвэл байгууллага
+	RedirectURI string `json:"redirect_uri" binding:"required"` // IdP дээр бүртгэлтэй callback
+}
+
+// SSOLinkParams ...
+type SSOLinkParams struct {
+	RedirectURI string `json:"redirect_uri" binding:"required"` // IdP дээр бүртгэлтэй callback
+}
+
+// SSOCallbackParams ...
+type SSOCallbackParams struct {
+	State string `json:"state" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+}
@@ -0,0 +1,16 @@
+package form
+
+// ReportSubscriptionParams create body params
+type ReportSubscriptionParams struct {
+	Name       string              `json:"name" binding:"required"`
+	Template   string              `json:"template" binding:"required"` // monthly_report, cost_query
+	Query      *CostExplorerParams `json:"query"`                       // cost_query, start_date and end_date are ignored
+	Days       int                 `json:"days"`                        // cost_query, default 7
+	Schedule   string              `json:"schedule" binding:"required"` // cron, 0 8 * * 1
+	Timezone   string              `json:"timezone"`                    // Asia/Ulaanbaatar, default database.timezone
+	Format     string              `json:"format"`                      // pdf, csv, xlsx, json
+	Channel    string              `json:"channel" binding:"required"`  // email, webhook
+	Recipients []string            `json:"recipients"`                  // email
+	WebhookURL string              `json:"webhook_url"`                 // webhook
+	IsActive   bool                `json:"is_active"`                   //
+}
@@ -7,6 +7,7 @@ type SystemUserParams struct {
 	Password  string `json:"password" binding:"required"` // Нууц үг
 	AccessKey string `json:"access_key" binding:"required"`
 	SecretKey string `json:"secret_key" binding:"required"`
+	Role      string `json:"role"` // admin, member. Зөвхөн admin өөрчилнө
 }
 
 // SystemUserFilterCols sort hiih bolomjtoi column
@@ -0,0 +1,10 @@
+package form
+
+// WebhookParams create body params
+type WebhookParams struct {
+	Name     string   `json:"name" binding:"required"`
+	URL      string   `json:"url" binding:"required"`
+	Events   []string `json:"events" binding:"required"` // budget.threshold, anomaly.detected, sync.failed, credential.failed, *
+	Format   string   `json:"format"`                    // json, slack, teams, default json
+	IsActive bool     `json:"is_active"`                 //
+}
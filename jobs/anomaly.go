@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"log"
+
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	viper "github.com/spf13/viper"
+	"gitlab.com/fibocloud/aws-billing/api_v2/notifications"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+	gorm "gorm.io/gorm"
+)
+
+// DetectAnomalies runs anomaly detection for every user with active AWS credentials
+func DetectAnomalies(db *gorm.DB) {
+	users, err := credentialUsers(db)
+	if err != nil {
+		log.Printf("[jobs] anomalies: %v", err)
+		return
+	}
+
+	source := viper.GetString("anomaly.source")
+	config := services.AnomalyConfig{
+		Window:      viper.GetInt("anomaly.window"),
+		Sensitivity: viper.GetFloat64("anomaly.sensitivity"),
+		MinImpact:   viper.GetFloat64("anomaly.min_impact"),
+	}
+	channels := notifications.SplitChannels(viper.GetString("anomaly.channels"))
+
+	for _, user := range users {
+		var svc costexploreriface.CostExplorerAPI
+		if source != services.SourceCUR {
+			sess, err := services.JobSession(db, user.Base.ID)
+			if err != nil {
+				log.Printf("[jobs] anomalies user %v: %v", user.Base.ID, err)
+				services.JobFailed(user.CompanyID, user.Base.ID, "Anomaly detection", err)
+				continue
+			}
+			svc = costexplorer.New(sess)
+		}
+
+		anomalies, err := services.RunAnomalyDetection(db, svc, user, source, config, viper.GetInt("anomaly.days"), channels)
+		if err != nil {
+			log.Printf("[jobs] anomalies user %v: %v", user.Base.ID, err)
+			services.JobFailed(user.CompanyID, user.Base.ID, "Anomaly detection", err)
+			continue
+		}
+		if len(anomalies) > 0 {
+			log.Printf("[jobs] anomalies user %v: %v new", user.Base.ID, len(anomalies))
+		}
+	}
+}
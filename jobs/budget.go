@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"log"
+
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+	gorm "gorm.io/gorm"
+)
+
+// EvaluateBudgets evaluates all active budgets
+func EvaluateBudgets(db *gorm.DB) {
+	var budgets []databases.Budget
+	if result := db.Preload("Thresholds").Where("is_active = ?", true).Find(&budgets); result.Error != nil {
+		log.Printf("[jobs] budgets: %v", result.Error)
+		return
+	}
+
+	clients := map[uint]*costexplorer.CostExplorer{}
+	failed := map[uint]bool{}
+	for _, budget := range budgets {
+		svc, ok := clients[budget.UserID]
+		if !ok {
+			sess, err := services.JobSession(db, budget.UserID)
+			if err != nil {
+				log.Printf("[jobs] budget %v: %v", budget.ID, err)
+				db.Model(&budget).Update("evaluate_error", err.Error())
+				if !failed[budget.UserID] {
+					failed[budget.UserID] = true
+					services.JobFailed(budget.CompanyID, budget.UserID, "Budget evaluation", err)
+				}
+				continue
+			}
+			svc = costexplorer.New(sess)
+			clients[budget.UserID] = svc
+		}
+
+		status, err := services.EvaluateBudget(db, svc, budget)
+		if err != nil {
+			log.Printf("[jobs] budget %v: %v", budget.ID, err)
+			if !failed[budget.UserID] {
+				failed[budget.UserID] = true
+				services.JobFailed(budget.CompanyID, budget.UserID, "Budget evaluation", err)
+			}
+			continue
+		}
+		for _, alert := range status.Crossed {
+			log.Printf("[jobs] budget %v crossed %v%% %v threshold", budget.ID, alert.Percentage, alert.Type)
+		}
+	}
+}
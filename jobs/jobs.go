@@ -0,0 +1,57 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	viper "github.com/spf13/viper"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	gorm "gorm.io/gorm"
+)
+
+// Start background jobs
+func Start(db *gorm.DB) {
+	go every("jobs.budget_interval", time.Hour, func() { EvaluateBudgets(db) })
+	go every("jobs.anomaly_interval", 24*time.Hour, func() { DetectAnomalies(db) })
+	go every("jobs.recommendation_interval", 7*24*time.Hour, func() { FetchRecommendations(db) })
+	go every("jobs.subscription_interval", time.Minute, func() { RunSubscriptions(db) })
+	go every("jobs.webhook_interval", time.Minute, func() { RetryWebhooks(db) })
+	go every("jobs.ratelimit_clean_interval", time.Hour, func() { CleanRateLimits(db) })
+}
+
+// every runs job on interval from config, a negative interval disables it
+func every(key string, fallback time.Duration, job func()) {
+	interval := fallback
+	if viper.IsSet(key) {
+		interval = viper.GetDuration(key)
+	}
+	if interval <= 0 {
+		log.Printf("[jobs] %v disabled", key)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		run(key, job)
+		<-ticker.C
+	}
+}
+
+// run recovers from job panic so the schedule keeps running
+func run(key string, job func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[jobs] %v panic: %v", key, r)
+		}
+	}()
+	job()
+}
+
+// credentialUsers active users with active AWS credentials
+func credentialUsers(db *gorm.DB) ([]databases.SystemUser, error) {
+	var users []databases.SystemUser
+	result := db.Where("is_active = ? AND id IN (?)", true,
+		db.Model(&databases.AwsCredentials{}).Select("user_id").Where("is_active = ?", true)).Find(&users)
+	return users, result.Error
+}
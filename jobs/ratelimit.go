@@ -0,0 +1,15 @@
+package jobs
+
+import (
+	"log"
+
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+	gorm "gorm.io/gorm"
+)
+
+// CleanRateLimits removes idle buckets of postgres rate limit store
+func CleanRateLimits(db *gorm.DB) {
+	if err := services.CleanRateLimits(db); err != nil {
+		log.Printf("[jobs] rate limits: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	viper "github.com/spf13/viper"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+	gorm "gorm.io/gorm"
+)
+
+// FetchRecommendations stores purchase recommendations of every user with
+// active AWS credentials, so they can be compared week to week
+func FetchRecommendations(db *gorm.DB) {
+	users, err := credentialUsers(db)
+	if err != nil {
+		log.Printf("[jobs] recommendations: %v", err)
+		return
+	}
+
+	for _, user := range users {
+		sess, err := services.JobSession(db, user.Base.ID)
+		if err != nil {
+			log.Printf("[jobs] recommendations user %v: %v", user.Base.ID, err)
+			services.JobFailed(user.CompanyID, user.Base.ID, "Recommendation fetch", err)
+			continue
+		}
+		svc := costexplorer.New(sess)
+
+		for _, kind := range strings.Split(viper.GetString("recommendation.kinds"), ",") {
+			kind = strings.TrimSpace(kind)
+			if kind == "" {
+				continue
+			}
+			fetch, err := services.PurchaseRecommendations(db, svc, user, form.PurchaseRecommendationParams{
+				Kind:           kind,
+				LookbackPeriod: viper.GetString("recommendation.lookback_period"),
+				Term:           viper.GetString("recommendation.term"),
+				PaymentOption:  viper.GetString("recommendation.payment_option"),
+			})
+			if err != nil {
+				log.Printf("[jobs] recommendations user %v %v: %v", user.Base.ID, kind, err)
+				services.JobFailed(user.CompanyID, user.Base.ID, "Recommendation fetch", err)
+				continue
+			}
+			log.Printf("[jobs] recommendations user %v %v: %v items, %.2f monthly savings", user.Base.ID, kind, fetch.Count, fetch.TotalMonthlySavings)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+	gorm "gorm.io/gorm"
+)
+
+// retryLease claimed delivery is retried again after it when the instance
+// stops before saving the attempt
+const retryLease = 10 * time.Minute
+
+// RunSubscriptions delivers due report subscriptions and retries failed
+// deliveries. Each row is claimed with a conditional update, so instances
+// running the job together send it once.
+func RunSubscriptions(db *gorm.DB) {
+	now := time.Now()
+
+	var subscriptions []databases.ReportSubscription
+	if result := db.Where("is_active = ? AND next_run_date <= ?", true, now).Find(&subscriptions); result.Error != nil {
+		log.Printf("[jobs] subscriptions: %v", result.Error)
+		return
+	}
+	for _, subscription := range subscriptions {
+		scheduled := *subscription.NextRunDate
+
+		// next run is saved first so a failing report is not repeated every tick
+		if err := services.ScheduleNext(&subscription, now); err != nil {
+			log.Printf("[jobs] subscription %v: %v", subscription.ID, err)
+		}
+		result := db.Model(&databases.ReportSubscription{}).
+			Where("id = ? AND next_run_date = ?", subscription.ID, scheduled).
+			Update("next_run_date", subscription.NextRunDate)
+		if result.Error != nil {
+			log.Printf("[jobs] subscription %v: %v", subscription.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected != 1 {
+			continue
+		}
+
+		if _, err := services.RunSubscription(db, subscription, scheduled, true); err != nil {
+			log.Printf("[jobs] subscription %v: %v", subscription.ID, err)
+		}
+	}
+
+	var deliveries []databases.ReportDelivery
+	result := db.Preload("Subscription").Where("status = ? AND next_retry_date <= ?", databases.DeliveryFailed, now).Find(&deliveries)
+	if result.Error != nil {
+		log.Printf("[jobs] subscription retries: %v", result.Error)
+		return
+	}
+	for _, delivery := range deliveries {
+		if delivery.Subscription == nil || !delivery.Subscription.IsActive {
+			db.Model(&delivery).Update("next_retry_date", nil)
+			continue
+		}
+		result := db.Model(&databases.ReportDelivery{}).
+			Where("id = ? AND next_retry_date = ?", delivery.ID, delivery.NextRetryDate).
+			Update("next_retry_date", now.Add(retryLease))
+		if result.Error != nil {
+			log.Printf("[jobs] subscription retry %v: %v", delivery.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected != 1 {
+			continue
+		}
+		subscription := *delivery.Subscription
+		delivery.Subscription = nil
+		if err := services.DeliverSubscription(db, subscription, &delivery, true); err != nil {
+			log.Printf("[jobs] subscription %v retry %v: %v", subscription.ID, delivery.Attempts, err)
+		}
+	}
+}
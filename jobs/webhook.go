@@ -0,0 +1,37 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+	gorm "gorm.io/gorm"
+)
+
+// RetryWebhooks retries failed webhook deliveries that are due and pending
+// ones left behind by a restart
+func RetryWebhooks(db *gorm.DB) {
+	now := time.Now()
+
+	var deliveries []databases.WebhookDelivery
+	result := db.Preload("Webhook").
+		Where("(status = ? AND next_retry_date <= ?) OR (status = ? AND modified_date <= ?)",
+			databases.DeliveryFailed, now, databases.DeliveryPending, now.Add(-5*time.Minute)).
+		Find(&deliveries)
+	if result.Error != nil {
+		log.Printf("[jobs] webhooks: %v", result.Error)
+		return
+	}
+	for _, delivery := range deliveries {
+		if delivery.Webhook == nil || !delivery.Webhook.IsActive {
+			db.Model(&delivery).Updates(map[string]interface{}{"status": databases.DeliveryFailed, "next_retry_date": nil})
+			continue
+		}
+		webhook := *delivery.Webhook
+		delivery.Webhook = nil
+		if err := services.DeliverWebhook(db, webhook, &delivery); err != nil {
+			log.Printf("[jobs] webhook %v delivery %v attempt %v: %v", webhook.ID, delivery.ID, delivery.Attempts, err)
+		}
+	}
+}
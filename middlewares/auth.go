@@ -5,6 +5,7 @@ import (
 
 	gin "github.com/gin-gonic/gin"
 	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
 	structs "gitlab.com/fibocloud/aws-billing/api_v2/structs"
 	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
 	gorm "gorm.io/gorm"
@@ -19,9 +20,30 @@ func Response(c *gin.Context, code int, message string) {
 	})
 }
 
-// Authenticate fetches user details from token
+// Authenticate fetches user details from token or API key. API key is sent
+// in X-API-Key header or as Authorization.
 func Authenticate(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		apiKey := c.GetHeader("X-API-Key")
+		if apiKey == "" && services.IsAPIKey(c.GetHeader("Authorization")) {
+			apiKey = c.GetHeader("Authorization")
+		}
+		if apiKey != "" {
+			key, user, err := services.AuthenticateAPIKey(db, apiKey, c.ClientIP())
+			if err != nil {
+				Response(c, http.StatusUnauthorized, err.Error())
+				return
+			}
+			if !services.APIKeyAllows(*key, c.Request.Method, c.FullPath()) {
+				Response(c, http.StatusForbidden, "API key scope does not allow this request")
+				return
+			}
+			c.Set("auth", *user)
+			c.Set("api_key", *key)
+			c.Next()
+			return
+		}
+
 		requiredToken := c.Request.Header["Authorization"]
 		if len(requiredToken) == 0 {
 			Response(c, http.StatusUnauthorized, "Please login to your account")
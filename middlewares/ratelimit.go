@@ -0,0 +1,116 @@
+package middlewares
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	gin "github.com/gin-gonic/gin"
+	databases "gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+)
+
+// RateLimit token bucket of the route group per API key, user or IP. Users
+// with ratelimit.users.<id> use their own limit. API keys with own rate limit
+// also take from the key's bucket. Store errors let the request through.
+func RateLimit(store services.RateLimitStore, group string) gin.HandlerFunc {
+	groupLimit := services.GroupRateLimit(group)
+	return func(c *gin.Context) {
+		var buckets []rateLimitBucket
+		limit := groupLimit
+		if iauth, exists := c.Get("auth"); exists {
+			if _, isKey := c.Get("api_key"); !isKey {
+				limit = services.UserRateLimit(group, iauth.(databases.SystemUser).Base.ID)
+			}
+		}
+		if limit.Requests > 0 {
+			buckets = append(buckets, rateLimitBucket{group + ":" + rateLimitKey(c), limit})
+		}
+		if ikey, exists := c.Get("api_key"); exists {
+			if key := ikey.(databases.APIKey); key.RateLimit > 0 {
+				buckets = append(buckets, rateLimitBucket{fmt.Sprintf("apikey:%v", key.Base.ID), services.APIKeyRateLimit(key)})
+			}
+		}
+		takeRateLimit(c, store, buckets)
+	}
+}
+
+// IPRateLimit token bucket per IP before authentication, so requests with
+// invalid tokens or API keys are limited too
+func IPRateLimit(store services.RateLimitStore) gin.HandlerFunc {
+	limit := services.IPRateLimit()
+	return func(c *gin.Context) {
+		if limit.Requests <= 0 {
+			c.Next()
+			return
+		}
+		takeRateLimit(c, store, []rateLimitBucket{{"ip:" + c.ClientIP(), limit}})
+	}
+}
+
+// rateLimitBucket bucket key and its limit
+type rateLimitBucket struct {
+	key   string
+	limit services.RateLimit
+}
+
+// takeRateLimit takes a token from every bucket until one is empty, headers
+// show the bucket closest to its limit
+func takeRateLimit(c *gin.Context, store services.RateLimitStore, buckets []rateLimitBucket) {
+	var results []services.RateLimitResult
+	allowed := true
+	for _, bucket := range buckets {
+		result, err := store.Take(bucket.key, bucket.limit)
+		if err != nil {
+			log.Printf("[ratelimit] %v: %v", bucket.key, err)
+			continue
+		}
+		results = append(results, result)
+		if !result.Allowed {
+			allowed = false
+			break
+		}
+	}
+	if len(results) == 0 {
+		c.Next()
+		return
+	}
+
+	result := results[0]
+	for _, item := range results[1:] {
+		if !item.Allowed || item.Remaining < result.Remaining {
+			result = item
+		}
+	}
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+
+	if !allowed {
+		retry := seconds(result.RetryAfter)
+		c.Header("Retry-After", strconv.Itoa(retry))
+		Response(c, http.StatusTooManyRequests, fmt.Sprintf("Too many requests, retry after %v seconds", retry))
+		return
+	}
+	c.Next()
+}
+
+// rateLimitKey bucket owner, API key before its user so keys do not use up
+// the user's own requests
+func rateLimitKey(c *gin.Context) string {
+	if ikey, exists := c.Get("api_key"); exists {
+		return fmt.Sprintf("key:%v", ikey.(databases.APIKey).Base.ID)
+	}
+	if iauth, exists := c.Get("auth"); exists {
+		return fmt.Sprintf("user:%v", iauth.(databases.SystemUser).Base.ID)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// seconds whole seconds rounded up
+func seconds(duration time.Duration) int {
+	return int(math.Ceil(duration.Seconds()))
+}
@@ -0,0 +1,105 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gin "github.com/gin-gonic/gin"
+	viper "github.com/spf13/viper"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/services"
+)
+
+// setConfig viper values of the test, cleared when it ends
+func setConfig(t *testing.T, values map[string]interface{}) {
+	for key, value := range values {
+		viper.Set(key, value)
+	}
+	t.Cleanup(func() {
+		for key := range values {
+			viper.Set(key, nil)
+		}
+	})
+}
+
+// statuses response codes of requests to path
+func statuses(router *gin.Engine, path string, requests int) []int {
+	var codes []int
+	for i := 0; i < requests; i++ {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		router.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	return codes
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIPRateLimitBeforeAuthenticate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setConfig(t, map[string]interface{}{"ratelimit.ip.requests": 2, "ratelimit.ip.per": "1m"})
+
+	router := gin.New()
+	router.Use(IPRateLimit(services.NewRateLimitStore(nil)))
+	// invalid token, authentication refuses before group limits run
+	router.GET("/private", func(c *gin.Context) {
+		Response(c, http.StatusUnauthorized, "Please login to your account")
+	})
+
+	codes := statuses(router, "/private", 3)
+	if !equal(codes, []int{401, 401, 429}) {
+		t.Fatalf("unexpected statuses %v", codes)
+	}
+}
+
+func TestRateLimitUserOverride(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setConfig(t, map[string]interface{}{
+		"ratelimit.groups.test.requests": 1,
+		"ratelimit.users.7.requests":     3,
+	})
+
+	router := gin.New()
+	store := services.NewRateLimitStore(nil)
+	auth := func(c *gin.Context) {
+		user := databases.SystemUser{Base: databases.Base{ID: 7}}
+		if c.Query("user") == "8" {
+			user.Base.ID = 8
+		}
+		c.Set("auth", user)
+		if c.Query("key") != "" {
+			c.Set("api_key", databases.APIKey{Base: databases.Base{ID: 1}, UserID: user.Base.ID})
+		}
+	}
+	router.GET("/test", auth, RateLimit(store, "test"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		path  string
+		codes []int
+	}{
+		{"/test", []int{200, 200, 200, 429}},
+		{"/test?user=8", []int{200, 429}},
+		// API keys of the user use the group limit
+		{"/test?key=1", []int{200, 429}},
+	}
+	for _, test := range tests {
+		if codes := statuses(router, test.path, len(test.codes)); !equal(codes, test.codes) {
+			t.Errorf("%v: expected %v, got %v", test.path, test.codes, codes)
+		}
+	}
+}
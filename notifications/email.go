@@ -0,0 +1,101 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+
+	viper "github.com/spf13/viper"
+)
+
+// emailChannel sends notification to its recipients through smtp server of
+// smtp config, attachments are added as MIME parts
+func emailChannel(notification Notification) error {
+	if len(notification.Recipients) == 0 {
+		return errors.New("email recipients are empty")
+	}
+	host := viper.GetString("smtp.host")
+	if host == "" {
+		return errors.New("smtp is not configured")
+	}
+	port := viper.GetString("smtp.port")
+	if port == "" {
+		port = "587"
+	}
+	from := viper.GetString("smtp.from")
+
+	message, err := emailMessage(from, notification)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if username := viper.GetString("smtp.username"); username != "" {
+		auth = smtp.PlainAuth("", username, viper.GetString("smtp.password"), host)
+	}
+	return smtp.SendMail(net.JoinHostPort(host, port), auth, from, notification.Recipients, message)
+}
+
+// emailMessage multipart/mixed message of text body and attachments
+func emailMessage(from string, notification Notification) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	text, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeBase64(text, []byte(notification.Message)); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range notification.Attachments {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(part, attachment.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %v\r\n", from)
+	fmt.Fprintf(&message, "To: %v\r\n", strings.Join(notification.Recipients, ", "))
+	fmt.Fprintf(&message, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8", notification.Subject))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/mixed; boundary=%v\r\n\r\n", writer.Boundary())
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+// writeBase64 base64 with 76 character lines
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := w.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := w.Write([]byte(encoded + "\r\n"))
+	return err
+}
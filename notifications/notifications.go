@@ -0,0 +1,166 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+)
+
+type (
+	// Notification message delivered through channels
+	Notification struct {
+		Event       string       `json:"event"` // budget.threshold ...
+		CompanyID   uint         `json:"company_id"`
+		UserID      uint         `json:"user_id"`
+		Subject     string       `json:"subject"`
+		Message     string       `json:"message"`
+		Data        interface{}  `json:"data"`
+		WebhookURL  string       `json:"-"` // target of webhook channel
+		Recipients  []string     `json:"-"` // target of email channel
+		Attachments []Attachment `json:"attachments,omitempty"`
+		Date        time.Time    `json:"date"`
+	}
+
+	// Attachment file sent with notification, base64 in webhook payload
+	Attachment struct {
+		Name        string `json:"name"`
+		ContentType string `json:"content_type"`
+		Data        []byte `json:"data"`
+	}
+
+	// Channel delivers notification
+	Channel interface {
+		Send(notification Notification) error
+	}
+
+	// ChannelFunc function as channel
+	ChannelFunc func(notification Notification) error
+)
+
+// Send ...
+func (f ChannelFunc) Send(notification Notification) error {
+	return f(notification)
+}
+
+var (
+	mu       sync.RWMutex
+	channels = map[string]Channel{
+		"log":     ChannelFunc(logChannel),
+		"webhook": ChannelFunc(webhookChannel),
+		"email":   ChannelFunc(emailChannel),
+	}
+	client    = utils.PublicClient(10 * time.Second)
+	listeners []func(notification Notification)
+)
+
+// Listen calls listener with every sent notification, whatever its channels
+func Listen(listener func(notification Notification)) {
+	mu.Lock()
+	defer mu.Unlock()
+	listeners = append(listeners, listener)
+}
+
+// Register adds or replaces channel
+func Register(name string, channel Channel) {
+	mu.Lock()
+	defer mu.Unlock()
+	channels[name] = channel
+}
+
+// Channels registered channel names
+func Channels() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	var names []string
+	for name := range channels {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Send delivers notification through named channels, errors of all channels
+// are joined so one failing channel does not stop the others. Listeners get
+// the notification even when it has no channels.
+func Send(names []string, notification Notification) error {
+	if notification.Date.IsZero() {
+		notification.Date = time.Now()
+	}
+
+	var failed []string
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		mu.RLock()
+		channel, ok := channels[name]
+		mu.RUnlock()
+		if !ok {
+			failed = append(failed, name+": unknown channel")
+			continue
+		}
+		if err := channel.Send(notification); err != nil {
+			failed = append(failed, name+": "+err.Error())
+		}
+	}
+
+	mu.RLock()
+	current := listeners
+	mu.RUnlock()
+	for _, listener := range current {
+		listener(notification)
+	}
+
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// SplitChannels comma separated channel names
+func SplitChannels(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func logChannel(notification Notification) error {
+	log.Printf("[notification] %v company=%v user=%v: %v", notification.Event, notification.CompanyID, notification.UserID, notification.Message)
+	return nil
+}
+
+func webhookChannel(notification Notification) error {
+	if notification.WebhookURL == "" {
+		return errors.New("webhook url is empty")
+	}
+	if err := utils.PublicURL(notification.WebhookURL); err != nil {
+		return fmt.Errorf("webhook url %v", err)
+	}
+
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	res, err := client.Post(notification.WebhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %v", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+package report
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type (
+	// ServiceLine one row of top services table
+	ServiceLine struct {
+		Service       string   `json:"service"`
+		Amount        float64  `json:"amount"`
+		Previous      float64  `json:"previous"`
+		ChangePercent *float64 `json:"change_percent"`
+	}
+
+	// DailyPoint cost of one day
+	DailyPoint struct {
+		Date   string  `json:"date"`
+		Amount float64 `json:"amount"`
+	}
+
+	// ForecastSummary month end forecast, only for the current month
+	ForecastSummary struct {
+		MonthEnd float64 `json:"month_end"`
+		Lower    float64 `json:"lower"`
+		Upper    float64 `json:"upper"`
+		Error    string  `json:"error"` // forecast unavailable
+	}
+
+	// BudgetLine monthly budget of the report scope
+	BudgetLine struct {
+		Name     string  `json:"name"`
+		Amount   float64 `json:"amount"`
+		Actual   float64 `json:"actual"`
+		Forecast float64 `json:"forecast"`
+	}
+
+	// MonthlyReport data of the monthly cost report
+	MonthlyReport struct {
+		Title         string           `json:"title"` // company or account name
+		Scope         string           `json:"scope"`
+		Month         string           `json:"month"` // YYYY-MM
+		Currency      string           `json:"currency"`
+		Metric        string           `json:"metric"`
+		Total         float64          `json:"total"`
+		PreviousTotal float64          `json:"previous_total"`
+		ChangePercent *float64         `json:"change_percent"`
+		Services      []ServiceLine    `json:"services"` // largest first
+		Daily         []DailyPoint     `json:"daily"`
+		Forecast      *ForecastSummary `json:"forecast"`
+		Budgets       []BudgetLine     `json:"budgets"`
+		GeneratedDate string           `json:"generated_date"`
+	}
+)
+
+// page layout
+const (
+	margin       = 40.0
+	contentWidth = PageWidth - 2*margin
+	pageBottom   = PageHeight - margin
+)
+
+// Money amount with thousands separators and 2 decimals
+func Money(amount float64) string {
+	text := strconv.FormatFloat(math.Abs(amount), 'f', 2, 64)
+	whole, fraction := text[:len(text)-3], text[len(text)-3:]
+
+	var b strings.Builder
+	if amount < 0 && text != "0.00" {
+		b.WriteByte('-')
+	}
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	b.WriteString(fraction)
+	return b.String()
+}
+
+// Percent signed percent, "-" when unknown
+func Percent(value *float64) string {
+	if value == nil {
+		return "-"
+	}
+	text := strconv.FormatFloat(*value, 'f', 1, 64) + "%"
+	if *value > 0 {
+		text = "+" + text
+	}
+	return text
+}
+
+// changeColor red for increase, green for decrease
+func changeColor(value *float64) Color {
+	switch {
+	case value == nil:
+		return Gray
+	case *value > 0:
+		return Red
+	case *value < 0:
+		return Green
+	}
+	return Black
+}
+
+// monthlyLayout keeps the vertical position and breaks pages
+type monthlyLayout struct {
+	doc    *Document
+	report MonthlyReport
+	y      float64
+}
+
+// ensure starts a new page when height does not fit
+func (l *monthlyLayout) ensure(height float64) {
+	if l.y+height > pageBottom {
+		l.doc.AddPage()
+		l.y = margin
+	}
+}
+
+// section title with a rule under it
+func (l *monthlyLayout) section(title string) {
+	l.ensure(40)
+	l.y += 24
+	l.doc.Text(margin, l.y, 12, true, Black, title)
+	l.y += 6
+	l.doc.Line(margin, l.y, margin+contentWidth, l.y, 0.5, LightGray)
+	l.y += 8
+}
+
+func (l *monthlyLayout) header() {
+	r := l.report
+	l.y = margin + 18
+	l.doc.Text(margin, l.y, 18, true, Black, "Monthly cost report")
+	l.doc.TextRight(margin+contentWidth, l.y, 12, true, Blue, r.Month)
+	l.y += 18
+	l.doc.Text(margin, l.y, 10, false, Gray, Truncate(r.Title+" - "+r.Scope, contentWidth-160, 10, false))
+	l.doc.TextRight(margin+contentWidth, l.y, 8, false, Gray, "Generated "+r.GeneratedDate)
+	l.y += 6
+}
+
+// summary boxes of total, previous month, change and forecast
+func (l *monthlyLayout) summary() {
+	r := l.report
+	forecast := "-"
+	if r.Forecast != nil && r.Forecast.Error == "" {
+		forecast = Money(r.Forecast.MonthEnd)
+	}
+	boxes := []struct {
+		label, value string
+		color        Color
+	}{
+		{"Total", Money(r.Total), Black},
+		{"Previous month", Money(r.PreviousTotal), Black},
+		{"Month over month", Percent(r.ChangePercent), changeColor(r.ChangePercent)},
+		{"Forecast month end", forecast, Black},
+	}
+
+	l.y += 14
+	gap := 10.0
+	width := (contentWidth - gap*float64(len(boxes)-1)) / float64(len(boxes))
+	for i, box := range boxes {
+		x := margin + float64(i)*(width+gap)
+		l.doc.Rect(x, l.y, width, 52, LightGray)
+		l.doc.Text(x+8, l.y+16, 8, false, Gray, box.label)
+		l.doc.Text(x+8, l.y+38, 14, true, box.color, Truncate(box.value, width-16, 14, true))
+	}
+	l.y += 52
+	l.doc.Text(margin, l.y+12, 7, false, Gray, r.Metric+", amounts in "+r.Currency)
+	l.y += 12
+}
+
+// daily bar chart
+func (l *monthlyLayout) daily() {
+	l.section("Daily spend")
+	days := l.report.Daily
+	height := 140.0
+	l.ensure(height + 24)
+	if len(days) == 0 {
+		l.doc.Text(margin, l.y+12, 9, false, Gray, "No cost in this month")
+		l.y += 16
+		return
+	}
+
+	max := 0.0
+	for _, day := range days {
+		max = math.Max(max, day.Amount)
+	}
+	axis := 50.0 // room for amount labels
+	left := margin + axis
+	width := contentWidth - axis
+	top := l.y + 4
+	bottom := top + height
+
+	l.doc.TextRight(left-4, top+6, 7, false, Gray, Money(max))
+	l.doc.TextRight(left-4, bottom, 7, false, Gray, "0.00")
+	l.doc.Line(left, top, left+width, top, 0.3, LightGray)
+	l.doc.Line(left, top+height/2, left+width, top+height/2, 0.3, LightGray)
+
+	slot := width / float64(len(days))
+	for i, day := range days {
+		x := left + float64(i)*slot
+		if max > 0 && day.Amount > 0 {
+			bar := day.Amount / max * height
+			l.doc.Rect(x+slot*0.15, bottom-bar, slot*0.7, bar, Blue)
+		}
+		if i == 0 || (i+1)%5 == 0 {
+			label := day.Date
+			if len(label) == 10 {
+				label = label[8:]
+			}
+			l.doc.Text(x+slot/2-TextWidth(label, 7, false)/2, bottom+10, 7, false, Gray, label)
+		}
+	}
+	l.doc.Line(left, bottom, left+width, bottom, 0.5, Gray)
+	l.y = bottom + 14
+}
+
+// services table of amount, previous month and change
+func (l *monthlyLayout) services() {
+	l.section("Top services")
+	services := l.report.Services
+	if len(services) == 0 {
+		l.doc.Text(margin, l.y+12, 9, false, Gray, "No cost in this month")
+		l.y += 16
+		return
+	}
+
+	right := margin + contentWidth
+	row := func(y float64, bold bool, color Color, name, amount, previous, change string, changeColor Color) {
+		l.doc.Text(margin, y, 9, bold, color, Truncate(name, 270, 9, bold))
+		l.doc.TextRight(right-170, y, 9, bold, color, amount)
+		l.doc.TextRight(right-80, y, 9, bold, color, previous)
+		l.doc.TextRight(right, y, 9, bold, changeColor, change)
+	}
+
+	l.y += 12
+	row(l.y, true, Gray, "Service", "This month", "Previous month", "Change", Gray)
+	l.y += 4
+	for i, service := range services {
+		l.ensure(18)
+		l.y += 16
+		if i%2 == 0 {
+			l.doc.Rect(margin, l.y-11, contentWidth, 16, Color{0.96, 0.96, 0.96})
+		}
+		row(l.y, false, Black, service.Service, Money(service.Amount), Money(service.Previous),
+			Percent(service.ChangePercent), changeColor(service.ChangePercent))
+	}
+	l.y += 6
+}
+
+// forecast of the remaining month
+func (l *monthlyLayout) forecast() {
+	f := l.report.Forecast
+	if f == nil {
+		return
+	}
+	l.section("Forecast")
+	l.y += 12
+	if f.Error != "" {
+		l.doc.Text(margin, l.y, 9, false, Gray, Truncate("Forecast unavailable: "+f.Error, contentWidth, 9, false))
+		l.y += 4
+		return
+	}
+	l.doc.Text(margin, l.y, 9, false, Black, "Month end "+Money(f.MonthEnd)+" "+l.report.Currency)
+	l.doc.TextRight(margin+contentWidth, l.y, 9, false, Gray,
+		"Prediction interval "+Money(f.Lower)+" - "+Money(f.Upper))
+	l.y += 4
+}
+
+// budgets with actual and forecast progress bars
+func (l *monthlyLayout) budgets() {
+	budgets := l.report.Budgets
+	if len(budgets) == 0 {
+		return
+	}
+	l.section("Budgets")
+	right := margin + contentWidth
+	barLeft := margin + 300
+	barWidth := contentWidth - 300 - 60
+	for _, budget := range budgets {
+		l.ensure(34)
+		l.y += 14
+		l.doc.Text(margin, l.y, 9, true, Black, Truncate(budget.Name, 180, 9, true))
+		l.doc.TextRight(margin+290, l.y, 9, false, Gray, Money(budget.Actual)+" / "+Money(budget.Amount))
+
+		actual, forecast := 0.0, 0.0
+		if budget.Amount > 0 {
+			actual = budget.Actual / budget.Amount
+			forecast = budget.Forecast / budget.Amount
+		}
+		color := Green
+		if forecast > 1 {
+			color = Orange
+		}
+		if actual > 1 {
+			color = Red
+		}
+		l.doc.Rect(barLeft, l.y-8, barWidth, 9, LightGray)
+		l.doc.Rect(barLeft, l.y-8, barWidth*math.Min(forecast, 1), 9, LightBlue)
+		l.doc.Rect(barLeft, l.y-8, barWidth*math.Min(actual, 1), 9, color)
+		l.doc.TextRight(right, l.y, 9, true, color, strconv.FormatFloat(actual*100, 'f', 0, 64)+"%")
+		l.y += 12
+		l.doc.Text(margin, l.y, 7, false, Gray, "Forecast "+Money(budget.Forecast)+" ("+
+			strconv.FormatFloat(forecast*100, 'f', 0, 64)+"% of budget)")
+	}
+	l.y += 4
+}
+
+// footer page numbers
+func (l *monthlyLayout) footer() {
+	pages := l.doc.Pages()
+	for i := range l.doc.pages {
+		l.doc.page = l.doc.pages[i]
+		text := "Page " + strconv.Itoa(i+1) + " of " + strconv.Itoa(pages)
+		l.doc.TextRight(margin+contentWidth, PageHeight-20, 7, false, Gray, text)
+	}
+}
+
+// RenderMonthly writes the monthly report as PDF
+func RenderMonthly(w io.Writer, r MonthlyReport) error {
+	l := &monthlyLayout{doc: NewDocument(), report: r}
+	l.header()
+	l.summary()
+	l.daily()
+	l.services()
+	l.forecast()
+	l.budgets()
+	l.footer()
+	_, err := l.doc.WriteTo(w)
+	return err
+}
@@ -0,0 +1,215 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A4 page size in points
+const (
+	PageWidth  = 595.0
+	PageHeight = 842.0
+)
+
+// Color RGB color, components 0-1
+type Color struct {
+	R, G, B float64
+}
+
+// Colors used by reports
+var (
+	Black     = Color{0, 0, 0}
+	Gray      = Color{0.45, 0.45, 0.45}
+	LightGray = Color{0.9, 0.9, 0.9}
+	Blue      = Color{0.16, 0.44, 0.75}
+	LightBlue = Color{0.67, 0.8, 0.93}
+	Green     = Color{0.18, 0.6, 0.3}
+	Orange    = Color{0.93, 0.55, 0.1}
+	Red       = Color{0.8, 0.15, 0.15}
+)
+
+// helvetica widths of characters 32-126 in 1/1000 of font size
+var helvetica = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// helveticaBold widths of characters 32-126 in 1/1000 of font size
+var helveticaBold = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+// Document PDF document of Helvetica text and vector shapes. Coordinates
+// start at the top left corner of the page, y grows downwards.
+type Document struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+}
+
+// NewDocument document with one empty A4 page
+func NewDocument() *Document {
+	d := &Document{}
+	d.AddPage()
+	return d
+}
+
+// AddPage starts a new page
+func (d *Document) AddPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+}
+
+// Pages number of pages
+func (d *Document) Pages() int {
+	return len(d.pages)
+}
+
+// number PDF number with at most 2 decimals
+func number(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// latin1 text in WinAnsi encoding, characters outside Latin-1 become '?'
+func latin1(text string) []byte {
+	out := make([]byte, 0, len(text))
+	for _, r := range text {
+		if r > 255 {
+			r = '?'
+		}
+		out = append(out, byte(r))
+	}
+	return out
+}
+
+// escape PDF literal string
+func escape(text []byte) string {
+	var b strings.Builder
+	for _, c := range text {
+		switch c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\r', '\n':
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// TextWidth width of text in points
+func TextWidth(text string, size float64, bold bool) float64 {
+	widths := &helvetica
+	if bold {
+		widths = &helveticaBold
+	}
+	total := 0
+	for _, c := range latin1(text) {
+		if c >= 32 && c <= 126 {
+			total += widths[c-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// Truncate shortens text to fit the width, ending with "..."
+func Truncate(text string, width, size float64, bold bool) string {
+	if TextWidth(text, size, bold) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && TextWidth(string(runes)+"...", size, bold) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// color fill and stroke color operators
+func (d *Document) color(c Color) {
+	fmt.Fprintf(d.page, "%v %v %v rg %v %v %v RG\n",
+		number(c.R), number(c.G), number(c.B), number(c.R), number(c.G), number(c.B))
+}
+
+// Text draws text with its baseline at y
+func (d *Document) Text(x, y, size float64, bold bool, color Color, text string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	d.color(color)
+	fmt.Fprintf(d.page, "BT /%v %v Tf %v %v Td (%v) Tj ET\n",
+		font, number(size), number(x), number(PageHeight-y), escape(latin1(text)))
+}
+
+// TextRight draws text ending at x
+func (d *Document) TextRight(x, y, size float64, bold bool, color Color, text string) {
+	d.Text(x-TextWidth(text, size, bold), y, size, bold, color, text)
+}
+
+// Rect fills rectangle with its top left corner at x, y
+func (d *Document) Rect(x, y, width, height float64, color Color) {
+	d.color(color)
+	fmt.Fprintf(d.page, "%v %v %v %v re f\n",
+		number(x), number(PageHeight-y-height), number(width), number(height))
+}
+
+// Line draws line
+func (d *Document) Line(x1, y1, x2, y2, width float64, color Color) {
+	d.color(color)
+	fmt.Fprintf(d.page, "%v w %v %v m %v %v l S\n",
+		number(width), number(x1), number(PageHeight-y1), number(x2), number(PageHeight-y2))
+}
+
+// WriteTo writes the document, output has no timestamps so the same
+// document always gives the same bytes
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	var out bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%v 0 obj\n%v\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1 catalog, 2 pages, 3-4 fonts, then page and content per page
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = strconv.Itoa(5+i*2) + " 0 R"
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%v] /Count %v >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %v %v] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %v 0 R >>",
+			number(PageWidth), number(PageHeight), 6+i*2))
+		object(fmt.Sprintf("<< /Length %v >>\nstream\n%vendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %v\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %v /Root 1 0 R >>\nstartxref\n%v\n%%%%EOF\n", len(offsets)+1, xref)
+
+	n, err := w.Write(out.Bytes())
+	return int64(n), err
+}
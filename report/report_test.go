@@ -0,0 +1,111 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// update rewrites golden files: go test ./report -update
+var update = flag.Bool("update", false, "update golden files")
+
+// golden compares output with testdata/name
+func golden(t *testing.T, name string, output []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(path, output, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, expected) {
+		t.Fatalf("output differs from %v, run go test ./report -update and review the diff", path)
+	}
+}
+
+func TestRenderMonthly(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "monthly.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report MonthlyReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := RenderMonthly(&out, report); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "monthly.pdf", out.Bytes())
+
+	// no timestamps, same input gives same bytes
+	var again bytes.Buffer
+	RenderMonthly(&again, report)
+	if !bytes.Equal(out.Bytes(), again.Bytes()) {
+		t.Fatal("output is not deterministic")
+	}
+}
+
+func TestRenderMonthlyEmpty(t *testing.T) {
+	var out bytes.Buffer
+	err := RenderMonthly(&out, MonthlyReport{
+		Title:         "Empty",
+		Scope:         "Company",
+		Month:         "2021-03",
+		Currency:      "USD",
+		Metric:        "UnblendedCost",
+		Forecast:      &ForecastSummary{Error: "Forecast is not available"},
+		GeneratedDate: "2021-04-01 08:00",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "monthly_empty.pdf", out.Bytes())
+}
+
+func TestDocument(t *testing.T) {
+	doc := NewDocument()
+	doc.Text(40, 60, 12, true, Black, "Escaped (parens) \\ back\nslash")
+	doc.Text(40, 80, 10, false, Blue, "Latin-1 é ü, outside Latin-1 Тест")
+	doc.TextRight(555, 100, 8, false, Gray, Truncate("A long text truncated to the available width of the cell", 120, 8, false))
+	doc.Rect(40, 120, 200, 20, LightGray)
+	doc.Line(40, 150, 555, 150, 0.5, Red)
+	doc.AddPage()
+	doc.Text(40, 60, 12, false, Green, "Second page")
+
+	var out bytes.Buffer
+	if _, err := doc.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "document.pdf", out.Bytes())
+}
+
+func TestMoney(t *testing.T) {
+	change := func(value float64) *float64 { return &value }
+	tests := []struct {
+		text, expected string
+	}{
+		{Money(0), "0.00"},
+		{Money(-0.001), "0.00"},
+		{Money(999.995), "1,000.00"},
+		{Money(1234567.891), "1,234,567.89"},
+		{Money(-1234.5), "-1,234.50"},
+		{Percent(nil), "-"},
+		{Percent(change(6.66)), "+6.7%"},
+		{Percent(change(-12)), "-12.0%"},
+		{Percent(change(0)), "0.0%"},
+	}
+	for _, test := range tests {
+		if test.text != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, test.text)
+		}
+	}
+}
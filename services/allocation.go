@@ -0,0 +1,658 @@
+package services
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	"gitlab.com/fibocloud/aws-billing/api_v2/cur"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+	gorm "gorm.io/gorm"
+)
+
+// monthFormat allocation month format
+const monthFormat = "2006-01"
+
+// Unallocated cost center of spend no rule matched
+const Unallocated = "Unallocated"
+
+// Allocation source
+const (
+	AllocationSourceCur          = "cur"
+	AllocationSourceCostExplorer = "costexplorer"
+)
+
+var allocationMatchTypes = []string{
+	databases.AllocationMatchAccount,
+	databases.AllocationMatchTag,
+	databases.AllocationMatchService,
+	databases.AllocationMatchUsageType,
+}
+
+var allocationSplitMethods = []string{databases.SplitProportional, databases.SplitFixed, databases.SplitEven}
+
+type (
+	// AllocationLine spend of one account, service, usage type and tags combination
+	AllocationLine struct {
+		Account   string            `json:"account"`
+		Service   string            `json:"service"`
+		UsageType string            `json:"usage_type"`
+		Tags      map[string]string `json:"tags"`
+		Cost      float64           `json:"cost"`
+	}
+
+	// AllocationCostCenter allocated spend of one cost center
+	AllocationCostCenter struct {
+		CostCenter string             `json:"cost_center"`
+		Direct     float64            `json:"direct"`
+		Shared     float64            `json:"shared"`
+		Total      float64            `json:"total"`
+		Services   map[string]float64 `json:"services"`    // direct spend per service
+		SharedFrom map[string]float64 `json:"shared_from"` // split name => share
+	}
+
+	// AllocationSplitResult shared pool and how it was split
+	AllocationSplitResult struct {
+		Name   string             `json:"name"`
+		Method string             `json:"method"`
+		Amount float64            `json:"amount"`
+		Shares map[string]float64 `json:"shares"`
+	}
+
+	// AllocationResult allocation of one month
+	AllocationResult struct {
+		Month       string                  `json:"month"`
+		Source      string                  `json:"source"`
+		RuleSetID   uint                    `json:"rule_set_id"`
+		Version     int                     `json:"version"`
+		Total       float64                 `json:"total"`
+		CostCenters []AllocationCostCenter  `json:"cost_centers"`
+		Splits      []AllocationSplitResult `json:"splits"`
+		Warnings    []string                `json:"warnings"`
+	}
+)
+
+// companyRows rows of user's company, own rows when user has no company
+func companyRows(db *gorm.DB, user databases.SystemUser) *gorm.DB {
+	if user.CompanyID != 0 {
+		return db.Where("company_id = ?", user.CompanyID)
+	}
+	return db.Where("user_id = ?", user.Base.ID)
+}
+
+// parseMonth start and end of YYYY-MM month
+func parseMonth(field, value string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(monthFormat, value, utils.Location())
+	if err != nil {
+		return start, start, NewParamError(field, "must be YYYY-MM")
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// splitValues comma separated values
+func splitValues(value string) []string {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+// joinValues comma separated value, commas inside values are not allowed
+func joinValues(field string, values []string) (string, error) {
+	var items []string
+	for _, item := range values {
+		item = strings.TrimSpace(item)
+		if strings.Contains(item, ",") {
+			return "", NewParamError(field, "values must not contain comma")
+		}
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return "", NewParamError(field, "at least one value is required")
+	}
+	return strings.Join(items, ","), nil
+}
+
+// validateMatch match type and its key
+func validateMatch(field, matchType, matchKey string) error {
+	if err := oneOf(field+".match_type", matchType, allocationMatchTypes); err != nil {
+		return err
+	}
+	if matchType == databases.AllocationMatchTag && strings.TrimSpace(matchKey) == "" {
+		return NewParamError(field+".match_key", "tag key is required")
+	}
+	return nil
+}
+
+// RuleSetFromParams validates params and builds unsaved rule set
+func RuleSetFromParams(params form.AllocationRuleSetParams) (*databases.AllocationRuleSet, error) {
+	if _, _, err := parseMonth("effective_from", params.EffectiveFrom); err != nil {
+		return nil, err
+	}
+	if params.EffectiveTo != "" {
+		if _, _, err := parseMonth("effective_to", params.EffectiveTo); err != nil {
+			return nil, err
+		}
+		if params.EffectiveTo <= params.EffectiveFrom {
+			return nil, NewParamError("effective_to", "must be after effective_from")
+		}
+	}
+
+	ruleSet := &databases.AllocationRuleSet{
+		Name:          params.Name,
+		EffectiveFrom: params.EffectiveFrom,
+		EffectiveTo:   params.EffectiveTo,
+		Note:          params.Note,
+	}
+
+	for i, rule := range params.Rules {
+		field := "rules[" + strconv.Itoa(i) + "]"
+		if err := validateMatch(field, rule.MatchType, rule.MatchKey); err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(rule.CostCenter) == "" || rule.CostCenter == Unallocated {
+			return nil, NewParamError(field+".cost_center", "invalid cost center")
+		}
+		values, err := joinValues(field+".values", rule.Values)
+		if err != nil {
+			return nil, err
+		}
+		ruleSet.Rules = append(ruleSet.Rules, databases.AllocationRule{
+			Priority:   rule.Priority,
+			CostCenter: strings.TrimSpace(rule.CostCenter),
+			MatchType:  rule.MatchType,
+			MatchKey:   strings.TrimSpace(rule.MatchKey),
+			Values:     values,
+		})
+	}
+
+	for i, split := range params.Splits {
+		field := "splits[" + strconv.Itoa(i) + "]"
+		if err := validateMatch(field, split.MatchType, split.MatchKey); err != nil {
+			return nil, err
+		}
+		if err := oneOf(field+".method", split.Method, allocationSplitMethods); err != nil {
+			return nil, err
+		}
+		values, err := joinValues(field+".values", split.Values)
+		if err != nil {
+			return nil, err
+		}
+
+		item := databases.AllocationSplit{
+			Name:      split.Name,
+			MatchType: split.MatchType,
+			MatchKey:  strings.TrimSpace(split.MatchKey),
+			Values:    values,
+			Method:    split.Method,
+		}
+		if len(split.Targets) > 0 {
+			if item.Targets, err = joinValues(field+".targets", split.Targets); err != nil {
+				return nil, err
+			}
+		}
+
+		if split.Method == databases.SplitFixed {
+			if len(split.Targets) == 0 || len(split.Percentages) != len(split.Targets) {
+				return nil, NewParamError(field+".percentages", "one percentage per target is required")
+			}
+			var sum float64
+			var percentages []string
+			for _, percentage := range split.Percentages {
+				if percentage < 0 {
+					return nil, NewParamError(field+".percentages", "must not be negative")
+				}
+				sum += percentage
+				percentages = append(percentages, strconv.FormatFloat(percentage, 'f', -1, 64))
+			}
+			if math.Abs(sum-100) > 0.01 {
+				return nil, NewParamError(field+".percentages", "must sum to 100")
+			}
+			item.Percentages = strings.Join(percentages, ",")
+		}
+		ruleSet.Splits = append(ruleSet.Splits, item)
+	}
+	return ruleSet, nil
+}
+
+// CreateAllocationRuleSet stores rule set as the next version of user's company
+func CreateAllocationRuleSet(db *gorm.DB, user databases.SystemUser, params form.AllocationRuleSetParams) (*databases.AllocationRuleSet, error) {
+	ruleSet, err := RuleSetFromParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	ruleSet.CompanyID = user.CompanyID
+	ruleSet.UserID = user.Base.ID
+	ruleSet.Base = databases.Base{CreatedDate: now, ModifiedDate: now}
+	for i := range ruleSet.Rules {
+		ruleSet.Rules[i].Base = databases.Base{CreatedDate: now, ModifiedDate: now}
+	}
+	for i := range ruleSet.Splits {
+		ruleSet.Splits[i].Base = databases.Base{CreatedDate: now, ModifiedDate: now}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var version int
+		if err := companyRows(tx.Model(&databases.AllocationRuleSet{}), user).
+			Select("COALESCE(MAX(version), 0)").Scan(&version).Error; err != nil {
+			return err
+		}
+		ruleSet.Version = version + 1
+		return tx.Create(ruleSet).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ruleSet, nil
+}
+
+// GetAllocationRuleSet rule set of user's company with rules and splits
+func GetAllocationRuleSet(db *gorm.DB, user databases.SystemUser, id uint) (*databases.AllocationRuleSet, error) {
+	var ruleSet databases.AllocationRuleSet
+	result := companyRows(db.Preload("Rules").Preload("Splits"), user).Limit(1).Find(&ruleSet, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, NewParamError("rule_set_id", "rule set not found")
+	}
+	return &ruleSet, nil
+}
+
+// EffectiveRuleSet latest version effective in the month
+func EffectiveRuleSet(db *gorm.DB, user databases.SystemUser, month string) (*databases.AllocationRuleSet, error) {
+	var ruleSet databases.AllocationRuleSet
+	result := companyRows(db.Preload("Rules").Preload("Splits"), user).
+		Where("effective_from <= ? AND (effective_to = '' OR effective_to > ?)", month, month).
+		Order("effective_from desc, version desc").Limit(1).Find(&ruleSet)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, NewParamError("month", "no allocation rules effective in "+month)
+	}
+	return &ruleSet, nil
+}
+
+// CurAllocationLines spend of the month from imported CUR line items without credits and refunds
+func CurAllocationLines(db *gorm.DB, user databases.SystemUser, month string) ([]AllocationLine, error) {
+	type row struct {
+		UsageAccountID string
+		ServiceName    string
+		UsageType      string
+		Tags           string
+		Cost           float64
+	}
+
+	query := db.Model(&databases.CurLineItem{})
+	if user.CompanyID != 0 {
+		query = query.Where("company_id = ?", user.CompanyID)
+	} else {
+		query = query.Where("user_id = ?", user.Base.ID)
+	}
+
+	var rows []row
+	result := query.Where("billing_period = ? AND line_item_type NOT IN (?)", month, []string{credit, refund}).
+		Select("usage_account_id, service_name, usage_type, tags, sum(unblended_cost) as cost").
+		Group("usage_account_id, service_name, usage_type, tags").
+		Scan(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	lines := make([]AllocationLine, 0, len(rows))
+	for _, item := range rows {
+		line := AllocationLine{
+			Account:   item.UsageAccountID,
+			Service:   item.ServiceName,
+			UsageType: item.UsageType,
+			Cost:      item.Cost,
+		}
+		if item.Tags != "" {
+			json.Unmarshal([]byte(item.Tags), &line.Tags)
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// CostExplorerAllocationLines spend of the month per linked account and service,
+// Cost Explorer has no tags nor usage types in this grouping
+func CostExplorerAllocationLines(svc costexploreriface.CostExplorerAPI, month string) ([]AllocationLine, error) {
+	start, end, err := parseMonth("month", month)
+	if err != nil {
+		return nil, err
+	}
+
+	metric := "UnblendedCost"
+	output, err := GetCostAndUsage(svc, &costexplorer.GetCostAndUsageInput{
+		Granularity: aws.String(costexplorer.GranularityMonthly),
+		Metrics:     []*string{aws.String(metric)},
+		Filter:      CostFilter(nil),
+		GroupBy: []*costexplorer.GroupDefinition{
+			GroupDefinition(costexplorer.DimensionLinkedAccount, ""),
+			GroupDefinition(costexplorer.DimensionService, ""),
+		},
+		TimePeriod: &costexplorer.DateInterval{
+			Start: aws.String(start.Format(utils.DateFormat)),
+			End:   aws.String(end.Format(utils.DateFormat)),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []AllocationLine
+	for _, period := range output.ResultsByTime {
+		for _, group := range period.Groups {
+			keys := aws.StringValueSlice(group.Keys)
+			if len(keys) != 2 {
+				continue
+			}
+			lines = append(lines, AllocationLine{
+				Account: keys[0],
+				Service: keys[1],
+				Cost:    Amount(group.Metrics[metric]),
+			})
+		}
+	}
+	return lines, nil
+}
+
+// matchValue value equals one of values, trailing * matches prefix
+func matchValue(value string, values []string) bool {
+	for _, item := range values {
+		if strings.HasSuffix(item, "*") {
+			if strings.HasPrefix(value, strings.TrimSuffix(item, "*")) {
+				return true
+			}
+			continue
+		}
+		if value == item {
+			return true
+		}
+	}
+	return false
+}
+
+// tagValue CUR stores user tags as user_<key>, keys are compared in canonical form
+func tagValue(tags map[string]string, key string) (string, bool) {
+	key = cur.CanonicalColumn(key)
+	if value, ok := tags[key]; ok {
+		return value, true
+	}
+	value, ok := tags["user_"+key]
+	return value, ok
+}
+
+// matchLine line matches the match type, key and comma separated values
+func matchLine(line AllocationLine, matchType, matchKey, values string) bool {
+	items := splitValues(values)
+	switch matchType {
+	case databases.AllocationMatchAccount:
+		return matchValue(line.Account, items)
+	case databases.AllocationMatchService:
+		return matchValue(line.Service, items)
+	case databases.AllocationMatchUsageType:
+		return matchValue(line.UsageType, items)
+	case databases.AllocationMatchTag:
+		value, ok := tagValue(line.Tags, matchKey)
+		return ok && matchValue(value, items)
+	}
+	return false
+}
+
+// Allocate assigns lines to cost centers: a line of a shared split goes to
+// the split pool, otherwise to the first matching rule by priority, else
+// Unallocated. Pools are then split between cost centers.
+func Allocate(lines []AllocationLine, ruleSet databases.AllocationRuleSet) *AllocationResult {
+	result := &AllocationResult{RuleSetID: ruleSet.Base.ID, Version: ruleSet.Version}
+
+	rules := make([]databases.AllocationRule, len(ruleSet.Rules))
+	copy(rules, ruleSet.Rules)
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Priority < rules[j].Priority })
+
+	centers := map[string]*AllocationCostCenter{}
+	center := func(name string) *AllocationCostCenter {
+		if item, ok := centers[name]; ok {
+			return item
+		}
+		item := &AllocationCostCenter{CostCenter: name, Services: map[string]float64{}, SharedFrom: map[string]float64{}}
+		centers[name] = item
+		return item
+	}
+	for _, rule := range rules {
+		center(rule.CostCenter)
+	}
+
+	pools := make([]float64, len(ruleSet.Splits))
+	for _, line := range lines {
+		result.Total += line.Cost
+
+		shared := false
+		for i, split := range ruleSet.Splits {
+			if matchLine(line, split.MatchType, split.MatchKey, split.Values) {
+				pools[i] += line.Cost
+				shared = true
+				break
+			}
+		}
+		if shared {
+			continue
+		}
+
+		name := Unallocated
+		for _, rule := range rules {
+			if matchLine(line, rule.MatchType, rule.MatchKey, rule.Values) {
+				name = rule.CostCenter
+				break
+			}
+		}
+		item := center(name)
+		item.Direct += line.Cost
+		item.Services[line.Service] += line.Cost
+	}
+
+	for i, split := range ruleSet.Splits {
+		shares := splitShares(split, centers)
+		if len(shares) == 0 && pools[i] != 0 {
+			shares = map[string]float64{Unallocated: 1}
+			result.Warnings = append(result.Warnings, split.Name+": no cost center to split between")
+		}
+
+		splitResult := AllocationSplitResult{Name: split.Name, Method: split.Method, Amount: pools[i], Shares: map[string]float64{}}
+		for name, share := range shares {
+			amount := pools[i] * share
+			item := center(name)
+			item.Shared += amount
+			item.SharedFrom[split.Name] += amount
+			splitResult.Shares[name] = amount
+		}
+		result.Splits = append(result.Splits, splitResult)
+	}
+
+	for _, item := range centers {
+		item.Total = item.Direct + item.Shared
+		if item.CostCenter == Unallocated && item.Total == 0 {
+			continue
+		}
+		result.CostCenters = append(result.CostCenters, *item)
+	}
+	sort.Slice(result.CostCenters, func(i, j int) bool {
+		return result.CostCenters[i].Total > result.CostCenters[j].Total
+	})
+	return result
+}
+
+// splitShares share of each target cost center, sums to 1
+func splitShares(split databases.AllocationSplit, centers map[string]*AllocationCostCenter) map[string]float64 {
+	targets := splitValues(split.Targets)
+	if len(targets) == 0 {
+		for name := range centers {
+			if name != Unallocated {
+				targets = append(targets, name)
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	shares := map[string]float64{}
+	switch split.Method {
+	case databases.SplitFixed:
+		for i, percentage := range splitValues(split.Percentages) {
+			if i >= len(targets) {
+				break
+			}
+			value, _ := strconv.ParseFloat(percentage, 64)
+			shares[targets[i]] += value / 100
+		}
+		return shares
+	case databases.SplitProportional:
+		var base float64
+		for _, name := range targets {
+			if item, ok := centers[name]; ok && item.Direct > 0 {
+				base += item.Direct
+			}
+		}
+		if base > 0 {
+			for _, name := range targets {
+				if item, ok := centers[name]; ok && item.Direct > 0 {
+					shares[name] += item.Direct / base
+				}
+			}
+			return shares
+		}
+	}
+
+	// even, proportional without direct spend
+	for _, name := range targets {
+		shares[name] += 1 / float64(len(targets))
+	}
+	return shares
+}
+
+// allocationLines lines of the month from the source
+func allocationLines(db *gorm.DB, svc costexploreriface.CostExplorerAPI, user databases.SystemUser, params form.AllocationRunParams) ([]AllocationLine, error) {
+	if params.Source == AllocationSourceCostExplorer {
+		return CostExplorerAllocationLines(svc, params.Month)
+	}
+	return CurAllocationLines(db, user, params.Month)
+}
+
+// PreviewAllocation allocates the month without storing it, by the given
+// unsaved rules, the given version or the version effective in the month
+func PreviewAllocation(db *gorm.DB, svc costexploreriface.CostExplorerAPI, user databases.SystemUser, params form.AllocationRunParams) (*AllocationResult, error) {
+	if _, _, err := parseMonth("month", params.Month); err != nil {
+		return nil, err
+	}
+	if params.Source == "" {
+		params.Source = AllocationSourceCur
+	}
+	if err := oneOf("source", params.Source, []string{AllocationSourceCur, AllocationSourceCostExplorer}); err != nil {
+		return nil, err
+	}
+
+	var ruleSet *databases.AllocationRuleSet
+	var err error
+	switch {
+	case params.RuleSet != nil:
+		ruleSet, err = RuleSetFromParams(*params.RuleSet)
+	case params.RuleSetID != 0:
+		ruleSet, err = GetAllocationRuleSet(db, user, params.RuleSetID)
+	default:
+		ruleSet, err = EffectiveRuleSet(db, user, params.Month)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := allocationLines(db, svc, user, params)
+	if err != nil {
+		return nil, err
+	}
+
+	result := Allocate(lines, *ruleSet)
+	result.Month = params.Month
+	result.Source = params.Source
+	if params.Source == AllocationSourceCostExplorer {
+		for _, rule := range ruleSet.Rules {
+			if rule.MatchType == databases.AllocationMatchTag || rule.MatchType == databases.AllocationMatchUsageType {
+				result.Warnings = append(result.Warnings, "rule "+rule.CostCenter+": "+rule.MatchType+" does not match Cost Explorer spend")
+			}
+		}
+	}
+	if len(lines) == 0 {
+		result.Warnings = append(result.Warnings, "no spend found in "+params.Month)
+	}
+	return result, nil
+}
+
+// RunAllocation allocates the month by the effective version and replaces its statements
+func RunAllocation(db *gorm.DB, svc costexploreriface.CostExplorerAPI, user databases.SystemUser, params form.AllocationRunParams) ([]databases.AllocationStatement, error) {
+	if params.RuleSet != nil {
+		return nil, NewParamError("rule_set", "unsaved rules can only be previewed")
+	}
+
+	result, err := PreviewAllocation(db, svc, user, params)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	statements := make([]databases.AllocationStatement, 0, len(result.CostCenters))
+	for _, item := range result.CostCenters {
+		details, _ := json.Marshal(map[string]interface{}{
+			"services":    item.Services,
+			"shared_from": item.SharedFrom,
+		})
+		statement := databases.AllocationStatement{
+			Base:       databases.Base{CreatedDate: now, ModifiedDate: now},
+			CompanyID:  user.CompanyID,
+			Month:      result.Month,
+			CostCenter: item.CostCenter,
+			RuleSetID:  result.RuleSetID,
+			Version:    result.Version,
+			Source:     result.Source,
+			Direct:     item.Direct,
+			Shared:     item.Shared,
+			Total:      item.Total,
+			Details:    string(details),
+		}
+		if user.CompanyID == 0 {
+			statement.UserID = user.Base.ID
+		}
+		statements = append(statements, statement)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := companyRows(tx, user).Where("month = ?", result.Month).
+			Delete(&databases.AllocationStatement{}).Error; err != nil {
+			return err
+		}
+		if len(statements) == 0 {
+			return nil
+		}
+		return tx.Create(&statements).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return statements, nil
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+type (
+	// DailyAmount cost of one day
+	DailyAmount struct {
+		Date   time.Time
+		Amount float64
+	}
+
+	// AnomalyConfig detector settings
+	AnomalyConfig struct {
+		Window      int     `json:"window"`      // baseline days, default 56
+		MinHistory  int     `json:"min_history"` // days required before detecting, default 14
+		Sensitivity float64 `json:"sensitivity"` // deviations from expected, default 3
+		MinImpact   float64 `json:"min_impact"`  // absolute difference, default 1
+	}
+
+	// AnomalyPoint detected anomaly
+	AnomalyPoint struct {
+		Date     time.Time `json:"date"`
+		Actual   float64   `json:"actual"`
+		Expected float64   `json:"expected"`
+		Impact   float64   `json:"impact"`
+		Score    float64   `json:"score"`
+	}
+)
+
+// withDefaults fills zero settings
+func (c AnomalyConfig) withDefaults() AnomalyConfig {
+	if c.Window <= 0 {
+		c.Window = 56
+	}
+	if c.MinHistory <= 0 {
+		c.MinHistory = 14
+	}
+	if c.Sensitivity <= 0 {
+		c.Sensitivity = 3
+	}
+	if c.MinImpact <= 0 {
+		c.MinImpact = 1
+	}
+	return c
+}
+
+// DenseSeries fills missing days with zero and sorts by date
+func DenseSeries(series []DailyAmount) []DailyAmount {
+	if len(series) == 0 {
+		return nil
+	}
+	amounts := map[string]float64{}
+	first, last := series[0].Date, series[0].Date
+	for _, day := range series {
+		amounts[day.Date.Format("2006-01-02")] += day.Amount
+		if day.Date.Before(first) {
+			first = day.Date
+		}
+		if day.Date.After(last) {
+			last = day.Date
+		}
+	}
+
+	var dense []DailyAmount
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		dense = append(dense, DailyAmount{Date: day, Amount: amounts[day.Format("2006-01-02")]})
+	}
+	return dense
+}
+
+// Expected baseline of the day following history: deseasonalized level of
+// the window multiplied by the weekday factor, and the robust spread of the
+// history around its own baseline.
+func Expected(history []DailyAmount, weekday time.Weekday) (expected, spread float64) {
+	if len(history) == 0 {
+		return 0, 0
+	}
+
+	// weekday seasonality factor = weekday mean / overall mean
+	var total float64
+	sums := map[time.Weekday]float64{}
+	counts := map[time.Weekday]float64{}
+	for _, day := range history {
+		total += day.Amount
+		sums[day.Date.Weekday()] += day.Amount
+		counts[day.Date.Weekday()]++
+	}
+	mean := total / float64(len(history))
+	factor := func(w time.Weekday) float64 {
+		if mean == 0 || counts[w] == 0 {
+			return 1
+		}
+		return sums[w] / counts[w] / mean
+	}
+
+	// level is the median of deseasonalized values, robust against earlier spikes
+	var deseasonalized []float64
+	for _, day := range history {
+		if f := factor(day.Date.Weekday()); f != 0 {
+			deseasonalized = append(deseasonalized, day.Amount/f)
+		}
+	}
+	level := median(deseasonalized)
+	expected = level * factor(weekday)
+
+	var residuals []float64
+	for _, day := range history {
+		residuals = append(residuals, day.Amount-level*factor(day.Date.Weekday()))
+	}
+	center := median(residuals)
+	var deviations []float64
+	for _, residual := range residuals {
+		deviations = append(deviations, math.Abs(residual-center))
+	}
+	// median absolute deviation scaled to standard deviation
+	spread = 1.4826 * median(deviations)
+	return expected, spread
+}
+
+// DetectAnomalies checks every day on or after from against the baseline of
+// the preceding window.
+func DetectAnomalies(series []DailyAmount, config AnomalyConfig, from time.Time) []AnomalyPoint {
+	config = config.withDefaults()
+	dense := DenseSeries(series)
+
+	var anomalies []AnomalyPoint
+	for i, day := range dense {
+		if day.Date.Before(from) || i < config.MinHistory {
+			continue
+		}
+		start := i - config.Window
+		if start < 0 {
+			start = 0
+		}
+
+		expected, spread := Expected(dense[start:i], day.Date.Weekday())
+		// floor the spread so flat series do not alert on cents
+		spread = math.Max(spread, math.Max(0.1*math.Abs(expected), config.MinImpact/config.Sensitivity))
+
+		impact := day.Amount - expected
+		score := impact / spread
+		if math.Abs(score) >= config.Sensitivity && math.Abs(impact) >= config.MinImpact {
+			anomalies = append(anomalies, AnomalyPoint{
+				Date:     day.Date,
+				Actual:   day.Amount,
+				Expected: expected,
+				Impact:   impact,
+				Score:    score,
+			})
+		}
+	}
+	return anomalies
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
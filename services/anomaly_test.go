@@ -0,0 +1,179 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// monday first day of synthetic series
+var monday = time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC)
+
+// dailySeries days from monday with amount of each day
+func dailySeries(days int, amount func(i int, date time.Time) float64) []DailyAmount {
+	var series []DailyAmount
+	for i := 0; i < days; i++ {
+		date := monday.AddDate(0, 0, i)
+		series = append(series, DailyAmount{Date: date, Amount: amount(i, date)})
+	}
+	return series
+}
+
+// weekly 100 on weekdays and 20 on weekends
+func weekly(i int, date time.Time) float64 {
+	if date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+		return 20
+	}
+	return 100
+}
+
+// flat constant amount with value on the last day of days
+func flat(amount float64, days int, last float64) func(int, time.Time) float64 {
+	return func(i int, date time.Time) float64 {
+		if i == days-1 {
+			return last
+		}
+		return amount
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestExpected(t *testing.T) {
+	history := dailySeries(56, weekly)
+	tests := []struct {
+		name     string
+		history  []DailyAmount
+		weekday  time.Weekday
+		expected float64
+		spread   float64
+	}{
+		{"weekday", history, time.Monday, 100, 0},
+		{"saturday", history, time.Saturday, 20, 0},
+		{"sunday", history, time.Sunday, 20, 0},
+		{"flat", dailySeries(28, flat(50, 28, 50)), time.Wednesday, 50, 0},
+		// one earlier spike does not move the median level
+		{"earlier spike", dailySeries(28, func(i int, date time.Time) float64 {
+			if i == 10 {
+				return 500
+			}
+			return 50
+		}), time.Friday, 50, 0},
+		{"empty", nil, time.Monday, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected, spread := Expected(test.history, test.weekday)
+			if !near(expected, test.expected) || !near(spread, test.spread) {
+				t.Fatalf("expected %v ± %v, got %v ± %v", test.expected, test.spread, expected, spread)
+			}
+		})
+	}
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	tests := []struct {
+		name     string
+		series   []DailyAmount
+		config   AnomalyConfig
+		from     time.Time
+		dates    []string
+		expected float64
+	}{
+		{
+			name:     "spike",
+			series:   dailySeries(30, flat(100, 30, 200)),
+			from:     monday.AddDate(0, 0, 29),
+			dates:    []string{"2021-02-02"},
+			expected: 100,
+		},
+		{
+			name:     "drop",
+			series:   dailySeries(30, flat(100, 30, 0)),
+			from:     monday.AddDate(0, 0, 29),
+			dates:    []string{"2021-02-02"},
+			expected: 100,
+		},
+		{
+			name:   "weekends are seasonal",
+			series: dailySeries(56, weekly),
+			from:   monday.AddDate(0, 0, 14),
+		},
+		{
+			// 100 is normal on weekdays but not on saturday
+			name: "weekday level on saturday",
+			series: dailySeries(55, func(i int, date time.Time) float64 {
+				if i == 54 {
+					return 100
+				}
+				return weekly(i, date)
+			}),
+			from:     monday.AddDate(0, 0, 54),
+			dates:    []string{"2021-02-27"},
+			expected: 20,
+		},
+		{
+			name:   "below min impact",
+			series: dailySeries(30, flat(1, 30, 1.5)),
+			from:   monday.AddDate(0, 0, 29),
+		},
+		{
+			name:     "lower min impact",
+			series:   dailySeries(30, flat(1, 30, 1.5)),
+			config:   AnomalyConfig{MinImpact: 0.25},
+			from:     monday.AddDate(0, 0, 29),
+			dates:    []string{"2021-02-02"},
+			expected: 1,
+		},
+		{
+			// spread is floored to 10% of expected, 130 is 3 deviations
+			name:     "default sensitivity",
+			series:   dailySeries(30, flat(100, 30, 130)),
+			from:     monday.AddDate(0, 0, 29),
+			dates:    []string{"2021-02-02"},
+			expected: 100,
+		},
+		{
+			name:   "lower sensitivity",
+			series: dailySeries(30, flat(100, 30, 130)),
+			config: AnomalyConfig{Sensitivity: 4},
+			from:   monday.AddDate(0, 0, 29),
+		},
+		{
+			name:   "short history",
+			series: dailySeries(10, flat(100, 10, 500)),
+			from:   monday,
+		},
+		{
+			name:   "before from",
+			series: dailySeries(30, flat(100, 30, 500)),
+			from:   monday.AddDate(0, 0, 30),
+		},
+		{
+			// missing days are zero cost
+			name:     "missing days",
+			series:   append(dailySeries(20, flat(100, 20, 100)), DailyAmount{Date: monday.AddDate(0, 0, 21), Amount: 100}),
+			from:     monday.AddDate(0, 0, 20),
+			dates:    []string{"2021-01-24"},
+			expected: 100,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			anomalies := DetectAnomalies(test.series, test.config, test.from)
+			if len(anomalies) != len(test.dates) {
+				t.Fatalf("expected %v anomalies, got %+v", len(test.dates), anomalies)
+			}
+			for i, anomaly := range anomalies {
+				if date := anomaly.Date.Format("2006-01-02"); date != test.dates[i] {
+					t.Errorf("expected anomaly on %v, got %v", test.dates[i], date)
+				}
+				if !near(anomaly.Expected, test.expected) || !near(anomaly.Impact, anomaly.Actual-anomaly.Expected) {
+					t.Errorf("unexpected anomaly %+v", anomaly)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+	gorm "gorm.io/gorm"
+)
+
+// APIKeyPrefix start of every API key, ak_<8 hex prefix>_<secret>
+const APIKeyPrefix = "ak_"
+
+// apiKeyPrefixLength length of stored prefix including ak_
+const apiKeyPrefixLength = len(APIKeyPrefix) + 8
+
+// lastUsedInterval last used date is written at most once per interval
+const lastUsedInterval = time.Minute
+
+// API key authentication errors
+var (
+	ErrInvalidAPIKey = errors.New("Invalid API key")
+	ErrAPIKeyExpired = errors.New("API key has expired")
+	ErrAPIKeyIP      = errors.New("API key is not allowed from this IP")
+)
+
+// apiKeyScopes ...
+var apiKeyScopes = []string{databases.ScopeRead, databases.ScopeWrite}
+
+// readRoutes cost read routes allowed for read scope, "METHOD route pattern"
+// matched exactly so new routes are not readable until listed
+var readRoutes = map[string]bool{
+	"POST /api/v2/aws/getcost":                true,
+	"POST /api/v2/aws/export":                 true,
+	"POST /api/v2/aws/forecast":               true,
+	"POST /api/v2/aws/monthend":               true,
+	"POST /api/v2/aws/movers":                 true,
+	"POST /api/v2/aws/riutilization":          true,
+	"POST /api/v2/aws/ricoverage":             true,
+	"POST /api/v2/aws/sputilization":          true,
+	"POST /api/v2/aws/spcoverage":             true,
+	"POST /api/v2/aws/rightsizing":            true,
+	"POST /api/v2/awsanomalies/list":          true,
+	"GET /api/v2/awsanomalies/monitors":       true,
+	"GET /api/v2/awsanomalies/subscriptions":  true,
+	"POST /api/v2/anomalies/list":             true,
+	"POST /api/v2/allocations/preview":        true,
+	"GET /api/v2/allocations/rulesets":        true,
+	"GET /api/v2/allocations/rulesets/:id":    true,
+	"GET /api/v2/allocations/statements":      true,
+	"GET /api/v2/costcategories/list":         true,
+	"GET /api/v2/costcategories/describe":     true,
+	"POST /api/v2/currencies/rates/list":      true,
+	"GET /api/v2/cur/definitions":             true,
+	"GET /api/v2/cur/imports":                 true,
+	"POST /api/v2/cur/lineitems":              true,
+	"POST /api/v2/cur/summary":                true,
+	"POST /api/v2/recommendations/history":    true,
+	"GET /api/v2/recommendations/history/:id": true,
+	"GET /api/v2/budgets/list":                true,
+	"GET /api/v2/budgets/get/:id":             true,
+	"GET /api/v2/budgets/status/:id":          true,
+	"GET /api/v2/budgets/alerts":              true,
+	"GET /api/v2/budgets/alerts/:id":          true,
+	"POST /api/v2/invoices/list":              true,
+	"GET /api/v2/invoices/get/:id":            true,
+	"GET /api/v2/invoices/download/:id":       true,
+	"POST /api/v2/reports/monthly":            true,
+	"GET /api/v2/dashboards/list":             true,
+	"GET /api/v2/dashboards/get/:id":          true,
+	"GET /api/v2/dashboards/run/:id":          true,
+	"GET /api/v2/queries/list":                true,
+	"GET /api/v2/queries/get/:id":             true,
+	"GET /api/v2/queries/run/:id":             true,
+	"GET /api/v2/quota":                       true,
+}
+
+// IsAPIKey token is API key and not JWT
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// HashAPIKey SHA-256 of key, keys are random so no salt is needed
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAPIKey random key and its prefix, only the hash of key is stored
+func NewAPIKey() (string, string, error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 24)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	prefix := APIKeyPrefix + hex.EncodeToString(id)
+	return prefix + "_" + hex.EncodeToString(secret), prefix, nil
+}
+
+// APIKeyFromParams ...
+func APIKeyFromParams(key *databases.APIKey, params form.APIKeyParams) error {
+	if params.Scope == "" {
+		params.Scope = databases.ScopeRead
+	}
+	if err := oneOf("scope", params.Scope, apiKeyScopes); err != nil {
+		return err
+	}
+
+	key.ExpiresDate = nil
+	if params.ExpiresDate != "" {
+		date, err := utils.ParseDate(params.ExpiresDate)
+		if err != nil {
+			return NewParamError("expires_date", "must be YYYY-MM-DD")
+		}
+		// valid through the whole expiry date
+		expires := date.AddDate(0, 0, 1)
+		if !expires.After(time.Now()) {
+			return NewParamError("expires_date", "must be in the future")
+		}
+		key.ExpiresDate = &expires
+	}
+
+	if params.RateLimit < 0 {
+		return NewParamError("rate_limit", "must not be negative")
+	}
+
+	for _, item := range params.AllowedIPs {
+		if net.ParseIP(item) == nil {
+			if _, _, err := net.ParseCIDR(item); err != nil {
+				return NewParamError("allowed_ips", "invalid IP or CIDR "+item)
+			}
+		}
+	}
+
+	key.Name = params.Name
+	key.Scope = params.Scope
+	key.IsCompany = params.IsCompany
+	key.AllowedIPs = strings.Join(params.AllowedIPs, ",")
+	key.RateLimit = params.RateLimit
+	return nil
+}
+
+// ipAllowed IP is in allowlist, empty list allows all
+func ipAllowed(allowed, ip string) bool {
+	items := splitValues(allowed)
+	if len(items) == 0 {
+		return true
+	}
+	client := net.ParseIP(ip)
+	if client == nil {
+		return false
+	}
+	for _, item := range items {
+		if strings.Contains(item, "/") {
+			if _, network, err := net.ParseCIDR(item); err == nil && network.Contains(client) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(item); allowedIP != nil && allowedIP.Equal(client) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticateAPIKey key of the raw value and the user it acts as, revoked,
+// expired keys and keys used from IP outside the allowlist are refused
+func AuthenticateAPIKey(db *gorm.DB, raw, ip string) (*databases.APIKey, *databases.SystemUser, error) {
+	if len(raw) <= apiKeyPrefixLength || !IsAPIKey(raw) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var key databases.APIKey
+	result := db.Where("prefix = ? AND revoked_date IS NULL", raw[:apiKeyPrefixLength]).Limit(1).Find(&key)
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	if result.RowsAffected == 0 || subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(HashAPIKey(raw))) != 1 {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if key.ExpiresDate != nil && !now.Before(*key.ExpiresDate) {
+		return nil, nil, ErrAPIKeyExpired
+	}
+	if !ipAllowed(key.AllowedIPs, ip) {
+		return nil, nil, ErrAPIKeyIP
+	}
+
+	var user databases.SystemUser
+	if result := db.Where("is_active = ?", true).Limit(1).Find(&user, key.UserID); result.Error != nil || result.RowsAffected == 0 {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	// company key stops working when its creator leaves the company
+	if key.IsCompany && user.CompanyID != key.CompanyID {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedDate == nil || now.Sub(*key.LastUsedDate) >= lastUsedInterval || key.LastUsedIP != ip {
+		key.LastUsedDate = &now
+		key.LastUsedIP = ip
+		db.Model(&key).Updates(map[string]interface{}{"last_used_date": now, "last_used_ip": ip})
+	}
+	return &key, &user, nil
+}
+
+// APIKeyAllows scope of key allows the request, path is the full route
+// pattern. API keys never manage API keys or link SSO identities.
+func APIKeyAllows(key databases.APIKey, method, path string) bool {
+	if path == "" || strings.HasPrefix(path, "/api/v2/apikeys") || strings.HasPrefix(path, "/api/v2/sso/link") {
+		return false
+	}
+	if key.Scope == databases.ScopeWrite {
+		return true
+	}
+	return readRoutes[method+" "+path]
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"testing"
+
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+)
+
+func TestAPIKeyAllows(t *testing.T) {
+	read := databases.APIKey{Scope: databases.ScopeRead}
+	write := databases.APIKey{Scope: databases.ScopeWrite}
+	tests := []struct {
+		key     databases.APIKey
+		method  string
+		path    string
+		allowed bool
+	}{
+		{read, "POST", "/api/v2/aws/getcost", true},
+		{read, "GET", "/api/v2/budgets/status/:id", true},
+		{read, "GET", "/api/v2/dashboards/run/:id", true},
+		{read, "POST", "/api/v2/budgets/evaluate/:id", false},
+		{read, "POST", "/api/v2/user/list", false},
+		{read, "POST", "/api/v2/audit/list", false},
+		{read, "GET", "/api/v2/user/me", false},
+		{read, "GET", "/api/v2/credentials/list", false},
+		{read, "GET", "/api/v2/webhooks/list", false},
+		{read, "GET", "/api/v2/quota/companies", false},
+		{read, "POST", "/api/v2/other/aws/getcost", false},
+		{read, "GET", "/api/v2/aws/getcost", false},
+		{read, "GET", "", false},
+		{write, "POST", "/api/v2/budgets", true},
+		{write, "POST", "/api/v2/user/list", true},
+		{write, "POST", "/api/v2/apikeys", false},
+		{write, "GET", "/api/v2/apikeys/list", false},
+		{write, "POST", "/api/v2/sso/link/start", false},
+	}
+	for _, test := range tests {
+		if allowed := APIKeyAllows(test.key, test.method, test.path); allowed != test.allowed {
+			t.Errorf("%v %v %v: expected %v", test.key.Scope, test.method, test.path, test.allowed)
+		}
+	}
+}
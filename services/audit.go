@@ -0,0 +1,146 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	gorm "gorm.io/gorm"
+)
+
+// redacted value of secret fields in audit changes
+const redacted = "[REDACTED]"
+
+// secretFields field names containing one of these are redacted, and
+// secretNames fields of exactly these names
+var (
+	secretFields = []string{"password", "secret", "token"}
+	secretNames  = map[string]bool{"code": true, "key_hash": true}
+)
+
+// auditIgnored fields changed on every save
+var auditIgnored = map[string]bool{"modified_date": true}
+
+// Roles user roles in company
+var Roles = []string{databases.RoleAdmin, databases.RoleMember}
+
+// ValidateRole ...
+func ValidateRole(role string) error {
+	return oneOf("role", role, Roles)
+}
+
+// IsAdmin admin of a company, users without company are never admins
+func IsAdmin(user databases.SystemUser) bool {
+	return user.CompanyID != 0 && user.Role == databases.RoleAdmin
+}
+
+// CanManage changes settings shared by the company, budgets, webhooks and
+// report subscriptions. Company admins manage the company's, users without
+// company their own.
+func CanManage(user databases.SystemUser) bool {
+	return user.CompanyID == 0 || IsAdmin(user)
+}
+
+// AuditChange before and after value of one field
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// isSecretField ...
+func isSecretField(name string) bool {
+	name = strings.ToLower(name)
+	if secretNames[name] {
+		return true
+	}
+	for _, field := range secretFields {
+		if strings.Contains(name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact replaces values of secret fields in nested maps and lists
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = redactField(key, item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redact(item)
+		}
+	}
+	return value
+}
+
+// redactField value of the field, secret when the field is secret and set
+func redactField(key string, value interface{}) interface{} {
+	if isSecretField(key) {
+		if value == nil || value == "" {
+			return value
+		}
+		return redacted
+	}
+	return redact(value)
+}
+
+// AuditSnapshot fields of the value as in JSON response, taken before the
+// value is changed. Fields hidden from JSON, like credential secret keys,
+// are not in the snapshot.
+func AuditSnapshot(value interface{}) map[string]interface{} {
+	if value == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var snapshot map[string]interface{}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		// not an object, ids of bulk delete
+		var items interface{}
+		json.Unmarshal(data, &items)
+		return map[string]interface{}{"value": items}
+	}
+	return snapshot
+}
+
+// AuditChanges changed fields between before and after with secret fields
+// redacted, nil before is create and nil after is delete. Changed secrets are
+// listed with both values redacted.
+func AuditChanges(before, after interface{}) map[string]AuditChange {
+	from := AuditSnapshot(before)
+	to := AuditSnapshot(after)
+
+	changes := map[string]AuditChange{}
+	add := func(key string, before, after interface{}) {
+		changes[key] = AuditChange{Before: redactField(key, before), After: redactField(key, after)}
+	}
+	for key, value := range to {
+		if auditIgnored[key] || reflect.DeepEqual(from[key], value) {
+			continue
+		}
+		add(key, from[key], value)
+	}
+	for key, value := range from {
+		if _, ok := to[key]; !ok && !auditIgnored[key] {
+			add(key, value, nil)
+		}
+	}
+	return changes
+}
+
+// Audit appends entry with changes of the target, audit failure does not
+// fail the action
+func Audit(db *gorm.DB, entry databases.AuditLog, before, after interface{}) error {
+	changes, err := json.Marshal(AuditChanges(before, after))
+	if err != nil {
+		return err
+	}
+	entry.Changes = string(changes)
+	return db.Create(&entry).Error
+}
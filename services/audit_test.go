@@ -0,0 +1,42 @@
+package services
+
+import (
+	"testing"
+
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+)
+
+func TestIsAdmin(t *testing.T) {
+	tests := []struct {
+		user  databases.SystemUser
+		admin bool
+	}{
+		{databases.SystemUser{CompanyID: 1, Role: databases.RoleAdmin}, true},
+		{databases.SystemUser{CompanyID: 1, Role: databases.RoleMember}, false},
+		{databases.SystemUser{CompanyID: 0, Role: databases.RoleMember}, false},
+		{databases.SystemUser{CompanyID: 0, Role: databases.RoleAdmin}, false},
+		{databases.SystemUser{CompanyID: 0}, false},
+	}
+	for _, test := range tests {
+		if admin := IsAdmin(test.user); admin != test.admin {
+			t.Errorf("company %v role %q: expected %v", test.user.CompanyID, test.user.Role, test.admin)
+		}
+	}
+}
+
+func TestCanManage(t *testing.T) {
+	tests := []struct {
+		user   databases.SystemUser
+		manage bool
+	}{
+		{databases.SystemUser{CompanyID: 1, Role: databases.RoleAdmin}, true},
+		{databases.SystemUser{CompanyID: 1, Role: databases.RoleMember}, false},
+		{databases.SystemUser{CompanyID: 1}, false},
+		{databases.SystemUser{CompanyID: 0, Role: databases.RoleMember}, true},
+	}
+	for _, test := range tests {
+		if manage := CanManage(test.user); manage != test.manage {
+			t.Errorf("company %v role %q: expected %v", test.user.CompanyID, test.user.Role, test.manage)
+		}
+	}
+}
@@ -0,0 +1,410 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+)
+
+type (
+	// AwsAnomalyRootCause ...
+	AwsAnomalyRootCause struct {
+		Service       string `json:"service"`
+		Region        string `json:"region"`
+		LinkedAccount string `json:"linked_account"`
+		UsageType     string `json:"usage_type"`
+	}
+
+	// AwsAnomaly anomaly detected by AWS Cost Anomaly Detection
+	AwsAnomaly struct {
+		ID             string                `json:"id"`
+		MonitorArn     string                `json:"monitor_arn"`
+		StartDate      string                `json:"start_date"`
+		EndDate        string                `json:"end_date"`
+		DimensionValue string                `json:"dimension_value"`
+		Feedback       string                `json:"feedback"`
+		CurrentScore   float64               `json:"current_score"`
+		MaxScore       float64               `json:"max_score"`
+		MaxImpact      float64               `json:"max_impact"`
+		TotalImpact    float64               `json:"total_impact"`
+		RootCauses     []AwsAnomalyRootCause `json:"root_causes"`
+	}
+
+	// AwsAnomalyMonitor ...
+	AwsAnomalyMonitor struct {
+		Arn                   string   `json:"arn"`
+		Name                  string   `json:"name"`
+		Type                  string   `json:"type"`
+		Dimension             string   `json:"dimension"`
+		DimensionalValueCount int64    `json:"dimensional_value_count"`
+		LinkedAccounts        []string `json:"linked_accounts"`
+		TagKey                string   `json:"tag_key"`
+		TagValues             []string `json:"tag_values"`
+		CreationDate          string   `json:"creation_date"`
+		LastUpdatedDate       string   `json:"last_updated_date"`
+		LastEvaluatedDate     string   `json:"last_evaluated_date"`
+	}
+
+	// AwsAnomalySubscriber ...
+	AwsAnomalySubscriber struct {
+		Type    string `json:"type"`
+		Address string `json:"address"`
+		Status  string `json:"status"`
+	}
+
+	// AwsAnomalySubscription ...
+	AwsAnomalySubscription struct {
+		Arn         string                 `json:"arn"`
+		Name        string                 `json:"name"`
+		AccountID   string                 `json:"account_id"`
+		Frequency   string                 `json:"frequency"`
+		Threshold   float64                `json:"threshold"`
+		MonitorArns []string               `json:"monitor_arns"`
+		Subscribers []AwsAnomalySubscriber `json:"subscribers"`
+	}
+)
+
+// oneOf checks value is in allowed enum values
+func oneOf(field, value string, allowed []string) error {
+	for _, item := range allowed {
+		if value == item {
+			return nil
+		}
+	}
+	return NewParamError(field, "must be "+strings.Join(allowed, ", "))
+}
+
+// GetAwsAnomalies anomalies detected within the date range, all pages
+func GetAwsAnomalies(svc costexploreriface.CostExplorerAPI, params form.AwsAnomaliesParams) ([]AwsAnomaly, error) {
+	if _, err := utils.ParseDate(params.StartDate); err != nil {
+		return nil, NewParamError("start_date", "must be YYYY-MM-DD")
+	}
+	input := &costexplorer.GetAnomaliesInput{
+		DateInterval: &costexplorer.AnomalyDateInterval{StartDate: aws.String(params.StartDate)},
+	}
+	if params.EndDate != "" {
+		if _, err := utils.ParseDate(params.EndDate); err != nil {
+			return nil, NewParamError("end_date", "must be YYYY-MM-DD")
+		}
+		input.DateInterval.EndDate = aws.String(params.EndDate)
+	}
+	if params.MonitorArn != "" {
+		input.MonitorArn = aws.String(params.MonitorArn)
+	}
+	if params.Feedback != "" {
+		if err := oneOf("feedback", params.Feedback, costexplorer.AnomalyFeedbackType_Values()); err != nil {
+			return nil, err
+		}
+		input.Feedback = aws.String(params.Feedback)
+	}
+	if params.MinImpact > 0 {
+		input.TotalImpact = &costexplorer.TotalImpactFilter{
+			NumericOperator: aws.String(costexplorer.NumericOperatorGreaterThanOrEqual),
+			StartValue:      aws.Float64(params.MinImpact),
+		}
+	}
+
+	anomalies := []AwsAnomaly{}
+	for {
+		output, err := svc.GetAnomalies(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, anomaly := range output.Anomalies {
+			anomalies = append(anomalies, awsAnomaly(anomaly))
+		}
+		if aws.StringValue(output.NextPageToken) == "" {
+			return anomalies, nil
+		}
+		input.NextPageToken = output.NextPageToken
+	}
+}
+
+func awsAnomaly(anomaly *costexplorer.Anomaly) AwsAnomaly {
+	result := AwsAnomaly{
+		ID:             aws.StringValue(anomaly.AnomalyId),
+		MonitorArn:     aws.StringValue(anomaly.MonitorArn),
+		StartDate:      aws.StringValue(anomaly.AnomalyStartDate),
+		EndDate:        aws.StringValue(anomaly.AnomalyEndDate),
+		DimensionValue: aws.StringValue(anomaly.DimensionValue),
+		Feedback:       aws.StringValue(anomaly.Feedback),
+		RootCauses:     []AwsAnomalyRootCause{},
+	}
+	if anomaly.AnomalyScore != nil {
+		result.CurrentScore = aws.Float64Value(anomaly.AnomalyScore.CurrentScore)
+		result.MaxScore = aws.Float64Value(anomaly.AnomalyScore.MaxScore)
+	}
+	if anomaly.Impact != nil {
+		result.MaxImpact = aws.Float64Value(anomaly.Impact.MaxImpact)
+		result.TotalImpact = aws.Float64Value(anomaly.Impact.TotalImpact)
+	}
+	for _, cause := range anomaly.RootCauses {
+		result.RootCauses = append(result.RootCauses, AwsAnomalyRootCause{
+			Service:       aws.StringValue(cause.Service),
+			Region:        aws.StringValue(cause.Region),
+			LinkedAccount: aws.StringValue(cause.LinkedAccount),
+			UsageType:     aws.StringValue(cause.UsageType),
+		})
+	}
+	return result
+}
+
+// GetAwsAnomalyMonitors monitors of the account, all monitors when arns is empty
+func GetAwsAnomalyMonitors(svc costexploreriface.CostExplorerAPI, arns []string) ([]AwsAnomalyMonitor, error) {
+	input := &costexplorer.GetAnomalyMonitorsInput{}
+	if len(arns) > 0 {
+		input.MonitorArnList = aws.StringSlice(arns)
+	}
+
+	monitors := []AwsAnomalyMonitor{}
+	for {
+		output, err := svc.GetAnomalyMonitors(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, monitor := range output.AnomalyMonitors {
+			monitors = append(monitors, awsAnomalyMonitor(monitor))
+		}
+		if aws.StringValue(output.NextPageToken) == "" {
+			return monitors, nil
+		}
+		input.NextPageToken = output.NextPageToken
+	}
+}
+
+func awsAnomalyMonitor(monitor *costexplorer.AnomalyMonitor) AwsAnomalyMonitor {
+	result := AwsAnomalyMonitor{
+		Arn:                   aws.StringValue(monitor.MonitorArn),
+		Name:                  aws.StringValue(monitor.MonitorName),
+		Type:                  aws.StringValue(monitor.MonitorType),
+		Dimension:             aws.StringValue(monitor.MonitorDimension),
+		DimensionalValueCount: aws.Int64Value(monitor.DimensionalValueCount),
+		CreationDate:          aws.StringValue(monitor.CreationDate),
+		LastUpdatedDate:       aws.StringValue(monitor.LastUpdatedDate),
+		LastEvaluatedDate:     aws.StringValue(monitor.LastEvaluatedDate),
+	}
+	if spec := monitor.MonitorSpecification; spec != nil {
+		if spec.Dimensions != nil && aws.StringValue(spec.Dimensions.Key) == costexplorer.DimensionLinkedAccount {
+			result.LinkedAccounts = aws.StringValueSlice(spec.Dimensions.Values)
+		}
+		if spec.Tags != nil {
+			result.TagKey = aws.StringValue(spec.Tags.Key)
+			result.TagValues = aws.StringValueSlice(spec.Tags.Values)
+		}
+	}
+	return result
+}
+
+// CreateAwsAnomalyMonitor creates service monitor for DIMENSIONAL type, linked
+// account or tag monitor for CUSTOM type
+func CreateAwsAnomalyMonitor(svc costexploreriface.CostExplorerAPI, params form.AwsAnomalyMonitorParams) (*AwsAnomalyMonitor, error) {
+	monitor := &costexplorer.AnomalyMonitor{
+		MonitorName: aws.String(params.Name),
+		MonitorType: aws.String(params.Type),
+	}
+	switch params.Type {
+	case costexplorer.MonitorTypeDimensional, "":
+		monitor.MonitorType = aws.String(costexplorer.MonitorTypeDimensional)
+		monitor.MonitorDimension = aws.String(costexplorer.MonitorDimensionService)
+	case costexplorer.MonitorTypeCustom:
+		switch {
+		case len(params.LinkedAccounts) > 0 && params.TagKey == "":
+			monitor.MonitorSpecification = &costexplorer.Expression{
+				Dimensions: &costexplorer.DimensionValues{
+					Key:    aws.String(costexplorer.DimensionLinkedAccount),
+					Values: aws.StringSlice(params.LinkedAccounts),
+				},
+			}
+		case params.TagKey != "" && len(params.LinkedAccounts) == 0:
+			if len(params.TagValues) == 0 {
+				return nil, NewParamError("tag_values", "is required")
+			}
+			monitor.MonitorSpecification = &costexplorer.Expression{
+				Tags: &costexplorer.TagValues{
+					Key:    aws.String(params.TagKey),
+					Values: aws.StringSlice(params.TagValues),
+				},
+			}
+		default:
+			return nil, NewParamError("linked_accounts", "either linked_accounts or tag_key is required for CUSTOM monitor")
+		}
+	default:
+		return nil, oneOf("type", params.Type, costexplorer.MonitorType_Values())
+	}
+
+	output, err := svc.CreateAnomalyMonitor(&costexplorer.CreateAnomalyMonitorInput{AnomalyMonitor: monitor})
+	if err != nil {
+		return nil, err
+	}
+	monitor.MonitorArn = output.MonitorArn
+	result := awsAnomalyMonitor(monitor)
+	return &result, nil
+}
+
+// UpdateAwsAnomalyMonitor renames monitor, AWS does not allow changing its specification
+func UpdateAwsAnomalyMonitor(svc costexploreriface.CostExplorerAPI, params form.AwsAnomalyMonitorParams) (*AwsAnomalyMonitor, error) {
+	if params.MonitorArn == "" {
+		return nil, NewParamError("monitor_arn", "is required")
+	}
+	_, err := svc.UpdateAnomalyMonitor(&costexplorer.UpdateAnomalyMonitorInput{
+		MonitorArn:  aws.String(params.MonitorArn),
+		MonitorName: aws.String(params.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	monitors, err := GetAwsAnomalyMonitors(svc, []string{params.MonitorArn})
+	if err != nil {
+		return nil, err
+	}
+	if len(monitors) == 0 {
+		return &AwsAnomalyMonitor{Arn: params.MonitorArn, Name: params.Name}, nil
+	}
+	return &monitors[0], nil
+}
+
+// GetAwsAnomalySubscriptions subscriptions of the account, of one monitor when monitorArn is set
+func GetAwsAnomalySubscriptions(svc costexploreriface.CostExplorerAPI, monitorArn string, arns []string) ([]AwsAnomalySubscription, error) {
+	input := &costexplorer.GetAnomalySubscriptionsInput{}
+	if monitorArn != "" {
+		input.MonitorArn = aws.String(monitorArn)
+	}
+	if len(arns) > 0 {
+		input.SubscriptionArnList = aws.StringSlice(arns)
+	}
+
+	subscriptions := []AwsAnomalySubscription{}
+	for {
+		output, err := svc.GetAnomalySubscriptions(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, subscription := range output.AnomalySubscriptions {
+			subscriptions = append(subscriptions, awsAnomalySubscription(subscription))
+		}
+		if aws.StringValue(output.NextPageToken) == "" {
+			return subscriptions, nil
+		}
+		input.NextPageToken = output.NextPageToken
+	}
+}
+
+func awsAnomalySubscription(subscription *costexplorer.AnomalySubscription) AwsAnomalySubscription {
+	result := AwsAnomalySubscription{
+		Arn:         aws.StringValue(subscription.SubscriptionArn),
+		Name:        aws.StringValue(subscription.SubscriptionName),
+		AccountID:   aws.StringValue(subscription.AccountId),
+		Frequency:   aws.StringValue(subscription.Frequency),
+		Threshold:   aws.Float64Value(subscription.Threshold),
+		MonitorArns: aws.StringValueSlice(subscription.MonitorArnList),
+		Subscribers: []AwsAnomalySubscriber{},
+	}
+	for _, subscriber := range subscription.Subscribers {
+		result.Subscribers = append(result.Subscribers, AwsAnomalySubscriber{
+			Type:    aws.StringValue(subscriber.Type),
+			Address: aws.StringValue(subscriber.Address),
+			Status:  aws.StringValue(subscriber.Status),
+		})
+	}
+	return result
+}
+
+// awsAnomalySubscriptionInput validates params into AWS subscription
+func awsAnomalySubscriptionInput(params form.AwsAnomalySubscriptionParams) (*costexplorer.AnomalySubscription, error) {
+	if params.Frequency == "" {
+		params.Frequency = costexplorer.AnomalySubscriptionFrequencyDaily
+	}
+	if err := oneOf("frequency", params.Frequency, costexplorer.AnomalySubscriptionFrequency_Values()); err != nil {
+		return nil, err
+	}
+	if params.Threshold < 0 {
+		return nil, NewParamError("threshold", "must not be negative")
+	}
+	if len(params.MonitorArns) == 0 {
+		return nil, NewParamError("monitor_arns", "is required")
+	}
+	if len(params.Subscribers) == 0 {
+		return nil, NewParamError("subscribers", "is required")
+	}
+
+	subscription := &costexplorer.AnomalySubscription{
+		SubscriptionName: aws.String(params.Name),
+		Frequency:        aws.String(params.Frequency),
+		Threshold:        aws.Float64(params.Threshold),
+		MonitorArnList:   aws.StringSlice(params.MonitorArns),
+	}
+	for _, subscriber := range params.Subscribers {
+		if err := oneOf("subscribers.type", subscriber.Type, costexplorer.SubscriberType_Values()); err != nil {
+			return nil, err
+		}
+		// AWS only delivers IMMEDIATE alerts to SNS topics
+		if params.Frequency == costexplorer.AnomalySubscriptionFrequencyImmediate && subscriber.Type != costexplorer.SubscriberTypeSns {
+			return nil, NewParamError("subscribers.type", "IMMEDIATE frequency requires SNS subscribers")
+		}
+		subscription.Subscribers = append(subscription.Subscribers, &costexplorer.Subscriber{
+			Type:    aws.String(subscriber.Type),
+			Address: aws.String(subscriber.Address),
+		})
+	}
+	return subscription, nil
+}
+
+// CreateAwsAnomalySubscription ...
+func CreateAwsAnomalySubscription(svc costexploreriface.CostExplorerAPI, params form.AwsAnomalySubscriptionParams) (*AwsAnomalySubscription, error) {
+	subscription, err := awsAnomalySubscriptionInput(params)
+	if err != nil {
+		return nil, err
+	}
+	output, err := svc.CreateAnomalySubscription(&costexplorer.CreateAnomalySubscriptionInput{AnomalySubscription: subscription})
+	if err != nil {
+		return nil, err
+	}
+	subscription.SubscriptionArn = output.SubscriptionArn
+	result := awsAnomalySubscription(subscription)
+	return &result, nil
+}
+
+// UpdateAwsAnomalySubscription replaces name, frequency, threshold, monitors and subscribers
+func UpdateAwsAnomalySubscription(svc costexploreriface.CostExplorerAPI, params form.AwsAnomalySubscriptionParams) (*AwsAnomalySubscription, error) {
+	if params.SubscriptionArn == "" {
+		return nil, NewParamError("subscription_arn", "is required")
+	}
+	subscription, err := awsAnomalySubscriptionInput(params)
+	if err != nil {
+		return nil, err
+	}
+	_, err = svc.UpdateAnomalySubscription(&costexplorer.UpdateAnomalySubscriptionInput{
+		SubscriptionArn:  aws.String(params.SubscriptionArn),
+		SubscriptionName: subscription.SubscriptionName,
+		Frequency:        subscription.Frequency,
+		Threshold:        subscription.Threshold,
+		MonitorArnList:   subscription.MonitorArnList,
+		Subscribers:      subscription.Subscribers,
+	})
+	if err != nil {
+		return nil, err
+	}
+	subscription.SubscriptionArn = aws.String(params.SubscriptionArn)
+	result := awsAnomalySubscription(subscription)
+	return &result, nil
+}
+
+// ProvideAwsAnomalyFeedback ...
+func ProvideAwsAnomalyFeedback(svc costexploreriface.CostExplorerAPI, params form.AwsAnomalyFeedbackParams) (string, error) {
+	if err := oneOf("feedback", params.Feedback, costexplorer.AnomalyFeedbackType_Values()); err != nil {
+		return "", err
+	}
+	output, err := svc.ProvideAnomalyFeedback(&costexplorer.ProvideAnomalyFeedbackInput{
+		AnomalyId: aws.String(params.AnomalyID),
+		Feedback:  aws.String(params.Feedback),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.AnomalyId), nil
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/notifications"
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+	gorm "gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Budget period
+const (
+	BudgetMonthly   = "MONTHLY"
+	BudgetQuarterly = "QUARTERLY"
+	BudgetAnnually  = "ANNUALLY"
+)
+
+// BudgetStatus spend of budget in current period
+type BudgetStatus struct {
+	BudgetID        uint                    `json:"budget_id"`
+	PeriodStart     string                  `json:"period_start"`
+	PeriodEnd       string                  `json:"period_end"`
+	Amount          float64                 `json:"amount"`
+	Actual          float64                 `json:"actual"`
+	Forecast        float64                 `json:"forecast"`
+	ActualPercent   float64                 `json:"actual_percent"`
+	ForecastPercent float64                 `json:"forecast_percent"`
+	ForecastError   string                  `json:"forecast_error"`
+	Crossed         []databases.BudgetAlert `json:"crossed"` // шинээр давсан босго
+}
+
+// BudgetPeriod current period [start, end) of budget
+func BudgetPeriod(period string, today time.Time) (time.Time, time.Time, error) {
+	switch period {
+	case BudgetMonthly:
+		start := utils.MonthStart(today)
+		return start, start.AddDate(0, 1, 0), nil
+	case BudgetQuarterly:
+		month := time.Month((int(today.Month())-1)/3*3 + 1)
+		start := time.Date(today.Year(), month, 1, 0, 0, 0, 0, today.Location())
+		return start, start.AddDate(0, 3, 0), nil
+	case BudgetAnnually:
+		start := time.Date(today.Year(), 1, 1, 0, 0, 0, 0, today.Location())
+		return start, start.AddDate(1, 0, 0), nil
+	}
+	return today, today, NewParamError("period", "must be MONTHLY, QUARTERLY or ANNUALLY")
+}
+
+// BudgetFilter cost filter of budget scope
+func BudgetFilter(budget databases.Budget) (*costexplorer.Expression, error) {
+	switch budget.ScopeType {
+	case databases.BudgetScopeCompany:
+		return CostFilter(nil), nil
+	case databases.BudgetScopeAccount:
+		return CostFilter(map[string][]*string{costexplorer.DimensionLinkedAccount: {aws.String(budget.ScopeValue)}}), nil
+	case databases.BudgetScopeService:
+		return CostFilter(map[string][]*string{costexplorer.DimensionService: {aws.String(budget.ScopeValue)}}), nil
+	case databases.BudgetScopeTag:
+		return &costexplorer.Expression{
+			And: []*costexplorer.Expression{
+				CostFilter(nil),
+				{
+					Tags: &costexplorer.TagValues{
+						Key:    aws.String(budget.ScopeKey),
+						Values: []*string{aws.String(budget.ScopeValue)},
+					},
+				},
+			},
+		}, nil
+	}
+	return nil, NewParamError("scope_type", "must be company, account, service or tag")
+}
+
+// ValidateBudget ...
+func ValidateBudget(budget databases.Budget) error {
+	if _, _, err := BudgetPeriod(budget.Period, utils.Today()); err != nil {
+		return err
+	}
+	if _, err := BudgetFilter(budget); err != nil {
+		return err
+	}
+	if budget.ScopeType != databases.BudgetScopeCompany && budget.ScopeValue == "" {
+		return NewParamError("scope_value", "is required")
+	}
+	if budget.ScopeType == databases.BudgetScopeTag && budget.ScopeKey == "" {
+		return NewParamError("scope_key", "is required")
+	}
+	if budget.Amount <= 0 {
+		return NewParamError("amount", "must be positive")
+	}
+	if budget.WebhookURL != "" {
+		if err := utils.PublicURL(budget.WebhookURL); err != nil {
+			return NewParamError("webhook_url", err.Error())
+		}
+	}
+	for _, threshold := range budget.Thresholds {
+		if threshold.Percentage <= 0 {
+			return NewParamError("thresholds.percentage", "must be positive")
+		}
+		if threshold.Type != databases.ThresholdActual && threshold.Type != databases.ThresholdForecasted {
+			return NewParamError("thresholds.type", "must be ACTUAL or FORECASTED")
+		}
+	}
+	return nil
+}
+
+// BudgetSpend actual and forecasted spend of the budget's current period
+func BudgetSpend(svc costexploreriface.CostExplorerAPI, budget databases.Budget) (*BudgetStatus, error) {
+	today := utils.Today()
+	start, end, err := BudgetPeriod(budget.Period, today)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := BudgetFilter(budget)
+	if err != nil {
+		return nil, err
+	}
+	metric := UsageMetric(budget.Metric)
+	if metric == "" {
+		metric = "UnblendedCost"
+	}
+
+	status := &BudgetStatus{
+		BudgetID:    budget.ID,
+		PeriodStart: start.Format(utils.DateFormat),
+		PeriodEnd:   end.Format(utils.DateFormat),
+		Amount:      budget.Amount,
+	}
+
+	// today is included, its cost is partial
+	actualEnd := today.AddDate(0, 0, 1)
+	if actualEnd.After(end) {
+		actualEnd = end
+	}
+	output, err := GetCostAndUsage(svc, &costexplorer.GetCostAndUsageInput{
+		Filter:      filter,
+		Granularity: aws.String(costexplorer.GranularityMonthly),
+		Metrics:     []*string{aws.String(metric)},
+		TimePeriod: &costexplorer.DateInterval{
+			Start: aws.String(status.PeriodStart),
+			End:   aws.String(actualEnd.Format(utils.DateFormat)),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, period := range output.ResultsByTime {
+		status.Actual += Amount(period.Total[metric])
+	}
+
+	// linear projection when Cost Explorer can not forecast
+	elapsed := actualEnd.Sub(start).Hours()
+	status.Forecast = status.Actual
+	if elapsed > 0 {
+		status.Forecast = status.Actual / elapsed * end.Sub(start).Hours()
+	}
+
+	if actualEnd.Before(end) {
+		forecast, err := svc.GetCostForecast(&costexplorer.GetCostForecastInput{
+			Filter:      filter,
+			Granularity: aws.String(costexplorer.GranularityMonthly),
+			Metric:      aws.String(ForecastMetric(metric)),
+			TimePeriod: &costexplorer.DateInterval{
+				Start: aws.String(actualEnd.Format(utils.DateFormat)),
+				End:   aws.String(status.PeriodEnd),
+			},
+		})
+		if err != nil {
+			status.ForecastError = err.Error()
+		} else {
+			status.Forecast = status.Actual + Amount(forecast.Total)
+		}
+	}
+
+	status.ActualPercent = status.Actual / budget.Amount * 100
+	status.ForecastPercent = status.Forecast / budget.Amount * 100
+	return status, nil
+}
+
+// EvaluateBudget checks budget thresholds and raises an alert once for each
+// threshold crossed in the current period.
+func EvaluateBudget(db *gorm.DB, svc costexploreriface.CostExplorerAPI, budget databases.Budget) (*BudgetStatus, error) {
+	status, err := BudgetSpend(svc, budget)
+
+	now := time.Now()
+	budget.EvaluatedDate = &now
+	if err != nil {
+		db.Model(&budget).Updates(map[string]interface{}{"evaluated_date": now, "evaluate_error": err.Error()})
+		return nil, err
+	}
+	db.Model(&budget).Updates(map[string]interface{}{
+		"evaluated_date": now,
+		"evaluate_error": "",
+		"actual":         status.Actual,
+		"forecast":       status.Forecast,
+	})
+
+	for _, threshold := range budget.Thresholds {
+		percent := status.ActualPercent
+		if threshold.Type == databases.ThresholdForecasted {
+			percent = status.ForecastPercent
+		}
+		if percent < threshold.Percentage {
+			continue
+		}
+
+		// alert is keyed by threshold value, editing the budget does not
+		// repeat alerts of the period
+		alert := databases.BudgetAlert{
+			BudgetID:     budget.ID,
+			ThresholdID:  threshold.ID,
+			PeriodStart:  status.PeriodStart,
+			Type:         threshold.Type,
+			Percentage:   threshold.Percentage,
+			BudgetAmount: budget.Amount,
+			Actual:       status.Actual,
+			Forecast:     status.Forecast,
+			Channels:     budget.Channels,
+			Base: databases.Base{
+				CreatedDate: now,
+			},
+		}
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&alert)
+		if result.Error != nil {
+			return status, result.Error
+		}
+		if result.RowsAffected == 0 {
+			// already alerted in this period
+			continue
+		}
+
+		if err := notifications.Send(notifications.SplitChannels(budget.Channels), budgetNotification(budget, alert)); err != nil {
+			db.Model(&alert).Update("delivery_error", err.Error())
+			alert.DeliveryError = err.Error()
+		}
+		status.Crossed = append(status.Crossed, alert)
+	}
+	return status, nil
+}
+
+func budgetNotification(budget databases.Budget, alert databases.BudgetAlert) notifications.Notification {
+	kind := "actual"
+	amount := alert.Actual
+	if alert.Type == databases.ThresholdForecasted {
+		kind = "forecasted"
+		amount = alert.Forecast
+	}
+	return notifications.Notification{
+		Event:      EventBudgetThreshold,
+		CompanyID:  budget.CompanyID,
+		UserID:     budget.UserID,
+		Subject:    fmt.Sprintf("Budget %v reached %v%%", budget.Name, alert.Percentage),
+		Message:    fmt.Sprintf("%v spend of budget %q is %.2f of %.2f (%v%% threshold, %v period from %v)", strings.Title(kind), budget.Name, amount, budget.Amount, alert.Percentage, strings.ToLower(budget.Period), alert.PeriodStart),
+		Data:       alert,
+		WebhookURL: budget.WebhookURL,
+	}
+}
+
+// BudgetFromParams ...
+func BudgetFromParams(budget *databases.Budget, params form.BudgetParams) {
+	budget.Name = params.Name
+	budget.ScopeType = params.ScopeType
+	budget.ScopeKey = params.ScopeKey
+	budget.ScopeValue = params.ScopeValue
+	budget.Period = params.Period
+	budget.Amount = params.Amount
+	budget.Metric = params.Metric
+	budget.Channels = strings.Join(params.Channels, ",")
+	budget.WebhookURL = params.WebhookURL
+	budget.IsActive = params.IsActive
+
+	budget.Thresholds = nil
+	for _, threshold := range params.Thresholds {
+		budget.Thresholds = append(budget.Thresholds, databases.BudgetThreshold{
+			Percentage: threshold.Percentage,
+			Type:       threshold.Type,
+			Base: databases.Base{
+				CreatedDate: time.Now(),
+			},
+		})
+	}
+}
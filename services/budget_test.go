@@ -0,0 +1,118 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+)
+
+// budgetSvc spend of 90 and forecast of 30 more in every period
+func budgetSvc() *fakeCostExplorer {
+	return &fakeCostExplorer{
+		usage: func(input *costexplorer.GetCostAndUsageInput) (*costexplorer.GetCostAndUsageOutput, error) {
+			return &costexplorer.GetCostAndUsageOutput{ResultsByTime: []*costexplorer.ResultByTime{
+				{TimePeriod: input.TimePeriod, Total: map[string]*costexplorer.MetricValue{"UnblendedCost": metricValue("90")}},
+			}}, nil
+		},
+		forecast: func(input *costexplorer.GetCostForecastInput) (*costexplorer.GetCostForecastOutput, error) {
+			return &costexplorer.GetCostForecastOutput{Total: metricValue("30")}, nil
+		},
+	}
+}
+
+func TestEvaluateBudgetAlertsOncePerThresholdValue(t *testing.T) {
+	db := testDB(t, &databases.Budget{}, &databases.BudgetThreshold{}, &databases.BudgetAlert{})
+	budget := databases.Budget{
+		Name:      "Monthly",
+		ScopeType: databases.BudgetScopeCompany,
+		Period:    "MONTHLY",
+		Amount:    100,
+		Channels:  "log",
+		IsActive:  true,
+		Thresholds: []databases.BudgetThreshold{
+			{Percentage: 80, Type: databases.ThresholdActual},
+			{Percentage: 100, Type: databases.ThresholdActual},
+		},
+	}
+	if err := db.Create(&budget).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := EvaluateBudget(db, budgetSvc(), budget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Crossed) != 1 || status.Crossed[0].Percentage != 80 {
+		t.Fatalf("expected 80%% alert, got %+v", status.Crossed)
+	}
+
+	// edit replaces threshold rows with new ids, same values are not alerted again
+	db.Where("budget_id = ?", budget.ID).Delete(&databases.BudgetThreshold{})
+	budget.Thresholds = []databases.BudgetThreshold{
+		{BudgetID: budget.ID, Percentage: 80, Type: databases.ThresholdActual, Base: databases.Base{CreatedDate: time.Now()}},
+		{BudgetID: budget.ID, Percentage: 110, Type: databases.ThresholdForecasted, Base: databases.Base{CreatedDate: time.Now()}},
+	}
+	db.Create(&budget.Thresholds)
+
+	status, err = EvaluateBudget(db, budgetSvc(), budget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Crossed) != 1 || status.Crossed[0].Type != databases.ThresholdForecasted {
+		t.Fatalf("expected only new forecasted alert, got %+v", status.Crossed)
+	}
+
+	var alerts int64
+	db.Model(&databases.BudgetAlert{}).Count(&alerts)
+	if alerts != 2 {
+		t.Fatalf("expected 2 alerts, got %v", alerts)
+	}
+}
+
+func TestBudgetSpendIsReadOnly(t *testing.T) {
+	db := testDB(t, &databases.Budget{}, &databases.BudgetThreshold{}, &databases.BudgetAlert{})
+	budget := databases.Budget{
+		ScopeType:  databases.BudgetScopeCompany,
+		Period:     "MONTHLY",
+		Amount:     50,
+		Thresholds: []databases.BudgetThreshold{{Percentage: 50, Type: databases.ThresholdActual}},
+	}
+	db.Create(&budget)
+
+	status, err := BudgetSpend(budgetSvc(), budget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Actual != 90 || status.ActualPercent != 180 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	var alerts int64
+	db.Model(&databases.BudgetAlert{}).Count(&alerts)
+	if alerts != 0 {
+		t.Fatal("status created alerts")
+	}
+}
+
+func TestValidateBudgetWebhookURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"", true},
+		{"https://8.8.8.8/hook", true},
+		{"http://8.8.8.8/hook", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+		{"https://127.0.0.1/hook", false},
+		{"https://10.0.0.5/hook", false},
+		{"https://[::1]/hook", false},
+		{"ftp://8.8.8.8/hook", false},
+	}
+	for _, test := range tests {
+		budget := databases.Budget{ScopeType: databases.BudgetScopeCompany, Period: "MONTHLY", Amount: 10, WebhookURL: test.url}
+		if err := ValidateBudget(budget); (err == nil) != test.valid {
+			t.Errorf("%q: expected valid %v, got %v", test.url, test.valid, err)
+		}
+	}
+}
@@ -0,0 +1,579 @@
+package services
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+)
+
+type (
+	// ReservationUtilization utilization of reserved instances in a period or of one subscription
+	ReservationUtilization struct {
+		Key                   string            `json:"key"` // subscription ID
+		Attributes            map[string]string `json:"attributes"`
+		StartDate             string            `json:"start_date"`
+		EndDate               string            `json:"end_date"`
+		UtilizationPercentage float64           `json:"utilization_percentage"`
+		PurchasedHours        float64           `json:"purchased_hours"`
+		UsedHours             float64           `json:"used_hours"`
+		UnusedHours           float64           `json:"unused_hours"`
+		AmortizedFee          float64           `json:"amortized_fee"`
+		UnusedCost            float64           `json:"unused_cost"` // cost of unused hours
+		OnDemandCostOfUsed    float64           `json:"on_demand_cost_of_used"`
+		NetSavings            float64           `json:"net_savings"`
+		PotentialSavings      float64           `json:"potential_savings"`
+	}
+
+	// ReservationUtilizationReport ...
+	ReservationUtilizationReport struct {
+		StartDate     string                   `json:"start_date"`
+		EndDate       string                   `json:"end_date"`
+		Granularity   string                   `json:"granularity"`
+		Total         ReservationUtilization   `json:"total"`
+		Periods       []ReservationUtilization `json:"periods"`
+		Subscriptions []ReservationUtilization `json:"subscriptions"`
+	}
+
+	// ReservationCoverage hours of usage covered by reserved instances
+	ReservationCoverage struct {
+		Key                string            `json:"key"`
+		Attributes         map[string]string `json:"attributes"`
+		StartDate          string            `json:"start_date"`
+		EndDate            string            `json:"end_date"`
+		CoveragePercentage float64           `json:"coverage_percentage"`
+		ReservedHours      float64           `json:"reserved_hours"`
+		OnDemandHours      float64           `json:"on_demand_hours"`
+		TotalHours         float64           `json:"total_hours"`
+		OnDemandCost       float64           `json:"on_demand_cost"`
+	}
+
+	// ReservationCoverageReport ...
+	ReservationCoverageReport struct {
+		StartDate   string                `json:"start_date"`
+		EndDate     string                `json:"end_date"`
+		Granularity string                `json:"granularity"`
+		GroupBy     string                `json:"group_by"`
+		Total       ReservationCoverage   `json:"total"`
+		Periods     []ReservationCoverage `json:"periods"`
+		Groups      []ReservationCoverage `json:"groups"`
+	}
+
+	// SavingsPlansUtilization commitment used by savings plans in a period or of one plan
+	SavingsPlansUtilization struct {
+		Arn                    string            `json:"arn"`
+		Attributes             map[string]string `json:"attributes"`
+		StartDate              string            `json:"start_date"`
+		EndDate                string            `json:"end_date"`
+		UtilizationPercentage  float64           `json:"utilization_percentage"`
+		TotalCommitment        float64           `json:"total_commitment"`
+		UsedCommitment         float64           `json:"used_commitment"`
+		UnusedCommitment       float64           `json:"unused_commitment"`
+		AmortizedCommitment    float64           `json:"amortized_commitment"`
+		OnDemandCostEquivalent float64           `json:"on_demand_cost_equivalent"`
+		NetSavings             float64           `json:"net_savings"`
+	}
+
+	// SavingsPlansUtilizationReport ...
+	SavingsPlansUtilizationReport struct {
+		StartDate   string                    `json:"start_date"`
+		EndDate     string                    `json:"end_date"`
+		Granularity string                    `json:"granularity"`
+		Total       SavingsPlansUtilization   `json:"total"`
+		Periods     []SavingsPlansUtilization `json:"periods"`
+		Plans       []SavingsPlansUtilization `json:"plans"`
+	}
+
+	// SavingsPlansCoverage spend covered by savings plans
+	SavingsPlansCoverage struct {
+		Key                string            `json:"key"`
+		Attributes         map[string]string `json:"attributes"`
+		StartDate          string            `json:"start_date"`
+		EndDate            string            `json:"end_date"`
+		CoveragePercentage float64           `json:"coverage_percentage"`
+		CoveredSpend       float64           `json:"covered_spend"`
+		OnDemandCost       float64           `json:"on_demand_cost"`
+		TotalCost          float64           `json:"total_cost"`
+	}
+
+	// SavingsPlansCoverageReport ...
+	SavingsPlansCoverageReport struct {
+		StartDate   string                 `json:"start_date"`
+		EndDate     string                 `json:"end_date"`
+		Granularity string                 `json:"granularity"`
+		GroupBy     string                 `json:"group_by"`
+		Total       SavingsPlansCoverage   `json:"total"`
+		Periods     []SavingsPlansCoverage `json:"periods"`
+		Groups      []SavingsPlansCoverage `json:"groups"`
+	}
+)
+
+// commitmentPeriod validates dates and granularity, hourly is not supported
+// by commitment reports
+func commitmentPeriod(params *form.CostExplorerCommitmentParams) (*costexplorer.DateInterval, error) {
+	if _, _, err := parseRange("period", form.DateRange{StartDate: params.StartDate, EndDate: params.EndDate}); err != nil {
+		return nil, err
+	}
+	if params.Granularity == "" {
+		params.Granularity = costexplorer.GranularityMonthly
+	}
+	if params.Granularity != costexplorer.GranularityDaily && params.Granularity != costexplorer.GranularityMonthly {
+		return nil, NewParamError("granularity", "must be DAILY or MONTHLY")
+	}
+	return &costexplorer.DateInterval{
+		Start: aws.String(params.StartDate),
+		End:   aws.String(params.EndDate),
+	}, nil
+}
+
+// commitmentFilter dimension filter of commitment reports. Unlike CostFilter
+// it has no RECORD_TYPE condition, these APIs do not support it.
+func commitmentFilter(dimensions map[string][]*string) *costexplorer.Expression {
+	var expressions []*costexplorer.Expression
+	keys := make([]string, 0, len(dimensions))
+	for key := range dimensions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if len(dimensions[key]) == 0 {
+			continue
+		}
+		expressions = append(expressions, &costexplorer.Expression{
+			Dimensions: &costexplorer.DimensionValues{
+				Key:    aws.String(key),
+				Values: dimensions[key],
+			},
+		})
+	}
+
+	switch len(expressions) {
+	case 0:
+		return nil
+	case 1:
+		return expressions[0]
+	}
+	return &costexplorer.Expression{And: expressions}
+}
+
+func attributes(values map[string]*string) map[string]string {
+	result := map[string]string{}
+	for key, value := range values {
+		result[key] = aws.StringValue(value)
+	}
+	return result
+}
+
+// attributesKey stable key of group attributes
+func attributesKey(values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, values[key])
+	}
+	return strings.Join(parts, "|")
+}
+
+func percentage(part, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return part / total * 100
+}
+
+func reservationUtilization(aggregates *costexplorer.ReservationAggregates) ReservationUtilization {
+	if aggregates == nil {
+		return ReservationUtilization{}
+	}
+	return ReservationUtilization{
+		UtilizationPercentage: ParseAmount(aggregates.UtilizationPercentage),
+		PurchasedHours:        ParseAmount(aggregates.PurchasedHours),
+		UsedHours:             ParseAmount(aggregates.TotalActualHours),
+		UnusedHours:           ParseAmount(aggregates.UnusedHours),
+		AmortizedFee:          ParseAmount(aggregates.TotalAmortizedFee),
+		UnusedCost:            ParseAmount(aggregates.RICostForUnusedHours),
+		OnDemandCostOfUsed:    ParseAmount(aggregates.OnDemandCostOfRIHoursUsed),
+		NetSavings:            ParseAmount(aggregates.NetRISavings),
+		PotentialSavings:      ParseAmount(aggregates.TotalPotentialRISavings),
+	}
+}
+
+func (u *ReservationUtilization) add(other ReservationUtilization) {
+	u.PurchasedHours += other.PurchasedHours
+	u.UsedHours += other.UsedHours
+	u.UnusedHours += other.UnusedHours
+	u.AmortizedFee += other.AmortizedFee
+	u.UnusedCost += other.UnusedCost
+	u.OnDemandCostOfUsed += other.OnDemandCostOfUsed
+	u.NetSavings += other.NetSavings
+	u.PotentialSavings += other.PotentialSavings
+	u.UtilizationPercentage = percentage(u.UsedHours, u.PurchasedHours)
+}
+
+// GetReservationUtilization utilization per period and per subscription
+func GetReservationUtilization(svc costexploreriface.CostExplorerAPI, params form.CostExplorerCommitmentParams) (*ReservationUtilizationReport, error) {
+	period, err := commitmentPeriod(&params)
+	if err != nil {
+		return nil, err
+	}
+	input := &costexplorer.GetReservationUtilizationInput{
+		Granularity: aws.String(params.Granularity),
+		TimePeriod:  period,
+		GroupBy: []*costexplorer.GroupDefinition{
+			{Type: aws.String(costexplorer.GroupDefinitionTypeDimension), Key: aws.String("SUBSCRIPTION_ID")},
+		},
+		Filter: commitmentFilter(map[string][]*string{
+			costexplorer.DimensionService:       params.Services,
+			costexplorer.DimensionLinkedAccount: params.LinkedAccounts,
+			costexplorer.DimensionRegion:        params.Regions,
+		}),
+	}
+
+	report := &ReservationUtilizationReport{
+		StartDate:     params.StartDate,
+		EndDate:       params.EndDate,
+		Granularity:   params.Granularity,
+		Periods:       []ReservationUtilization{},
+		Subscriptions: []ReservationUtilization{},
+	}
+	periods := map[string]int{}
+	subscriptions := map[string]*ReservationUtilization{}
+	var order []string
+	for {
+		output, err := svc.GetReservationUtilization(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, byTime := range output.UtilizationsByTime {
+			start := aws.StringValue(byTime.TimePeriod.Start)
+			if _, ok := periods[start]; !ok {
+				item := reservationUtilization(byTime.Total)
+				item.StartDate = start
+				item.EndDate = aws.StringValue(byTime.TimePeriod.End)
+				periods[start] = len(report.Periods)
+				report.Periods = append(report.Periods, item)
+			}
+			for _, group := range byTime.Groups {
+				key := aws.StringValue(group.Value)
+				if _, ok := subscriptions[key]; !ok {
+					subscriptions[key] = &ReservationUtilization{Key: key, Attributes: attributes(group.Attributes)}
+					order = append(order, key)
+				}
+				subscriptions[key].add(reservationUtilization(group.Utilization))
+			}
+		}
+		if output.NextPageToken == nil {
+			break
+		}
+		input.NextPageToken = output.NextPageToken
+	}
+
+	for _, item := range report.Periods {
+		report.Total.add(item)
+	}
+	report.Total.StartDate, report.Total.EndDate = report.StartDate, report.EndDate
+	for _, key := range order {
+		subscription := subscriptions[key]
+		subscription.StartDate, subscription.EndDate = report.StartDate, report.EndDate
+		report.Subscriptions = append(report.Subscriptions, *subscription)
+	}
+	// least utilized, most wasted commitment first
+	sort.SliceStable(report.Subscriptions, func(i, j int) bool {
+		return report.Subscriptions[i].UnusedCost > report.Subscriptions[j].UnusedCost
+	})
+	return report, nil
+}
+
+func reservationCoverage(coverage *costexplorer.Coverage) ReservationCoverage {
+	result := ReservationCoverage{}
+	if coverage == nil {
+		return result
+	}
+	if hours := coverage.CoverageHours; hours != nil {
+		result.CoveragePercentage = ParseAmount(hours.CoverageHoursPercentage)
+		result.ReservedHours = ParseAmount(hours.ReservedHours)
+		result.OnDemandHours = ParseAmount(hours.OnDemandHours)
+		result.TotalHours = ParseAmount(hours.TotalRunningHours)
+	}
+	if cost := coverage.CoverageCost; cost != nil {
+		result.OnDemandCost = ParseAmount(cost.OnDemandCost)
+	}
+	return result
+}
+
+func (c *ReservationCoverage) add(other ReservationCoverage) {
+	c.ReservedHours += other.ReservedHours
+	c.OnDemandHours += other.OnDemandHours
+	c.TotalHours += other.TotalHours
+	c.OnDemandCost += other.OnDemandCost
+	c.CoveragePercentage = percentage(c.ReservedHours, c.TotalHours)
+}
+
+// GetReservationCoverage coverage per period and per group
+func GetReservationCoverage(svc costexploreriface.CostExplorerAPI, params form.CostExplorerCommitmentParams) (*ReservationCoverageReport, error) {
+	period, err := commitmentPeriod(&params)
+	if err != nil {
+		return nil, err
+	}
+	input := &costexplorer.GetReservationCoverageInput{
+		Granularity: aws.String(params.Granularity),
+		TimePeriod:  period,
+		Metrics:     []*string{aws.String("Hour")},
+		Filter: commitmentFilter(map[string][]*string{
+			costexplorer.DimensionService:       params.Services,
+			costexplorer.DimensionLinkedAccount: params.LinkedAccounts,
+			costexplorer.DimensionRegion:        params.Regions,
+		}),
+	}
+	if params.GroupBy != "" {
+		input.GroupBy = []*costexplorer.GroupDefinition{
+			{Type: aws.String(costexplorer.GroupDefinitionTypeDimension), Key: aws.String(params.GroupBy)},
+		}
+	}
+
+	report := &ReservationCoverageReport{
+		StartDate:   params.StartDate,
+		EndDate:     params.EndDate,
+		Granularity: params.Granularity,
+		GroupBy:     params.GroupBy,
+		Periods:     []ReservationCoverage{},
+		Groups:      []ReservationCoverage{},
+	}
+	periods := map[string]int{}
+	groups := map[string]*ReservationCoverage{}
+	var order []string
+	for {
+		output, err := svc.GetReservationCoverage(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, byTime := range output.CoveragesByTime {
+			start := aws.StringValue(byTime.TimePeriod.Start)
+			if _, ok := periods[start]; !ok {
+				item := reservationCoverage(byTime.Total)
+				item.StartDate = start
+				item.EndDate = aws.StringValue(byTime.TimePeriod.End)
+				periods[start] = len(report.Periods)
+				report.Periods = append(report.Periods, item)
+			}
+			for _, group := range byTime.Groups {
+				values := attributes(group.Attributes)
+				key := attributesKey(values)
+				if _, ok := groups[key]; !ok {
+					groups[key] = &ReservationCoverage{Key: key, Attributes: values}
+					order = append(order, key)
+				}
+				groups[key].add(reservationCoverage(group.Coverage))
+			}
+		}
+		if output.NextPageToken == nil {
+			break
+		}
+		input.NextPageToken = output.NextPageToken
+	}
+
+	for _, item := range report.Periods {
+		report.Total.add(item)
+	}
+	report.Total.StartDate, report.Total.EndDate = report.StartDate, report.EndDate
+	for _, key := range order {
+		group := groups[key]
+		group.StartDate, group.EndDate = report.StartDate, report.EndDate
+		report.Groups = append(report.Groups, *group)
+	}
+	// most on demand spend first, the best candidates for reservation
+	sort.SliceStable(report.Groups, func(i, j int) bool {
+		return report.Groups[i].OnDemandCost > report.Groups[j].OnDemandCost
+	})
+	return report, nil
+}
+
+func savingsPlansUtilization(utilization *costexplorer.SavingsPlansUtilization, savings *costexplorer.SavingsPlansSavings, amortized *costexplorer.SavingsPlansAmortizedCommitment) SavingsPlansUtilization {
+	result := SavingsPlansUtilization{}
+	if utilization != nil {
+		result.UtilizationPercentage = ParseAmount(utilization.UtilizationPercentage)
+		result.TotalCommitment = ParseAmount(utilization.TotalCommitment)
+		result.UsedCommitment = ParseAmount(utilization.UsedCommitment)
+		result.UnusedCommitment = ParseAmount(utilization.UnusedCommitment)
+	}
+	if savings != nil {
+		result.OnDemandCostEquivalent = ParseAmount(savings.OnDemandCostEquivalent)
+		result.NetSavings = ParseAmount(savings.NetSavings)
+	}
+	if amortized != nil {
+		result.AmortizedCommitment = ParseAmount(amortized.TotalAmortizedCommitment)
+	}
+	return result
+}
+
+// GetSavingsPlansUtilization utilization per period and per savings plan
+func GetSavingsPlansUtilization(svc costexploreriface.CostExplorerAPI, params form.CostExplorerCommitmentParams) (*SavingsPlansUtilizationReport, error) {
+	period, err := commitmentPeriod(&params)
+	if err != nil {
+		return nil, err
+	}
+	filter := commitmentFilter(map[string][]*string{
+		costexplorer.DimensionLinkedAccount: params.LinkedAccounts,
+		costexplorer.DimensionRegion:        params.Regions,
+	})
+
+	output, err := svc.GetSavingsPlansUtilization(&costexplorer.GetSavingsPlansUtilizationInput{
+		Granularity: aws.String(params.Granularity),
+		TimePeriod:  period,
+		Filter:      filter,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SavingsPlansUtilizationReport{
+		StartDate:   params.StartDate,
+		EndDate:     params.EndDate,
+		Granularity: params.Granularity,
+		Periods:     []SavingsPlansUtilization{},
+		Plans:       []SavingsPlansUtilization{},
+	}
+	if total := output.Total; total != nil {
+		report.Total = savingsPlansUtilization(total.Utilization, total.Savings, total.AmortizedCommitment)
+	}
+	report.Total.StartDate, report.Total.EndDate = report.StartDate, report.EndDate
+	for _, byTime := range output.SavingsPlansUtilizationsByTime {
+		item := savingsPlansUtilization(byTime.Utilization, byTime.Savings, byTime.AmortizedCommitment)
+		item.StartDate = aws.StringValue(byTime.TimePeriod.Start)
+		item.EndDate = aws.StringValue(byTime.TimePeriod.End)
+		report.Periods = append(report.Periods, item)
+	}
+
+	detailsInput := &costexplorer.GetSavingsPlansUtilizationDetailsInput{
+		TimePeriod: period,
+		Filter:     filter,
+	}
+	for {
+		details, err := svc.GetSavingsPlansUtilizationDetails(detailsInput)
+		if err != nil {
+			return nil, err
+		}
+		for _, detail := range details.SavingsPlansUtilizationDetails {
+			item := savingsPlansUtilization(detail.Utilization, detail.Savings, detail.AmortizedCommitment)
+			item.Arn = aws.StringValue(detail.SavingsPlanArn)
+			item.Attributes = attributes(detail.Attributes)
+			item.StartDate, item.EndDate = report.StartDate, report.EndDate
+			report.Plans = append(report.Plans, item)
+		}
+		if details.NextToken == nil {
+			break
+		}
+		detailsInput.NextToken = details.NextToken
+	}
+	sort.SliceStable(report.Plans, func(i, j int) bool {
+		return report.Plans[i].UnusedCommitment > report.Plans[j].UnusedCommitment
+	})
+	return report, nil
+}
+
+func savingsPlansCoverage(coverage *costexplorer.SavingsPlansCoverageData) SavingsPlansCoverage {
+	if coverage == nil {
+		return SavingsPlansCoverage{}
+	}
+	return SavingsPlansCoverage{
+		CoveragePercentage: ParseAmount(coverage.CoveragePercentage),
+		CoveredSpend:       ParseAmount(coverage.SpendCoveredBySavingsPlans),
+		OnDemandCost:       ParseAmount(coverage.OnDemandCost),
+		TotalCost:          ParseAmount(coverage.TotalCost),
+	}
+}
+
+func (c *SavingsPlansCoverage) add(other SavingsPlansCoverage) {
+	c.CoveredSpend += other.CoveredSpend
+	c.OnDemandCost += other.OnDemandCost
+	c.TotalCost += other.TotalCost
+	c.CoveragePercentage = percentage(c.CoveredSpend, c.TotalCost)
+}
+
+// GetSavingsPlansCoverage coverage per period and per group
+func GetSavingsPlansCoverage(svc costexploreriface.CostExplorerAPI, params form.CostExplorerCommitmentParams) (*SavingsPlansCoverageReport, error) {
+	period, err := commitmentPeriod(&params)
+	if err != nil {
+		return nil, err
+	}
+	input := &costexplorer.GetSavingsPlansCoverageInput{
+		Granularity: aws.String(params.Granularity),
+		TimePeriod:  period,
+		Metrics:     []*string{aws.String("SpendCoveredBySavingsPlans")},
+		Filter: commitmentFilter(map[string][]*string{
+			costexplorer.DimensionLinkedAccount: params.LinkedAccounts,
+			costexplorer.DimensionRegion:        params.Regions,
+		}),
+	}
+	if params.GroupBy != "" {
+		input.GroupBy = []*costexplorer.GroupDefinition{
+			{Type: aws.String(costexplorer.GroupDefinitionTypeDimension), Key: aws.String(params.GroupBy)},
+		}
+	}
+
+	report := &SavingsPlansCoverageReport{
+		StartDate:   params.StartDate,
+		EndDate:     params.EndDate,
+		Granularity: params.Granularity,
+		GroupBy:     params.GroupBy,
+		Periods:     []SavingsPlansCoverage{},
+		Groups:      []SavingsPlansCoverage{},
+	}
+	// coverages are returned per period and group, totals are summed here
+	periods := map[string]*SavingsPlansCoverage{}
+	groups := map[string]*SavingsPlansCoverage{}
+	var periodOrder, groupOrder []string
+	for {
+		output, err := svc.GetSavingsPlansCoverage(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, coverage := range output.SavingsPlansCoverages {
+			item := savingsPlansCoverage(coverage.Coverage)
+
+			start := aws.StringValue(coverage.TimePeriod.Start)
+			if _, ok := periods[start]; !ok {
+				periods[start] = &SavingsPlansCoverage{StartDate: start, EndDate: aws.StringValue(coverage.TimePeriod.End)}
+				periodOrder = append(periodOrder, start)
+			}
+			periods[start].add(item)
+
+			values := attributes(coverage.Attributes)
+			key := attributesKey(values)
+			if _, ok := groups[key]; !ok {
+				groups[key] = &SavingsPlansCoverage{Key: key, Attributes: values}
+				groupOrder = append(groupOrder, key)
+			}
+			groups[key].add(item)
+			report.Total.add(item)
+		}
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+
+	report.Total.StartDate, report.Total.EndDate = report.StartDate, report.EndDate
+	sort.Strings(periodOrder)
+	for _, start := range periodOrder {
+		report.Periods = append(report.Periods, *periods[start])
+	}
+	if params.GroupBy != "" {
+		for _, key := range groupOrder {
+			group := groups[key]
+			group.StartDate, group.EndDate = report.StartDate, report.EndDate
+			report.Groups = append(report.Groups, *group)
+		}
+		sort.SliceStable(report.Groups, func(i, j int) bool {
+			return report.Groups[i].OnDemandCost > report.Groups[j].OnDemandCost
+		})
+	}
+	return report, nil
+}
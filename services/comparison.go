@@ -0,0 +1,218 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+)
+
+type (
+	// ServiceComparison month end comparison of one service
+	ServiceComparison struct {
+		Service               string   `json:"service"`
+		MonthToDate           float64  `json:"month_to_date"`
+		PreviousPeriod        float64  `json:"previous_period"` // same number of days last month
+		PreviousMonth         float64  `json:"previous_month"`
+		Projected             float64  `json:"projected"` // month end
+		Delta                 float64  `json:"delta"`     // month to date - previous period
+		DeltaPercent          *float64 `json:"delta_percent"`
+		ProjectedDelta        float64  `json:"projected_delta"` // projected - previous month
+		ProjectedDeltaPercent *float64 `json:"projected_delta_percent"`
+	}
+
+	// MonthEndComparison this month against last month
+	MonthEndComparison struct {
+		Metric               string              `json:"metric"`
+		Unit                 string              `json:"unit"`
+		MonthStart           string              `json:"month_start"`
+		Today                string              `json:"today"`
+		DaysElapsed          int                 `json:"days_elapsed"`
+		DaysInMonth          int                 `json:"days_in_month"`
+		MonthToDate          float64             `json:"month_to_date"`
+		PreviousPeriod       float64             `json:"previous_period"`
+		PreviousMonth        float64             `json:"previous_month"`
+		ForecastMonthEnd     float64             `json:"forecast_month_end"`
+		ForecastLower        float64             `json:"forecast_lower"`
+		ForecastUpper        float64             `json:"forecast_upper"`
+		ForecastError        string              `json:"forecast_error"` // forecast unavailable, month end is linear projection
+		Delta                float64             `json:"delta"`
+		DeltaPercent         *float64            `json:"delta_percent"`
+		ForecastDelta        float64             `json:"forecast_delta"`
+		ForecastDeltaPercent *float64            `json:"forecast_delta_percent"`
+		Services             []ServiceComparison `json:"services"`
+		Original             *MonthEndComparison `json:"original,omitempty"` // USD, өөр валютаар харуулсан үед
+	}
+)
+
+// GroupedCost metric per group value within [start, end). Cost category and
+// tag keys are returned without their "name$" prefix.
+func GroupedCost(svc costexploreriface.CostExplorerAPI, start, end time.Time, metric string, group *costexplorer.GroupDefinition, filter *costexplorer.Expression) (map[string]float64, string, error) {
+	if !start.Before(end) {
+		return map[string]float64{}, "", nil
+	}
+
+	output, err := GetCostAndUsage(svc, &costexplorer.GetCostAndUsageInput{
+		Filter:      filter,
+		Granularity: aws.String(costexplorer.GranularityMonthly),
+		Metrics:     []*string{aws.String(metric)},
+		GroupBy:     []*costexplorer.GroupDefinition{group},
+		TimePeriod: &costexplorer.DateInterval{
+			Start: aws.String(start.Format(utils.DateFormat)),
+			End:   aws.String(end.Format(utils.DateFormat)),
+		},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	unit := ""
+	for _, period := range output.ResultsByTime {
+		for _, group := range period.Groups {
+			if value := group.Metrics[metric]; value != nil {
+				unit = aws.StringValue(value.Unit)
+			}
+		}
+	}
+	totals := GroupTotals(output, metric)
+	if aws.StringValue(group.Type) == costexplorer.GroupDefinitionTypeDimension {
+		return totals, unit, nil
+	}
+	prefix := aws.StringValue(group.Key) + "$"
+	values := map[string]float64{}
+	for key, amount := range totals {
+		values[strings.TrimPrefix(key, prefix)] += amount
+	}
+	return values, unit, nil
+}
+
+// MonthEnd month to date spend against the same days and the whole of last
+// month, with the forecasted month end. Today is excluded from month to date
+// since its cost is incomplete.
+func MonthEnd(svc costexploreriface.CostExplorerAPI, params form.CostExplorerMonthEndParams) (*MonthEndComparison, error) {
+	metric := UsageMetric(params.Metric)
+	if metric == "" {
+		metric = "UnblendedCost"
+	}
+
+	today := utils.Today()
+	monthStart := utils.MonthStart(today)
+	nextMonth := monthStart.AddDate(0, 1, 0)
+	previousStart := monthStart.AddDate(0, -1, 0)
+	elapsed := int(today.Sub(monthStart).Hours() / 24)
+	previousEnd := previousStart.AddDate(0, 0, elapsed)
+	if previousEnd.After(monthStart) {
+		previousEnd = monthStart
+	}
+
+	filter := WithCostCategory(CostFilter(map[string][]*string{
+		costexplorer.DimensionService:       params.Services,
+		costexplorer.DimensionLinkedAccount: params.LinkedAccounts,
+	}), params.CostCategory)
+	byService := GroupDefinition(costexplorer.DimensionService, "")
+
+	result := &MonthEndComparison{
+		Metric:      metric,
+		MonthStart:  monthStart.Format(utils.DateFormat),
+		Today:       today.Format(utils.DateFormat),
+		DaysElapsed: elapsed,
+		DaysInMonth: int(nextMonth.Sub(monthStart).Hours() / 24),
+	}
+
+	monthToDate, unit, err := GroupedCost(svc, monthStart, today, metric, byService, filter)
+	if err != nil {
+		return nil, err
+	}
+	previousPeriod, previousUnit, err := GroupedCost(svc, previousStart, previousEnd, metric, byService, filter)
+	if err != nil {
+		return nil, err
+	}
+	previousMonth, _, err := GroupedCost(svc, previousStart, monthStart, metric, byService, filter)
+	if err != nil {
+		return nil, err
+	}
+	result.Unit = unit
+	if result.Unit == "" {
+		result.Unit = previousUnit
+	}
+
+	services := map[string]*ServiceComparison{}
+	item := func(name string) *ServiceComparison {
+		if _, ok := services[name]; !ok {
+			services[name] = &ServiceComparison{Service: name}
+		}
+		return services[name]
+	}
+	for name, amount := range monthToDate {
+		item(name).MonthToDate = amount
+		result.MonthToDate += amount
+	}
+	for name, amount := range previousPeriod {
+		item(name).PreviousPeriod = amount
+		result.PreviousPeriod += amount
+	}
+	for name, amount := range previousMonth {
+		item(name).PreviousMonth = amount
+		result.PreviousMonth += amount
+	}
+
+	// linear run rate, replaced by the Cost Explorer forecast when available
+	remaining := 0.0
+	if elapsed > 0 {
+		remaining = result.MonthToDate / float64(elapsed) * float64(result.DaysInMonth-elapsed)
+	}
+	result.ForecastLower = result.MonthToDate + remaining
+	result.ForecastUpper = result.MonthToDate + remaining
+
+	forecast, err := Forecast(svc, form.CostExplorerForcastParams{
+		StartDate:      result.Today,
+		EndDate:        nextMonth.Format(utils.DateFormat),
+		Granularity:    costexplorer.GranularityMonthly,
+		Metric:         metric,
+		Services:       params.Services,
+		LinkedAccounts: params.LinkedAccounts,
+		CostCategory:   params.CostCategory,
+	})
+	if err != nil {
+		result.ForecastError = err.Error()
+	} else {
+		remaining = forecast.ForecastTotal
+		result.ForecastLower = result.MonthToDate + remaining
+		result.ForecastUpper = result.MonthToDate + remaining
+		// rest of the month is one monthly period with its own interval
+		if forecast.TotalLower != nil && forecast.TotalUpper != nil {
+			result.ForecastLower = result.MonthToDate + *forecast.TotalLower
+			result.ForecastUpper = result.MonthToDate + *forecast.TotalUpper
+		}
+	}
+	result.ForecastMonthEnd = result.MonthToDate + remaining
+
+	result.Delta = result.MonthToDate - result.PreviousPeriod
+	result.DeltaPercent = PercentChange(result.PreviousPeriod, result.MonthToDate)
+	result.ForecastDelta = result.ForecastMonthEnd - result.PreviousMonth
+	result.ForecastDeltaPercent = PercentChange(result.PreviousMonth, result.ForecastMonthEnd)
+
+	// remaining cost is split between services by their month to date share
+	for _, service := range services {
+		share := 0.0
+		if result.MonthToDate != 0 {
+			share = service.MonthToDate / result.MonthToDate
+		}
+		service.Projected = service.MonthToDate + remaining*share
+		service.Delta = service.MonthToDate - service.PreviousPeriod
+		service.DeltaPercent = PercentChange(service.PreviousPeriod, service.MonthToDate)
+		service.ProjectedDelta = service.Projected - service.PreviousMonth
+		service.ProjectedDeltaPercent = PercentChange(service.PreviousMonth, service.Projected)
+		result.Services = append(result.Services, *service)
+	}
+	sort.Slice(result.Services, func(i, j int) bool {
+		return result.Services[i].Projected > result.Services[j].Projected
+	})
+
+	return result, nil
+}
@@ -0,0 +1,386 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+)
+
+type (
+	// CostCategoryStatus processing status of a component
+	CostCategoryStatus struct {
+		Component string `json:"component"`
+		Status    string `json:"status"` // PROCESSING, APPLIED
+	}
+
+	// CostCategoryRule rule in our condition form, expression is set when the
+	// rule can not be represented by conditions
+	CostCategoryRule struct {
+		form.CostCategoryRuleParams
+		Expression *costexplorer.Expression `json:"expression,omitempty"`
+	}
+
+	// CostCategoryDefinition ...
+	CostCategoryDefinition struct {
+		Arn              string                               `json:"arn"`
+		Name             string                               `json:"name"`
+		EffectiveStart   string                               `json:"effective_start"`
+		EffectiveEnd     string                               `json:"effective_end"`
+		DefaultValue     string                               `json:"default_value"`
+		RuleVersion      string                               `json:"rule_version"`
+		NumberOfRules    int64                                `json:"number_of_rules"`
+		Values           []string                             `json:"values"`
+		ProcessingStatus []CostCategoryStatus                 `json:"processing_status"`
+		Rules            []CostCategoryRule                   `json:"rules,omitempty"`
+		SplitChargeRules []form.CostCategorySplitChargeParams `json:"split_charge_rules,omitempty"`
+	}
+)
+
+func costCategoryStatus(statuses []*costexplorer.CostCategoryProcessingStatus) []CostCategoryStatus {
+	result := []CostCategoryStatus{}
+	for _, status := range statuses {
+		result = append(result, CostCategoryStatus{
+			Component: aws.StringValue(status.Component),
+			Status:    aws.StringValue(status.Status),
+		})
+	}
+	return result
+}
+
+// ListCostCategories cost category definitions effective now
+func ListCostCategories(svc costexploreriface.CostExplorerAPI) ([]CostCategoryDefinition, error) {
+	input := &costexplorer.ListCostCategoryDefinitionsInput{}
+	definitions := []CostCategoryDefinition{}
+	for {
+		output, err := svc.ListCostCategoryDefinitions(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, reference := range output.CostCategoryReferences {
+			definitions = append(definitions, CostCategoryDefinition{
+				Arn:              aws.StringValue(reference.CostCategoryArn),
+				Name:             aws.StringValue(reference.Name),
+				EffectiveStart:   aws.StringValue(reference.EffectiveStart),
+				EffectiveEnd:     aws.StringValue(reference.EffectiveEnd),
+				DefaultValue:     aws.StringValue(reference.DefaultValue),
+				NumberOfRules:    aws.Int64Value(reference.NumberOfRules),
+				Values:           aws.StringValueSlice(reference.Values),
+				ProcessingStatus: costCategoryStatus(reference.ProcessingStatus),
+			})
+		}
+		if aws.StringValue(output.NextToken) == "" {
+			return definitions, nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// DescribeCostCategory definition with rules and split charge rules
+func DescribeCostCategory(svc costexploreriface.CostExplorerAPI, arn string) (*CostCategoryDefinition, error) {
+	if arn == "" {
+		return nil, NewParamError("arn", "is required")
+	}
+	output, err := svc.DescribeCostCategoryDefinition(&costexplorer.DescribeCostCategoryDefinitionInput{
+		CostCategoryArn: aws.String(arn),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	category := output.CostCategory
+	definition := &CostCategoryDefinition{
+		Arn:              aws.StringValue(category.CostCategoryArn),
+		Name:             aws.StringValue(category.Name),
+		EffectiveStart:   aws.StringValue(category.EffectiveStart),
+		EffectiveEnd:     aws.StringValue(category.EffectiveEnd),
+		DefaultValue:     aws.StringValue(category.DefaultValue),
+		RuleVersion:      aws.StringValue(category.RuleVersion),
+		NumberOfRules:    int64(len(category.Rules)),
+		Values:           []string{},
+		ProcessingStatus: costCategoryStatus(category.ProcessingStatus),
+		Rules:            []CostCategoryRule{},
+		SplitChargeRules: []form.CostCategorySplitChargeParams{},
+	}
+
+	values := map[string]bool{}
+	for _, rule := range category.Rules {
+		item := costCategoryRule(rule)
+		definition.Rules = append(definition.Rules, item)
+		if item.Value != "" && !values[item.Value] {
+			values[item.Value] = true
+			definition.Values = append(definition.Values, item.Value)
+		}
+	}
+	for _, split := range category.SplitChargeRules {
+		item := form.CostCategorySplitChargeParams{
+			Source:  aws.StringValue(split.Source),
+			Targets: aws.StringValueSlice(split.Targets),
+			Method:  aws.StringValue(split.Method),
+		}
+		for _, parameter := range split.Parameters {
+			if aws.StringValue(parameter.Type) != costexplorer.CostCategorySplitChargeRuleParameterTypeAllocationPercentages {
+				continue
+			}
+			for _, value := range parameter.Values {
+				percentage, _ := strconv.ParseFloat(aws.StringValue(value), 64)
+				item.Percentages = append(item.Percentages, percentage)
+			}
+		}
+		definition.SplitChargeRules = append(definition.SplitChargeRules, item)
+	}
+	return definition, nil
+}
+
+// costCategoryRule AWS rule into conditions
+func costCategoryRule(rule *costexplorer.CostCategoryRule) CostCategoryRule {
+	item := CostCategoryRule{CostCategoryRuleParams: form.CostCategoryRuleParams{
+		Value:    aws.StringValue(rule.Value),
+		Type:     aws.StringValue(rule.Type),
+		Operator: "AND",
+	}}
+	if item.Type == "" {
+		item.Type = costexplorer.CostCategoryRuleTypeRegular
+	}
+	if inherited := rule.InheritedValue; inherited != nil {
+		item.InheritedDimension = aws.StringValue(inherited.DimensionName)
+		item.InheritedKey = aws.StringValue(inherited.DimensionKey)
+	}
+	if rule.Rule == nil {
+		return item
+	}
+
+	expressions := []*costexplorer.Expression{rule.Rule}
+	switch {
+	case len(rule.Rule.And) > 0:
+		expressions = rule.Rule.And
+	case len(rule.Rule.Or) > 0:
+		expressions = rule.Rule.Or
+		item.Operator = "OR"
+	}
+	for _, expression := range expressions {
+		condition, ok := costCategoryCondition(expression)
+		if !ok {
+			// nested or negated expressions are returned as is
+			item.Conditions = nil
+			item.Expression = rule.Rule
+			return item
+		}
+		item.Conditions = append(item.Conditions, condition)
+	}
+	return item
+}
+
+func costCategoryCondition(expression *costexplorer.Expression) (form.CostCategoryConditionParams, bool) {
+	switch {
+	case expression.Dimensions != nil:
+		return form.CostCategoryConditionParams{
+			Type:         costexplorer.GroupDefinitionTypeDimension,
+			Key:          aws.StringValue(expression.Dimensions.Key),
+			Values:       aws.StringValueSlice(expression.Dimensions.Values),
+			MatchOptions: aws.StringValueSlice(expression.Dimensions.MatchOptions),
+		}, true
+	case expression.Tags != nil:
+		return form.CostCategoryConditionParams{
+			Type:         costexplorer.GroupDefinitionTypeTag,
+			Key:          aws.StringValue(expression.Tags.Key),
+			Values:       aws.StringValueSlice(expression.Tags.Values),
+			MatchOptions: aws.StringValueSlice(expression.Tags.MatchOptions),
+		}, true
+	case expression.CostCategories != nil:
+		return form.CostCategoryConditionParams{
+			Type:         costexplorer.GroupDefinitionTypeCostCategory,
+			Key:          aws.StringValue(expression.CostCategories.Key),
+			Values:       aws.StringValueSlice(expression.CostCategories.Values),
+			MatchOptions: aws.StringValueSlice(expression.CostCategories.MatchOptions),
+		}, true
+	}
+	return form.CostCategoryConditionParams{}, false
+}
+
+// costCategoryRules validates params into AWS rules and split charge rules
+func costCategoryRules(params form.CostCategoryParams) ([]*costexplorer.CostCategoryRule, []*costexplorer.CostCategorySplitChargeRule, error) {
+	if len(params.Rules) == 0 {
+		return nil, nil, NewParamError("rules", "is required")
+	}
+
+	var rules []*costexplorer.CostCategoryRule
+	for _, rule := range params.Rules {
+		if rule.Type == "" {
+			rule.Type = costexplorer.CostCategoryRuleTypeRegular
+		}
+		switch rule.Type {
+		case costexplorer.CostCategoryRuleTypeRegular:
+			expression, err := costCategoryExpression(rule)
+			if err != nil {
+				return nil, nil, err
+			}
+			if rule.Value == "" {
+				return nil, nil, NewParamError("rules.value", "is required")
+			}
+			rules = append(rules, &costexplorer.CostCategoryRule{
+				Type:  aws.String(rule.Type),
+				Value: aws.String(rule.Value),
+				Rule:  expression,
+			})
+		case costexplorer.CostCategoryRuleTypeInheritedValue:
+			if err := oneOf("rules.inherited_dimension", rule.InheritedDimension, costexplorer.CostCategoryInheritedValueDimensionName_Values()); err != nil {
+				return nil, nil, err
+			}
+			inherited := &costexplorer.CostCategoryInheritedValueDimension{DimensionName: aws.String(rule.InheritedDimension)}
+			if rule.InheritedDimension == costexplorer.CostCategoryInheritedValueDimensionNameTag {
+				if rule.InheritedKey == "" {
+					return nil, nil, NewParamError("rules.inherited_key", "is required for TAG")
+				}
+				inherited.DimensionKey = aws.String(rule.InheritedKey)
+			}
+			rules = append(rules, &costexplorer.CostCategoryRule{
+				Type:           aws.String(rule.Type),
+				InheritedValue: inherited,
+			})
+		default:
+			return nil, nil, oneOf("rules.type", rule.Type, costexplorer.CostCategoryRuleType_Values())
+		}
+	}
+
+	var splits []*costexplorer.CostCategorySplitChargeRule
+	for _, split := range params.SplitChargeRules {
+		if err := oneOf("split_charge_rules.method", split.Method, costexplorer.CostCategorySplitChargeMethod_Values()); err != nil {
+			return nil, nil, err
+		}
+		if len(split.Targets) == 0 {
+			return nil, nil, NewParamError("split_charge_rules.targets", "is required")
+		}
+		item := &costexplorer.CostCategorySplitChargeRule{
+			Source:  aws.String(split.Source),
+			Targets: aws.StringSlice(split.Targets),
+			Method:  aws.String(split.Method),
+		}
+		if split.Method == costexplorer.CostCategorySplitChargeMethodFixed {
+			if len(split.Percentages) != len(split.Targets) {
+				return nil, nil, NewParamError("split_charge_rules.percentages", "must have one percentage per target")
+			}
+			total := 0.0
+			var values []*string
+			for _, percentage := range split.Percentages {
+				total += percentage
+				values = append(values, aws.String(strconv.FormatFloat(percentage, 'f', -1, 64)))
+			}
+			if total < 99.99 || total > 100.01 {
+				return nil, nil, NewParamError("split_charge_rules.percentages", "must sum to 100")
+			}
+			item.Parameters = []*costexplorer.CostCategorySplitChargeRuleParameter{
+				{
+					Type:   aws.String(costexplorer.CostCategorySplitChargeRuleParameterTypeAllocationPercentages),
+					Values: values,
+				},
+			}
+		}
+		splits = append(splits, item)
+	}
+	return rules, splits, nil
+}
+
+// costCategoryExpression conditions joined by operator
+func costCategoryExpression(rule form.CostCategoryRuleParams) (*costexplorer.Expression, error) {
+	if len(rule.Conditions) == 0 {
+		return nil, NewParamError("rules.conditions", "is required")
+	}
+
+	var expressions []*costexplorer.Expression
+	for _, condition := range rule.Conditions {
+		for _, option := range condition.MatchOptions {
+			if err := oneOf("rules.conditions.match_options", option, costexplorer.MatchOption_Values()); err != nil {
+				return nil, err
+			}
+		}
+		var matchOptions []*string
+		if len(condition.MatchOptions) > 0 {
+			matchOptions = aws.StringSlice(condition.MatchOptions)
+		}
+
+		switch strings.ToUpper(condition.Type) {
+		case costexplorer.GroupDefinitionTypeDimension:
+			expressions = append(expressions, &costexplorer.Expression{Dimensions: &costexplorer.DimensionValues{
+				Key: aws.String(condition.Key), Values: aws.StringSlice(condition.Values), MatchOptions: matchOptions,
+			}})
+		case costexplorer.GroupDefinitionTypeTag:
+			expressions = append(expressions, &costexplorer.Expression{Tags: &costexplorer.TagValues{
+				Key: aws.String(condition.Key), Values: aws.StringSlice(condition.Values), MatchOptions: matchOptions,
+			}})
+		case costexplorer.GroupDefinitionTypeCostCategory:
+			expressions = append(expressions, &costexplorer.Expression{CostCategories: &costexplorer.CostCategoryValues{
+				Key: aws.String(condition.Key), Values: aws.StringSlice(condition.Values), MatchOptions: matchOptions,
+			}})
+		default:
+			return nil, NewParamError("rules.conditions.type", "must be DIMENSION, TAG or COST_CATEGORY")
+		}
+	}
+
+	if len(expressions) == 1 {
+		return expressions[0], nil
+	}
+	switch strings.ToUpper(rule.Operator) {
+	case "", "AND":
+		return &costexplorer.Expression{And: expressions}, nil
+	case "OR":
+		return &costexplorer.Expression{Or: expressions}, nil
+	}
+	return nil, NewParamError("rules.operator", "must be AND or OR")
+}
+
+// CreateCostCategory ...
+func CreateCostCategory(svc costexploreriface.CostExplorerAPI, params form.CostCategoryParams) (*CostCategoryDefinition, error) {
+	if params.Name == "" {
+		return nil, NewParamError("name", "is required")
+	}
+	rules, splits, err := costCategoryRules(params)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &costexplorer.CreateCostCategoryDefinitionInput{
+		Name:             aws.String(params.Name),
+		RuleVersion:      aws.String(costexplorer.CostCategoryRuleVersionCostCategoryExpressionV1),
+		Rules:            rules,
+		SplitChargeRules: splits,
+	}
+	if params.DefaultValue != "" {
+		input.DefaultValue = aws.String(params.DefaultValue)
+	}
+	output, err := svc.CreateCostCategoryDefinition(input)
+	if err != nil {
+		return nil, err
+	}
+	return DescribeCostCategory(svc, aws.StringValue(output.CostCategoryArn))
+}
+
+// UpdateCostCategory replaces rules, split charge rules and default value,
+// AWS does not allow renaming
+func UpdateCostCategory(svc costexploreriface.CostExplorerAPI, params form.CostCategoryParams) (*CostCategoryDefinition, error) {
+	if params.Arn == "" {
+		return nil, NewParamError("arn", "is required")
+	}
+	rules, splits, err := costCategoryRules(params)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &costexplorer.UpdateCostCategoryDefinitionInput{
+		CostCategoryArn:  aws.String(params.Arn),
+		RuleVersion:      aws.String(costexplorer.CostCategoryRuleVersionCostCategoryExpressionV1),
+		Rules:            rules,
+		SplitChargeRules: splits,
+	}
+	if params.DefaultValue != "" {
+		input.DefaultValue = aws.String(params.DefaultValue)
+	}
+	output, err := svc.UpdateCostCategoryDefinition(input)
+	if err != nil {
+		return nil, err
+	}
+	return DescribeCostCategory(svc, aws.StringValue(output.CostCategoryArn))
+}
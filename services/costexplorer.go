@@ -0,0 +1,211 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+)
+
+var credit = "Credit"
+var refund = "Refund"
+
+// forecastMetrics GetCostAndUsage metric => GetCostForecast metric
+var forecastMetrics = map[string]string{
+	"AmortizedCost":    costexplorer.MetricAmortizedCost,
+	"BlendedCost":      costexplorer.MetricBlendedCost,
+	"NetAmortizedCost": costexplorer.MetricNetAmortizedCost,
+	"NetUnblendedCost": costexplorer.MetricNetUnblendedCost,
+	"UnblendedCost":    costexplorer.MetricUnblendedCost,
+}
+
+// CostFilter filter without credits and refunds, restricted to the given
+// dimension values (SERVICE, LINKED_ACCOUNT ...)
+func CostFilter(dimensions map[string][]*string) *costexplorer.Expression {
+	expressions := []*costexplorer.Expression{
+		{
+			Not: &costexplorer.Expression{
+				Dimensions: &costexplorer.DimensionValues{
+					Key:    aws.String(costexplorer.DimensionRecordType),
+					Values: []*string{&credit, &refund},
+				},
+			},
+		},
+	}
+
+	for key, values := range dimensions {
+		if len(values) == 0 {
+			continue
+		}
+		expressions = append(expressions, &costexplorer.Expression{
+			Dimensions: &costexplorer.DimensionValues{
+				Key:    aws.String(key),
+				Values: values,
+			},
+		})
+	}
+
+	if len(expressions) == 1 {
+		return expressions[0]
+	}
+	return &costexplorer.Expression{And: expressions}
+}
+
+// WithCostCategory restricts filter to the cost category values
+func WithCostCategory(filter *costexplorer.Expression, category *form.CostCategoryFilter) *costexplorer.Expression {
+	if category == nil || category.Key == "" || len(category.Values) == 0 {
+		return filter
+	}
+	expression := &costexplorer.Expression{
+		CostCategories: &costexplorer.CostCategoryValues{
+			Key:    aws.String(category.Key),
+			Values: category.Values,
+		},
+	}
+	if filter == nil {
+		return expression
+	}
+	if filter.And != nil {
+		return &costexplorer.Expression{And: append(append([]*costexplorer.Expression{}, filter.And...), expression)}
+	}
+	return &costexplorer.Expression{And: []*costexplorer.Expression{filter, expression}}
+}
+
+// GroupDefinition group by dimension, group by cost category when dimension
+// is COST_CATEGORY and key is the cost category name
+func GroupDefinition(dimension, key string) *costexplorer.GroupDefinition {
+	if dimension == costexplorer.GroupDefinitionTypeCostCategory {
+		return &costexplorer.GroupDefinition{
+			Type: aws.String(costexplorer.GroupDefinitionTypeCostCategory),
+			Key:  aws.String(key),
+		}
+	}
+	return &costexplorer.GroupDefinition{
+		Type: aws.String(costexplorer.GroupDefinitionTypeDimension),
+		Key:  aws.String(dimension),
+	}
+}
+
+// CostAndUsageInput GetCostAndUsage input of cost params
+func CostAndUsageInput(params form.CostExplorerParams) *costexplorer.GetCostAndUsageInput {
+	input := &costexplorer.GetCostAndUsageInput{
+		Granularity: aws.String(params.Granularity),
+		Metrics:     params.Metric,
+		TimePeriod: &costexplorer.DateInterval{
+			End:   aws.String(params.EndDate),
+			Start: aws.String(params.StartDate),
+		},
+		Filter: WithCostCategory(CostFilter(map[string][]*string{
+			costexplorer.DimensionService: params.Services,
+		}), params.CostCategory),
+	}
+
+	if params.GroupName != "" {
+		groupType := params.GroupType
+		if groupType == "" {
+			groupType = costexplorer.GroupDefinitionTypeDimension
+		}
+		input.GroupBy = []*costexplorer.GroupDefinition{
+			{
+				Type: aws.String(groupType),
+				Key:  aws.String(params.GroupName),
+			},
+		}
+	}
+	return input
+}
+
+// GetCostAndUsage fetch all pages
+func GetCostAndUsage(svc costexploreriface.CostExplorerAPI, input *costexplorer.GetCostAndUsageInput) (*costexplorer.GetCostAndUsageOutput, error) {
+	output, err := svc.GetCostAndUsage(input)
+	if err != nil {
+		return nil, err
+	}
+
+	for output.NextPageToken != nil {
+		input.NextPageToken = output.NextPageToken
+		page, err := svc.GetCostAndUsage(input)
+		if err != nil {
+			return nil, err
+		}
+		output.ResultsByTime = mergeResults(output.ResultsByTime, page.ResultsByTime)
+		output.NextPageToken = page.NextPageToken
+	}
+	input.NextPageToken = nil
+	return output, nil
+}
+
+// mergeResults pages split groups of the same period
+func mergeResults(results, page []*costexplorer.ResultByTime) []*costexplorer.ResultByTime {
+	index := map[string]*costexplorer.ResultByTime{}
+	for _, result := range results {
+		index[aws.StringValue(result.TimePeriod.Start)] = result
+	}
+	for _, result := range page {
+		if existing, ok := index[aws.StringValue(result.TimePeriod.Start)]; ok {
+			existing.Groups = append(existing.Groups, result.Groups...)
+			continue
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// ForecastMetric GetCostForecast metric name, accepts both UnblendedCost and UNBLENDED_COST
+func ForecastMetric(metric string) string {
+	if value, ok := forecastMetrics[metric]; ok {
+		return value
+	}
+	return metric
+}
+
+// UsageMetric GetCostAndUsage metric name, accepts both UnblendedCost and UNBLENDED_COST
+func UsageMetric(metric string) string {
+	for key, value := range forecastMetrics {
+		if value == metric {
+			return key
+		}
+	}
+	return metric
+}
+
+// Amount parse metric amount
+func Amount(value *costexplorer.MetricValue) float64 {
+	if value == nil {
+		return 0
+	}
+	amount, _ := strconv.ParseFloat(aws.StringValue(value.Amount), 64)
+	return amount
+}
+
+// ParseAmount parse amount string
+func ParseAmount(value *string) float64 {
+	amount, _ := strconv.ParseFloat(aws.StringValue(value), 64)
+	return amount
+}
+
+// GroupTotals sum of metric per group key across all periods
+func GroupTotals(output *costexplorer.GetCostAndUsageOutput, metric string) map[string]float64 {
+	totals := map[string]float64{}
+	if output == nil {
+		return totals
+	}
+	for _, period := range output.ResultsByTime {
+		for _, group := range period.Groups {
+			totals[strings.Join(aws.StringValueSlice(group.Keys), "|")] += Amount(group.Metrics[metric])
+		}
+	}
+	return totals
+}
+
+// PercentChange change from previous to current, nil when previous is zero
+func PercentChange(previous, current float64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	change := (current - previous) / previous * 100
+	return &change
+}
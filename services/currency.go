@@ -0,0 +1,364 @@
+package services
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+	gorm "gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BaseCurrency currency of AWS costs
+const BaseCurrency = "USD"
+
+// Rates daily exchange rates of one currency, 1 USD = rate currency
+type Rates struct {
+	Currency string
+	dates    []string // sorted
+	rates    map[string]float64
+}
+
+// Rate of the day, the latest rate on or before the day is used for
+// weekends, holidays and future dates
+func (r *Rates) Rate(date string) (float64, error) {
+	if r.Currency == BaseCurrency {
+		return 1, nil
+	}
+	i := sort.SearchStrings(r.dates, date)
+	if i < len(r.dates) && r.dates[i] == date {
+		return r.rates[date], nil
+	}
+	if i == 0 {
+		return 0, NewParamError("currency", "no "+r.Currency+" rate on or before "+date)
+	}
+	return r.rates[r.dates[i-1]], nil
+}
+
+// PeriodRate average of daily rates within [start, end)
+func (r *Rates) PeriodRate(start, end string) (float64, error) {
+	if r.Currency == BaseCurrency {
+		return 1, nil
+	}
+	from, err := utils.ParseDate(start)
+	if err != nil {
+		return 0, err
+	}
+	to, err := utils.ParseDate(end)
+	if err != nil {
+		return 0, err
+	}
+	if !from.Before(to) {
+		return r.Rate(start)
+	}
+
+	var sum float64
+	var days int
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		rate, err := r.Rate(day.Format(utils.DateFormat))
+		if err != nil {
+			return 0, err
+		}
+		sum += rate
+		days++
+	}
+	return sum / float64(days), nil
+}
+
+// normalizeCurrency upper case ISO code, USD when empty
+func normalizeCurrency(currency string) string {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return BaseCurrency
+	}
+	return currency
+}
+
+// DisplayCurrency requested currency, company currency otherwise, USD by default
+func DisplayCurrency(db *gorm.DB, user databases.SystemUser, requested string) string {
+	if requested != "" {
+		return normalizeCurrency(requested)
+	}
+	if user.CompanyID != 0 {
+		var company databases.Company
+		if result := db.Limit(1).Find(&company, user.CompanyID); result.Error == nil && result.RowsAffected != 0 {
+			return normalizeCurrency(company.Currency)
+		}
+	}
+	return BaseCurrency
+}
+
+// LoadRates rates of the currency within [start, end] and the last one before start
+func LoadRates(db *gorm.DB, currency, start, end string) (*Rates, error) {
+	rates := &Rates{Currency: normalizeCurrency(currency), rates: map[string]float64{}}
+	if rates.Currency == BaseCurrency {
+		return rates, nil
+	}
+
+	var items []databases.ExchangeRate
+	result := db.Where("currency = ? AND date <= ? AND date >= (?)", rates.Currency, end,
+		db.Model(&databases.ExchangeRate{}).Select("COALESCE(MAX(date), '')").
+			Where("currency = ? AND date <= ?", rates.Currency, start)).
+		Order("date").Find(&items)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(items) == 0 {
+		return nil, NewParamError("currency", "no "+rates.Currency+" exchange rates")
+	}
+
+	for _, item := range items {
+		rates.dates = append(rates.dates, item.Date)
+		rates.rates[item.Date] = item.Rate
+	}
+	return rates, nil
+}
+
+// SetCompanyCurrency display currency of the company
+func SetCompanyCurrency(db *gorm.DB, companyID uint, currency string) (*databases.Company, error) {
+	var company databases.Company
+	if result := db.Limit(1).Find(&company, companyID); result.Error != nil || result.RowsAffected == 0 {
+		return nil, NewParamError("company_id", "company not found")
+	}
+	if currency = normalizeCurrency(currency); len(currency) != 3 {
+		return nil, NewParamError("currency", "must be ISO 4217 code")
+	}
+
+	company.Currency = currency
+	company.ModifiedDate = time.Now()
+	if err := db.Model(&company).Select("currency", "modified_date").Updates(&company).Error; err != nil {
+		return nil, err
+	}
+	return &company, nil
+}
+
+// DisplayRates rates of user's display currency within [start, end]
+func DisplayRates(db *gorm.DB, user databases.SystemUser, requested, start, end string) (*Rates, error) {
+	return LoadRates(db, DisplayCurrency(db, user, requested), start, end)
+}
+
+// ImportExchangeRates creates or updates rates by date and currency
+func ImportExchangeRates(db *gorm.DB, params form.ExchangeRateImportParams) (int, error) {
+	if params.Source == "" {
+		params.Source = "import"
+	}
+
+	now := time.Now()
+	rates := make([]databases.ExchangeRate, 0, len(params.Rates))
+	for i, item := range params.Rates {
+		field := "rates[" + strconv.Itoa(i) + "]"
+		if _, err := utils.ParseDate(item.Date); err != nil {
+			return 0, NewParamError(field+".date", "must be YYYY-MM-DD")
+		}
+		currency := normalizeCurrency(item.Currency)
+		if len(currency) != 3 || currency == BaseCurrency {
+			return 0, NewParamError(field+".currency", "must be ISO 4217 code other than USD")
+		}
+		if item.Rate <= 0 {
+			return 0, NewParamError(field+".rate", "must be positive")
+		}
+		rates = append(rates, databases.ExchangeRate{
+			Base:     databases.Base{CreatedDate: now, ModifiedDate: now},
+			Date:     item.Date,
+			Currency: currency,
+			Rate:     item.Rate,
+			Source:   params.Source,
+		})
+	}
+	if len(rates) == 0 {
+		return 0, nil
+	}
+
+	result := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "date"}, {Name: "currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "source", "modified_date"}),
+	}).CreateInBatches(&rates, 500)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return len(rates), nil
+}
+
+// ParseExchangeRatesCSV reads date,currency,rate rows, header row is optional
+func ParseExchangeRatesCSV(r io.Reader) ([]form.ExchangeRateParams, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	var rates []form.ExchangeRateParams
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, NewParamError("file", err.Error())
+		}
+		if len(record) < 3 {
+			return nil, NewParamError("file", "line "+strconv.Itoa(line)+": expected date,currency,rate")
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if err != nil {
+			if line == 1 {
+				continue // header
+			}
+			return nil, NewParamError("file", "line "+strconv.Itoa(line)+": invalid rate")
+		}
+		rates = append(rates, form.ExchangeRateParams{
+			Date:     strings.TrimSpace(record[0]),
+			Currency: strings.TrimSpace(record[1]),
+			Rate:     rate,
+		})
+	}
+	return rates, nil
+}
+
+// ConvertedCostAndUsage cost and usage in display currency, USD output is kept in original
+type ConvertedCostAndUsage struct {
+	*costexplorer.GetCostAndUsageOutput
+	Currency string                              `json:"currency"`
+	Rates    map[string]float64                  `json:"rates"` // period start => average rate of the period
+	Original *costexplorer.GetCostAndUsageOutput `json:"original,omitempty"`
+}
+
+// convertMetrics converts cost metrics, usage quantities are left as is
+func convertMetrics(metrics map[string]*costexplorer.MetricValue, rate float64, currency string) {
+	for _, value := range metrics {
+		if value == nil || aws.StringValue(value.Unit) != BaseCurrency {
+			continue
+		}
+		value.Amount = aws.String(strconv.FormatFloat(Amount(value)*rate, 'f', -1, 64))
+		value.Unit = aws.String(currency)
+	}
+}
+
+// ConvertCostAndUsage converts each period by its average rate
+func ConvertCostAndUsage(output *costexplorer.GetCostAndUsageOutput, rates *Rates) (*ConvertedCostAndUsage, error) {
+	converted := &ConvertedCostAndUsage{GetCostAndUsageOutput: output, Currency: rates.Currency, Rates: map[string]float64{}}
+	if rates.Currency == BaseCurrency {
+		return converted, nil
+	}
+
+	copied := &costexplorer.GetCostAndUsageOutput{}
+	awsutil.Copy(copied, output)
+	for _, period := range copied.ResultsByTime {
+		start := aws.StringValue(period.TimePeriod.Start)
+		rate, err := rates.PeriodRate(start, aws.StringValue(period.TimePeriod.End))
+		if err != nil {
+			return nil, err
+		}
+		converted.Rates[start] = rate
+		convertMetrics(period.Total, rate, rates.Currency)
+		for _, group := range period.Groups {
+			convertMetrics(group.Metrics, rate, rates.Currency)
+		}
+	}
+	converted.GetCostAndUsageOutput = copied
+	converted.Original = output
+	return converted, nil
+}
+
+// ConvertForecast converts each point by its period rate, future periods use
+// the latest known rate
+func ConvertForecast(result *ForecastResult, rates *Rates) (*ForecastResult, error) {
+	if rates.Currency == BaseCurrency {
+		return result, nil
+	}
+
+	converted := *result
+	converted.Unit = rates.Currency
+	converted.Original = result
+	converted.ActualTotal, converted.ForecastTotal = 0, 0
+	converted.TotalLower, converted.TotalUpper = nil, nil
+	converted.Series = make([]ForecastPoint, len(result.Series))
+	for i, point := range result.Series {
+		rate, err := rates.PeriodRate(point.Start, point.End)
+		if err != nil {
+			return nil, err
+		}
+		point.Amount *= rate
+		point.Actual *= rate
+		point.Forecast *= rate
+		if point.Lower != nil {
+			lower := *point.Lower * rate
+			point.Lower = &lower
+		}
+		if point.Upper != nil {
+			upper := *point.Upper * rate
+			point.Upper = &upper
+		}
+		converted.ActualTotal += point.Actual
+		converted.ForecastTotal += point.Forecast
+		converted.Series[i] = point
+	}
+	converted.Total = converted.ActualTotal + converted.ForecastTotal
+
+	// interval bounds of the whole range scale by the average rate of the range
+	if result.Total != 0 && result.TotalLower != nil && result.TotalUpper != nil {
+		ratio := converted.Total / result.Total
+		lower, upper := *result.TotalLower*ratio, *result.TotalUpper*ratio
+		converted.TotalLower, converted.TotalUpper = &lower, &upper
+	}
+	return &converted, nil
+}
+
+// ConvertMonthEnd converts last month amounts by last month's average rate
+// and this month's amounts by this month's average rate to date
+func ConvertMonthEnd(comparison *MonthEndComparison, rates *Rates) (*MonthEndComparison, error) {
+	if rates.Currency == BaseCurrency {
+		return comparison, nil
+	}
+
+	monthStart, err := utils.ParseDate(comparison.MonthStart)
+	if err != nil {
+		return nil, err
+	}
+	today, err := utils.ParseDate(comparison.Today)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := rates.PeriodRate(monthStart.AddDate(0, -1, 0).Format(utils.DateFormat), comparison.MonthStart)
+	if err != nil {
+		return nil, err
+	}
+	current, err := rates.PeriodRate(comparison.MonthStart, today.AddDate(0, 0, 1).Format(utils.DateFormat))
+	if err != nil {
+		return nil, err
+	}
+
+	converted := *comparison
+	converted.Unit = rates.Currency
+	converted.Original = comparison
+	converted.MonthToDate *= current
+	converted.ForecastMonthEnd *= current
+	converted.ForecastLower *= current
+	converted.ForecastUpper *= current
+	converted.PreviousPeriod *= previous
+	converted.PreviousMonth *= previous
+	converted.Delta = converted.MonthToDate - converted.PreviousPeriod
+	converted.DeltaPercent = PercentChange(converted.PreviousPeriod, converted.MonthToDate)
+	converted.ForecastDelta = converted.ForecastMonthEnd - converted.PreviousMonth
+	converted.ForecastDeltaPercent = PercentChange(converted.PreviousMonth, converted.ForecastMonthEnd)
+
+	converted.Services = make([]ServiceComparison, len(comparison.Services))
+	for i, item := range comparison.Services {
+		item.MonthToDate *= current
+		item.Projected *= current
+		item.PreviousPeriod *= previous
+		item.PreviousMonth *= previous
+		item.Delta = item.MonthToDate - item.PreviousPeriod
+		item.DeltaPercent = PercentChange(item.PreviousPeriod, item.MonthToDate)
+		item.ProjectedDelta = item.Projected - item.PreviousMonth
+		item.ProjectedDeltaPercent = PercentChange(item.PreviousMonth, item.Projected)
+		converted.Services[i] = item
+	}
+	return &converted, nil
+}
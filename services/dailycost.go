@@ -0,0 +1,225 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/notifications"
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+	gorm "gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Daily cost source
+const (
+	SourceCostExplorer = "costexplorer"
+	SourceCUR          = "cur"
+)
+
+// saveDailyCosts upserts snapshot rows
+func saveDailyCosts(db *gorm.DB, rows []databases.DailyCost) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "date"}, {Name: "service"}, {Name: "linked_account"}},
+		DoUpdates: clause.AssignmentColumns([]string{"amount", "source", "modified_date"}),
+	}).CreateInBatches(rows, 500).Error
+}
+
+// SyncDailyCosts stores daily cost per service and linked account from Cost Explorer
+func SyncDailyCosts(db *gorm.DB, svc costexploreriface.CostExplorerAPI, userID uint, start, end time.Time) (int, error) {
+	output, err := GetCostAndUsage(svc, &costexplorer.GetCostAndUsageInput{
+		Filter:      CostFilter(nil),
+		Granularity: aws.String(costexplorer.GranularityDaily),
+		Metrics:     []*string{aws.String("UnblendedCost")},
+		GroupBy: []*costexplorer.GroupDefinition{
+			{Type: aws.String(costexplorer.GroupDefinitionTypeDimension), Key: aws.String(costexplorer.DimensionService)},
+			{Type: aws.String(costexplorer.GroupDefinitionTypeDimension), Key: aws.String(costexplorer.DimensionLinkedAccount)},
+		},
+		TimePeriod: &costexplorer.DateInterval{
+			Start: aws.String(start.Format(utils.DateFormat)),
+			End:   aws.String(end.Format(utils.DateFormat)),
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	var rows []databases.DailyCost
+	for _, period := range output.ResultsByTime {
+		for _, group := range period.Groups {
+			if len(group.Keys) < 2 {
+				continue
+			}
+			rows = append(rows, databases.DailyCost{
+				UserID:        userID,
+				Date:          aws.StringValue(period.TimePeriod.Start),
+				Service:       aws.StringValue(group.Keys[0]),
+				LinkedAccount: aws.StringValue(group.Keys[1]),
+				Amount:        Amount(group.Metrics["UnblendedCost"]),
+				Source:        SourceCostExplorer,
+				ModifiedDate:  now,
+			})
+		}
+	}
+	return len(rows), saveDailyCosts(db, rows)
+}
+
+// SyncDailyCostsFromCUR stores daily cost of the user from CUR line items of
+// the company, or of the user without company
+func SyncDailyCostsFromCUR(db *gorm.DB, user databases.SystemUser, start, end time.Time) (int, error) {
+	userID := user.Base.ID
+	query := db.Model(&databases.CurLineItem{})
+	if user.CompanyID != 0 {
+		query = query.Where("company_id = ?", user.CompanyID)
+	} else {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var rows []databases.DailyCost
+	result := query.
+		Select("to_char(usage_start_date, 'YYYY-MM-DD') as date, service_name as service, usage_account_id as linked_account, sum(unblended_cost) as amount").
+		Where("usage_start_date >= ? AND usage_start_date < ?", start, end).
+		Where("line_item_type NOT IN ?", []string{credit, refund}).
+		Group("1, 2, 3").
+		Scan(&rows)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	now := time.Now()
+	for i := range rows {
+		rows[i].UserID = userID
+		rows[i].Source = SourceCUR
+		rows[i].ModifiedDate = now
+	}
+	return len(rows), saveDailyCosts(db, rows)
+}
+
+// DetectStoredAnomalies runs detector on stored daily cost per service for
+// days since from. Root cause is the linked account contributing the largest
+// part of the deviation. New anomalies are saved and notified.
+func DetectStoredAnomalies(db *gorm.DB, user databases.SystemUser, config AnomalyConfig, from time.Time, channels []string) ([]databases.CostAnomaly, error) {
+	config = config.withDefaults()
+	historyStart := from.AddDate(0, 0, -config.Window)
+
+	var costs []databases.DailyCost
+	result := db.Where("user_id = ? AND date >= ?", user.Base.ID, historyStart.Format(utils.DateFormat)).Find(&costs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	byService := map[string][]DailyAmount{}
+	byAccount := map[string]map[string][]DailyAmount{}
+	for _, cost := range costs {
+		date, err := utils.ParseDate(cost.Date)
+		if err != nil {
+			continue
+		}
+		point := DailyAmount{Date: date, Amount: cost.Amount}
+		byService[cost.Service] = append(byService[cost.Service], point)
+		if byAccount[cost.Service] == nil {
+			byAccount[cost.Service] = map[string][]DailyAmount{}
+		}
+		byAccount[cost.Service][cost.LinkedAccount] = append(byAccount[cost.Service][cost.LinkedAccount], point)
+	}
+
+	var created []databases.CostAnomaly
+	for service, series := range byService {
+		for _, point := range DetectAnomalies(series, config, from) {
+			anomaly := databases.CostAnomaly{
+				UserID:             user.Base.ID,
+				CompanyID:          user.CompanyID,
+				Date:               point.Date.Format(utils.DateFormat),
+				Service:            service,
+				Expected:           point.Expected,
+				Actual:             point.Actual,
+				Impact:             point.Impact,
+				Score:              point.Score,
+				RootCauseDimension: costexplorer.DimensionLinkedAccount,
+				Status:             databases.AnomalyOpen,
+				Base: databases.Base{
+					CreatedDate: time.Now(),
+				},
+			}
+			anomaly.RootCauseValue, anomaly.RootCauseImpact = rootCause(byAccount[service], point.Date, point.Impact)
+
+			result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&anomaly)
+			if result.Error != nil {
+				return created, result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			created = append(created, anomaly)
+
+			notifications.Send(channels, notifications.Notification{
+				Event:     EventAnomalyDetected,
+				CompanyID: anomaly.CompanyID,
+				UserID:    anomaly.UserID,
+				Subject:   fmt.Sprintf("Cost anomaly in %v", service),
+				Message: fmt.Sprintf("%v cost on %v was %.2f, expected %.2f (account %v)",
+					service, anomaly.Date, anomaly.Actual, anomaly.Expected, anomaly.RootCauseValue),
+				Data: anomaly,
+			})
+		}
+	}
+	return created, nil
+}
+
+// rootCause account whose own deviation on date is closest in direction and
+// largest in size to the service deviation
+func rootCause(accounts map[string][]DailyAmount, date time.Time, impact float64) (string, float64) {
+	best, bestImpact := "", 0.0
+	for account, series := range accounts {
+		dense := DenseSeries(series)
+		for i, day := range dense {
+			if !day.Date.Equal(date) {
+				continue
+			}
+			expected, _ := Expected(dense[:i], date.Weekday())
+			accountImpact := day.Amount - expected
+			if accountImpact*impact > 0 && math.Abs(accountImpact) > math.Abs(bestImpact) {
+				best, bestImpact = account, accountImpact
+			}
+		}
+	}
+	return best, bestImpact
+}
+
+// RunAnomalyDetection refreshes the daily cost snapshot from source and
+// detects anomalies of the last days. svc is not used for CUR source.
+func RunAnomalyDetection(db *gorm.DB, svc costexploreriface.CostExplorerAPI, user databases.SystemUser, source string, config AnomalyConfig, days int, channels []string) ([]databases.CostAnomaly, error) {
+	config = config.withDefaults()
+	if days <= 0 {
+		days = 7
+	}
+	today := utils.Today()
+	from := today.AddDate(0, 0, -days)
+	start := from.AddDate(0, 0, -config.Window)
+
+	var err error
+	switch source {
+	case SourceCostExplorer, "":
+		if svc == nil {
+			return nil, ErrNoCredentials
+		}
+		_, err = SyncDailyCosts(db, svc, user.Base.ID, start, today)
+	case SourceCUR:
+		_, err = SyncDailyCostsFromCUR(db, user, start, today)
+	default:
+		return nil, NewParamError("source", "must be costexplorer or cur")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return DetectStoredAnomalies(db, user, config, from, channels)
+}
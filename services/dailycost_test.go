@@ -0,0 +1,107 @@
+package services
+
+import (
+	"testing"
+
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+)
+
+func TestRootCause(t *testing.T) {
+	day := monday.AddDate(0, 0, 20)
+	account := func(amount, last float64) []DailyAmount {
+		return dailySeries(21, flat(amount, 21, last))
+	}
+	tests := []struct {
+		name     string
+		accounts map[string][]DailyAmount
+		impact   float64
+		account  string
+		expected float64
+	}{
+		{
+			name:     "largest increase",
+			accounts: map[string][]DailyAmount{"a": account(60, 70), "b": account(40, 140), "c": account(10, 0)},
+			impact:   100,
+			account:  "b",
+			expected: 100,
+		},
+		{
+			name:     "largest decrease",
+			accounts: map[string][]DailyAmount{"a": account(60, 70), "b": account(40, 140), "c": account(10, 0)},
+			impact:   -10,
+			account:  "c",
+			expected: -10,
+		},
+		{
+			name:     "no account moved in direction",
+			accounts: map[string][]DailyAmount{"a": account(60, 60), "b": account(40, 30)},
+			impact:   50,
+		},
+		{
+			name:     "no cost on date",
+			accounts: map[string][]DailyAmount{"a": dailySeries(10, flat(60, 10, 60))},
+			impact:   50,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			account, impact := rootCause(test.accounts, day, test.impact)
+			if account != test.account || !near(impact, test.expected) {
+				t.Fatalf("expected %q %v, got %q %v", test.account, test.expected, account, impact)
+			}
+		})
+	}
+}
+
+func TestDetectStoredAnomalies(t *testing.T) {
+	db := testDB(t, &databases.DailyCost{}, &databases.CostAnomaly{})
+	start, _ := utils.ParseDate("2021-01-04")
+	for i := 0; i < 30; i++ {
+		date := start.AddDate(0, 0, i).Format(utils.DateFormat)
+		b := 40.0
+		if i == 29 {
+			b = 140
+		}
+		db.Create(&[]databases.DailyCost{
+			{UserID: 1, Date: date, Service: "AmazonEC2", LinkedAccount: "111111111111", Amount: 60},
+			{UserID: 1, Date: date, Service: "AmazonEC2", LinkedAccount: "222222222222", Amount: b},
+			{UserID: 1, Date: date, Service: "AmazonS3", LinkedAccount: "111111111111", Amount: 5},
+		})
+	}
+
+	user := databases.SystemUser{Base: databases.Base{ID: 1}, CompanyID: 2}
+	from := start.AddDate(0, 0, 27)
+	created, err := DetectStoredAnomalies(db, user, AnomalyConfig{}, from, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 {
+		t.Fatalf("expected 1 anomaly, got %+v", created)
+	}
+	anomaly := created[0]
+	if anomaly.Service != "AmazonEC2" || anomaly.Date != "2021-02-02" || !near(anomaly.Impact, 100) ||
+		anomaly.RootCauseValue != "222222222222" || !near(anomaly.RootCauseImpact, 100) || anomaly.CompanyID != 2 {
+		t.Fatalf("unexpected anomaly %+v", anomaly)
+	}
+
+	// detecting the same days again does not create or notify duplicates
+	created, err = DetectStoredAnomalies(db, user, AnomalyConfig{}, from, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&databases.CostAnomaly{}).Count(&count)
+	if len(created) != 0 || count != 1 {
+		t.Fatalf("expected no new anomalies, got %v created, %v stored", len(created), count)
+	}
+
+	// acknowledged anomaly keeps its status
+	db.Model(&databases.CostAnomaly{}).Where("id = ?", anomaly.ID).Update("status", databases.AnomalyAcknowledged)
+	DetectStoredAnomalies(db, user, AnomalyConfig{}, from, nil)
+	var stored databases.CostAnomaly
+	db.First(&stored, anomaly.ID)
+	if stored.Status != databases.AnomalyAcknowledged {
+		t.Fatalf("anomaly was replaced %+v", stored)
+	}
+}
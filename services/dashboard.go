@@ -0,0 +1,192 @@
+package services
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	gorm "gorm.io/gorm"
+)
+
+// DashboardCharts widget chart types
+var DashboardCharts = []string{"line", "bar", "stacked_bar", "pie", "table"}
+
+// WidgetResult cost of one dashboard widget, error of one widget does not
+// fail the whole dashboard
+type WidgetResult struct {
+	WidgetID     uint                   `json:"widget_id"`
+	SavedQueryID uint                   `json:"saved_query_id"`
+	Title        string                 `json:"title"`
+	Chart        string                 `json:"chart"`
+	Position     int                    `json:"position"`
+	Width        int                    `json:"width"`
+	StartDate    string                 `json:"start_date"`
+	EndDate      string                 `json:"end_date"`
+	Result       *ConvertedCostAndUsage `json:"result"`
+	Error        string                 `json:"error"`
+}
+
+// VisibleRows own rows and rows shared with the user's company
+func VisibleRows(db *gorm.DB, user databases.SystemUser) *gorm.DB {
+	if user.CompanyID != 0 {
+		return db.Where("user_id = ? OR (company_id = ? AND is_shared = ?)", user.Base.ID, user.CompanyID, true)
+	}
+	return db.Where("user_id = ?", user.Base.ID)
+}
+
+// SavedQueryFromParams ...
+func SavedQueryFromParams(query *databases.SavedQuery, params form.SavedQueryParams) error {
+	if params.DateRange == "" {
+		params.DateRange = params.Params.DateRange
+	}
+	params.Params.DateRange = ""
+	if params.DateRange != "" {
+		params.Params.StartDate, params.Params.EndDate = "", ""
+	}
+	data, err := json.Marshal(params.Params)
+	if err != nil {
+		return err
+	}
+	query.Name = params.Name
+	query.Description = params.Description
+	query.Params = string(data)
+	query.DateRange = params.DateRange
+	query.IsShared = params.IsShared
+	return nil
+}
+
+// ValidateSavedQuery ...
+func ValidateSavedQuery(query databases.SavedQuery) error {
+	_, err := SavedQueryParams(query)
+	return err
+}
+
+// SavedQueryParams cost params of the saved query with relative dates
+// resolved as of today
+func SavedQueryParams(query databases.SavedQuery) (form.CostExplorerParams, error) {
+	var params form.CostExplorerParams
+	if err := json.Unmarshal([]byte(query.Params), &params); err != nil {
+		return params, NewParamError("params", err.Error())
+	}
+	if params.Granularity == "" {
+		params.Granularity = costexplorer.GranularityDaily
+	}
+	params.DateRange = query.DateRange
+	return params, ResolveCostParams(&params)
+}
+
+// RunCostQuery cost and usage of the params in display currency
+func RunCostQuery(db *gorm.DB, svc costexploreriface.CostExplorerAPI, user databases.SystemUser, params form.CostExplorerParams) (*ConvertedCostAndUsage, error) {
+	cost, err := GetCostAndUsage(svc, CostAndUsageInput(params))
+	if err != nil {
+		return nil, err
+	}
+	rates, err := DisplayRates(db, user, params.Currency, params.StartDate, params.EndDate)
+	if err != nil {
+		return nil, err
+	}
+	return ConvertCostAndUsage(cost, rates)
+}
+
+// RunSavedQuery runs saved query with the credentials of its owner, amounts
+// are in the display currency of the viewer
+func RunSavedQuery(db *gorm.DB, query databases.SavedQuery, viewer databases.SystemUser) (form.CostExplorerParams, *ConvertedCostAndUsage, error) {
+	params, err := SavedQueryParams(query)
+	if err != nil {
+		return params, nil, err
+	}
+	sess, err := Session(db, query.UserID)
+	if err != nil {
+		return params, nil, err
+	}
+	result, err := RunCostQuery(db, costexplorer.New(sess), viewer, params)
+	return params, result, err
+}
+
+// DashboardFromParams replaces widgets, saved queries must be visible to the
+// user and shared when the dashboard is shared
+func DashboardFromParams(db *gorm.DB, user databases.SystemUser, dashboard *databases.Dashboard, params form.DashboardParams) error {
+	dashboard.Name = params.Name
+	dashboard.Description = params.Description
+	dashboard.IsShared = params.IsShared
+
+	dashboard.Widgets = nil
+	for i, item := range params.Widgets {
+		field := "widgets[" + strconv.Itoa(i) + "]"
+
+		var query databases.SavedQuery
+		if result := VisibleRows(db, user).Limit(1).Find(&query, item.SavedQueryID); result.Error != nil || result.RowsAffected == 0 {
+			return NewParamError(field+".saved_query_id", "saved query not found")
+		}
+		if dashboard.IsShared && !query.IsShared {
+			return NewParamError(field+".saved_query_id", "must be shared query on shared dashboard")
+		}
+
+		if item.Chart == "" {
+			item.Chart = "bar"
+		}
+		if err := oneOf(field+".chart", item.Chart, DashboardCharts); err != nil {
+			return err
+		}
+		if item.Width == 0 {
+			item.Width = 6
+		}
+		if item.Width < 1 || item.Width > 12 {
+			return NewParamError(field+".width", "must be between 1 and 12")
+		}
+
+		dashboard.Widgets = append(dashboard.Widgets, databases.DashboardWidget{
+			Base:         databases.Base{CreatedDate: time.Now()},
+			SavedQueryID: item.SavedQueryID,
+			Title:        item.Title,
+			Chart:        item.Chart,
+			Position:     item.Position,
+			Width:        item.Width,
+		})
+	}
+	return nil
+}
+
+// RunDashboard runs saved query of every widget in position order
+func RunDashboard(db *gorm.DB, dashboard databases.Dashboard, viewer databases.SystemUser) []WidgetResult {
+	widgets := append([]databases.DashboardWidget{}, dashboard.Widgets...)
+	sort.SliceStable(widgets, func(i, j int) bool {
+		return widgets[i].Position < widgets[j].Position
+	})
+
+	results := make([]WidgetResult, 0, len(widgets))
+	for _, widget := range widgets {
+		item := WidgetResult{
+			WidgetID:     widget.ID,
+			SavedQueryID: widget.SavedQueryID,
+			Title:        widget.Title,
+			Chart:        widget.Chart,
+			Position:     widget.Position,
+			Width:        widget.Width,
+		}
+		// a query unshared or deleted after the dashboard was saved is not run
+		var query databases.SavedQuery
+		if result := VisibleRows(db, viewer).Limit(1).Find(&query, widget.SavedQueryID); result.Error != nil || result.RowsAffected == 0 {
+			item.Error = "saved query not found"
+			results = append(results, item)
+			continue
+		}
+		if item.Title == "" {
+			item.Title = query.Name
+		}
+
+		params, result, err := RunSavedQuery(db, query, viewer)
+		item.StartDate, item.EndDate = params.StartDate, params.EndDate
+		item.Result = result
+		if err != nil {
+			item.Error = err.Error()
+		}
+		results = append(results, item)
+	}
+	return results
+}
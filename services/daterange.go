@@ -0,0 +1,205 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	viper "github.com/spf13/viper"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+)
+
+// Relative date ranges, last_N_days and last_N_months accept any N
+const (
+	RangeToday            = "today"
+	RangeYesterday        = "yesterday"
+	RangeMonthToDate      = "mtd"
+	RangeQuarterToDate    = "qtd"
+	RangeYearToDate       = "ytd"
+	RangePreviousMonth    = "previous_month"
+	RangeTrailing12Months = "trailing_12_months"
+	RangeLastDays         = "last_N_days"
+	RangeLastMonths       = "last_N_months"
+)
+
+// DateRanges supported relative date ranges
+var DateRanges = []string{
+	RangeToday, RangeYesterday, RangeMonthToDate, RangeQuarterToDate, RangeYearToDate,
+	RangePreviousMonth, RangeTrailing12Months, RangeLastDays, RangeLastMonths,
+}
+
+// rangeAliases long names of ranges
+var rangeAliases = map[string]string{
+	"month_to_date":   RangeMonthToDate,
+	"quarter_to_date": RangeQuarterToDate,
+	"year_to_date":    RangeYearToDate,
+	"last_month":      RangePreviousMonth,
+}
+
+var lastRange = regexp.MustCompile(`^last_(\d+)_(day|days|month|months)$`)
+
+// Cost Explorer granularity and metrics
+var (
+	granularities = []string{costexplorer.GranularityDaily, costexplorer.GranularityMonthly, costexplorer.GranularityHourly}
+	usageMetrics  = []string{"AmortizedCost", "BlendedCost", "NetAmortizedCost", "NetUnblendedCost", "NormalizedUsageAmount", "UnblendedCost", "UsageQuantity"}
+	groupTypes    = []string{costexplorer.GroupDefinitionTypeDimension, costexplorer.GroupDefinitionTypeTag, costexplorer.GroupDefinitionTypeCostCategory}
+)
+
+// hourlyLookbackDays Cost Explorer keeps hourly data for 14 days
+const hourlyLookbackDays = 14
+
+// normalizeRange lower case name with spaces and dashes as underscores, so
+// "Last 30 days" and "MTD" are accepted
+func normalizeRange(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+	if alias, ok := rangeAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// ResolveDateRange start and exclusive end date of relative range as of
+// today. Last N days end yesterday since today's cost is incomplete, last N
+// months include the current month, trailing 12 months are the complete
+// months before the current one.
+func ResolveDateRange(name string, today time.Time) (string, string, error) {
+	monthStart := utils.MonthStart(today)
+	tomorrow := today.AddDate(0, 0, 1)
+	start, end := today, tomorrow
+
+	switch name = normalizeRange(name); name {
+	case RangeToday:
+	case RangeYesterday:
+		start, end = today.AddDate(0, 0, -1), today
+	case RangeMonthToDate:
+		start = monthStart
+	case RangeQuarterToDate:
+		start = monthStart.AddDate(0, -(int(today.Month())-1)%3, 0)
+	case RangeYearToDate:
+		start = time.Date(today.Year(), 1, 1, 0, 0, 0, 0, today.Location())
+	case RangePreviousMonth:
+		start, end = monthStart.AddDate(0, -1, 0), monthStart
+	case RangeTrailing12Months:
+		start, end = monthStart.AddDate(0, -12, 0), monthStart
+	default:
+		match := lastRange.FindStringSubmatch(name)
+		if match == nil {
+			return "", "", oneOf("date_range", name, DateRanges)
+		}
+		n, err := strconv.Atoi(match[1])
+		if err != nil || n < 1 {
+			return "", "", NewParamError("date_range", "N must be positive")
+		}
+		if strings.HasPrefix(match[2], "day") {
+			start, end = today.AddDate(0, 0, -n), today
+		} else {
+			start = monthStart.AddDate(0, -(n - 1), 0)
+		}
+	}
+	return start.Format(utils.DateFormat), end.Format(utils.DateFormat), nil
+}
+
+// ResolveDate YYYY-MM-DD, today, yesterday or tomorrow
+func ResolveDate(value string, today time.Time) (time.Time, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	}
+	return utils.ParseDate(strings.TrimSpace(value))
+}
+
+// LookbackMonths months of Cost Explorer history, 12 by default and 38 when
+// multi-year data is enabled for the account (cost_explorer.lookback_months)
+func LookbackMonths() int {
+	months := viper.GetInt("cost_explorer.lookback_months")
+	if months <= 0 {
+		return 12
+	}
+	if months > 38 {
+		return 38
+	}
+	return months
+}
+
+// ResolveCostParams resolves date_range or relative dates of the params into
+// YYYY-MM-DD in the configured timezone and validates them against Cost
+// Explorer limits. All invalid fields are reported together.
+func ResolveCostParams(params *form.CostExplorerParams) error {
+	today := utils.Today()
+	errs := &ValidationError{}
+
+	var start, end time.Time
+	if params.DateRange != "" {
+		from, to, err := ResolveDateRange(params.DateRange, today)
+		if err != nil {
+			errs.Add("date_range", err.(*ParamError).Message)
+		} else {
+			params.StartDate, params.EndDate = from, to
+			start, _ = utils.ParseDate(from)
+			end, _ = utils.ParseDate(to)
+		}
+	} else {
+		var err error
+		if params.StartDate == "" {
+			errs.Add("start_date", "is required unless date_range is set")
+		} else if start, err = ResolveDate(params.StartDate, today); err != nil {
+			errs.Add("start_date", "must be YYYY-MM-DD, today or yesterday")
+		} else {
+			params.StartDate = start.Format(utils.DateFormat)
+		}
+		if params.EndDate == "" {
+			errs.Add("end_date", "is required unless date_range is set")
+		} else if end, err = ResolveDate(params.EndDate, today); err != nil {
+			errs.Add("end_date", "must be YYYY-MM-DD, today or tomorrow")
+		} else {
+			params.EndDate = end.Format(utils.DateFormat)
+		}
+	}
+
+	if !errs.Has("start_date") && !errs.Has("end_date") && !errs.Has("date_range") {
+		if !end.After(start) {
+			errs.Add("end_date", "is exclusive, must be after start_date")
+		}
+		oldest := utils.MonthStart(today).AddDate(0, -LookbackMonths(), 0)
+		if params.Granularity == costexplorer.GranularityHourly {
+			oldest = today.AddDate(0, 0, -hourlyLookbackDays)
+		}
+		if start.Before(oldest) {
+			errs.Add("start_date", "must be on or after "+oldest.Format(utils.DateFormat)+", older cost is not available")
+		}
+	}
+
+	if params.Granularity == "" {
+		errs.Add("granularity", "is required")
+	} else if err := oneOf("granularity", params.Granularity, granularities); err != nil {
+		errs.Add("granularity", err.(*ParamError).Message)
+	}
+
+	if len(params.Metric) == 0 {
+		errs.Add("metric", "is required")
+	}
+	for _, metric := range params.Metric {
+		if metric == nil || oneOf("metric", *metric, usageMetrics) != nil {
+			errs.Add("metric", "must be "+strings.Join(usageMetrics, ", "))
+		}
+	}
+
+	if params.GroupType != "" {
+		if err := oneOf("group_type", params.GroupType, groupTypes); err != nil {
+			errs.Add("group_type", err.(*ParamError).Message)
+		}
+		if params.GroupName == "" {
+			errs.Add("group_name", "is required with group_type")
+		}
+	}
+
+	return errs.Err()
+}
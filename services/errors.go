@@ -0,0 +1,59 @@
+package services
+
+import "strings"
+
+// ParamError invalid request parameter
+type ParamError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *ParamError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// NewParamError ...
+func NewParamError(field, message string) *ParamError {
+	return &ParamError{Field: field, Message: message}
+}
+
+// ValidationError invalid request parameters, one error per field
+type ValidationError struct {
+	Errors []*ParamError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Add error of the field, only the first error of a field is kept
+func (e *ValidationError) Add(field, message string) {
+	for _, err := range e.Errors {
+		if err.Field == field {
+			return
+		}
+	}
+	e.Errors = append(e.Errors, NewParamError(field, message))
+}
+
+// Has field has error
+func (e *ValidationError) Has(field string) bool {
+	for _, err := range e.Errors {
+		if err.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Err nil when there is no error
+func (e *ValidationError) Err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+)
+
+// CostExport streams cost and usage pages as a flat table of period, group
+// keys, metric, amount and unit, one page in memory at a time
+type CostExport struct {
+	svc   costexploreriface.CostExplorerAPI
+	input *costexplorer.GetCostAndUsageInput
+	rates *Rates
+	page  *costexplorer.GetCostAndUsageOutput
+}
+
+// NewCostExport fetches the first page, so request errors are returned
+// before anything is written to the client
+func NewCostExport(svc costexploreriface.CostExplorerAPI, input *costexplorer.GetCostAndUsageInput, rates *Rates) (*CostExport, error) {
+	if rates != nil && rates.Currency != BaseCurrency {
+		if _, err := rates.Rate(aws.StringValue(input.TimePeriod.Start)); err != nil {
+			return nil, err
+		}
+	}
+
+	input.NextPageToken = nil
+	page, err := svc.GetCostAndUsage(input)
+	if err != nil {
+		return nil, err
+	}
+	return &CostExport{svc: svc, input: input, rates: rates, page: page}, nil
+}
+
+// converted display currency differs from USD
+func (e *CostExport) converted() bool {
+	return e.rates != nil && e.rates.Currency != BaseCurrency
+}
+
+// Header column names
+func (e *CostExport) Header() []interface{} {
+	header := []interface{}{"period_start", "period_end"}
+	for _, group := range e.input.GroupBy {
+		header = append(header, strings.ToLower(aws.StringValue(group.Key)))
+	}
+	header = append(header, "metric", "amount", "unit")
+	if e.converted() {
+		header = append(header, "usd_amount")
+	}
+	return header
+}
+
+// groupValues group keys without the "key$" prefix of tags and cost categories
+func (e *CostExport) groupValues(keys []*string) []interface{} {
+	values := make([]interface{}, len(e.input.GroupBy))
+	for i, group := range e.input.GroupBy {
+		if i >= len(keys) {
+			break
+		}
+		value := aws.StringValue(keys[i])
+		if aws.StringValue(group.Type) != costexplorer.GroupDefinitionTypeDimension {
+			value = strings.TrimPrefix(value, aws.StringValue(group.Key)+"$")
+		}
+		values[i] = value
+	}
+	return values
+}
+
+// metricRows one row per metric, sorted by metric name
+func (e *CostExport) metricRows(prefix []interface{}, metrics map[string]*costexplorer.MetricValue, rate float64) [][]interface{} {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rows := make([][]interface{}, 0, len(names))
+	for _, name := range names {
+		value := metrics[name]
+		amount := Amount(value)
+		unit := aws.StringValue(value.Unit)
+		row := append(append([]interface{}{}, prefix...), name)
+		if e.converted() && unit == BaseCurrency {
+			row = append(row, amount*rate, e.rates.Currency, amount)
+		} else if e.converted() {
+			row = append(row, amount, unit, "")
+		} else {
+			row = append(row, amount, unit)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Write writes header and every page, flushing after each page
+func (e *CostExport) Write(table TableWriter) error {
+	if err := table.WriteRow(e.Header()); err != nil {
+		return err
+	}
+
+	for {
+		for _, period := range e.page.ResultsByTime {
+			start := aws.StringValue(period.TimePeriod.Start)
+			end := aws.StringValue(period.TimePeriod.End)
+			rate := 1.0
+			if e.converted() {
+				var err error
+				if rate, err = e.rates.PeriodRate(start, end); err != nil {
+					return err
+				}
+			}
+
+			var rows [][]interface{}
+			if len(e.input.GroupBy) == 0 {
+				rows = e.metricRows([]interface{}{start, end}, period.Total, rate)
+			}
+			for _, group := range period.Groups {
+				prefix := append([]interface{}{start, end}, e.groupValues(group.Keys)...)
+				rows = append(rows, e.metricRows(prefix, group.Metrics, rate)...)
+			}
+			for _, row := range rows {
+				if err := table.WriteRow(row); err != nil {
+					return err
+				}
+			}
+		}
+		if err := table.Flush(); err != nil {
+			return err
+		}
+
+		if e.page.NextPageToken == nil {
+			break
+		}
+		e.input.NextPageToken = e.page.NextPageToken
+		page, err := e.svc.GetCostAndUsage(e.input)
+		if err != nil {
+			return err
+		}
+		e.page = page
+	}
+	e.input.NextPageToken = nil
+	return table.Close()
+}
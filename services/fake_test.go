@@ -0,0 +1,28 @@
+package services
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+)
+
+// fakeCostExplorer Cost Explorer answering from functions of the test, other
+// calls panic
+type fakeCostExplorer struct {
+	costexploreriface.CostExplorerAPI
+	usage    func(input *costexplorer.GetCostAndUsageInput) (*costexplorer.GetCostAndUsageOutput, error)
+	forecast func(input *costexplorer.GetCostForecastInput) (*costexplorer.GetCostForecastOutput, error)
+}
+
+func (svc *fakeCostExplorer) GetCostAndUsage(input *costexplorer.GetCostAndUsageInput) (*costexplorer.GetCostAndUsageOutput, error) {
+	return svc.usage(input)
+}
+
+func (svc *fakeCostExplorer) GetCostForecast(input *costexplorer.GetCostForecastInput) (*costexplorer.GetCostForecastOutput, error) {
+	return svc.forecast(input)
+}
+
+// metricValue USD amount
+func metricValue(amount string) *costexplorer.MetricValue {
+	return &costexplorer.MetricValue{Amount: aws.String(amount), Unit: aws.String("USD")}
+}
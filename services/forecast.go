@@ -0,0 +1,193 @@
+package services
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+)
+
+// DefaultPredictionIntervalLevel used when request has no level
+const DefaultPredictionIntervalLevel = 80
+
+type (
+	// ForecastPoint one period of actual and forecast series
+	ForecastPoint struct {
+		Start      string   `json:"start"`
+		End        string   `json:"end"`
+		Amount     float64  `json:"amount"`      // actual + forecast
+		Actual     float64  `json:"actual"`      //
+		Forecast   float64  `json:"forecast"`    //
+		Lower      *float64 `json:"lower"`       // prediction interval lower bound
+		Upper      *float64 `json:"upper"`       // prediction interval upper bound
+		IsForecast bool     `json:"is_forecast"` //
+	}
+
+	// ForecastResult actuals to date and forecast to end of period
+	ForecastResult struct {
+		Metric                  string          `json:"metric"`
+		Unit                    string          `json:"unit"`
+		StartDate               string          `json:"start_date"`
+		ForecastStartDate       string          `json:"forecast_start_date"`
+		EndDate                 string          `json:"end_date"`
+		PredictionIntervalLevel int64           `json:"prediction_interval_level"`
+		ActualTotal             float64         `json:"actual_total"`
+		ForecastTotal           float64         `json:"forecast_total"`
+		Total                   float64         `json:"total"`
+		TotalLower              *float64        `json:"total_lower"` // total interval, null when forecast has several periods
+		TotalUpper              *float64        `json:"total_upper"` //
+		Series                  []ForecastPoint `json:"series"`
+		Original                *ForecastResult `json:"original,omitempty"` // USD, өөр валютаар харуулсан үед
+	}
+)
+
+// Forecast combines actual cost from start date until today with the
+// forecast from today until end date. Start date is clamped to today for the
+// forecast since Cost Explorer does not forecast the past.
+func Forecast(svc costexploreriface.CostExplorerAPI, params form.CostExplorerForcastParams) (*ForecastResult, error) {
+	today := utils.Today()
+
+	end, err := utils.ParseDate(params.EndDate)
+	if err != nil {
+		return nil, NewParamError("end_date", "invalid date "+params.EndDate)
+	}
+
+	start := today
+	if params.StartDate != "" {
+		if start, err = utils.ParseDate(params.StartDate); err != nil {
+			return nil, NewParamError("start_date", "invalid date "+params.StartDate)
+		}
+	}
+	if !start.Before(end) {
+		return nil, NewParamError("start_date", "must be before end_date")
+	}
+
+	forecastStart := start
+	if forecastStart.Before(today) {
+		forecastStart = today
+	}
+
+	level := params.PredictionIntervalLevel
+	if level == 0 {
+		level = DefaultPredictionIntervalLevel
+	}
+	if level < 51 || level > 99 {
+		return nil, NewParamError("prediction_interval_level", "must be between 51 and 99")
+	}
+
+	result := &ForecastResult{
+		Metric:                  ForecastMetric(params.Metric),
+		StartDate:               start.Format(utils.DateFormat),
+		ForecastStartDate:       forecastStart.Format(utils.DateFormat),
+		EndDate:                 end.Format(utils.DateFormat),
+		PredictionIntervalLevel: level,
+	}
+
+	filter := WithCostCategory(CostFilter(map[string][]*string{
+		costexplorer.DimensionService:       params.Services,
+		costexplorer.DimensionLinkedAccount: params.LinkedAccounts,
+	}), params.CostCategory)
+
+	if start.Before(forecastStart) {
+		metric := UsageMetric(result.Metric)
+		actual, err := GetCostAndUsage(svc, &costexplorer.GetCostAndUsageInput{
+			Filter:      filter,
+			Granularity: aws.String(params.Granularity),
+			Metrics:     []*string{aws.String(metric)},
+			TimePeriod: &costexplorer.DateInterval{
+				Start: aws.String(result.StartDate),
+				End:   aws.String(result.ForecastStartDate),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, period := range actual.ResultsByTime {
+			value := period.Total[metric]
+			if value != nil && result.Unit == "" {
+				result.Unit = aws.StringValue(value.Unit)
+			}
+			amount := Amount(value)
+			result.ActualTotal += amount
+			result.Series = append(result.Series, ForecastPoint{
+				Start:  aws.StringValue(period.TimePeriod.Start),
+				End:    aws.StringValue(period.TimePeriod.End),
+				Amount: amount,
+				Actual: amount,
+			})
+		}
+	}
+
+	if !forecastStart.Before(end) {
+		// no forecast, total is known
+		lower, upper := result.ActualTotal, result.ActualTotal
+		result.TotalLower, result.TotalUpper = &lower, &upper
+	} else {
+		forecast, err := svc.GetCostForecast(&costexplorer.GetCostForecastInput{
+			Filter:                  filter,
+			Granularity:             aws.String(params.Granularity),
+			Metric:                  aws.String(result.Metric),
+			PredictionIntervalLevel: aws.Int64(level),
+			TimePeriod: &costexplorer.DateInterval{
+				Start: aws.String(result.ForecastStartDate),
+				End:   aws.String(result.EndDate),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if forecast.Total != nil {
+			result.Unit = aws.StringValue(forecast.Total.Unit)
+			result.ForecastTotal = Amount(forecast.Total)
+		}
+
+		for _, period := range forecast.ForecastResultsByTime {
+			lower := ParseAmount(period.PredictionIntervalLowerBound)
+			upper := ParseAmount(period.PredictionIntervalUpperBound)
+			result.addForecast(params.Granularity == costexplorer.GranularityMonthly, ForecastPoint{
+				Start:      aws.StringValue(period.TimePeriod.Start),
+				End:        aws.StringValue(period.TimePeriod.End),
+				Forecast:   ParseAmount(period.MeanValue),
+				Lower:      &lower,
+				Upper:      &upper,
+				IsForecast: true,
+			})
+		}
+
+		// Cost Explorer gives intervals per period only, bounds of several
+		// periods can not be summed into an interval of the total
+		if len(forecast.ForecastResultsByTime) == 1 {
+			period := forecast.ForecastResultsByTime[0]
+			lower := result.ActualTotal + ParseAmount(period.PredictionIntervalLowerBound)
+			upper := result.ActualTotal + ParseAmount(period.PredictionIntervalUpperBound)
+			result.TotalLower, result.TotalUpper = &lower, &upper
+		}
+	}
+
+	result.Total = result.ActualTotal + result.ForecastTotal
+	return result, nil
+}
+
+// addForecast appends forecast point. With monthly granularity the current
+// month is split between actual and forecast, both parts are merged into one
+// point so the chart stays continuous.
+func (r *ForecastResult) addForecast(monthly bool, point ForecastPoint) {
+	n := len(r.Series)
+	if monthly && n > 0 && !r.Series[n-1].IsForecast && r.Series[n-1].Start[:7] == point.Start[:7] {
+		last := r.Series[n-1]
+		lower := last.Actual + *point.Lower
+		upper := last.Actual + *point.Upper
+		point.Start = last.Start
+		point.Actual = last.Actual
+		point.Lower = &lower
+		point.Upper = &upper
+		r.Series[n-1] = point
+		r.Series[n-1].Amount = point.Actual + point.Forecast
+		return
+	}
+	point.Amount = point.Forecast
+	r.Series = append(r.Series, point)
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+)
+
+// eachDay start and end of every day in the interval
+func eachDay(interval *costexplorer.DateInterval, each func(start, end string)) {
+	start, _ := utils.ParseDate(aws.StringValue(interval.Start))
+	end, _ := utils.ParseDate(aws.StringValue(interval.End))
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		each(day.Format(utils.DateFormat), day.AddDate(0, 0, 1).Format(utils.DateFormat))
+	}
+}
+
+// forecastSvc daily actual of 10 and forecast of 20 with interval 15-30
+func forecastSvc() *fakeCostExplorer {
+	return &fakeCostExplorer{
+		usage: func(input *costexplorer.GetCostAndUsageInput) (*costexplorer.GetCostAndUsageOutput, error) {
+			output := &costexplorer.GetCostAndUsageOutput{}
+			eachDay(input.TimePeriod, func(start, end string) {
+				output.ResultsByTime = append(output.ResultsByTime, &costexplorer.ResultByTime{
+					TimePeriod: &costexplorer.DateInterval{Start: aws.String(start), End: aws.String(end)},
+					Total:      map[string]*costexplorer.MetricValue{aws.StringValue(input.Metrics[0]): metricValue("10")},
+				})
+			})
+			return output, nil
+		},
+		forecast: func(input *costexplorer.GetCostForecastInput) (*costexplorer.GetCostForecastOutput, error) {
+			output := &costexplorer.GetCostForecastOutput{}
+			eachDay(input.TimePeriod, func(start, end string) {
+				output.ForecastResultsByTime = append(output.ForecastResultsByTime, &costexplorer.ForecastResult{
+					TimePeriod:                   &costexplorer.DateInterval{Start: aws.String(start), End: aws.String(end)},
+					MeanValue:                    aws.String("20"),
+					PredictionIntervalLowerBound: aws.String("15"),
+					PredictionIntervalUpperBound: aws.String("30"),
+				})
+			})
+			output.Total = metricValue(strconv.Itoa(20 * len(output.ForecastResultsByTime)))
+			return output, nil
+		},
+	}
+}
+
+func TestForecastTotalInterval(t *testing.T) {
+	today := utils.Today()
+	date := func(days int) string {
+		return today.AddDate(0, 0, days).Format(utils.DateFormat)
+	}
+	value := func(amount *float64) interface{} {
+		if amount == nil {
+			return nil
+		}
+		return *amount
+	}
+	tests := []struct {
+		name         string
+		start, end   string
+		total        float64
+		lower, upper interface{}
+	}{
+		// interval of the only period is the interval of the total
+		{"one period", date(0), date(1), 20, 15.0, 30.0},
+		{"actual and one period", date(-3), date(1), 50, 45.0, 60.0},
+		// sums of period bounds are not an interval of the total
+		{"several periods", date(-3), date(3), 90, nil, nil},
+		// range ending today has no forecast, total is known
+		{"actual only", date(-3), date(0), 30, 30.0, 30.0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := Forecast(forecastSvc(), form.CostExplorerForcastParams{
+				StartDate:   test.start,
+				EndDate:     test.end,
+				Granularity: costexplorer.GranularityDaily,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Total != test.total || value(result.TotalLower) != test.lower || value(result.TotalUpper) != test.upper {
+				t.Fatalf("expected %v [%v, %v], got %v [%v, %v]", test.total, test.lower, test.upper,
+					result.Total, value(result.TotalLower), value(result.TotalUpper))
+			}
+		})
+	}
+}
@@ -0,0 +1,474 @@
+package services
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	viper "github.com/spf13/viper"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+	gorm "gorm.io/gorm"
+)
+
+// Invoice source
+const (
+	InvoiceSourceCur          = "cur"
+	InvoiceSourceCostExplorer = "costexplorer"
+)
+
+var tax = "Tax"
+
+// InvoiceCost AWS cost of one service and record type (Usage, Credit, Refund, Tax ...)
+type InvoiceCost struct {
+	Service    string  `json:"service"`
+	RecordType string  `json:"record_type"`
+	Cost       float64 `json:"cost"`
+}
+
+// IsReseller user belongs to the reseller company (reseller.company_id),
+// manages pricing and invoices of all companies
+func IsReseller(user databases.SystemUser) bool {
+	companyID := viper.GetUint("reseller.company_id")
+	return companyID != 0 && user.CompanyID == companyID
+}
+
+// round2 round to cents
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// GetPricingRule pricing rule of the company with overrides and fees
+func GetPricingRule(db *gorm.DB, companyID uint) (*databases.PricingRule, error) {
+	var rule databases.PricingRule
+	result := db.Preload("Overrides").Preload("Fees").Where("company_id = ?", companyID).Limit(1).Find(&rule)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, NewParamError("company_id", "company has no pricing rule")
+	}
+	return &rule, nil
+}
+
+// SavePricingRule creates or replaces pricing rule of the company
+func SavePricingRule(db *gorm.DB, companyID uint, params form.PricingRuleParams) (*databases.PricingRule, error) {
+	var company databases.Company
+	if result := db.Limit(1).Find(&company, companyID); result.Error != nil || result.RowsAffected == 0 {
+		return nil, NewParamError("company_id", "company not found")
+	}
+
+	accounts, err := joinValues("accounts", params.Accounts)
+	if err != nil {
+		return nil, err
+	}
+	if params.DiscountPercent < 0 || params.DiscountPercent > 100 {
+		return nil, NewParamError("discount_percent", "must be between 0 and 100")
+	}
+	if params.TaxPercent < 0 {
+		return nil, NewParamError("tax_percent", "must not be negative")
+	}
+	if params.MarkupPercent <= -100 {
+		return nil, NewParamError("markup_percent", "must be greater than -100")
+	}
+	if params.Currency == "" {
+		params.Currency = "USD"
+	}
+	if params.PaymentTermDays <= 0 {
+		params.PaymentTermDays = viper.GetInt("invoice.payment_term_days")
+	}
+
+	now := time.Now()
+	rule := databases.PricingRule{
+		CompanyID:          companyID,
+		Accounts:           accounts,
+		MarkupPercent:      params.MarkupPercent,
+		DiscountPercent:    params.DiscountPercent,
+		TaxPercent:         params.TaxPercent,
+		CreditsPassthrough: params.CreditsPassthrough,
+		Currency:           strings.ToUpper(params.Currency),
+		PaymentTermDays:    params.PaymentTermDays,
+		Note:               params.Note,
+	}
+	seen := map[string]bool{}
+	for i, override := range params.Overrides {
+		if seen[override.Service] {
+			return nil, NewParamError(fmt.Sprintf("overrides[%v].service", i), "duplicated service")
+		}
+		if override.MarkupPercent <= -100 {
+			return nil, NewParamError(fmt.Sprintf("overrides[%v].markup_percent", i), "must be greater than -100")
+		}
+		seen[override.Service] = true
+		rule.Overrides = append(rule.Overrides, databases.PricingOverride{
+			Base:          databases.Base{CreatedDate: now, ModifiedDate: now},
+			Service:       override.Service,
+			MarkupPercent: override.MarkupPercent,
+		})
+	}
+	for _, fee := range params.Fees {
+		rule.Fees = append(rule.Fees, databases.PricingFee{
+			Base:   databases.Base{CreatedDate: now, ModifiedDate: now},
+			Name:   fee.Name,
+			Amount: fee.Amount,
+		})
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var existing databases.PricingRule
+		result := tx.Where("company_id = ?", companyID).Limit(1).Find(&existing)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			rule.Base = databases.Base{CreatedDate: now, ModifiedDate: now}
+			return tx.Create(&rule).Error
+		}
+
+		if err := tx.Where("pricing_rule_id = ?", existing.Base.ID).Delete(&databases.PricingOverride{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("pricing_rule_id = ?", existing.Base.ID).Delete(&databases.PricingFee{}).Error; err != nil {
+			return err
+		}
+		rule.Base = databases.Base{ID: existing.Base.ID, CreatedDate: existing.CreatedDate, ModifiedDate: now}
+		return tx.Save(&rule).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// CurInvoiceCosts cost of the accounts in the month from CUR line items of the company, or of the user without company
+func CurInvoiceCosts(db *gorm.DB, user databases.SystemUser, month string, accounts []string) ([]InvoiceCost, error) {
+	query := db.Model(&databases.CurLineItem{})
+	if user.CompanyID != 0 {
+		query = query.Where("company_id = ?", user.CompanyID)
+	} else {
+		query = query.Where("user_id = ?", user.Base.ID)
+	}
+
+	var costs []InvoiceCost
+	result := query.Where("billing_period = ? AND usage_account_id IN (?)", month, accounts).
+		Select("service_name as service, line_item_type as record_type, sum(unblended_cost) as cost").
+		Group("service_name, line_item_type").
+		Scan(&costs)
+	return costs, result.Error
+}
+
+// CostExplorerInvoiceCosts cost of the accounts in the month per service and record type
+func CostExplorerInvoiceCosts(svc costexploreriface.CostExplorerAPI, month string, accounts []string) ([]InvoiceCost, error) {
+	start, end, err := parseMonth("month", month)
+	if err != nil {
+		return nil, err
+	}
+
+	metric := "UnblendedCost"
+	output, err := GetCostAndUsage(svc, &costexplorer.GetCostAndUsageInput{
+		Granularity: aws.String(costexplorer.GranularityMonthly),
+		Metrics:     []*string{aws.String(metric)},
+		Filter: &costexplorer.Expression{
+			Dimensions: &costexplorer.DimensionValues{
+				Key:    aws.String(costexplorer.DimensionLinkedAccount),
+				Values: aws.StringSlice(accounts),
+			},
+		},
+		GroupBy: []*costexplorer.GroupDefinition{
+			GroupDefinition(costexplorer.DimensionService, ""),
+			GroupDefinition(costexplorer.DimensionRecordType, ""),
+		},
+		TimePeriod: &costexplorer.DateInterval{
+			Start: aws.String(start.Format(utils.DateFormat)),
+			End:   aws.String(end.Format(utils.DateFormat)),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var costs []InvoiceCost
+	for _, period := range output.ResultsByTime {
+		for _, group := range period.Groups {
+			keys := aws.StringValueSlice(group.Keys)
+			if len(keys) != 2 {
+				continue
+			}
+			costs = append(costs, InvoiceCost{Service: keys[0], RecordType: keys[1], Cost: Amount(group.Metrics[metric])})
+		}
+	}
+	return costs, nil
+}
+
+// BuildInvoice prices AWS costs by the rule: usage is marked up per service,
+// discount applies to marked up usage, fees are added as is, credits and
+// refunds are passed at cost only when the rule says so. AWS tax is not
+// billed, invoice tax is computed from the rule. USD amounts are converted
+// by the rate, fees are in the invoice currency.
+func BuildInvoice(rule databases.PricingRule, costs []InvoiceCost, rate float64) *databases.Invoice {
+	invoice := &databases.Invoice{
+		CompanyID:  rule.CompanyID,
+		Currency:   rule.Currency,
+		Rate:       rate,
+		TaxPercent: rule.TaxPercent,
+	}
+
+	markups := map[string]float64{}
+	for _, override := range rule.Overrides {
+		markups[override.Service] = override.MarkupPercent
+	}
+
+	usage := map[string]float64{}
+	var credits float64
+	for _, item := range costs {
+		switch item.RecordType {
+		case tax:
+			continue
+		case credit, refund:
+			credits += item.Cost
+		default:
+			usage[item.Service] += item.Cost
+		}
+		invoice.Cost += item.Cost
+	}
+
+	names := make([]string, 0, len(usage))
+	for service := range usage {
+		names = append(names, service)
+	}
+	sort.Slice(names, func(i, j int) bool { return usage[names[i]] > usage[names[j]] })
+
+	var lines []databases.InvoiceLine
+	var usageAmount, usageUsd float64
+	for _, service := range names {
+		markup, ok := markups[service]
+		if !ok {
+			markup = rule.MarkupPercent
+		}
+		usd := usage[service] * (1 + markup/100)
+		amount := round2(usd * rate)
+		if amount == 0 {
+			continue
+		}
+		usageAmount += amount
+		usageUsd += usd
+		lines = append(lines, databases.InvoiceLine{
+			Kind:          databases.InvoiceLineUsage,
+			Description:   service,
+			Cost:          round2(usage[service]),
+			MarkupPercent: markup,
+			Amount:        amount,
+			UsdAmount:     round2(usd),
+		})
+	}
+
+	if rule.DiscountPercent > 0 && usageAmount > 0 {
+		lines = append(lines, databases.InvoiceLine{
+			Kind:        databases.InvoiceLineDiscount,
+			Description: fmt.Sprintf("Discount %v%%", rule.DiscountPercent),
+			Amount:      -round2(usageAmount * rule.DiscountPercent / 100),
+			UsdAmount:   -round2(usageUsd * rule.DiscountPercent / 100),
+		})
+	}
+	for _, fee := range rule.Fees {
+		lines = append(lines, databases.InvoiceLine{
+			Kind:        databases.InvoiceLineFee,
+			Description: fee.Name,
+			Amount:      round2(fee.Amount),
+			UsdAmount:   round2(fee.Amount / rate),
+		})
+	}
+	if rule.CreditsPassthrough && credits != 0 {
+		lines = append(lines, databases.InvoiceLine{
+			Kind:        databases.InvoiceLineCredit,
+			Description: "AWS credits and refunds",
+			Cost:        round2(credits),
+			Amount:      round2(credits * rate),
+			UsdAmount:   round2(credits),
+		})
+	}
+
+	var usdSubtotal float64
+	for i := range lines {
+		lines[i].Position = i + 1
+		invoice.Subtotal += lines[i].Amount
+		usdSubtotal += lines[i].UsdAmount
+	}
+	invoice.Lines = lines
+	invoice.Cost = round2(invoice.Cost)
+	invoice.Subtotal = round2(invoice.Subtotal)
+	invoice.UsdTotal = round2(usdSubtotal)
+	if invoice.Subtotal > 0 {
+		invoice.Tax = round2(invoice.Subtotal * rule.TaxPercent / 100)
+		invoice.UsdTotal = round2(usdSubtotal * (1 + rule.TaxPercent/100))
+	}
+	invoice.Total = round2(invoice.Subtotal + invoice.Tax)
+	return invoice
+}
+
+// GenerateInvoice builds draft invoice of the company for the month,
+// replaces the previous draft, issued invoices are never regenerated
+func GenerateInvoice(db *gorm.DB, svc costexploreriface.CostExplorerAPI, user databases.SystemUser, params form.InvoiceGenerateParams) (*databases.Invoice, error) {
+	start, end, err := parseMonth("month", params.Month)
+	if err != nil {
+		return nil, err
+	}
+	if params.Source == "" {
+		params.Source = InvoiceSourceCostExplorer
+	}
+	if err := oneOf("source", params.Source, []string{InvoiceSourceCur, InvoiceSourceCostExplorer}); err != nil {
+		return nil, err
+	}
+
+	rule, err := GetPricingRule(db, params.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing []databases.Invoice
+	if err := db.Where("company_id = ? AND month = ?", params.CompanyID, params.Month).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	for _, item := range existing {
+		if item.Status != databases.InvoiceDraft {
+			return nil, NewParamError("month", "invoice "+item.Number+" is already "+item.Status)
+		}
+	}
+
+	var costs []InvoiceCost
+	accounts := splitValues(rule.Accounts)
+	if params.Source == InvoiceSourceCur {
+		costs, err = CurInvoiceCosts(db, user, params.Month, accounts)
+	} else {
+		costs, err = CostExplorerInvoiceCosts(svc, params.Month, accounts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// average rate of the month
+	rates, err := LoadRates(db, rule.Currency, start.Format(utils.DateFormat), end.AddDate(0, 0, -1).Format(utils.DateFormat))
+	if err != nil {
+		return nil, err
+	}
+	rate, err := rates.PeriodRate(start.Format(utils.DateFormat), end.Format(utils.DateFormat))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	invoice := BuildInvoice(*rule, costs, rate)
+	invoice.Base = databases.Base{CreatedDate: now, ModifiedDate: now}
+	invoice.UserID = user.Base.ID
+	invoice.Month = params.Month
+	invoice.Source = params.Source
+	invoice.Status = databases.InvoiceDraft
+	for i := range invoice.Lines {
+		invoice.Lines[i].Base = databases.Base{CreatedDate: now, ModifiedDate: now}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, item := range existing {
+			if err := tx.Where("invoice_id = ?", item.Base.ID).Delete(&databases.InvoiceLine{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&databases.Invoice{}, item.Base.ID).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(invoice).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// SetInvoiceStatus moves invoice draft => issued => paid, issuing assigns
+// the next number of the year and the due date
+func SetInvoiceStatus(db *gorm.DB, invoice *databases.Invoice, status string) error {
+	now := time.Now()
+	switch {
+	case invoice.Status == databases.InvoiceDraft && status == databases.InvoiceIssued:
+		return db.Transaction(func(tx *gorm.DB) error {
+			prefix := fmt.Sprintf("%v-%v-", viper.GetString("invoice.prefix"), now.In(utils.Location()).Year())
+			var sequence int
+			if err := tx.Model(&databases.Invoice{}).Where("number LIKE ?", prefix+"%").
+				Select("COALESCE(MAX(sequence), 0)").Scan(&sequence).Error; err != nil {
+				return err
+			}
+
+			days := viper.GetInt("invoice.payment_term_days")
+			if rule, err := GetPricingRule(tx, invoice.CompanyID); err == nil && rule.PaymentTermDays > 0 {
+				days = rule.PaymentTermDays
+			}
+			due := now.AddDate(0, 0, days)
+
+			invoice.Sequence = sequence + 1
+			invoice.Number = fmt.Sprintf("%v%04d", prefix, invoice.Sequence)
+			invoice.Status = databases.InvoiceIssued
+			invoice.IssuedDate = &now
+			invoice.DueDate = &due
+			invoice.ModifiedDate = now
+			return tx.Model(invoice).Select("number", "sequence", "status", "issued_date", "due_date", "modified_date").Updates(invoice).Error
+		})
+	case invoice.Status == databases.InvoiceIssued && status == databases.InvoicePaid:
+		invoice.Status = databases.InvoicePaid
+		invoice.PaidDate = &now
+		invoice.ModifiedDate = now
+		return db.Model(invoice).Select("status", "paid_date", "modified_date").Updates(invoice).Error
+	}
+	return NewParamError("status", "invoice "+invoice.Status+" can not become "+status)
+}
+
+var invoiceTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money": func(value float64) string { return fmt.Sprintf("%.2f", value) },
+	"date": func(value *time.Time) string {
+		if value == nil {
+			return ""
+		}
+		return value.In(utils.Location()).Format(utils.DateFormat)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Invoice {{.Invoice.Number}}</title>
+<style>
+body { font-family: sans-serif; margin: 40px; }
+table { width: 100%; border-collapse: collapse; }
+th, td { padding: 6px; border-bottom: 1px solid #ddd; text-align: left; }
+.amount { text-align: right; }
+</style>
+</head>
+<body>
+<h1>{{if .Invoice.Number}}Invoice {{.Invoice.Number}}{{else}}Draft invoice{{end}}</h1>
+<p><strong>{{.Seller}}</strong><br>{{.Address}}</p>
+<p>Bill to: <strong>{{if .Invoice.Company}}{{.Invoice.Company.Name}}{{end}}</strong></p>
+<p>Period: {{.Invoice.Month}}<br>{{if ne .Invoice.Currency "USD"}}Exchange rate: 1 USD = {{.Invoice.Rate}} {{.Invoice.Currency}}<br>{{end}}Issued: {{date .Invoice.IssuedDate}}<br>Due: {{date .Invoice.DueDate}}<br>Status: {{.Invoice.Status}}</p>
+<table>
+<tr><th>#</th><th>Description</th><th class="amount">Amount ({{.Invoice.Currency}})</th></tr>
+{{range .Invoice.Lines}}<tr><td>{{.Position}}</td><td>{{.Description}}</td><td class="amount">{{money .Amount}}</td></tr>
+{{end}}<tr><td></td><td>Subtotal</td><td class="amount">{{money .Invoice.Subtotal}}</td></tr>
+<tr><td></td><td>Tax {{.Invoice.TaxPercent}}%</td><td class="amount">{{money .Invoice.Tax}}</td></tr>
+<tr><td></td><td><strong>Total</strong></td><td class="amount"><strong>{{money .Invoice.Total}}</strong></td></tr>
+</table>
+</body>
+</html>
+`))
+
+// RenderInvoice writes invoice as printable HTML document
+func RenderInvoice(w io.Writer, invoice databases.Invoice) error {
+	return invoiceTemplate.Execute(w, map[string]interface{}{
+		"Invoice": invoice,
+		"Seller":  viper.GetString("reseller.name"),
+		"Address": viper.GetString("reseller.address"),
+	})
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	viper "github.com/spf13/viper"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	gorm "gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EventAccountLocked notification sent to the user when login gets locked
+const EventAccountLocked = "account.locked"
+
+// LoginBlockedError login is refused until the date
+type LoginBlockedError struct {
+	Until  time.Time
+	Locked bool // locked out, otherwise waiting progressive delay
+}
+
+func (e *LoginBlockedError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("Login is locked until %v", e.Until.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("Too many failed logins, retry after %v", e.Until.Format(time.RFC3339))
+}
+
+// loginDuration duration of login.<name>, fallback when not configured
+func loginDuration(name string, fallback time.Duration) time.Duration {
+	if viper.IsSet("login." + name) {
+		if value := viper.GetDuration("login." + name); value > 0 {
+			return value
+		}
+	}
+	return fallback
+}
+
+// loginMaxFailures failures before lockout, login.max_failures per email and
+// login.ip_max_failures per IP
+func loginMaxFailures(key string) int {
+	if strings.HasPrefix(key, "ip:") {
+		if failures := viper.GetInt("login.ip_max_failures"); failures > 0 {
+			return failures
+		}
+		return 20
+	}
+	if failures := viper.GetInt("login.max_failures"); failures > 0 {
+		return failures
+	}
+	return 5
+}
+
+// loginKeys throttle keys of the attempt, email is case insensitive
+func loginKeys(email, ip string) []string {
+	keys := []string{"email:" + strings.ToLower(strings.TrimSpace(email))}
+	if ip != "" {
+		keys = append(keys, "ip:"+ip)
+	}
+	return keys
+}
+
+// loginDelay wait after failures, login.delay doubled after each failure up
+// to login.max_delay
+func loginDelay(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	delay, max := loginDuration("delay", time.Second), loginDuration("max_delay", 30*time.Second)
+	for i := 1; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
+
+// expireThrottle forgets failures after expired lockout or login.window
+// without failure
+func expireThrottle(throttle *databases.LoginThrottle, now time.Time) {
+	if throttle.LockedUntil != nil {
+		if now.Before(*throttle.LockedUntil) {
+			return
+		}
+		throttle.Failures = 0
+		throttle.LockedUntil = nil
+	}
+	if throttle.LastFailureDate != nil && now.Sub(*throttle.LastFailureDate) > loginDuration("window", 15*time.Minute) {
+		throttle.Failures = 0
+	}
+}
+
+// LoginAttempt attempt counted by CheckLogin
+type LoginAttempt struct {
+	Email  string
+	IP     string
+	Locked bool // this attempt locked the email out
+}
+
+// throttles locked rows of the attempt's keys, created when missing
+func throttles(tx *gorm.DB, keys []string, now time.Time) ([]databases.LoginThrottle, error) {
+	var rows []databases.LoginThrottle
+	for _, key := range keys {
+		throttle := databases.LoginThrottle{
+			Base: databases.Base{CreatedDate: now, ModifiedDate: now},
+			Key:  key,
+		}
+		if result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&throttle); result.Error != nil {
+			return nil, result.Error
+		}
+		if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&throttle); result.Error != nil {
+			return nil, result.Error
+		}
+		rows = append(rows, throttle)
+	}
+	return rows, nil
+}
+
+// CheckLogin LoginBlockedError when the email or IP is locked out or has to
+// wait after the last attempt. Otherwise the attempt is counted as failed
+// before the password is checked, in the same transaction as the check, so
+// parallel guesses wait for each other. LoginSucceeded takes it back.
+func CheckLogin(db *gorm.DB, email, ip string) (*LoginAttempt, error) {
+	attempt := &LoginAttempt{Email: email, IP: ip}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		rows, err := throttles(tx, loginKeys(email, ip), now)
+		if err != nil {
+			return err
+		}
+
+		var blocked *LoginBlockedError
+		for i := range rows {
+			throttle := &rows[i]
+			expireThrottle(throttle, now)
+			err := &LoginBlockedError{}
+			switch {
+			case throttle.LockedUntil != nil:
+				err.Until, err.Locked = *throttle.LockedUntil, true
+			case throttle.Failures > 0 && throttle.LastFailureDate != nil:
+				err.Until = throttle.LastFailureDate.Add(loginDelay(throttle.Failures))
+			}
+			if !now.Before(err.Until) {
+				continue
+			}
+			if blocked == nil || err.Until.After(blocked.Until) {
+				blocked = err
+			}
+		}
+		if blocked != nil {
+			return blocked
+		}
+
+		for i := range rows {
+			throttle := &rows[i]
+			throttle.Failures++
+			throttle.LastFailureDate = &now
+			throttle.ModifiedDate = now
+			if throttle.Failures >= loginMaxFailures(throttle.Key) {
+				until := now.Add(loginDuration("lockout", 15*time.Minute))
+				throttle.LockedUntil = &until
+				attempt.Locked = attempt.Locked || strings.HasPrefix(throttle.Key, "email:")
+			}
+			if result := tx.Save(throttle); result.Error != nil {
+				return result.Error
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return attempt, nil
+}
+
+// LoginSucceeded forgets failures of the email and takes back the attempt
+// of the IP, earlier IP failures are kept so one valid account does not
+// reset guessing of others
+func LoginSucceeded(db *gorm.DB, attempt *LoginAttempt) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		keys := loginKeys(attempt.Email, attempt.IP)
+		if result := tx.Where("key = ?", keys[0]).Delete(&databases.LoginThrottle{}); result.Error != nil {
+			return result.Error
+		}
+		if len(keys) == 1 {
+			return nil
+		}
+
+		rows, err := throttles(tx, keys[1:], time.Now())
+		if err != nil {
+			return err
+		}
+		throttle := rows[0]
+		if throttle.Failures > 0 {
+			throttle.Failures--
+		}
+		// lock set by this attempt
+		if throttle.Failures < loginMaxFailures(throttle.Key) {
+			throttle.LockedUntil = nil
+		}
+		return tx.Save(&throttle).Error
+	})
+}
+
+// LoginLocked LoginBlockedError while the email is locked out, for logins
+// that do not check the password and so do not count attempts
+func LoginLocked(db *gorm.DB, email string) error {
+	var throttle databases.LoginThrottle
+	if result := db.Where("key = ?", loginKeys(email, "")[0]).Limit(1).Find(&throttle); result.Error != nil {
+		return result.Error
+	}
+	if throttle.LockedUntil != nil && time.Now().Before(*throttle.LockedUntil) {
+		return &LoginBlockedError{Until: *throttle.LockedUntil, Locked: true}
+	}
+	return nil
+}
+
+// UnlockLogin removes lockout and failures of the email
+func UnlockLogin(db *gorm.DB, email string) error {
+	return db.Where("key = ?", loginKeys(email, "")[0]).Delete(&databases.LoginThrottle{}).Error
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	viper "github.com/spf13/viper"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+)
+
+// setLogin login settings of the test, restored when it ends
+func setLogin(t *testing.T, settings map[string]interface{}) {
+	for key, value := range settings {
+		viper.Set("login."+key, value)
+	}
+	t.Cleanup(func() {
+		for key := range settings {
+			viper.Set("login."+key, nil)
+		}
+	})
+}
+
+func TestCheckLoginParallel(t *testing.T) {
+	db := testDB(t, &databases.LoginThrottle{})
+	setLogin(t, map[string]interface{}{"delay": "1m"})
+
+	// guesses check the limit before any of them is answered
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed, blocked := 0, 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := CheckLogin(db, "a@example.com", "10.0.0.1")
+			mu.Lock()
+			defer mu.Unlock()
+			if _, ok := err.(*LoginBlockedError); ok {
+				blocked++
+			} else if err == nil {
+				allowed++
+			} else {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 1 || blocked != 9 {
+		t.Fatalf("expected 1 allowed and 9 blocked, got %v and %v", allowed, blocked)
+	}
+}
+
+func TestCheckLoginLockout(t *testing.T) {
+	db := testDB(t, &databases.LoginThrottle{})
+	setLogin(t, map[string]interface{}{"delay": "1ns", "max_delay": "1ns", "max_failures": 3})
+
+	for i := 1; i <= 3; i++ {
+		attempt, err := CheckLogin(db, "a@example.com", "10.0.0.1")
+		if err != nil {
+			t.Fatalf("attempt %v: %v", i, err)
+		}
+		if attempt.Locked != (i == 3) {
+			t.Fatalf("attempt %v: locked %v", i, attempt.Locked)
+		}
+	}
+	_, err := CheckLogin(db, "A@Example.com ", "10.0.0.2")
+	if blocked, ok := err.(*LoginBlockedError); !ok || !blocked.Locked {
+		t.Fatalf("expected lockout, got %v", err)
+	}
+
+	if err := UnlockLogin(db, "a@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckLogin(db, "a@example.com", "10.0.0.2"); err != nil {
+		t.Fatalf("unlocked login was refused: %v", err)
+	}
+}
+
+func TestLoginSucceeded(t *testing.T) {
+	db := testDB(t, &databases.LoginThrottle{})
+	setLogin(t, map[string]interface{}{"delay": "1ns", "max_delay": "1ns", "max_failures": 2, "ip_max_failures": 2})
+
+	// successful logins from a shared IP do not lock it
+	for i := 0; i < 5; i++ {
+		attempt, err := CheckLogin(db, fmt.Sprintf("user%v@example.com", i), "10.0.0.1")
+		if err != nil {
+			t.Fatalf("login %v: %v", i, err)
+		}
+		if err := LoginSucceeded(db, attempt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// failure of the email is forgotten after success
+	CheckLogin(db, "a@example.com", "10.0.0.2")
+	attempt, err := CheckLogin(db, "a@example.com", "10.0.0.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// correct password on the last attempt before lockout
+	LoginSucceeded(db, attempt)
+	if attempt, err := CheckLogin(db, "a@example.com", "10.0.0.4"); err != nil || attempt.Locked {
+		t.Fatalf("email failures were kept: %v", err)
+	}
+
+	// failures of other emails still lock the IP
+	CheckLogin(db, "b@example.com", "10.0.0.1")
+	CheckLogin(db, "c@example.com", "10.0.0.1")
+	if _, err := CheckLogin(db, "d@example.com", "10.0.0.1"); err == nil {
+		t.Fatal("IP was not locked")
+	}
+}
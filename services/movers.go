@@ -0,0 +1,251 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+)
+
+// Mover status
+const (
+	MoverNew         = "new"
+	MoverDisappeared = "disappeared"
+	MoverIncreased   = "increased"
+	MoverDecreased   = "decreased"
+	MoverUnchanged   = "unchanged"
+)
+
+// moverDimensions allowed dimensions of movers report
+var moverDimensions = map[string]bool{
+	costexplorer.DimensionService:                true,
+	costexplorer.DimensionLinkedAccount:          true,
+	costexplorer.DimensionRegion:                 true,
+	costexplorer.DimensionUsageType:              true,
+	costexplorer.GroupDefinitionTypeCostCategory: true,
+}
+
+type (
+	// Mover cost change of one dimension value
+	Mover struct {
+		Key           string   `json:"key"`
+		AmountA       float64  `json:"amount_a"`
+		AmountB       float64  `json:"amount_b"`
+		Change        float64  `json:"change"`
+		ChangePercent *float64 `json:"change_percent"`
+		Status        string   `json:"status"`
+	}
+
+	// WaterfallStep bar of waterfall chart
+	WaterfallStep struct {
+		Label  string  `json:"label"`
+		Type   string  `json:"type"` // total, increase, decrease
+		Amount float64 `json:"amount"`
+		From   float64 `json:"from"`
+		To     float64 `json:"to"`
+	}
+
+	// MoversReport cost change between period A and B
+	MoversReport struct {
+		Dimension     string          `json:"dimension"`
+		Metric        string          `json:"metric"`
+		Unit          string          `json:"unit"`
+		PeriodA       form.DateRange  `json:"period_a"`
+		PeriodB       form.DateRange  `json:"period_b"`
+		TotalA        float64         `json:"total_a"`
+		TotalB        float64         `json:"total_b"`
+		Change        float64         `json:"change"`
+		ChangePercent *float64        `json:"change_percent"`
+		Movers        []Mover         `json:"movers"`
+		New           []Mover         `json:"new"`
+		Disappeared   []Mover         `json:"disappeared"`
+		Waterfall     []WaterfallStep `json:"waterfall"`
+	}
+)
+
+// Movers ranks dimension values by their cost change from period A to
+// period B. Waterfall explains the total change by the top movers, the rest
+// is summed into one "Other" step.
+func Movers(svc costexploreriface.CostExplorerAPI, params form.CostExplorerMoversParams) (*MoversReport, error) {
+	dimension := params.Dimension
+	if dimension == "" {
+		dimension = costexplorer.DimensionService
+	}
+	if !moverDimensions[dimension] {
+		return nil, NewParamError("dimension", "must be SERVICE, LINKED_ACCOUNT, REGION, USAGE_TYPE or COST_CATEGORY")
+	}
+	if dimension == costexplorer.GroupDefinitionTypeCostCategory && params.CostCategoryKey == "" {
+		return nil, NewParamError("cost_category_key", "is required for COST_CATEGORY dimension")
+	}
+	group := GroupDefinition(dimension, params.CostCategoryKey)
+	metric := UsageMetric(params.Metric)
+	if metric == "" {
+		metric = "UnblendedCost"
+	}
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+
+	startA, endA, err := parseRange("period_a", params.PeriodA)
+	if err != nil {
+		return nil, err
+	}
+	startB, endB, err := parseRange("period_b", params.PeriodB)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := WithCostCategory(CostFilter(map[string][]*string{
+		costexplorer.DimensionService:       params.Services,
+		costexplorer.DimensionLinkedAccount: params.LinkedAccounts,
+	}), params.CostCategory)
+
+	amountsA, unit, err := GroupedCost(svc, startA, endA, metric, group, filter)
+	if err != nil {
+		return nil, err
+	}
+	amountsB, unitB, err := GroupedCost(svc, startB, endB, metric, group, filter)
+	if err != nil {
+		return nil, err
+	}
+	if unit == "" {
+		unit = unitB
+	}
+
+	report := &MoversReport{
+		Dimension: dimension,
+		Metric:    metric,
+		Unit:      unit,
+		PeriodA:   params.PeriodA,
+		PeriodB:   params.PeriodB,
+	}
+
+	keys := map[string]bool{}
+	for key, amount := range amountsA {
+		keys[key] = true
+		report.TotalA += amount
+	}
+	for key, amount := range amountsB {
+		keys[key] = true
+		report.TotalB += amount
+	}
+	report.Change = report.TotalB - report.TotalA
+	report.ChangePercent = PercentChange(report.TotalA, report.TotalB)
+
+	var movers []Mover
+	for key := range keys {
+		mover := Mover{
+			Key:           key,
+			AmountA:       amountsA[key],
+			AmountB:       amountsB[key],
+			Change:        amountsB[key] - amountsA[key],
+			ChangePercent: PercentChange(amountsA[key], amountsB[key]),
+		}
+		_, inA := amountsA[key]
+		_, inB := amountsB[key]
+		switch {
+		case !inA || (mover.AmountA == 0 && mover.AmountB != 0):
+			mover.Status = MoverNew
+		case !inB || (mover.AmountB == 0 && mover.AmountA != 0):
+			mover.Status = MoverDisappeared
+		case mover.Change > 0:
+			mover.Status = MoverIncreased
+		case mover.Change < 0:
+			mover.Status = MoverDecreased
+		default:
+			mover.Status = MoverUnchanged
+		}
+		movers = append(movers, mover)
+	}
+
+	sort.Slice(movers, func(i, j int) bool {
+		if params.SortBy == "relative" {
+			return relativeChange(movers[i]) > relativeChange(movers[j])
+		}
+		if math.Abs(movers[i].Change) != math.Abs(movers[j].Change) {
+			return math.Abs(movers[i].Change) > math.Abs(movers[j].Change)
+		}
+		return movers[i].Key < movers[j].Key
+	})
+
+	for _, mover := range movers {
+		switch mover.Status {
+		case MoverNew:
+			report.New = append(report.New, mover)
+		case MoverDisappeared:
+			report.Disappeared = append(report.Disappeared, mover)
+		}
+	}
+
+	if len(movers) > limit {
+		report.Movers = movers[:limit]
+	} else {
+		report.Movers = movers
+	}
+	report.Waterfall = waterfall(report, movers, limit)
+	return report, nil
+}
+
+// relativeChange new items rank first, disappeared items are -100%
+func relativeChange(mover Mover) float64 {
+	if mover.ChangePercent == nil {
+		if mover.Change > 0 {
+			return math.Inf(1)
+		}
+		return 0
+	}
+	return math.Abs(*mover.ChangePercent)
+}
+
+func waterfall(report *MoversReport, movers []Mover, limit int) []WaterfallStep {
+	// waterfall always explains by absolute change
+	ranked := append([]Mover{}, movers...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return math.Abs(ranked[i].Change) > math.Abs(ranked[j].Change)
+	})
+
+	steps := []WaterfallStep{{Label: "Period A", Type: "total", Amount: report.TotalA, From: 0, To: report.TotalA}}
+	current := report.TotalA
+	step := func(label string, change float64) {
+		kind := "increase"
+		if change < 0 {
+			kind = "decrease"
+		}
+		steps = append(steps, WaterfallStep{Label: label, Type: kind, Amount: change, From: current, To: current + change})
+		current += change
+	}
+
+	other := 0.0
+	for i, mover := range ranked {
+		if i < limit {
+			if mover.Change != 0 {
+				step(mover.Key, mover.Change)
+			}
+			continue
+		}
+		other += mover.Change
+	}
+	if other != 0 {
+		step("Other", other)
+	}
+
+	return append(steps, WaterfallStep{Label: "Period B", Type: "total", Amount: report.TotalB, From: 0, To: report.TotalB})
+}
+
+func parseRange(field string, dateRange form.DateRange) (start, end time.Time, err error) {
+	if start, err = utils.ParseDate(dateRange.StartDate); err != nil {
+		return start, end, NewParamError(field+".start_date", "invalid date "+dateRange.StartDate)
+	}
+	if end, err = utils.ParseDate(dateRange.EndDate); err != nil {
+		return start, end, NewParamError(field+".end_date", "invalid date "+dateRange.EndDate)
+	}
+	if !start.Before(end) {
+		return start, end, NewParamError(field+".start_date", "must be before end_date")
+	}
+	return start, end, nil
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	viper "github.com/spf13/viper"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	gorm "gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrCostExplorerQuota monthly Cost Explorer quota is used up
+var ErrCostExplorerQuota = errors.New("Monthly Cost Explorer request quota is used up")
+
+// CostExplorerQuotaUsage requests and quota of a month, quota -1 is unlimited
+type CostExplorerQuotaUsage struct {
+	CompanyID uint   `json:"company_id"`
+	UserID    uint   `json:"user_id"`
+	Month     string `json:"month"`
+	Requests  int    `json:"requests"`
+	Quota     int    `json:"quota"`
+	Remaining int    `json:"remaining"`
+	// background job requests, counted but not limited
+	JobRequests int `json:"job_requests"`
+}
+
+// quotaOwner usage row owner, company users share the company's row
+func quotaOwner(user databases.SystemUser) (uint, uint) {
+	if user.CompanyID != 0 {
+		return user.CompanyID, 0
+	}
+	return 0, user.Base.ID
+}
+
+// CostExplorerQuota monthly requests of the company, company setting or
+// quota.cost_explorer_monthly, -1 is unlimited
+func CostExplorerQuota(db *gorm.DB, companyID uint) int {
+	if companyID != 0 {
+		var company databases.Company
+		if result := db.Limit(1).Find(&company, companyID); result.RowsAffected != 0 && company.CostExplorerQuota != 0 {
+			return company.CostExplorerQuota
+		}
+	}
+	if quota := viper.GetInt("quota.cost_explorer_monthly"); quota > 0 {
+		return quota
+	}
+	return -1
+}
+
+// UseCostExplorer counts one Cost Explorer request of the user's company,
+// ErrCostExplorerQuota when the month's quota is used up
+func UseCostExplorer(db *gorm.DB, user databases.SystemUser) error {
+	return useCostExplorer(db, user, false)
+}
+
+// useCostExplorer job requests are counted apart and never refused, so
+// scheduled budgets, anomalies and reports keep running when users have used
+// up the quota
+func useCostExplorer(db *gorm.DB, user databases.SystemUser, job bool) error {
+	companyID, userID := quotaOwner(user)
+	now := time.Now()
+	month := now.Format("2006-01")
+
+	usage := databases.CostExplorerUsage{
+		Base:      databases.Base{CreatedDate: now, ModifiedDate: now},
+		CompanyID: companyID,
+		UserID:    userID,
+		Month:     month,
+	}
+	if result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&usage); result.Error != nil {
+		return result.Error
+	}
+
+	query := db.Model(&databases.CostExplorerUsage{}).
+		Where("company_id = ? AND user_id = ? AND month = ?", companyID, userID, month)
+	if job {
+		return query.Updates(map[string]interface{}{"job_requests": gorm.Expr("job_requests + 1"), "modified_date": now}).Error
+	}
+
+	// single conditional update so concurrent requests can not pass the quota
+	if quota := CostExplorerQuota(db, companyID); quota >= 0 {
+		query = query.Where("requests < ?", quota)
+	}
+	result := query.Updates(map[string]interface{}{"requests": gorm.Expr("requests + 1"), "modified_date": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCostExplorerQuota
+	}
+	return nil
+}
+
+// meterCostExplorer counts every Cost Explorer request of the session against
+// the quota, each page of paginated calls is a billed request. Job sessions
+// are counted as job requests.
+func meterCostExplorer(db *gorm.DB, user databases.SystemUser, sess *session.Session, job bool) {
+	sess.Handlers.Validate.PushBack(func(r *request.Request) {
+		// invalid params are not sent so they are not billed
+		if r.Error != nil || r.ClientInfo.ServiceName != costexplorer.ServiceName {
+			return
+		}
+		if err := useCostExplorer(db, user, job); err != nil {
+			r.Error = err
+		}
+	})
+}
+
+// CostExplorerUsageReport usage of the last months of the user's company,
+// newest first
+func CostExplorerUsageReport(db *gorm.DB, user databases.SystemUser, months int) ([]CostExplorerQuotaUsage, error) {
+	companyID, userID := quotaOwner(user)
+	quota := CostExplorerQuota(db, companyID)
+
+	var rows []databases.CostExplorerUsage
+	result := db.Where("company_id = ? AND user_id = ?", companyID, userID).Find(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	usages := map[string]databases.CostExplorerUsage{}
+	for _, row := range rows {
+		usages[row.Month] = row
+	}
+
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	var report []CostExplorerQuotaUsage
+	for i := 0; i < months; i++ {
+		month := start.AddDate(0, -i, 0).Format("2006-01")
+		report = append(report, quotaUsage(companyID, userID, month, usages[month], quota))
+	}
+	return report, nil
+}
+
+// CompanyCostExplorerUsage usage of every company in the month
+func CompanyCostExplorerUsage(db *gorm.DB, month string) ([]CostExplorerQuotaUsage, error) {
+	var rows []databases.CostExplorerUsage
+	result := db.Where("month = ?", month).Order("requests desc").Find(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	report := []CostExplorerQuotaUsage{}
+	for _, row := range rows {
+		report = append(report, quotaUsage(row.CompanyID, row.UserID, row.Month, row, CostExplorerQuota(db, row.CompanyID)))
+	}
+	return report, nil
+}
+
+// quotaUsage usage with remaining requests
+func quotaUsage(companyID, userID uint, month string, row databases.CostExplorerUsage, quota int) CostExplorerQuotaUsage {
+	usage := CostExplorerQuotaUsage{CompanyID: companyID, UserID: userID, Month: month, Requests: row.Requests, JobRequests: row.JobRequests, Quota: quota, Remaining: -1}
+	if quota >= 0 {
+		usage.Remaining = quota - row.Requests
+		if usage.Remaining < 0 {
+			usage.Remaining = 0
+		}
+	}
+	return usage
+}
+
+// SetCostExplorerQuota company setting, 0 uses quota.cost_explorer_monthly and
+// -1 is unlimited
+func SetCostExplorerQuota(db *gorm.DB, companyID uint, quota int) (*databases.Company, error) {
+	if quota < -1 {
+		return nil, NewParamError("cost_explorer", "must be -1 or more")
+	}
+	var company databases.Company
+	if result := db.First(&company, companyID); result.Error != nil {
+		return nil, result.Error
+	}
+	company.CostExplorerQuota = quota
+	company.ModifiedDate = time.Now()
+	if result := db.Save(&company); result.Error != nil {
+		return nil, result.Error
+	}
+	return &company, nil
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"testing"
+
+	viper "github.com/spf13/viper"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+)
+
+func TestUseCostExplorerJobs(t *testing.T) {
+	db := testDB(t, &databases.Company{}, &databases.CostExplorerUsage{})
+	viper.Set("quota.cost_explorer_monthly", 2)
+	t.Cleanup(func() { viper.Set("quota.cost_explorer_monthly", 0) })
+	user := databases.SystemUser{Base: databases.Base{ID: 1}, CompanyID: 1}
+
+	for i := 0; i < 2; i++ {
+		if err := UseCostExplorer(db, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := UseCostExplorer(db, user); err != ErrCostExplorerQuota {
+		t.Fatalf("expected quota error, got %v", err)
+	}
+
+	// jobs keep running after users used up the quota
+	for i := 0; i < 3; i++ {
+		if err := useCostExplorer(db, user, true); err != nil {
+			t.Fatalf("job request %v refused: %v", i, err)
+		}
+	}
+
+	report, err := CostExplorerUsageReport(db, user, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage := report[0]; usage.Requests != 2 || usage.JobRequests != 3 || usage.Remaining != 0 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+}
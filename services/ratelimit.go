@@ -0,0 +1,186 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	viper "github.com/spf13/viper"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	gorm "gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Rate limit stores
+const (
+	RateLimitMemory   = "memory"   // buckets of this instance
+	RateLimitPostgres = "postgres" // buckets shared by all instances
+)
+
+// RateLimit token bucket, Burst tokens refilled at Requests per Per
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// RateLimitResult bucket after taking a token
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int           // bucket size
+	Remaining  int           // whole tokens left
+	Reset      time.Duration // until bucket is full again
+	RetryAfter time.Duration // until next token when not allowed
+}
+
+// RateLimitStore takes one token from the bucket of key
+type RateLimitStore interface {
+	Take(key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// rateLimitConfig limit of ratelimit.<key>, missing values come from fallback
+func rateLimitConfig(key string, fallback RateLimit) RateLimit {
+	limit := fallback
+	if viper.IsSet(key + ".requests") {
+		limit.Requests = viper.GetInt(key + ".requests")
+		limit.Burst = 0
+	}
+	if viper.IsSet(key + ".per") {
+		limit.Per = viper.GetDuration(key + ".per")
+	}
+	if viper.IsSet(key + ".burst") {
+		limit.Burst = viper.GetInt(key + ".burst")
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = limit.Requests
+	}
+	if limit.Per <= 0 {
+		limit.Per = time.Minute
+	}
+	return limit
+}
+
+// GroupRateLimit limit of the route group, ratelimit.groups.<group> or
+// ratelimit.default. Zero requests disables limiting.
+func GroupRateLimit(group string) RateLimit {
+	limit := rateLimitConfig("ratelimit.default", RateLimit{Requests: 120, Per: time.Minute})
+	return rateLimitConfig("ratelimit.groups."+group, limit)
+}
+
+// UserRateLimit limit of the user in the route group, ratelimit.users.<id>
+// overrides the group limit for users that need more or less requests
+func UserRateLimit(group string, userID uint) RateLimit {
+	return rateLimitConfig(fmt.Sprintf("ratelimit.users.%v", userID), GroupRateLimit(group))
+}
+
+// IPRateLimit limit per IP of every request before authentication,
+// ratelimit.ip. Zero requests disables limiting.
+func IPRateLimit() RateLimit {
+	return rateLimitConfig("ratelimit.ip", RateLimit{Requests: 300, Per: time.Minute})
+}
+
+// APIKeyRateLimit own limit of the API key across all groups
+func APIKeyRateLimit(key databases.APIKey) RateLimit {
+	return RateLimit{Requests: key.RateLimit, Per: time.Minute, Burst: key.RateLimit}
+}
+
+// NewRateLimitStore store of ratelimit.store, memory by default
+func NewRateLimitStore(db *gorm.DB) RateLimitStore {
+	if viper.GetString("ratelimit.store") == RateLimitPostgres {
+		return &postgresRateLimitStore{db: db}
+	}
+	return &memoryRateLimitStore{buckets: map[string]*tokenBucket{}}
+}
+
+// tokenBucket tokens left at updated
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take refills the bucket since last update and takes one token
+func (bucket *tokenBucket) take(limit RateLimit, now time.Time) RateLimitResult {
+	rate := float64(limit.Requests) / limit.Per.Seconds()
+	if bucket.updated.IsZero() {
+		bucket.tokens = float64(limit.Burst)
+	} else if elapsed := now.Sub(bucket.updated).Seconds(); elapsed > 0 {
+		bucket.tokens = math.Min(float64(limit.Burst), bucket.tokens+elapsed*rate)
+	}
+	bucket.updated = now
+
+	result := RateLimitResult{Limit: limit.Burst}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+	}
+	result.Remaining = int(bucket.tokens)
+	result.Reset = time.Duration((float64(limit.Burst) - bucket.tokens) / rate * float64(time.Second))
+	return result
+}
+
+// memoryRateLimitStore buckets of this instance, idle buckets are swept
+type memoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func (store *memoryRateLimitStore) Take(key string, limit RateLimit) (RateLimitResult, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(store.lastSweep) > time.Hour {
+		// full buckets are the same as missing ones
+		for item, bucket := range store.buckets {
+			if now.Sub(bucket.updated) > time.Hour {
+				delete(store.buckets, item)
+			}
+		}
+		store.lastSweep = now
+	}
+
+	bucket, ok := store.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{}
+		store.buckets[key] = bucket
+	}
+	return bucket.take(limit, now), nil
+}
+
+// postgresRateLimitStore buckets in rate_limit_buckets, row is locked while
+// the token is taken
+type postgresRateLimitStore struct {
+	db *gorm.DB
+}
+
+func (store *postgresRateLimitStore) Take(key string, limit RateLimit) (RateLimitResult, error) {
+	var result RateLimitResult
+	err := store.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		row := databases.RateLimitBucket{
+			Base:   databases.Base{CreatedDate: now, ModifiedDate: now},
+			Key:    key,
+			Tokens: float64(limit.Burst),
+		}
+		if res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&row); res.Error != nil {
+			return res.Error
+		}
+		if res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&row); res.Error != nil {
+			return res.Error
+		}
+
+		bucket := tokenBucket{tokens: row.Tokens, updated: row.ModifiedDate}
+		result = bucket.take(limit, now)
+		return tx.Model(&row).Updates(map[string]interface{}{"tokens": bucket.tokens, "modified_date": now}).Error
+	})
+	return result, err
+}
+
+// CleanRateLimits removes buckets idle for a day, they are full again
+func CleanRateLimits(db *gorm.DB) error {
+	return db.Where("modified_date < ?", time.Now().Add(-24*time.Hour)).Delete(&databases.RateLimitBucket{}).Error
+}
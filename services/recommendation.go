@@ -0,0 +1,293 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	gorm "gorm.io/gorm"
+)
+
+// recommendationDefaults fills and validates purchase options
+func recommendationDefaults(params *form.PurchaseRecommendationParams) error {
+	if params.LookbackPeriod == "" {
+		params.LookbackPeriod = costexplorer.LookbackPeriodInDaysThirtyDays
+	}
+	if params.Term == "" {
+		params.Term = costexplorer.TermInYearsOneYear
+	}
+	if params.PaymentOption == "" {
+		params.PaymentOption = costexplorer.PaymentOptionNoUpfront
+	}
+	if err := oneOf("lookback_period", params.LookbackPeriod, costexplorer.LookbackPeriodInDays_Values()); err != nil {
+		return err
+	}
+	if err := oneOf("term", params.Term, costexplorer.TermInYears_Values()); err != nil {
+		return err
+	}
+	if err := oneOf("payment_option", params.PaymentOption, costexplorer.PaymentOption_Values()); err != nil {
+		return err
+	}
+	if params.AccountScope != "" {
+		if err := oneOf("account_scope", params.AccountScope, costexplorer.AccountScope_Values()); err != nil {
+			return err
+		}
+	}
+
+	switch params.Kind {
+	case databases.RecommendationSavingsPlans:
+		if params.SavingsPlansType == "" {
+			params.SavingsPlansType = costexplorer.SupportedSavingsPlansTypeComputeSp
+		}
+		return oneOf("savings_plans_type", params.SavingsPlansType, costexplorer.SupportedSavingsPlansType_Values())
+	case databases.RecommendationReservation:
+		if params.Service == "" {
+			params.Service = "Amazon Elastic Compute Cloud - Compute"
+		}
+		if params.OfferingClass != "" {
+			return oneOf("offering_class", params.OfferingClass, costexplorer.OfferingClass_Values())
+		}
+		return nil
+	}
+	return NewParamError("kind", "must be savings_plans or reservation")
+}
+
+// breakEven months until monthly savings pay back the upfront cost
+func breakEven(upfront, monthlySavings float64) float64 {
+	if upfront <= 0 || monthlySavings <= 0 {
+		return 0
+	}
+	return upfront / monthlySavings
+}
+
+// SavingsPlansRecommendations fetches savings plans purchase recommendations
+func SavingsPlansRecommendations(svc costexploreriface.CostExplorerAPI, params form.PurchaseRecommendationParams) (*databases.RecommendationFetch, error) {
+	input := &costexplorer.GetSavingsPlansPurchaseRecommendationInput{
+		LookbackPeriodInDays: aws.String(params.LookbackPeriod),
+		TermInYears:          aws.String(params.Term),
+		PaymentOption:        aws.String(params.PaymentOption),
+		SavingsPlansType:     aws.String(params.SavingsPlansType),
+	}
+	if params.AccountScope != "" {
+		input.AccountScope = aws.String(params.AccountScope)
+	}
+
+	fetch := &databases.RecommendationFetch{}
+	for {
+		output, err := svc.GetSavingsPlansPurchaseRecommendation(input)
+		if err != nil {
+			return nil, err
+		}
+		if metadata := output.Metadata; metadata != nil {
+			fetch.RecommendationID = aws.StringValue(metadata.RecommendationId)
+			fetch.GenerationDate = aws.StringValue(metadata.GenerationTimestamp)
+		}
+		if recommendation := output.SavingsPlansPurchaseRecommendation; recommendation != nil {
+			for _, detail := range recommendation.SavingsPlansPurchaseRecommendationDetails {
+				item := databases.PurchaseRecommendation{
+					AccountID:               aws.StringValue(detail.AccountId),
+					HourlyCommitment:        ParseAmount(detail.HourlyCommitmentToPurchase),
+					UpfrontCost:             ParseAmount(detail.UpfrontCost),
+					EstimatedMonthlySavings: ParseAmount(detail.EstimatedMonthlySavingsAmount),
+					EstimatedSavingsPercent: ParseAmount(detail.EstimatedSavingsPercentage),
+					EstimatedUtilization:    ParseAmount(detail.EstimatedAverageUtilization),
+					Currency:                aws.StringValue(detail.CurrencyCode),
+				}
+				// commitment is paid hourly, upfront part is excluded
+				item.RecurringMonthlyCost = item.HourlyCommitment * 730
+				if params.PaymentOption == costexplorer.PaymentOptionAllUpfront {
+					item.RecurringMonthlyCost = 0
+				}
+				if details := detail.SavingsPlansDetails; details != nil {
+					item.Region = aws.StringValue(details.Region)
+					item.InstanceFamily = aws.StringValue(details.InstanceFamily)
+				}
+				item.BreakEvenMonths = breakEven(item.UpfrontCost, item.EstimatedMonthlySavings)
+				fetch.Items = append(fetch.Items, item)
+			}
+		}
+		if aws.StringValue(output.NextPageToken) == "" {
+			break
+		}
+		input.NextPageToken = output.NextPageToken
+	}
+	return fetch, nil
+}
+
+// ReservationRecommendations fetches reserved instance purchase recommendations
+func ReservationRecommendations(svc costexploreriface.CostExplorerAPI, params form.PurchaseRecommendationParams) (*databases.RecommendationFetch, error) {
+	input := &costexplorer.GetReservationPurchaseRecommendationInput{
+		Service:              aws.String(params.Service),
+		LookbackPeriodInDays: aws.String(params.LookbackPeriod),
+		TermInYears:          aws.String(params.Term),
+		PaymentOption:        aws.String(params.PaymentOption),
+	}
+	if params.AccountScope != "" {
+		input.AccountScope = aws.String(params.AccountScope)
+	}
+	if params.OfferingClass != "" {
+		input.ServiceSpecification = &costexplorer.ServiceSpecification{
+			EC2Specification: &costexplorer.EC2Specification{OfferingClass: aws.String(params.OfferingClass)},
+		}
+	}
+
+	fetch := &databases.RecommendationFetch{}
+	for {
+		output, err := svc.GetReservationPurchaseRecommendation(input)
+		if err != nil {
+			return nil, err
+		}
+		if metadata := output.Metadata; metadata != nil {
+			fetch.RecommendationID = aws.StringValue(metadata.RecommendationId)
+			fetch.GenerationDate = aws.StringValue(metadata.GenerationTimestamp)
+		}
+		for _, recommendation := range output.Recommendations {
+			for _, detail := range recommendation.RecommendationDetails {
+				item := databases.PurchaseRecommendation{
+					AccountID:               aws.StringValue(detail.AccountId),
+					Quantity:                ParseAmount(detail.RecommendedNumberOfInstancesToPurchase),
+					UpfrontCost:             ParseAmount(detail.UpfrontCost),
+					RecurringMonthlyCost:    ParseAmount(detail.RecurringStandardMonthlyCost),
+					EstimatedMonthlySavings: ParseAmount(detail.EstimatedMonthlySavingsAmount),
+					EstimatedSavingsPercent: ParseAmount(detail.EstimatedMonthlySavingsPercentage),
+					EstimatedUtilization:    ParseAmount(detail.AverageUtilization),
+					BreakEvenMonths:         ParseAmount(detail.EstimatedBreakEvenInMonths),
+					Currency:                aws.StringValue(detail.CurrencyCode),
+				}
+				instanceDetails(&item, detail.InstanceDetails)
+				fetch.Items = append(fetch.Items, item)
+			}
+		}
+		if aws.StringValue(output.NextPageToken) == "" {
+			break
+		}
+		input.NextPageToken = output.NextPageToken
+	}
+	return fetch, nil
+}
+
+// instanceDetails region, family and type of the recommended instance
+func instanceDetails(item *databases.PurchaseRecommendation, details *costexplorer.InstanceDetails) {
+	if details == nil {
+		return
+	}
+	switch {
+	case details.EC2InstanceDetails != nil:
+		item.Region = aws.StringValue(details.EC2InstanceDetails.Region)
+		item.InstanceFamily = aws.StringValue(details.EC2InstanceDetails.Family)
+		item.InstanceType = aws.StringValue(details.EC2InstanceDetails.InstanceType)
+		item.Platform = aws.StringValue(details.EC2InstanceDetails.Platform)
+	case details.RDSInstanceDetails != nil:
+		item.Region = aws.StringValue(details.RDSInstanceDetails.Region)
+		item.InstanceFamily = aws.StringValue(details.RDSInstanceDetails.Family)
+		item.InstanceType = aws.StringValue(details.RDSInstanceDetails.InstanceType)
+		item.Platform = aws.StringValue(details.RDSInstanceDetails.DatabaseEngine)
+	case details.ElastiCacheInstanceDetails != nil:
+		item.Region = aws.StringValue(details.ElastiCacheInstanceDetails.Region)
+		item.InstanceFamily = aws.StringValue(details.ElastiCacheInstanceDetails.Family)
+		item.InstanceType = aws.StringValue(details.ElastiCacheInstanceDetails.NodeType)
+		item.Platform = aws.StringValue(details.ElastiCacheInstanceDetails.ProductDescription)
+	case details.ESInstanceDetails != nil:
+		item.Region = aws.StringValue(details.ESInstanceDetails.Region)
+		item.InstanceFamily = aws.StringValue(details.ESInstanceDetails.InstanceClass)
+		item.InstanceType = aws.StringValue(details.ESInstanceDetails.InstanceSize)
+	case details.RedshiftInstanceDetails != nil:
+		item.Region = aws.StringValue(details.RedshiftInstanceDetails.Region)
+		item.InstanceFamily = aws.StringValue(details.RedshiftInstanceDetails.Family)
+		item.InstanceType = aws.StringValue(details.RedshiftInstanceDetails.NodeType)
+	}
+}
+
+// PurchaseRecommendations fetches recommendations, ranks them by estimated
+// monthly savings and stores them as a new fetch for history
+func PurchaseRecommendations(db *gorm.DB, svc costexploreriface.CostExplorerAPI, user databases.SystemUser, params form.PurchaseRecommendationParams) (*databases.RecommendationFetch, error) {
+	if err := recommendationDefaults(&params); err != nil {
+		return nil, err
+	}
+
+	var fetch *databases.RecommendationFetch
+	var err error
+	if params.Kind == databases.RecommendationSavingsPlans {
+		fetch, err = SavingsPlansRecommendations(svc, params)
+	} else {
+		fetch, err = ReservationRecommendations(svc, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	fetch.CompanyID = user.CompanyID
+	fetch.UserID = user.Base.ID
+	fetch.Kind = params.Kind
+	fetch.LookbackPeriod = params.LookbackPeriod
+	fetch.Term = params.Term
+	fetch.PaymentOption = params.PaymentOption
+	fetch.AccountScope = params.AccountScope
+	if params.Kind == databases.RecommendationSavingsPlans {
+		fetch.SavingsPlansType = params.SavingsPlansType
+	} else {
+		fetch.Service = params.Service
+	}
+	fetch.Base = databases.Base{CreatedDate: now, ModifiedDate: now}
+
+	sort.SliceStable(fetch.Items, func(i, j int) bool {
+		return fetch.Items[i].EstimatedMonthlySavings > fetch.Items[j].EstimatedMonthlySavings
+	})
+	for i := range fetch.Items {
+		item := &fetch.Items[i]
+		item.Rank = i + 1
+		item.Base = databases.Base{CreatedDate: now, ModifiedDate: now}
+		fetch.TotalMonthlySavings += item.EstimatedMonthlySavings
+		fetch.TotalUpfrontCost += item.UpfrontCost
+		if fetch.Currency == "" {
+			fetch.Currency = item.Currency
+		}
+	}
+	fetch.Count = len(fetch.Items)
+
+	if err := db.Create(fetch).Error; err != nil {
+		return nil, err
+	}
+	return fetch, nil
+}
+
+// RecommendationChange fetch with its change since the previous fetch of the same options
+type RecommendationChange struct {
+	Fetch                databases.RecommendationFetch  `json:"fetch"`
+	Previous             *databases.RecommendationFetch `json:"previous"`
+	MonthlySavingsChange float64                        `json:"monthly_savings_change"`
+	CountChange          int                            `json:"count_change"`
+}
+
+// CompareRecommendations finds the fetch before the given one with the same options
+func CompareRecommendations(db *gorm.DB, fetch databases.RecommendationFetch) (*RecommendationChange, error) {
+	change := &RecommendationChange{Fetch: fetch}
+
+	var previous databases.RecommendationFetch
+	result := db.Where(&databases.RecommendationFetch{
+		UserID:           fetch.UserID,
+		Kind:             fetch.Kind,
+		Service:          fetch.Service,
+		SavingsPlansType: fetch.SavingsPlansType,
+		LookbackPeriod:   fetch.LookbackPeriod,
+		Term:             fetch.Term,
+		PaymentOption:    fetch.PaymentOption,
+	}).Where("account_scope = ? AND created_date < ?", fetch.AccountScope, fetch.CreatedDate).
+		Order("created_date desc").Limit(1).Find(&previous)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return change, nil
+	}
+
+	change.Previous = &previous
+	change.MonthlySavingsChange = fetch.TotalMonthlySavings - previous.TotalMonthlySavings
+	change.CountChange = fetch.Count - previous.Count
+	return change, nil
+}
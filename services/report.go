@@ -0,0 +1,213 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/report"
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+	gorm "gorm.io/gorm"
+)
+
+// reportServices number of services listed in the monthly report, the rest
+// are summed into one line
+const reportServices = 10
+
+// MonthlyReport data of the monthly cost report of the user's company or one
+// linked account. Amounts are in the display currency, the forecast is only
+// made for the current month.
+func MonthlyReport(db *gorm.DB, svc costexploreriface.CostExplorerAPI, user databases.SystemUser, params form.MonthlyReportParams) (*report.MonthlyReport, error) {
+	start, end, err := parseMonth("month", params.Month)
+	if err != nil {
+		return nil, err
+	}
+	today := utils.Today()
+	if start.After(today) {
+		return nil, NewParamError("month", "must not be in the future")
+	}
+	metric := UsageMetric(params.Metric)
+	if metric == "" {
+		metric = "UnblendedCost"
+	}
+
+	// today is included, its cost is partial
+	actualEnd := today.AddDate(0, 0, 1)
+	if actualEnd.After(end) {
+		actualEnd = end
+	}
+	previousStart := start.AddDate(0, -1, 0)
+
+	var accounts []*string
+	result := &report.MonthlyReport{
+		Title:         user.Email,
+		Scope:         "All accounts",
+		Month:         params.Month,
+		Metric:        metric,
+		GeneratedDate: today.Format(utils.DateFormat),
+	}
+	if params.LinkedAccount != "" {
+		accounts = []*string{aws.String(params.LinkedAccount)}
+		result.Scope = "Account " + params.LinkedAccount
+	}
+	if user.CompanyID != 0 {
+		var company databases.Company
+		if db.Limit(1).Find(&company, user.CompanyID).RowsAffected != 0 {
+			result.Title = company.Name
+		}
+	}
+
+	rates, err := DisplayRates(db, user, params.Currency, previousStart.Format(utils.DateFormat), end.Format(utils.DateFormat))
+	if err != nil {
+		return nil, err
+	}
+	result.Currency = rates.Currency
+	periodRate := func(from, to time.Time) (float64, error) {
+		return rates.PeriodRate(from.Format(utils.DateFormat), to.Format(utils.DateFormat))
+	}
+
+	filter := CostFilter(map[string][]*string{costexplorer.DimensionLinkedAccount: accounts})
+
+	// daily spend and month total
+	daily, err := GetCostAndUsage(svc, &costexplorer.GetCostAndUsageInput{
+		Filter:      filter,
+		Granularity: aws.String(costexplorer.GranularityDaily),
+		Metrics:     []*string{aws.String(metric)},
+		TimePeriod: &costexplorer.DateInterval{
+			Start: aws.String(start.Format(utils.DateFormat)),
+			End:   aws.String(actualEnd.Format(utils.DateFormat)),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, period := range daily.ResultsByTime {
+		date := aws.StringValue(period.TimePeriod.Start)
+		rate, err := rates.Rate(date)
+		if err != nil {
+			return nil, err
+		}
+		amount := round2(Amount(period.Total[metric]) * rate)
+		result.Daily = append(result.Daily, report.DailyPoint{Date: date, Amount: amount})
+		result.Total += amount
+	}
+	result.Total = round2(result.Total)
+
+	// services of this and last month
+	byService := GroupDefinition(costexplorer.DimensionService, "")
+	current, _, err := GroupedCost(svc, start, actualEnd, metric, byService, filter)
+	if err != nil {
+		return nil, err
+	}
+	previous, _, err := GroupedCost(svc, previousStart, start, metric, byService, filter)
+	if err != nil {
+		return nil, err
+	}
+	currentRate, err := periodRate(start, actualEnd)
+	if err != nil {
+		return nil, err
+	}
+	previousRate, err := periodRate(previousStart, start)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, amount := range previous {
+		result.PreviousTotal += amount * previousRate
+	}
+	result.PreviousTotal = round2(result.PreviousTotal)
+	result.ChangePercent = PercentChange(result.PreviousTotal, result.Total)
+
+	var lines []report.ServiceLine
+	for name, amount := range current {
+		line := report.ServiceLine{
+			Service:  name,
+			Amount:   round2(amount * currentRate),
+			Previous: round2(previous[name] * previousRate),
+		}
+		line.ChangePercent = PercentChange(line.Previous, line.Amount)
+		lines = append(lines, line)
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].Amount != lines[j].Amount {
+			return lines[i].Amount > lines[j].Amount
+		}
+		return lines[i].Service < lines[j].Service
+	})
+	if len(lines) > reportServices {
+		other := report.ServiceLine{Service: "Other services"}
+		for _, line := range lines[reportServices:] {
+			other.Amount += line.Amount
+			other.Previous += line.Previous
+		}
+		other.Amount, other.Previous = round2(other.Amount), round2(other.Previous)
+		other.ChangePercent = PercentChange(other.Previous, other.Amount)
+		lines = append(lines[:reportServices], other)
+	}
+	result.Services = lines
+
+	// forecast of the rest of the current month
+	monthEnd := result.Total
+	if actualEnd.Before(end) {
+		result.Forecast = &report.ForecastSummary{MonthEnd: result.Total, Lower: result.Total, Upper: result.Total}
+		forecast, err := Forecast(svc, form.CostExplorerForcastParams{
+			StartDate:      actualEnd.Format(utils.DateFormat),
+			EndDate:        end.Format(utils.DateFormat),
+			Granularity:    costexplorer.GranularityMonthly,
+			Metric:         metric,
+			LinkedAccounts: accounts,
+		})
+		if err == nil {
+			forecastRate, err := periodRate(actualEnd, end)
+			if err != nil {
+				return nil, err
+			}
+			result.Forecast.MonthEnd = round2(result.Total + forecast.ForecastTotal*forecastRate)
+			result.Forecast.Lower, result.Forecast.Upper = result.Forecast.MonthEnd, result.Forecast.MonthEnd
+			if forecast.TotalLower != nil && forecast.TotalUpper != nil {
+				result.Forecast.Lower = round2(result.Total + *forecast.TotalLower*forecastRate)
+				result.Forecast.Upper = round2(result.Total + *forecast.TotalUpper*forecastRate)
+			}
+		} else {
+			result.Forecast.Error = err.Error()
+		}
+		monthEnd = result.Forecast.MonthEnd
+	}
+
+	// monthly budgets of the same scope and metric
+	scope := companyRows(db, user).Where("is_active = ? AND period = ?", true, BudgetMonthly)
+	if params.LinkedAccount != "" {
+		scope = scope.Where("scope_type = ? AND scope_value = ?", databases.BudgetScopeAccount, params.LinkedAccount)
+	} else {
+		scope = scope.Where("scope_type = ?", databases.BudgetScopeCompany)
+	}
+	var budgets []databases.Budget
+	if err := scope.Order("name").Find(&budgets).Error; err != nil {
+		return nil, err
+	}
+	monthRate, err := periodRate(start, end)
+	if err != nil {
+		return nil, err
+	}
+	for _, budget := range budgets {
+		budgetMetric := UsageMetric(budget.Metric)
+		if budgetMetric == "" {
+			budgetMetric = "UnblendedCost"
+		}
+		if budgetMetric != metric {
+			continue
+		}
+		result.Budgets = append(result.Budgets, report.BudgetLine{
+			Name:     budget.Name,
+			Amount:   round2(budget.Amount * monthRate),
+			Actual:   result.Total,
+			Forecast: monthEnd,
+		})
+	}
+
+	return result, nil
+}
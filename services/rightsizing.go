@@ -0,0 +1,232 @@
+package services
+
+import (
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+)
+
+type (
+	// RightsizingInstance EC2 instance details and utilization
+	RightsizingInstance struct {
+		InstanceType       string  `json:"instance_type"`
+		Region             string  `json:"region"`
+		Platform           string  `json:"platform"`
+		Vcpu               string  `json:"vcpu"`
+		Memory             string  `json:"memory"`
+		Storage            string  `json:"storage"`
+		NetworkPerformance string  `json:"network_performance"`
+		HourlyRate         float64 `json:"hourly_rate"`
+		MonthlyCost        float64 `json:"monthly_cost"`
+		MaxCPU             float64 `json:"max_cpu"`     // percent
+		MaxMemory          float64 `json:"max_memory"`  // percent, CloudWatch agent шаардлагатай
+		MaxStorage         float64 `json:"max_storage"` // percent
+	}
+
+	// RightsizingTarget instance recommended instead of the current one
+	RightsizingTarget struct {
+		RightsizingInstance
+		EstimatedMonthlySavings float64 `json:"estimated_monthly_savings"`
+		IsDefault               bool    `json:"is_default"`
+	}
+
+	// RightsizingItem recommendation of one instance
+	RightsizingItem struct {
+		AccountID               string              `json:"account_id"`
+		ResourceID              string              `json:"resource_id"`
+		InstanceName            string              `json:"instance_name"`
+		Type                    string              `json:"type"` // TERMINATE, MODIFY
+		RunningHours            float64             `json:"running_hours"`
+		Current                 RightsizingInstance `json:"current"`
+		Recommended             *RightsizingTarget  `json:"recommended"` // nil for TERMINATE
+		Options                 []RightsizingTarget `json:"options"`
+		EstimatedMonthlySavings float64             `json:"estimated_monthly_savings"`
+		Currency                string              `json:"currency"`
+	}
+
+	// RightsizingAccount potential savings of one linked account
+	RightsizingAccount struct {
+		AccountID               string  `json:"account_id"`
+		Count                   int     `json:"count"`
+		TerminateCount          int     `json:"terminate_count"`
+		ModifyCount             int     `json:"modify_count"`
+		CurrentMonthlyCost      float64 `json:"current_monthly_cost"`
+		EstimatedMonthlySavings float64 `json:"estimated_monthly_savings"`
+	}
+
+	// RightsizingReport ...
+	RightsizingReport struct {
+		RecommendationID    string               `json:"recommendation_id"`
+		GenerationDate      string               `json:"generation_date"`
+		LookbackPeriod      string               `json:"lookback_period"`
+		Target              string               `json:"target"`
+		BenefitsConsidered  bool                 `json:"benefits_considered"`
+		Currency            string               `json:"currency"`
+		TotalMonthlySavings float64              `json:"total_monthly_savings"`
+		SavingsPercentage   float64              `json:"savings_percentage"`
+		Count               int                  `json:"count"`
+		Accounts            []RightsizingAccount `json:"accounts"`
+		Recommendations     []RightsizingItem    `json:"recommendations"`
+	}
+)
+
+func rightsizingInstance(details *costexplorer.ResourceDetails, utilization *costexplorer.ResourceUtilization) RightsizingInstance {
+	instance := RightsizingInstance{}
+	if details != nil && details.EC2ResourceDetails != nil {
+		ec2 := details.EC2ResourceDetails
+		instance.InstanceType = aws.StringValue(ec2.InstanceType)
+		instance.Region = aws.StringValue(ec2.Region)
+		instance.Platform = aws.StringValue(ec2.Platform)
+		instance.Vcpu = aws.StringValue(ec2.Vcpu)
+		instance.Memory = aws.StringValue(ec2.Memory)
+		instance.Storage = aws.StringValue(ec2.Storage)
+		instance.NetworkPerformance = aws.StringValue(ec2.NetworkPerformance)
+		instance.HourlyRate = ParseAmount(ec2.HourlyOnDemandRate)
+	}
+	if utilization != nil && utilization.EC2ResourceUtilization != nil {
+		ec2 := utilization.EC2ResourceUtilization
+		instance.MaxCPU = ParseAmount(ec2.MaxCpuUtilizationPercentage)
+		instance.MaxMemory = ParseAmount(ec2.MaxMemoryUtilizationPercentage)
+		instance.MaxStorage = ParseAmount(ec2.MaxStorageUtilizationPercentage)
+	}
+	return instance
+}
+
+func rightsizingItem(recommendation *costexplorer.RightsizingRecommendation) RightsizingItem {
+	item := RightsizingItem{
+		AccountID: aws.StringValue(recommendation.AccountId),
+		Type:      aws.StringValue(recommendation.RightsizingType),
+		Options:   []RightsizingTarget{},
+	}
+	if current := recommendation.CurrentInstance; current != nil {
+		item.ResourceID = aws.StringValue(current.ResourceId)
+		item.InstanceName = aws.StringValue(current.InstanceName)
+		item.RunningHours = ParseAmount(current.TotalRunningHoursInLookbackPeriod)
+		item.Currency = aws.StringValue(current.CurrencyCode)
+		item.Current = rightsizingInstance(current.ResourceDetails, current.ResourceUtilization)
+		item.Current.MonthlyCost = ParseAmount(current.MonthlyCost)
+	}
+
+	if detail := recommendation.TerminateRecommendationDetail; detail != nil {
+		item.EstimatedMonthlySavings = ParseAmount(detail.EstimatedMonthlySavings)
+	}
+	if detail := recommendation.ModifyRecommendationDetail; detail != nil {
+		for _, target := range detail.TargetInstances {
+			option := RightsizingTarget{
+				RightsizingInstance:     rightsizingInstance(target.ResourceDetails, target.ExpectedResourceUtilization),
+				EstimatedMonthlySavings: ParseAmount(target.EstimatedMonthlySavings),
+				IsDefault:               aws.BoolValue(target.DefaultTargetInstance),
+			}
+			option.MonthlyCost = ParseAmount(target.EstimatedMonthlyCost)
+			item.Options = append(item.Options, option)
+		}
+		for i := range item.Options {
+			if item.Recommended == nil || item.Options[i].IsDefault {
+				item.Recommended = &item.Options[i]
+			}
+		}
+		if item.Recommended != nil {
+			item.EstimatedMonthlySavings = item.Recommended.EstimatedMonthlySavings
+		}
+	}
+	return item
+}
+
+// Rightsizing EC2 rightsizing recommendations with savings per account
+func Rightsizing(svc costexploreriface.CostExplorerAPI, params form.CostExplorerRightsizingParams) (*RightsizingReport, error) {
+	target := costexplorer.RecommendationTargetSameInstanceFamily
+	if params.CrossInstanceFamily {
+		target = costexplorer.RecommendationTargetCrossInstanceFamily
+	}
+	benefits := true
+	if params.BenefitsConsidered != nil {
+		benefits = *params.BenefitsConsidered
+	}
+
+	var types []*string
+	switch params.Type {
+	case "":
+	case costexplorer.RightsizingTypeTerminate, costexplorer.RightsizingTypeModify:
+		types = []*string{aws.String(params.Type)}
+	default:
+		return nil, NewParamError("type", "must be TERMINATE or MODIFY")
+	}
+
+	input := &costexplorer.GetRightsizingRecommendationInput{
+		Service: aws.String("AmazonEC2"),
+		Configuration: &costexplorer.RightsizingRecommendationConfiguration{
+			RecommendationTarget: aws.String(target),
+			BenefitsConsidered:   aws.Bool(benefits),
+		},
+		Filter: commitmentFilter(map[string][]*string{
+			costexplorer.DimensionRightsizingType: types,
+			costexplorer.DimensionLinkedAccount:   params.LinkedAccounts,
+			costexplorer.DimensionRegion:          params.Regions,
+		}),
+	}
+
+	report := &RightsizingReport{
+		Target:             target,
+		BenefitsConsidered: benefits,
+		Accounts:           []RightsizingAccount{},
+		Recommendations:    []RightsizingItem{},
+	}
+	accounts := map[string]*RightsizingAccount{}
+	var currentCost float64
+	for {
+		output, err := svc.GetRightsizingRecommendation(input)
+		if err != nil {
+			return nil, err
+		}
+		if metadata := output.Metadata; metadata != nil {
+			report.RecommendationID = aws.StringValue(metadata.RecommendationId)
+			report.GenerationDate = aws.StringValue(metadata.GenerationTimestamp)
+			report.LookbackPeriod = aws.StringValue(metadata.LookbackPeriodInDays)
+		}
+		if summary := output.Summary; summary != nil && report.Currency == "" {
+			report.Currency = aws.StringValue(summary.SavingsCurrencyCode)
+		}
+
+		for _, recommendation := range output.RightsizingRecommendations {
+			item := rightsizingItem(recommendation)
+			report.Recommendations = append(report.Recommendations, item)
+			report.TotalMonthlySavings += item.EstimatedMonthlySavings
+			currentCost += item.Current.MonthlyCost
+
+			account, ok := accounts[item.AccountID]
+			if !ok {
+				account = &RightsizingAccount{AccountID: item.AccountID}
+				accounts[item.AccountID] = account
+			}
+			account.Count++
+			if item.Type == costexplorer.RightsizingTypeTerminate {
+				account.TerminateCount++
+			} else {
+				account.ModifyCount++
+			}
+			account.CurrentMonthlyCost += item.Current.MonthlyCost
+			account.EstimatedMonthlySavings += item.EstimatedMonthlySavings
+		}
+
+		if aws.StringValue(output.NextPageToken) == "" {
+			break
+		}
+		input.NextPageToken = output.NextPageToken
+	}
+
+	report.Count = len(report.Recommendations)
+	report.SavingsPercentage = percentage(report.TotalMonthlySavings, currentCost)
+	for _, account := range accounts {
+		report.Accounts = append(report.Accounts, *account)
+	}
+	sort.Slice(report.Accounts, func(i, j int) bool {
+		return report.Accounts[i].EstimatedMonthlySavings > report.Accounts[j].EstimatedMonthlySavings
+	})
+	sort.SliceStable(report.Recommendations, func(i, j int) bool {
+		return report.Recommendations[i].EstimatedMonthlySavings > report.Recommendations[j].EstimatedMonthlySavings
+	})
+	return report, nil
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awsCredentials "github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	gorm "gorm.io/gorm"
+)
+
+// ErrNoCredentials user has no AWS credentials
+var ErrNoCredentials = errors.New("You don't have a permission to access AWS")
+
+// Session AWS session of user's credentials, Cost Explorer requests are
+// limited by the quota
+func Session(db *gorm.DB, userID uint) (*session.Session, error) {
+	return newSession(db, userID, false)
+}
+
+// JobSession session of background jobs, Cost Explorer requests are counted
+// as job requests and not limited
+func JobSession(db *gorm.DB, userID uint) (*session.Session, error) {
+	return newSession(db, userID, true)
+}
+
+func newSession(db *gorm.DB, userID uint, job bool) (*session.Session, error) {
+	var user databases.SystemUser
+
+	result := db.Preload("AwsCredentials").First(&user, userID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if user.AwsCredentials == nil || user.AwsCredentials.Base.ID == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(user.AwsRegion), //"us-east-1"
+		Credentials: awsCredentials.NewStaticCredentials(user.AwsCredentials.AccessKey, user.AwsCredentials.SecretKey, ""),
+	})
+	if err != nil {
+		return nil, err
+	}
+	meterCostExplorer(db, user, sess, job)
+	return sess, nil
+}
@@ -0,0 +1,588 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/mail"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+	gorm "gorm.io/gorm"
+)
+
+// ssoLoginTTL time to finish login at the identity provider
+const ssoLoginTTL = 10 * time.Minute
+
+// oidcCacheTTL discovery documents and signing keys are refetched after it
+const oidcCacheTTL = time.Hour
+
+// SSO errors, returned to the user as is
+var (
+	ErrSSONotConfigured = errors.New("Single sign-on is not configured for this company")
+	ErrSSOState         = errors.New("Login has expired or was already used, start again")
+	ErrSSODomain        = errors.New("Email domain is not allowed for this company")
+	ErrSSOOtherCompany  = errors.New("Account belongs to another company")
+	ErrSSOInactive      = errors.New("Account is not active")
+	ErrSSOLinkRequired  = errors.New("Account with this email exists, sign in with password and link single sign-on from your account")
+	ErrSSOLinked        = errors.New("Identity is already linked to another account")
+)
+
+// SSOResult user of finished login, provisioned when created on this login
+// and linked when signed in account was linked to the identity
+type SSOResult struct {
+	User        databases.SystemUser
+	Provisioned bool
+	Linked      bool
+}
+
+// oidcConfig discovery document fields in use
+type oidcConfig struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// jwk RSA signing key of JWKS
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type (
+	cachedConfig struct {
+		config  oidcConfig
+		fetched time.Time
+	}
+	cachedKeys struct {
+		keys    map[string]*rsa.PublicKey
+		fetched time.Time
+	}
+)
+
+var (
+	oidcMu      sync.Mutex
+	oidcConfigs = map[string]cachedConfig{}
+	oidcKeys    = map[string]cachedKeys{}
+	// provider endpoints are set by company admins, internal hosts are refused
+	oidcClient = utils.PublicClientOf("sso", 10*time.Second)
+)
+
+// getJSON GET url into value, non 2xx is error
+func getJSON(target string, value interface{}) error {
+	res, err := oidcClient.Get(target)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%v responded %v", target, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(value)
+}
+
+// discover OpenID configuration of issuer, cached
+func discover(issuer string) (oidcConfig, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	oidcMu.Lock()
+	cached, ok := oidcConfigs[issuer]
+	oidcMu.Unlock()
+	if ok && time.Since(cached.fetched) < oidcCacheTTL {
+		return cached.config, nil
+	}
+
+	var config oidcConfig
+	if err := utils.PublicURLOf("sso", issuer); err != nil {
+		return config, fmt.Errorf("issuer: %v", err)
+	}
+	if err := getJSON(issuer+"/.well-known/openid-configuration", &config); err != nil {
+		return config, err
+	}
+	if strings.TrimSuffix(config.Issuer, "/") != issuer {
+		return config, fmt.Errorf("discovery issuer %v does not match %v", config.Issuer, issuer)
+	}
+	if config.AuthorizationEndpoint == "" || config.TokenEndpoint == "" || config.JwksURI == "" {
+		return config, errors.New("discovery document is missing endpoints")
+	}
+	for _, endpoint := range []string{config.TokenEndpoint, config.JwksURI} {
+		if err := utils.PublicURLOf("sso", endpoint); err != nil {
+			return config, fmt.Errorf("%v: %v", endpoint, err)
+		}
+	}
+
+	oidcMu.Lock()
+	oidcConfigs[issuer] = cachedConfig{config: config, fetched: time.Now()}
+	oidcMu.Unlock()
+	return config, nil
+}
+
+// signingKey RSA key of kid, keys are refetched for unknown kid after key rotation
+func signingKey(jwksURI, kid string) (*rsa.PublicKey, error) {
+	oidcMu.Lock()
+	cached, ok := oidcKeys[jwksURI]
+	oidcMu.Unlock()
+	if ok && time.Since(cached.fetched) < oidcCacheTTL {
+		if key, found := cached.keys[kid]; found {
+			return key, nil
+		}
+		if time.Since(cached.fetched) < time.Minute {
+			return nil, fmt.Errorf("unknown signing key %v", kid)
+		}
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(jwksURI, &set); err != nil {
+		return nil, err
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, item := range set.Keys {
+		if item.Kty != "RSA" || (item.Use != "" && item.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(item.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(item.E)
+		if err != nil {
+			continue
+		}
+		keys[item.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	oidcMu.Lock()
+	oidcKeys[jwksURI] = cachedKeys{keys: keys, fetched: time.Now()}
+	oidcMu.Unlock()
+	if key, found := keys[kid]; found {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %v", kid)
+}
+
+// randomString base64url of n random bytes
+func randomString(n int) (string, error) {
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// emailDomain lower case domain of email
+func emailDomain(email string) string {
+	if i := strings.LastIndex(email, "@"); i >= 0 {
+		return strings.ToLower(email[i+1:])
+	}
+	return ""
+}
+
+// domainAllowed email domain is exactly one of the allowlist, empty
+// allowlist allows nothing
+func domainAllowed(provider databases.SSOProvider, email string) bool {
+	domain := emailDomain(email)
+	if domain == "" {
+		return false
+	}
+	for _, item := range splitValues(provider.AllowedDomains) {
+		if strings.EqualFold(item, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// SSOProviderFromParams ...
+func SSOProviderFromParams(provider *databases.SSOProvider, params form.SSOProviderParams) error {
+	// sso.allow_http and sso.allow_private allow a local provider in development
+	if err := utils.PublicURLOf("sso", params.Issuer); err != nil {
+		return NewParamError("issuer", err.Error())
+	}
+	if params.DefaultRole == "" {
+		params.DefaultRole = databases.RoleMember
+	}
+	if err := ValidateRole(params.DefaultRole); err != nil {
+		return NewParamError("default_role", err.(*ParamError).Message)
+	}
+
+	domains := make([]string, 0, len(params.AllowedDomains))
+	for _, domain := range params.AllowedDomains {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		if domain == "" || strings.ContainsAny(domain, "@/ ") {
+			return NewParamError("allowed_domains", "invalid domain "+domain)
+		}
+		domains = append(domains, domain)
+	}
+	// the provider asserts emails of these domains only
+	if len(domains) == 0 {
+		return NewParamError("allowed_domains", "is required")
+	}
+
+	provider.Issuer = strings.TrimSuffix(params.Issuer, "/")
+	provider.ClientID = params.ClientID
+	if params.ClientSecret != "" {
+		provider.ClientSecret = params.ClientSecret
+	}
+	provider.AllowedDomains = strings.Join(domains, ",")
+	provider.DefaultRole = params.DefaultRole
+	provider.IsActive = params.IsActive
+	return nil
+}
+
+// FindSSOProvider active provider of the company, or of the email domain
+func FindSSOProvider(db *gorm.DB, params form.SSOStartParams) (*databases.SSOProvider, error) {
+	var providers []databases.SSOProvider
+	query := db.Where("is_active = ?", true)
+	if params.CompanyID != 0 {
+		query = query.Where("company_id = ?", params.CompanyID)
+	} else if domain := emailDomain(params.Email); domain != "" {
+		// whole domain of the comma separated list, checked exactly below
+		query = query.Where("',' || allowed_domains || ',' LIKE ?", "%,"+domain+",%")
+	} else {
+		return nil, NewParamError("email", "email or company_id is required")
+	}
+	if result := query.Find(&providers); result.Error != nil {
+		return nil, result.Error
+	}
+	for _, provider := range providers {
+		if params.CompanyID != 0 || domainAllowed(provider, params.Email) {
+			return &provider, nil
+		}
+	}
+	return nil, ErrSSONotConfigured
+}
+
+// StartSSO authorization URL with state, nonce and S256 code challenge. The
+// verifier stays on the server until the callback. linkUserID is the signed
+// in user linking the identity, 0 on login.
+func StartSSO(db *gorm.DB, provider databases.SSOProvider, params form.SSOStartParams, linkUserID uint) (string, error) {
+	redirect, err := url.Parse(params.RedirectURI)
+	if err != nil || redirect.Host == "" || (redirect.Scheme != "https" && redirect.Scheme != "http") {
+		return "", NewParamError("redirect_uri", "must be http or https url")
+	}
+	config, err := discover(provider.Issuer)
+	if err != nil {
+		return "", err
+	}
+
+	login := databases.SSOLogin{
+		Base:        databases.Base{CreatedDate: time.Now(), ModifiedDate: time.Now()},
+		ProviderID:  provider.ID,
+		RedirectURI: params.RedirectURI,
+		ExpiresDate: time.Now().Add(ssoLoginTTL),
+		LinkUserID:  linkUserID,
+	}
+	if login.State, err = randomString(24); err != nil {
+		return "", err
+	}
+	if login.Nonce, err = randomString(24); err != nil {
+		return "", err
+	}
+	if login.CodeVerifier, err = randomString(32); err != nil {
+		return "", err
+	}
+	if result := db.Create(&login); result.Error != nil {
+		return "", result.Error
+	}
+
+	challenge := sha256.Sum256([]byte(login.CodeVerifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {provider.ClientID},
+		"redirect_uri":          {params.RedirectURI},
+		"scope":                 {"openid email profile"},
+		"state":                 {login.State},
+		"nonce":                 {login.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	if params.Email != "" {
+		query.Set("login_hint", params.Email)
+	}
+
+	separator := "?"
+	if strings.Contains(config.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return config.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// exchangeCode id_token of authorization code
+func exchangeCode(config oidcConfig, provider databases.SSOProvider, login databases.SSOLogin, code string) (string, error) {
+	values := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {login.RedirectURI},
+		"client_id":     {provider.ClientID},
+		"code_verifier": {login.CodeVerifier},
+	}
+	if provider.ClientSecret != "" {
+		values.Set("client_secret", provider.ClientSecret)
+	}
+
+	res, err := oidcClient.PostForm(config.TokenEndpoint, values)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("token endpoint responded %v", res.Status)
+	}
+	if token.Error != "" {
+		return "", fmt.Errorf("token endpoint: %v %v", token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("token endpoint returned no id_token")
+	}
+	return token.IDToken, nil
+}
+
+// verifyIDToken signature, issuer, audience, expiry and nonce of id_token
+func verifyIDToken(config oidcConfig, provider databases.SSOProvider, login databases.SSOLogin, idToken string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return signingKey(config.JwksURI, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %v", err)
+	}
+
+	if issuer, _ := claims["iss"].(string); strings.TrimSuffix(issuer, "/") != strings.TrimSuffix(config.Issuer, "/") {
+		return nil, errors.New("invalid id_token issuer")
+	}
+	audience := false
+	switch aud := claims["aud"].(type) {
+	case string:
+		audience = aud == provider.ClientID
+	case []interface{}:
+		for _, item := range aud {
+			if item == provider.ClientID {
+				audience = true
+			}
+		}
+	}
+	if !audience {
+		return nil, errors.New("invalid id_token audience")
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("id_token has no expiry")
+	}
+	if nonce, _ := claims["nonce"].(string); nonce != login.Nonce {
+		return nil, errors.New("invalid id_token nonce")
+	}
+	return claims, nil
+}
+
+// identityEmail email of the claims, identity provider has to mark it
+// verified
+func identityEmail(claims jwt.MapClaims) (string, error) {
+	if verified, _ := claims["email_verified"].(bool); !verified {
+		return "", errors.New("email is not verified by the identity provider")
+	}
+	email, _ := claims["email"].(string)
+	address, err := mail.ParseAddress(email)
+	if err != nil {
+		return "", errors.New("identity provider returned no email")
+	}
+	return strings.ToLower(address.Address), nil
+}
+
+// FinishSSO verifies callback of started login and returns its user. On login
+// a new user is created in the company with the provider's default role,
+// existing accounts are never linked by email, locked out accounts get
+// LoginBlockedError. linkUserID links the identity to the signed in user who
+// started the login.
+func FinishSSO(db *gorm.DB, params form.SSOCallbackParams, linkUserID uint) (*SSOResult, error) {
+	var login databases.SSOLogin
+	if result := db.Where("state = ?", params.State).Limit(1).Find(&login); result.Error != nil {
+		return nil, result.Error
+	}
+	if login.ID == 0 || login.IsUsed || time.Now().After(login.ExpiresDate) || login.LinkUserID != linkUserID {
+		return nil, ErrSSOState
+	}
+	// state is single use even when concurrent callbacks race
+	result := db.Model(&databases.SSOLogin{}).Where("id = ? AND is_used = ?", login.ID, false).Updates(map[string]interface{}{"is_used": true, "modified_date": time.Now()})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrSSOState
+	}
+
+	var provider databases.SSOProvider
+	if result := db.Where("is_active = ?", true).Limit(1).Find(&provider, login.ProviderID); result.Error != nil || result.RowsAffected == 0 {
+		return nil, ErrSSONotConfigured
+	}
+	config, err := discover(provider.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := exchangeCode(config, provider, login, params.Code)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := verifyIDToken(config, provider, login, idToken)
+	if err != nil {
+		return nil, err
+	}
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, errors.New("id_token has no subject")
+	}
+	email, err := identityEmail(claims)
+	if err != nil {
+		return nil, err
+	}
+	if !domainAllowed(provider, email) {
+		return nil, ErrSSODomain
+	}
+
+	if linkUserID != 0 {
+		return linkSSO(db, provider, linkUserID, subject, email)
+	}
+	sso, err := ssoUser(db, provider, subject, email)
+	if err != nil {
+		return nil, err
+	}
+	// lockout after failed password logins applies to single sign-on too
+	if err := LoginLocked(db, sso.User.Email); err != nil {
+		return nil, err
+	}
+	return sso, nil
+}
+
+// ssoUser user of the identity, provisioned on first login when no account
+// has the email
+func ssoUser(db *gorm.DB, provider databases.SSOProvider, subject, email string) (*SSOResult, error) {
+	sso := &SSOResult{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var identity databases.SSOIdentity
+		if result := tx.Where("provider_id = ? AND subject = ?", provider.ID, subject).Limit(1).Find(&identity); result.Error != nil {
+			return result.Error
+		}
+		if identity.ID != 0 {
+			if result := tx.Limit(1).Find(&sso.User, identity.UserID); result.Error != nil || result.RowsAffected == 0 {
+				return ErrSSOInactive
+			}
+		} else {
+			var count int64
+			if result := tx.Model(&databases.SystemUser{}).Where("LOWER(email) = ?", email).Count(&count); result.Error != nil {
+				return result.Error
+			}
+			// the provider is configured by the company admin, its assertion
+			// alone does not prove ownership of an existing account
+			if count != 0 {
+				return ErrSSOLinkRequired
+			}
+
+			now := time.Now()
+			sso.User = databases.SystemUser{
+				Base:      databases.Base{CreatedDate: now, ModifiedDate: now},
+				IsActive:  true,
+				Email:     email,
+				CompanyID: provider.CompanyID,
+				Role:      provider.DefaultRole,
+			}
+			if result := tx.Create(&sso.User); result.Error != nil {
+				return result.Error
+			}
+			sso.Provisioned = true
+
+			identity = databases.SSOIdentity{
+				Base:       databases.Base{CreatedDate: now, ModifiedDate: now},
+				UserID:     sso.User.ID,
+				ProviderID: provider.ID,
+				Subject:    subject,
+				Email:      email,
+			}
+			if result := tx.Create(&identity); result.Error != nil {
+				return result.Error
+			}
+		}
+
+		if !sso.User.IsActive {
+			return ErrSSOInactive
+		}
+		if sso.User.CompanyID != provider.CompanyID {
+			return ErrSSOOtherCompany
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sso, nil
+}
+
+// linkSSO links the identity to the signed in user of the provider's company
+func linkSSO(db *gorm.DB, provider databases.SSOProvider, userID uint, subject, email string) (*SSOResult, error) {
+	sso := &SSOResult{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Limit(1).Find(&sso.User, userID); result.Error != nil || result.RowsAffected == 0 || !sso.User.IsActive {
+			return ErrSSOInactive
+		}
+		if sso.User.CompanyID == 0 || sso.User.CompanyID != provider.CompanyID {
+			return ErrSSOOtherCompany
+		}
+
+		var identity databases.SSOIdentity
+		if result := tx.Where("provider_id = ? AND subject = ?", provider.ID, subject).Limit(1).Find(&identity); result.Error != nil {
+			return result.Error
+		}
+		if identity.ID != 0 {
+			if identity.UserID != userID {
+				return ErrSSOLinked
+			}
+			return nil
+		}
+
+		now := time.Now()
+		identity = databases.SSOIdentity{
+			Base:       databases.Base{CreatedDate: now, ModifiedDate: now},
+			UserID:     userID,
+			ProviderID: provider.ID,
+			Subject:    subject,
+			Email:      email,
+		}
+		if result := tx.Create(&identity); result.Error != nil {
+			return result.Error
+		}
+		sso.Linked = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sso, nil
+}
@@ -0,0 +1,426 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	viper "github.com/spf13/viper"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	gorm "gorm.io/gorm"
+)
+
+const (
+	stubClientID = "billing"
+	stubRedirect = "https://billing.example.com/auth/sso/callback"
+)
+
+// stubIdP OpenID provider issuing RS256 id_tokens for authorized codes
+type stubIdP struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]stubCode
+}
+
+// stubCode authorization of one code
+type stubCode struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &stubIdP{key: key, codes: map[string]stubCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcConfig{
+			Issuer:                idp.URL,
+			AuthorizationEndpoint: idp.URL + "/authorize",
+			TokenEndpoint:         idp.URL + "/token",
+			JwksURI:               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string][]jwk{"keys": {{
+			Kid: "stub",
+			Kty: "RSA",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		idp.mu.Lock()
+		code, ok := idp.codes[r.Form.Get("code")]
+		delete(idp.codes, r.Form.Get("code"))
+		idp.mu.Unlock()
+
+		verifier := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != code.challenge || r.Form.Get("client_id") != stubClientID {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, code.claims)
+		token.Header["kid"] = "stub"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	allowLocalSSO(t)
+	return idp
+}
+
+// allowLocalSSO lets the http loopback stub pass the public url checks
+func allowLocalSSO(t *testing.T) {
+	viper.Set("sso.allow_http", true)
+	viper.Set("sso.allow_private", true)
+	t.Cleanup(func() {
+		viper.Set("sso.allow_http", false)
+		viper.Set("sso.allow_private", false)
+	})
+}
+
+// authorize signs the user in at the provider and returns callback params,
+// claims override the defaults of a verified acme.mn user
+func (idp *stubIdP) authorize(t *testing.T, authorizationURL string, claims jwt.MapClaims) form.SSOCallbackParams {
+	t.Helper()
+	target, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := target.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != stubClientID {
+		t.Fatalf("unexpected authorization request %v", authorizationURL)
+	}
+
+	token := jwt.MapClaims{
+		"iss":            idp.URL,
+		"aud":            stubClientID,
+		"sub":            "subject-1",
+		"email":          "bat@acme.mn",
+		"email_verified": true,
+		"nonce":          query.Get("nonce"),
+		"exp":            time.Now().Add(time.Minute).Unix(),
+	}
+	for name, value := range claims {
+		if value == nil {
+			delete(token, name)
+			continue
+		}
+		token[name] = value
+	}
+
+	code, _ := randomString(16)
+	idp.mu.Lock()
+	idp.codes[code] = stubCode{challenge: query.Get("code_challenge"), claims: token}
+	idp.mu.Unlock()
+	return form.SSOCallbackParams{State: query.Get("state"), Code: code}
+}
+
+// ssoFixture database with company 1 provider of the stub
+func ssoFixture(t *testing.T) (*gorm.DB, *stubIdP, databases.SSOProvider) {
+	db := testDB(t, &databases.SystemUser{}, &databases.SSOProvider{}, &databases.SSOIdentity{}, &databases.SSOLogin{}, &databases.LoginThrottle{})
+	idp := newStubIdP(t)
+	provider := databases.SSOProvider{
+		CompanyID:      1,
+		Issuer:         idp.URL,
+		ClientID:       stubClientID,
+		ClientSecret:   "secret",
+		AllowedDomains: "acme.mn",
+		DefaultRole:    databases.RoleMember,
+		IsActive:       true,
+	}
+	if err := db.Create(&provider).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, idp, provider
+}
+
+// ssoLogin starts login or linking and finishes it at the stub
+func ssoLogin(t *testing.T, db *gorm.DB, idp *stubIdP, provider databases.SSOProvider, linkUserID uint, claims jwt.MapClaims) (*SSOResult, error) {
+	t.Helper()
+	authorizationURL, err := StartSSO(db, provider, form.SSOStartParams{RedirectURI: stubRedirect}, linkUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return FinishSSO(db, idp.authorize(t, authorizationURL, claims), linkUserID)
+}
+
+func TestFinishSSOProvisionsNewUser(t *testing.T) {
+	db, idp, provider := ssoFixture(t)
+
+	sso, err := ssoLogin(t, db, idp, provider, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sso.Provisioned || sso.User.Email != "bat@acme.mn" || sso.User.CompanyID != 1 || sso.User.Role != databases.RoleMember {
+		t.Fatalf("unexpected result %+v", sso)
+	}
+
+	// second login finds the identity
+	again, err := ssoLogin(t, db, idp, provider, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Provisioned || again.User.ID != sso.User.ID {
+		t.Fatalf("unexpected second login %+v", again)
+	}
+}
+
+func TestFinishSSOLockedAccount(t *testing.T) {
+	db, idp, provider := ssoFixture(t)
+	if _, err := ssoLogin(t, db, idp, provider, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	until := time.Now().Add(time.Minute)
+	db.Create(&databases.LoginThrottle{Key: "email:bat@acme.mn", Failures: 5, LockedUntil: &until})
+	if _, err := ssoLogin(t, db, idp, provider, 0, nil); err == nil {
+		t.Fatal("expected locked account to be refused")
+	} else if blocked, ok := err.(*LoginBlockedError); !ok || !blocked.Locked {
+		t.Fatalf("expected lockout, got %v", err)
+	}
+
+	if err := UnlockLogin(db, "bat@acme.mn"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ssoLogin(t, db, idp, provider, 0, nil); err != nil {
+		t.Fatalf("expected unlocked login, got %v", err)
+	}
+}
+
+func TestFinishSSODoesNotTakeOverExistingAccount(t *testing.T) {
+	db, idp, provider := ssoFixture(t)
+	owner := databases.SystemUser{Email: "bat@acme.mn", IsActive: true, Password: "hash"}
+	db.Create(&owner)
+
+	for _, email := range []string{"bat@acme.mn", "BAT@acme.mn"} {
+		if _, err := ssoLogin(t, db, idp, provider, 0, jwt.MapClaims{"email": email}); err != ErrSSOLinkRequired {
+			t.Fatalf("%v: expected link required, got %v", email, err)
+		}
+	}
+
+	var user databases.SystemUser
+	db.First(&user, owner.ID)
+	var identities int64
+	db.Model(&databases.SSOIdentity{}).Count(&identities)
+	if user.CompanyID != 0 || identities != 0 {
+		t.Fatalf("account was changed: company %v, identities %v", user.CompanyID, identities)
+	}
+}
+
+func TestFinishSSORejectsClaims(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+	}{
+		{"email_verified missing", jwt.MapClaims{"email_verified": nil}},
+		{"email not verified", jwt.MapClaims{"email_verified": false}},
+		{"preferred_username only", jwt.MapClaims{"email": nil, "preferred_username": "bat@acme.mn"}},
+		{"other domain", jwt.MapClaims{"email": "bat@evil.mn"}},
+		{"sub domain", jwt.MapClaims{"email": "bat@evil.acme.mn"}},
+		{"wrong nonce", jwt.MapClaims{"nonce": "other"}},
+		{"wrong audience", jwt.MapClaims{"aud": "other"}},
+		{"wrong issuer", jwt.MapClaims{"iss": "https://evil.example.com"}},
+		{"expired", jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}},
+		{"no subject", jwt.MapClaims{"sub": nil}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, idp, provider := ssoFixture(t)
+			if sso, err := ssoLogin(t, db, idp, provider, 0, test.claims); err == nil {
+				t.Fatalf("expected error, got %+v", sso)
+			}
+			var users int64
+			db.Model(&databases.SystemUser{}).Count(&users)
+			if users != 0 {
+				t.Fatal("user was provisioned")
+			}
+		})
+	}
+}
+
+func TestFinishSSOStateAndVerifier(t *testing.T) {
+	db, idp, provider := ssoFixture(t)
+
+	authorizationURL, err := StartSSO(db, provider, form.SSOStartParams{RedirectURI: stubRedirect}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := idp.authorize(t, authorizationURL, nil)
+
+	// verifier stored with the login is replaced
+	db.Model(&databases.SSOLogin{}).Where("state = ?", params.State).Update("code_verifier", "other")
+	if _, err := FinishSSO(db, params, 0); err == nil {
+		t.Fatal("expected invalid_grant for wrong verifier")
+	}
+	// state is used even when the exchange failed
+	if _, err := FinishSSO(db, params, 0); err != ErrSSOState {
+		t.Fatalf("expected used state, got %v", err)
+	}
+	if _, err := FinishSSO(db, form.SSOCallbackParams{State: "unknown", Code: "code"}, 0); err != ErrSSOState {
+		t.Fatalf("expected unknown state, got %v", err)
+	}
+}
+
+func TestFinishSSOLinksSignedInUser(t *testing.T) {
+	db, idp, provider := ssoFixture(t)
+	owner := databases.SystemUser{Email: "bat@acme.mn", IsActive: true, CompanyID: 1}
+	other := databases.SystemUser{Email: "dorj@other.mn", IsActive: true, CompanyID: 2}
+	db.Create(&owner)
+	db.Create(&other)
+
+	// login started by the user can not be finished as login or by another user
+	authorizationURL, _ := StartSSO(db, provider, form.SSOStartParams{RedirectURI: stubRedirect}, owner.ID)
+	if _, err := FinishSSO(db, idp.authorize(t, authorizationURL, nil), 0); err != ErrSSOState {
+		t.Fatalf("expected state error for login callback, got %v", err)
+	}
+	authorizationURL, _ = StartSSO(db, provider, form.SSOStartParams{RedirectURI: stubRedirect}, owner.ID)
+	if _, err := FinishSSO(db, idp.authorize(t, authorizationURL, nil), other.ID); err != ErrSSOState {
+		t.Fatalf("expected state error for other user, got %v", err)
+	}
+
+	if _, err := ssoLogin(t, db, idp, provider, other.ID, nil); err != ErrSSOOtherCompany {
+		t.Fatalf("expected other company, got %v", err)
+	}
+
+	sso, err := ssoLogin(t, db, idp, provider, owner.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sso.Linked || sso.User.ID != owner.ID {
+		t.Fatalf("unexpected link %+v", sso)
+	}
+
+	login, err := ssoLogin(t, db, idp, provider, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login.User.ID != owner.ID || login.Provisioned {
+		t.Fatalf("unexpected login after link %+v", login)
+	}
+
+	// identity of the owner can not be linked to another company user
+	colleague := databases.SystemUser{Email: "tuya@acme.mn", IsActive: true, CompanyID: 1}
+	db.Create(&colleague)
+	if _, err := ssoLogin(t, db, idp, provider, colleague.ID, nil); err != ErrSSOLinked {
+		t.Fatalf("expected linked identity, got %v", err)
+	}
+}
+
+func TestSSOProviderDomains(t *testing.T) {
+	var provider databases.SSOProvider
+	params := form.SSOProviderParams{Issuer: "https://8.8.8.8", ClientID: stubClientID}
+	if err := SSOProviderFromParams(&provider, params); err == nil {
+		t.Fatal("expected allowed_domains to be required")
+	}
+	params.AllowedDomains = []string{"@Acme.mn", "acme.com"}
+	if err := SSOProviderFromParams(&provider, params); err != nil || provider.AllowedDomains != "acme.mn,acme.com" {
+		t.Fatalf("unexpected domains %v %v", provider.AllowedDomains, err)
+	}
+
+	tests := []struct {
+		email   string
+		allowed bool
+	}{
+		{"bat@acme.mn", true},
+		{"bat@ACME.com", true},
+		{"bat@evil.acme.mn", false},
+		{"bat@cme.mn", false},
+		{"bat@acme.mn.evil.com", false},
+		{"bat", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if allowed := domainAllowed(provider, test.email); allowed != test.allowed {
+			t.Errorf("%q: expected %v", test.email, test.allowed)
+		}
+	}
+	if domainAllowed(databases.SSOProvider{}, "bat@acme.mn") {
+		t.Error("empty allowlist allowed email")
+	}
+}
+
+func TestSSOProviderPublicIssuer(t *testing.T) {
+	params := form.SSOProviderParams{ClientID: stubClientID, AllowedDomains: []string{"acme.mn"}}
+	for _, issuer := range []string{"http://8.8.8.8", "https://127.0.0.1", "https://169.254.169.254", "http://localhost:8080", "https://user:pw@8.8.8.8"} {
+		params.Issuer = issuer
+		if err := SSOProviderFromParams(&databases.SSOProvider{}, params); err == nil {
+			t.Errorf("%v: expected issuer to be rejected", issuer)
+		}
+	}
+
+	allowLocalSSO(t)
+	params.Issuer = "http://127.0.0.1:8080"
+	if err := SSOProviderFromParams(&databases.SSOProvider{}, params); err != nil {
+		t.Errorf("expected local issuer allowed by config, got %v", err)
+	}
+}
+
+func TestDiscoverPublicEndpoints(t *testing.T) {
+	endpoints := map[string]string{}
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         endpoints["token"],
+			"jwks_uri":               endpoints["jwks"],
+		})
+	})
+
+	if _, err := discover(server.URL); err == nil {
+		t.Fatal("expected private issuer to be rejected")
+	}
+
+	allowLocalSSO(t)
+	endpoints["token"] = "https://idp.invalid/token"
+	endpoints["jwks"] = server.URL + "/jwks"
+	if _, err := discover(server.URL); err == nil {
+		t.Error("expected unresolvable token endpoint to be rejected")
+	}
+	endpoints["token"] = server.URL + "/token"
+	endpoints["jwks"] = "file:///etc/passwd"
+	if _, err := discover(server.URL); err == nil {
+		t.Error("expected non http jwks uri to be rejected")
+	}
+}
+
+func TestFindSSOProvider(t *testing.T) {
+	db, _, provider := ssoFixture(t)
+	db.Create(&databases.SSOProvider{CompanyID: 2, Issuer: "https://idp.example.com", ClientID: "x", AllowedDomains: "cme.mn,acme.mn.evil.com", IsActive: true})
+
+	found, err := FindSSOProvider(db, form.SSOStartParams{Email: "bat@acme.mn"})
+	if err != nil || found.ID != provider.ID {
+		t.Fatalf("expected provider %v, got %+v %v", provider.ID, found, err)
+	}
+	for _, email := range []string{"bat@me.mn", "bat@acme", "acme.mn"} {
+		if found, err := FindSSOProvider(db, form.SSOStartParams{Email: email}); err == nil {
+			t.Errorf("%q matched provider %v", email, found.ID)
+		}
+	}
+	if _, err := FindSSOProvider(db, form.SSOStartParams{Email: "bat"}); err == nil {
+		t.Error("email without domain matched")
+	}
+}
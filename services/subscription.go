@@ -0,0 +1,331 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/robfig/cron/v3"
+	viper "github.com/spf13/viper"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/notifications"
+	"gitlab.com/fibocloud/aws-billing/api_v2/report"
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+	gorm "gorm.io/gorm"
+)
+
+// FormatPDF report format
+const FormatPDF = "pdf"
+
+// defaultSubscriptionDays days of cost_query when subscription has none
+const defaultSubscriptionDays = 7
+
+var (
+	subscriptionTemplates = []string{databases.TemplateMonthlyReport, databases.TemplateCostQuery}
+	subscriptionChannels  = []string{"email", "webhook"}
+)
+
+// SubscriptionFromParams ...
+func SubscriptionFromParams(subscription *databases.ReportSubscription, params form.ReportSubscriptionParams) error {
+	subscription.Name = params.Name
+	subscription.Template = params.Template
+	subscription.Days = params.Days
+	subscription.Schedule = strings.TrimSpace(params.Schedule)
+	subscription.Timezone = params.Timezone
+	subscription.Format = params.Format
+	subscription.Channel = params.Channel
+	subscription.Recipients = strings.Join(params.Recipients, ",")
+	subscription.WebhookURL = params.WebhookURL
+	subscription.IsActive = params.IsActive
+
+	subscription.Query = ""
+	if params.Query != nil {
+		query, err := json.Marshal(params.Query)
+		if err != nil {
+			return err
+		}
+		subscription.Query = string(query)
+	}
+
+	if subscription.Format == "" {
+		subscription.Format = FormatPDF
+		if subscription.Template == databases.TemplateCostQuery {
+			subscription.Format = FormatCSV
+		}
+	}
+	if subscription.Template == databases.TemplateCostQuery && subscription.Days == 0 {
+		subscription.Days = defaultSubscriptionDays
+	}
+	return nil
+}
+
+// ValidateSubscription ...
+func ValidateSubscription(subscription databases.ReportSubscription) error {
+	if err := oneOf("template", subscription.Template, subscriptionTemplates); err != nil {
+		return err
+	}
+	if _, _, err := subscriptionSchedule(subscription); err != nil {
+		return err
+	}
+
+	if subscription.Template == databases.TemplateMonthlyReport {
+		if err := oneOf("format", subscription.Format, []string{FormatPDF}); err != nil {
+			return err
+		}
+	} else {
+		if err := CheckTableFormat(subscription.Format); err != nil {
+			return err
+		}
+		if subscription.Days < 1 || subscription.Days > 366 {
+			return NewParamError("days", "must be between 1 and 366")
+		}
+		if _, err := subscriptionQuery(subscription, utils.Today()); err != nil {
+			return err
+		}
+	}
+
+	if err := oneOf("channel", subscription.Channel, subscriptionChannels); err != nil {
+		return err
+	}
+	if subscription.Channel == "email" {
+		recipients := splitValues(subscription.Recipients)
+		if len(recipients) == 0 {
+			return NewParamError("recipients", "is required")
+		}
+		for _, recipient := range recipients {
+			if _, err := mail.ParseAddress(recipient); err != nil {
+				return NewParamError("recipients", "invalid email "+recipient)
+			}
+		}
+	}
+	if subscription.Channel == "webhook" {
+		if err := utils.PublicURL(subscription.WebhookURL); err != nil {
+			return NewParamError("webhook_url", err.Error())
+		}
+	}
+	return nil
+}
+
+// subscriptionSchedule cron schedule and timezone, database.timezone by default
+func subscriptionSchedule(subscription databases.ReportSubscription) (cron.Schedule, *time.Location, error) {
+	location := utils.Location()
+	if subscription.Timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(subscription.Timezone); err != nil {
+			return nil, nil, NewParamError("timezone", "unknown timezone "+subscription.Timezone)
+		}
+	}
+	schedule, err := cron.ParseStandard(subscription.Schedule)
+	if err != nil || strings.HasPrefix(subscription.Schedule, "CRON_TZ=") || strings.HasPrefix(subscription.Schedule, "TZ=") {
+		return nil, nil, NewParamError("schedule", "must be 5 field cron expression or @daily, @weekly, @monthly")
+	}
+	return schedule, location, nil
+}
+
+// ScheduleNext sets next run after the time, cleared when inactive
+func ScheduleNext(subscription *databases.ReportSubscription, after time.Time) error {
+	subscription.NextRunDate = nil
+	if !subscription.IsActive {
+		return nil
+	}
+	schedule, location, err := subscriptionSchedule(*subscription)
+	if err != nil {
+		return err
+	}
+	next := schedule.Next(after.In(location))
+	if next.IsZero() {
+		return NewParamError("schedule", "never runs")
+	}
+	subscription.NextRunDate = &next
+	return nil
+}
+
+// subscriptionQuery cost params of cost_query for the days before today
+func subscriptionQuery(subscription databases.ReportSubscription, today time.Time) (form.CostExplorerParams, error) {
+	var params form.CostExplorerParams
+	if subscription.Query != "" {
+		if err := json.Unmarshal([]byte(subscription.Query), &params); err != nil {
+			return params, NewParamError("query", err.Error())
+		}
+	}
+	if params.Granularity == "" {
+		params.Granularity = costexplorer.GranularityDaily
+	}
+	if err := oneOf("query.granularity", params.Granularity, []string{costexplorer.GranularityDaily, costexplorer.GranularityMonthly}); err != nil {
+		return params, err
+	}
+	if len(params.Metric) == 0 {
+		params.Metric = []*string{aws.String("UnblendedCost")}
+	}
+	params.DateRange = ""
+	params.StartDate = today.AddDate(0, 0, -subscription.Days).Format(utils.DateFormat)
+	params.EndDate = today.Format(utils.DateFormat)
+	return params, ResolveCostParams(&params)
+}
+
+// subscriptionToday start of the day in subscription timezone
+func subscriptionToday(subscription databases.ReportSubscription, now time.Time) time.Time {
+	_, location, err := subscriptionSchedule(subscription)
+	if err != nil {
+		location = utils.Location()
+	}
+	now = now.In(location)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+}
+
+// RenderSubscription report file of the subscription as of now, job renders
+// use the job session that is not limited by the Cost Explorer quota
+func RenderSubscription(db *gorm.DB, subscription databases.ReportSubscription, now time.Time, job bool) (*notifications.Attachment, error) {
+	var user databases.SystemUser
+	if result := db.First(&user, subscription.UserID); result.Error != nil {
+		return nil, result.Error
+	}
+	newSession := Session
+	if job {
+		newSession = JobSession
+	}
+	sess, err := newSession(db, subscription.UserID)
+	if err != nil {
+		return nil, err
+	}
+	svc := costexplorer.New(sess)
+	today := subscriptionToday(subscription, now)
+
+	var buf bytes.Buffer
+	attachment := &notifications.Attachment{}
+	switch subscription.Template {
+	case databases.TemplateMonthlyReport:
+		month := today
+		if month.Day() == 1 {
+			month = month.AddDate(0, -1, 0)
+		}
+		params := form.MonthlyReportParams{Month: month.Format(monthFormat)}
+		data, err := MonthlyReport(db, svc, user, params)
+		if err != nil {
+			return nil, err
+		}
+		if err := report.RenderMonthly(&buf, *data); err != nil {
+			return nil, err
+		}
+		attachment.Name = "cost-report-" + params.Month + ".pdf"
+		attachment.ContentType = "application/pdf"
+
+	case databases.TemplateCostQuery:
+		params, err := subscriptionQuery(subscription, today)
+		if err != nil {
+			return nil, err
+		}
+		rates, err := DisplayRates(db, user, params.Currency, params.StartDate, params.EndDate)
+		if err != nil {
+			return nil, err
+		}
+		export, err := NewCostExport(svc, CostAndUsageInput(params), rates)
+		if err != nil {
+			return nil, err
+		}
+		table, err := NewTableWriter(&buf, subscription.Format, "Cost")
+		if err != nil {
+			return nil, err
+		}
+		if err := export.Write(table); err != nil {
+			return nil, err
+		}
+		contentType, extension := TableContentType(subscription.Format)
+		attachment.Name = "cost-" + params.StartDate + "-" + params.EndDate + "." + extension
+		attachment.ContentType = contentType
+
+	default:
+		return nil, oneOf("template", subscription.Template, subscriptionTemplates)
+	}
+
+	attachment.Data = buf.Bytes()
+	return attachment, nil
+}
+
+// retryDelay delay before the next attempt, doubles after each failure
+func retryDelay(attempts int) time.Duration {
+	delay := 15 * time.Minute
+	if viper.IsSet("subscription.retry_delay") {
+		delay = viper.GetDuration("subscription.retry_delay")
+	}
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+	}
+	return delay
+}
+
+// maxAttempts attempts of one delivery, subscription.max_attempts
+func maxAttempts() int {
+	if attempts := viper.GetInt("subscription.max_attempts"); attempts > 0 {
+		return attempts
+	}
+	return 3
+}
+
+// DeliverSubscription renders and sends one attempt of the delivery. Failed
+// delivery is retried later until max attempts. job is set for scheduled runs
+// and retries.
+func DeliverSubscription(db *gorm.DB, subscription databases.ReportSubscription, delivery *databases.ReportDelivery, job bool) error {
+	now := time.Now()
+	delivery.Attempts++
+	delivery.NextRetryDate = nil
+	delivery.ModifiedDate = now
+
+	attachment, err := RenderSubscription(db, subscription, now, job)
+	if err == nil {
+		delivery.FileName = attachment.Name
+		delivery.Size = len(attachment.Data)
+		err = notifications.Send([]string{subscription.Channel}, notifications.Notification{
+			Event:       "report.subscription",
+			CompanyID:   subscription.CompanyID,
+			UserID:      subscription.UserID,
+			Subject:     subscription.Name,
+			Message:     fmt.Sprintf("Report %q scheduled at %v is attached.", subscription.Name, delivery.ScheduledDate.Format("2006-01-02 15:04 MST")),
+			Data:        delivery,
+			WebhookURL:  subscription.WebhookURL,
+			Recipients:  splitValues(subscription.Recipients),
+			Attachments: []notifications.Attachment{*attachment},
+		})
+	}
+
+	if err != nil {
+		delivery.Status = databases.DeliveryFailed
+		delivery.Error = err.Error()
+		if delivery.Attempts < maxAttempts() {
+			retry := now.Add(retryDelay(delivery.Attempts))
+			delivery.NextRetryDate = &retry
+		}
+	} else {
+		delivery.Status = databases.DeliverySuccess
+		delivery.Error = ""
+		delivery.DeliveredDate = &now
+	}
+
+	if result := db.Save(delivery); result.Error != nil {
+		return result.Error
+	}
+	db.Model(&subscription).Updates(map[string]interface{}{"last_run_date": now, "last_status": delivery.Status})
+	return err
+}
+
+// RunSubscription creates delivery of the scheduled time and sends it, runs
+// requested by users are not job runs
+func RunSubscription(db *gorm.DB, subscription databases.ReportSubscription, scheduled time.Time, job bool) (*databases.ReportDelivery, error) {
+	now := time.Now()
+	delivery := &databases.ReportDelivery{
+		Base:           databases.Base{CreatedDate: now, ModifiedDate: now},
+		SubscriptionID: subscription.ID,
+		ScheduledDate:  scheduled,
+		Status:         databases.DeliveryPending,
+	}
+	if result := db.Create(delivery); result.Error != nil {
+		return nil, result.Error
+	}
+	return delivery, DeliverSubscription(db, subscription, delivery, job)
+}
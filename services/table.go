@@ -0,0 +1,156 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Table export format
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// TableFormats supported export formats
+var TableFormats = []string{FormatJSON, FormatCSV, FormatXLSX}
+
+// TableWriter writes rows one by one without keeping them in memory, the
+// first row is the header. Values are string or float64.
+type TableWriter interface {
+	WriteRow(values []interface{}) error
+	Flush() error // sends written rows to the client
+	Close() error // completes the document
+}
+
+// CheckTableFormat format is one of TableFormats
+func CheckTableFormat(format string) error {
+	return oneOf("format", format, TableFormats)
+}
+
+// TableContentType content type and file extension of the format
+func TableContentType(format string) (string, string) {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8", "csv"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx"
+	}
+	return "application/json; charset=utf-8", "json"
+}
+
+// NewTableWriter writer of the format, sheet is used as XLSX sheet name
+func NewTableWriter(w io.Writer, format, sheet string) (TableWriter, error) {
+	switch format {
+	case FormatCSV:
+		return &csvTableWriter{out: w, writer: csv.NewWriter(w)}, nil
+	case FormatXLSX:
+		return newXlsxTableWriter(w, sheet)
+	case FormatJSON:
+		return &jsonTableWriter{out: w, writer: bufio.NewWriter(w)}, nil
+	}
+	return nil, oneOf("format", format, TableFormats)
+}
+
+// flushHTTP flushes response writer when it supports it
+func flushHTTP(w io.Writer) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// formatValue text of table value
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	}
+	return ""
+}
+
+type csvTableWriter struct {
+	out    io.Writer
+	writer *csv.Writer
+}
+
+func (t *csvTableWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = formatValue(value)
+	}
+	return t.writer.Write(record)
+}
+
+func (t *csvTableWriter) Flush() error {
+	t.writer.Flush()
+	flushHTTP(t.out)
+	return t.writer.Error()
+}
+
+func (t *csvTableWriter) Close() error {
+	return t.Flush()
+}
+
+// jsonTableWriter array of objects keyed by header
+type jsonTableWriter struct {
+	out    io.Writer
+	writer *bufio.Writer
+	header []string
+	rows   int
+}
+
+func (t *jsonTableWriter) WriteRow(values []interface{}) error {
+	if t.header == nil {
+		t.header = make([]string, len(values))
+		for i, value := range values {
+			t.header[i] = formatValue(value)
+		}
+		_, err := t.writer.WriteString("[")
+		return err
+	}
+
+	row := make(map[string]interface{}, len(values))
+	for i, value := range values {
+		if i < len(t.header) {
+			row[t.header[i]] = value
+		}
+	}
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	if t.rows > 0 {
+		if err := t.writer.WriteByte(','); err != nil {
+			return err
+		}
+	}
+	t.rows++
+	_, err = t.writer.Write(data)
+	return err
+}
+
+func (t *jsonTableWriter) Flush() error {
+	if err := t.writer.Flush(); err != nil {
+		return err
+	}
+	flushHTTP(t.out)
+	return nil
+}
+
+func (t *jsonTableWriter) Close() error {
+	if t.header == nil {
+		t.writer.WriteString("[")
+	}
+	if _, err := t.writer.WriteString("]"); err != nil {
+		return err
+	}
+	return t.Flush()
+}
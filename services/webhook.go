@@ -0,0 +1,343 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	viper "github.com/spf13/viper"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+	"gitlab.com/fibocloud/aws-billing/api_v2/notifications"
+	"gitlab.com/fibocloud/aws-billing/api_v2/utils"
+	gorm "gorm.io/gorm"
+)
+
+// Notification events delivered to company webhooks
+const (
+	EventBudgetThreshold  = "budget.threshold"
+	EventAnomalyDetected  = "anomaly.detected"
+	EventSyncFailed       = "sync.failed"
+	EventCredentialFailed = "credential.failed"
+	EventWebhookTest      = "webhook.test"
+)
+
+// WebhookEvents events webhooks subscribe to, "*" subscribes to all
+var WebhookEvents = []string{EventBudgetThreshold, EventAnomalyDetected, EventSyncFailed, EventCredentialFailed, "*"}
+
+// webhookFormats payload formats
+var webhookFormats = []string{databases.WebhookJSON, databases.WebhookSlack, databases.WebhookTeams}
+
+// webhookClient timeout of one delivery attempt, dials public addresses only
+// and does not follow redirects
+var webhookClient = utils.PublicClient(10 * time.Second)
+
+// webhookPayload JSON payload of json format
+type webhookPayload struct {
+	ID        uint        `json:"id"` // delivery ID, same on retries
+	Event     string      `json:"event"`
+	CompanyID uint        `json:"company_id"`
+	UserID    uint        `json:"user_id"`
+	Subject   string      `json:"subject"`
+	Message   string      `json:"message"`
+	Data      interface{} `json:"data"`
+	Date      time.Time   `json:"date"`
+}
+
+// NewWebhookSecret random signing secret
+func NewWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// WebhookFromParams ...
+func WebhookFromParams(webhook *databases.Webhook, params form.WebhookParams) error {
+	if params.Format == "" {
+		params.Format = databases.WebhookJSON
+	}
+	if err := oneOf("format", params.Format, webhookFormats); err != nil {
+		return err
+	}
+	if err := utils.PublicURL(params.URL); err != nil {
+		return NewParamError("url", err.Error())
+	}
+	if len(params.Events) == 0 {
+		return NewParamError("events", "is required")
+	}
+	for _, event := range params.Events {
+		if err := oneOf("events", event, WebhookEvents); err != nil {
+			return err
+		}
+	}
+
+	webhook.Name = params.Name
+	webhook.URL = params.URL
+	webhook.Events = strings.Join(params.Events, ",")
+	webhook.Format = params.Format
+	webhook.IsActive = params.IsActive
+	return nil
+}
+
+// subscribed webhook receives the event, "*" matches webhook events only so
+// report subscriptions are not posted to webhooks
+func subscribed(webhook databases.Webhook, event string) bool {
+	if event == "*" || oneOf("event", event, WebhookEvents) != nil {
+		return false
+	}
+	for _, item := range splitValues(webhook.Events) {
+		if item == "*" || item == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookSignature hex HMAC-SHA256 of "timestamp.body", receivers recompute
+// it with their secret and compare to X-Webhook-Signature
+func WebhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// FormatWebhook payload of the format, Slack and Teams incoming webhooks get
+// a chat message instead of the event JSON
+func FormatWebhook(format string, id uint, notification notifications.Notification) ([]byte, error) {
+	text := notification.Message
+	if notification.Subject != "" {
+		text = notification.Subject + "\n" + notification.Message
+	}
+
+	switch format {
+	case databases.WebhookSlack:
+		return json.Marshal(map[string]interface{}{
+			"text": text,
+			"blocks": []map[string]interface{}{
+				{"type": "header", "text": map[string]string{"type": "plain_text", "text": notification.Subject}},
+				{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": notification.Message}},
+				{"type": "context", "elements": []map[string]string{{"type": "mrkdwn", "text": "`" + notification.Event + "`"}}},
+			},
+		})
+	case databases.WebhookTeams:
+		return json.Marshal(map[string]interface{}{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    notification.Subject,
+			"themeColor": "0076D7",
+			"title":      notification.Subject,
+			"text":       notification.Message,
+			"sections": []map[string]interface{}{
+				{"facts": []map[string]string{{"name": "Event", "value": notification.Event}}},
+			},
+		})
+	}
+	return json.Marshal(webhookPayload{
+		ID:        id,
+		Event:     notification.Event,
+		CompanyID: notification.CompanyID,
+		UserID:    notification.UserID,
+		Subject:   notification.Subject,
+		Message:   notification.Message,
+		Data:      notification.Data,
+		Date:      notification.Date,
+	})
+}
+
+// QueueWebhook stores delivery of the notification, payload is kept so
+// retries send the same body
+func QueueWebhook(db *gorm.DB, webhook databases.Webhook, notification notifications.Notification, test bool) (*databases.WebhookDelivery, error) {
+	now := time.Now()
+	delivery := &databases.WebhookDelivery{
+		Base:      databases.Base{CreatedDate: now, ModifiedDate: now},
+		WebhookID: webhook.ID,
+		Event:     notification.Event,
+		Status:    databases.DeliveryPending,
+		IsTest:    test,
+	}
+	if result := db.Create(delivery); result.Error != nil {
+		return nil, result.Error
+	}
+
+	payload, err := FormatWebhook(webhook.Format, delivery.ID, notification)
+	if err != nil {
+		return nil, err
+	}
+	delivery.Payload = string(payload)
+	if result := db.Model(delivery).Update("payload", delivery.Payload); result.Error != nil {
+		return nil, result.Error
+	}
+	return delivery, nil
+}
+
+// webhookRetryDelay exponential backoff, webhook.retry_delay doubled after each failure
+func webhookRetryDelay(attempts int) time.Duration {
+	delay := time.Minute
+	if viper.IsSet("webhook.retry_delay") {
+		delay = viper.GetDuration("webhook.retry_delay")
+	}
+	return delay * time.Duration(1<<uint(attempts-1))
+}
+
+// webhookMaxAttempts attempts of one delivery, webhook.max_attempts
+func webhookMaxAttempts() int {
+	if attempts := viper.GetInt("webhook.max_attempts"); attempts > 0 {
+		return attempts
+	}
+	return 5
+}
+
+// DeliverWebhook one signed attempt of the delivery, 2xx response is success
+// and redirects are failures
+func DeliverWebhook(db *gorm.DB, webhook databases.Webhook, delivery *databases.WebhookDelivery) error {
+	now := time.Now()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	body := []byte(delivery.Payload)
+
+	delivery.Attempts++
+	delivery.ModifiedDate = now
+	delivery.NextRetryDate = nil
+	delivery.ResponseCode = 0
+
+	err := func() error {
+		// webhooks saved before https was required are checked again
+		if err := utils.PublicURL(webhook.URL); err != nil {
+			return err
+		}
+		req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "aws-billing-webhook")
+		req.Header.Set("X-Webhook-Event", delivery.Event)
+		req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+		req.Header.Set("X-Webhook-Timestamp", timestamp)
+		req.Header.Set("X-Webhook-Signature", WebhookSignature(webhook.Secret, timestamp, body))
+
+		res, err := webhookClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		// response body is not stored so webhooks can not read internal services
+		io.Copy(ioutil.Discard, io.LimitReader(res.Body, 4096))
+		delivery.ResponseCode = res.StatusCode
+		if res.StatusCode < 200 || res.StatusCode >= 300 {
+			return fmt.Errorf("webhook responded %v", res.Status)
+		}
+		return nil
+	}()
+
+	if err != nil {
+		delivery.Status = databases.DeliveryFailed
+		delivery.Error = err.Error()
+		if !delivery.IsTest && delivery.Attempts < webhookMaxAttempts() {
+			retry := now.Add(webhookRetryDelay(delivery.Attempts))
+			delivery.NextRetryDate = &retry
+		}
+	} else {
+		delivery.Status = databases.DeliverySuccess
+		delivery.Error = ""
+		delivery.DeliveredDate = &now
+	}
+
+	if result := db.Save(delivery); result.Error != nil {
+		return result.Error
+	}
+	return err
+}
+
+// ListenWebhooks queues every notification for the active webhooks of its
+// company subscribed to the event, first attempt is made in background
+func ListenWebhooks(db *gorm.DB) {
+	notifications.Listen(func(notification notifications.Notification) {
+		if notification.Event == EventWebhookTest {
+			return
+		}
+
+		query := db.Where("is_active = ?", true)
+		if notification.CompanyID != 0 {
+			query = query.Where("company_id = ?", notification.CompanyID)
+		} else {
+			query = query.Where("company_id = 0 AND user_id = ?", notification.UserID)
+		}
+		var webhooks []databases.Webhook
+		if result := query.Find(&webhooks); result.Error != nil {
+			log.Printf("[webhook] %v: %v", notification.Event, result.Error)
+			return
+		}
+
+		// attachments are for email, webhook receivers get the event only
+		notification.Attachments = nil
+		for _, webhook := range webhooks {
+			if !subscribed(webhook, notification.Event) {
+				continue
+			}
+			delivery, err := QueueWebhook(db, webhook, notification, false)
+			if err != nil {
+				log.Printf("[webhook] %v %v: %v", webhook.ID, notification.Event, err)
+				continue
+			}
+			go func(webhook databases.Webhook) {
+				if err := DeliverWebhook(db, webhook, delivery); err != nil {
+					log.Printf("[webhook] %v delivery %v: %v", webhook.ID, delivery.ID, err)
+				}
+			}(webhook)
+		}
+	})
+}
+
+// credentialErrorCodes AWS error codes of invalid or expired credentials
+var credentialErrorCodes = []string{
+	"UnrecognizedClientException", "InvalidClientTokenId", "SignatureDoesNotMatch",
+	"AccessDenied", "AccessDeniedException", "ExpiredToken", "ExpiredTokenException",
+}
+
+// IsCredentialError missing, invalid or expired AWS credentials
+func IsCredentialError(err error) bool {
+	if err == ErrNoCredentials {
+		return true
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		for _, code := range credentialErrorCodes {
+			if aerr.Code() == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// JobFailed notifies webhooks of failed background job, credential.failed
+// when AWS refused the credentials and sync.failed otherwise
+func JobFailed(companyID, userID uint, job string, err error) {
+	event, subject := EventSyncFailed, fmt.Sprintf("%v failed", job)
+	if IsCredentialError(err) {
+		event, subject = EventCredentialFailed, fmt.Sprintf("%v failed: AWS credentials were refused", job)
+	}
+	notifications.Send(nil, notifications.Notification{
+		Event:     event,
+		CompanyID: companyID,
+		UserID:    userID,
+		Subject:   subject,
+		Message:   err.Error(),
+		Data:      map[string]string{"job": job, "error": err.Error()},
+	})
+}
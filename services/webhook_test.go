@@ -0,0 +1,70 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	viper "github.com/spf13/viper"
+	"gitlab.com/fibocloud/aws-billing/api_v2/databases"
+	"gitlab.com/fibocloud/aws-billing/api_v2/form"
+)
+
+func TestWebhookFromParamsURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://8.8.8.8/hook", true},
+		{"http://8.8.8.8/hook", false},
+		{"https://127.0.0.1:8080/hook", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+		{"https://192.168.1.10/hook", false},
+		{"https://localhost/hook", false},
+	}
+	for _, test := range tests {
+		var webhook databases.Webhook
+		err := WebhookFromParams(&webhook, form.WebhookParams{URL: test.url, Events: []string{"*"}})
+		if (err == nil) != test.valid {
+			t.Errorf("%q: expected valid %v, got %v", test.url, test.valid, err)
+		}
+	}
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	db := testDB(t, &databases.Webhook{}, &databases.WebhookDelivery{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/ok", http.StatusFound)
+			return
+		}
+		w.Write([]byte("internal secret"))
+	}))
+	defer server.Close()
+
+	deliver := func(url string) (*databases.WebhookDelivery, error) {
+		delivery := &databases.WebhookDelivery{Payload: "{}", Status: databases.DeliveryPending, IsTest: true}
+		db.Create(delivery)
+		return delivery, DeliverWebhook(db, databases.Webhook{URL: url, Secret: "secret"}, delivery)
+	}
+
+	// loopback test server is refused
+	delivery, err := deliver(server.URL + "/ok")
+	if err == nil || delivery.Status != databases.DeliveryFailed || delivery.ResponseCode != 0 {
+		t.Fatalf("loopback was delivered: %+v", delivery)
+	}
+
+	viper.Set("webhook.allow_http", true)
+	viper.Set("webhook.allow_private", true)
+	defer viper.Set("webhook.allow_http", false)
+	defer viper.Set("webhook.allow_private", false)
+
+	delivery, err = deliver(server.URL + "/ok")
+	if err != nil || delivery.Status != databases.DeliverySuccess {
+		t.Fatalf("expected success, got %v %+v", err, delivery)
+	}
+	delivery, err = deliver(server.URL + "/redirect")
+	if err == nil || delivery.ResponseCode != http.StatusFound {
+		t.Fatalf("redirect was followed: %+v", delivery)
+	}
+}
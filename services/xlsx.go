@@ -0,0 +1,127 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+
+const xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+// xlsxTableWriter single sheet workbook, the sheet is the last zip entry so
+// rows are streamed into it with inline strings, no shared string table
+type xlsxTableWriter struct {
+	out   io.Writer
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+}
+
+func newXlsxTableWriter(w io.Writer, name string) (*xlsxTableWriter, error) {
+	if name == "" {
+		name = "Sheet1"
+	}
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31]) // Excel sheet name limit
+	}
+
+	archive := zip.NewWriter(w)
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(name))
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, escaped.String())},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, part := range parts {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(file, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	sheet := bufio.NewWriter(file)
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return &xlsxTableWriter{out: w, zip: archive, sheet: sheet}, nil
+}
+
+// xlsxColumn column letters of zero based index, 0 => A, 26 => AA
+func xlsxColumn(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+func (t *xlsxTableWriter) WriteRow(values []interface{}) error {
+	t.rows++
+	row := strconv.Itoa(t.rows)
+	t.sheet.WriteString(`<row r="` + row + `">`)
+	for i, value := range values {
+		ref := xlsxColumn(i) + row
+		switch v := value.(type) {
+		case float64:
+			t.sheet.WriteString(`<c r="` + ref + `"><v>` + strconv.FormatFloat(v, 'f', -1, 64) + `</v></c>`)
+		case int:
+			t.sheet.WriteString(`<c r="` + ref + `"><v>` + strconv.Itoa(v) + `</v></c>`)
+		default:
+			t.sheet.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+			if err := xml.EscapeText(t.sheet, []byte(formatValue(value))); err != nil {
+				return err
+			}
+			t.sheet.WriteString(`</t></is></c>`)
+		}
+	}
+	_, err := t.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (t *xlsxTableWriter) Flush() error {
+	if err := t.sheet.Flush(); err != nil {
+		return err
+	}
+	if err := t.zip.Flush(); err != nil {
+		return err
+	}
+	flushHTTP(t.out)
+	return nil
+}
+
+func (t *xlsxTableWriter) Close() error {
+	if _, err := t.sheet.WriteString(`</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	if err := t.sheet.Flush(); err != nil {
+		return err
+	}
+	if err := t.zip.Close(); err != nil {
+		return err
+	}
+	flushHTTP(t.out)
+	return nil
+}
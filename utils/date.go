@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"time"
+
+	viper "github.com/spf13/viper"
+)
+
+// DateFormat Cost Explorer date format
+const DateFormat = "2006-01-02"
+
+// Location configured timezone (database.timezone), UTC when missing
+func Location() *time.Location {
+	if name := viper.GetString("database.timezone"); name != "" {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// Today start of current day in configured timezone
+func Today() time.Time {
+	now := time.Now().In(Location())
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
+
+// ParseDate parse yyyy-mm-dd in configured timezone
+func ParseDate(value string) (time.Time, error) {
+	return time.ParseInLocation(DateFormat, value, Location())
+}
+
+// MonthStart first day of month
+func MonthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
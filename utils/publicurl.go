@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	viper "github.com/spf13/viper"
+)
+
+// ErrPrivateAddress outgoing request to internal network
+var ErrPrivateAddress = errors.New("private, loopback and link-local addresses are not allowed")
+
+// privateNetworks not reachable from outgoing webhooks, cloud metadata
+// 169.254.169.254 is link-local
+var privateNetworks = parseNetworks(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+	"172.16.0.0/12", "192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15", "224.0.0.0/4", "240.0.0.0/4",
+	"::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// PublicIP address is reachable on internet, webhook.allow_private allows all
+// for local development
+func PublicIP(ip net.IP) bool {
+	return publicIP("webhook", ip)
+}
+
+// publicIP address is reachable on internet, <section>.allow_private allows all
+func publicIP(section string, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if viper.GetBool(section + ".allow_private") {
+		return true
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// PublicURL outgoing webhook url, https unless webhook.allow_http and host
+// resolving to public addresses. Addresses are checked again when dialing.
+func PublicURL(raw string) error {
+	return PublicURLOf("webhook", raw)
+}
+
+// PublicURLOf PublicURL with allow_http and allow_private of the config
+// section, webhook or sso
+func PublicURLOf(section, raw string) error {
+	target, err := url.Parse(raw)
+	if err != nil || target.Hostname() == "" {
+		return errors.New("must be https url")
+	}
+	if target.Scheme != "https" && !(target.Scheme == "http" && viper.GetBool(section+".allow_http")) {
+		return errors.New("must be https url")
+	}
+	if target.User != nil {
+		return errors.New("must not contain credentials")
+	}
+
+	ips, err := net.LookupIP(target.Hostname())
+	if err != nil {
+		return errors.New("host can not be resolved")
+	}
+	for _, ip := range ips {
+		if !publicIP(section, ip) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// PublicClient http client of outgoing webhooks, connects to public addresses
+// only so DNS changes after PublicURL can not reach internal network, and
+// does not follow redirects
+func PublicClient(timeout time.Duration) *http.Client {
+	return PublicClientOf("webhook", timeout)
+}
+
+// PublicClientOf PublicClient with allow_private of the config section
+func PublicClientOf(section string, timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicIP(section, net.ParseIP(host)) {
+				return ErrPrivateAddress
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// no proxy, the dialed address is the target
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, address)
+			},
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}